@@ -16,15 +16,21 @@ limitations under the License. */
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-
-	"github.com/elodina/statsd-mesos-kafka/statsd"
 	"strconv"
+
+	"github.com/elodina/statsd-mesos-kafka/statsd/client"
 )
 
+// apiUrl is the scheduler API commands talk to, set by resolveApi.
+var apiUrl string
+
 func main() {
 	if err := exec(); err != nil {
 		fmt.Printf("Error: %s\n", err)
@@ -54,6 +60,50 @@ func exec() error {
 		return handleUpdate()
 	case "status":
 		return handleStatus()
+	case "validate":
+		return handleValidate()
+	case "bundle":
+		return handleBundle()
+	case "gc":
+		return handleGc()
+	case "timeline":
+		return handleTimeline()
+	case "events":
+		return handleEvents()
+	case "recommendations":
+		return handleRecommendations()
+	case "migrate":
+		return handleMigrate()
+	case "rotate":
+		return handleRotate()
+	case "drain-kafka":
+		return handleDrainKafka()
+	case "remove":
+		return handleRemove()
+	case "scale":
+		return handleScale()
+	case "replay":
+		return handleReplay()
+	case "simulate":
+		return handleSimulate()
+	case "hosts":
+		return handleHosts()
+	case "tap":
+		return handleTap()
+	case "maintenance":
+		return handleMaintenance()
+	case "agents":
+		return handleAgents()
+	case "info":
+		return handleInfo()
+	case "rollout":
+		return handleRollout()
+	case "pipeline":
+		return handlePipeline()
+	case "executor":
+		return handleExecutor()
+	case "teardown":
+		return handleTeardown()
 	}
 
 	return fmt.Errorf("Unknown command: %s\n", command)
@@ -67,55 +117,468 @@ func handleHelp() error {
   stop: stop framework
   update: update configuration
   status: get current status of cluster
+  validate: check configuration for errors and risky settings
+  timeline: show history of cluster events
+  events: stream cluster events as they happen
+  recommendations: suggest sizing based on observed load
+  info: show scheduler version, framework, master and capabilities
+  agents: list agents and attribute values seen in offers
+  hosts: whitelist or blacklist hosts servers may run on
+  tap: stream a sample of the metrics a server receives
+  maintenance: annotate a host in maintenance until a time, suppressing relaunches and failure handling there
+  migrate: move a server from one host to another
+  remove: kill the server on one host, optionally blacklisting the host
+  rotate: switch producer properties and reload them on all servers
+  drain-kafka: buffer records on disk instead of producing during broker maintenance
+  scale: set the number of servers running across the cluster
+  rollout: show progress of restarting servers after a config update or cancel it
+  executor: upload an executor binary servers can be launched with, or list uploaded ones
+  pipeline: describe what servers do with metrics and what lands on each topic
+  gc: show orphaned frameworks and tasks, optionally kill them
+  teardown: kill all tasks, optionally unregistering the framework
+  replay: send metrics produced in a time range to statsd again
+  simulate: replay recorded offers and status updates through the scheduler and show what it would do
+  bundle: package scheduler, executors and configs into a versioned tarball
 More help you can get from ./cli <command> -h`)
 	return nil
 }
 
 func handleStatus() error {
 	var api string
+	var rollup string
+	var groupBy string
 	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.StringVar(&rollup, "rollup", "", "Show totals per group instead of each server. group|zone|state")
+	flag.StringVar(&groupBy, "group.by", "", "Agent attribute servers are grouped by for rollup=group, e.g. rack.")
 
 	flag.Parse()
 	if err := resolveApi(api); err != nil {
 		return err
 	}
-	response := statsd.NewApiRequest(statsd.Config.Api + "/api/status").Get()
-	fmt.Println(response.Message)
-	return nil
+	request := client.NewApiRequest(apiUrl + "/api/status")
+	request.AddParam("rollup", rollup)
+	request.AddParam("group.by", groupBy)
+	return printResponse(request.Get())
+}
+
+func handleValidate() error {
+	var api string
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+	return printResponse(client.NewApiRequest(apiUrl + "/api/validate").Get())
+}
+
+func handleRecommendations() error {
+	var api string
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+	return printResponse(client.NewApiRequest(apiUrl + "/api/recommendations").Get())
+}
+
+func handleAgents() error {
+	var api string
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+	return printResponse(client.NewApiRequest(apiUrl + "/api/agents").Get())
+}
+
+func handleInfo() error {
+	var api string
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+	return printResponse(client.NewApiRequest(apiUrl + "/api/v1/info").Get())
+}
+
+func handlePipeline() error {
+	var api string
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+	return printResponse(client.NewApiRequest(apiUrl + "/api/pipeline").Get())
+}
+
+func handleExecutor() error {
+	var api string
+	var file string
+	var version string
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.StringVar(&file, "file", "", "Executor binary to upload. Lists uploaded executors if not set.")
+	flag.StringVar(&version, "version", "", "Version to upload the executor as. Defaults to the start of its SHA-256.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+
+	request := client.NewApiRequest(apiUrl + "/api/executor")
+	if file == "" {
+		return printResponse(request.Get())
+	}
+
+	executor, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer executor.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, executor); err != nil {
+		return err
+	}
+	if _, err := executor.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	request.AddParam("version", version)
+	request.AddParam("sha256", hex.EncodeToString(hash.Sum(nil)))
+	return printResponse(request.Post("application/octet-stream", executor))
+}
+
+func handleRollout() error {
+	var api string
+	var cancel bool
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.BoolVar(&cancel, "cancel", false, "Stop the rollout in progress, servers not restarted yet keep running as they are.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+	path := "/api/rollout/status"
+	if cancel {
+		path = "/api/rollout/cancel"
+	}
+	return printResponse(client.NewApiRequest(apiUrl + path).Get())
+}
+
+func handleMigrate() error {
+	var api string
+	var from string
+	var to string
+	var timeout string
+	var dryRun bool
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.StringVar(&from, "from", "", "Host to move the server from.")
+	flag.StringVar(&to, "to", "", "Host to move the server to.")
+	flag.StringVar(&timeout, "timeout", "", "How long to wait for the new server to become healthy. Defaults to 5m.")
+	flag.BoolVar(&dryRun, "dry.run", false, "Only show what would change without applying it.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+
+	request := client.NewApiRequest(apiUrl + "/api/migrate")
+	request.AddParam("from", from)
+	request.AddParam("to", to)
+	request.AddParam("timeout", timeout)
+	if dryRun {
+		request.AddParam("dryRun", "true")
+	}
+	return printResponse(request.Get())
+}
+
+func handleRemove() error {
+	var api string
+	var host string
+	var blacklist bool
+	var timeout string
+	var dryRun bool
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.StringVar(&host, "host", "", "Host to remove the server from.")
+	flag.BoolVar(&blacklist, "blacklist", false, "Don't launch servers on the host again.")
+	flag.StringVar(&timeout, "timeout", "", "How long to wait for the server to stop. Defaults to 1m.")
+	flag.BoolVar(&dryRun, "dry.run", false, "Only show what would change without applying it.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+
+	request := client.NewApiRequest(apiUrl + "/api/remove")
+	request.AddParam("host", host)
+	request.AddParam("blacklist", strconv.FormatBool(blacklist))
+	request.AddParam("timeout", timeout)
+	if dryRun {
+		request.AddParam("dryRun", "true")
+	}
+	return printResponse(request.Get())
+}
+
+func handleRotate() error {
+	var api string
+	var producerProperties string
+	var timeout string
+	var dryRun bool
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.StringVar(&producerProperties, "producer.properties", "", "Producer.properties file with new credentials, relative to the scheduler working dir.")
+	flag.StringVar(&timeout, "timeout", "", "How long to wait for servers to reload producer properties. Defaults to 5m.")
+	flag.BoolVar(&dryRun, "dry.run", false, "Only show what would change without applying it.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+
+	request := client.NewApiRequest(apiUrl + "/api/rotate")
+	request.AddParam("producer.properties", producerProperties)
+	request.AddParam("timeout", timeout)
+	if dryRun {
+		request.AddParam("dryRun", "true")
+	}
+	return printResponse(request.Get())
+}
+
+func handleDrainKafka() error {
+	var api string
+	var window string
+	var resume bool
+	var status bool
+	var dryRun bool
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.StringVar(&window, "window", "", "How long servers buffer records on disk before they resume producing, e.g. 30m. At most 24h.")
+	flag.BoolVar(&resume, "resume", false, "End the current drain early and replay buffered records.")
+	flag.BoolVar(&status, "status", false, "Show per-host progress of the current drain.")
+	flag.BoolVar(&dryRun, "dry.run", false, "Only show what would change without applying it.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+
+	if status {
+		return printResponse(client.NewApiRequest(apiUrl + "/api/drain-kafka/status").Get())
+	}
+	if window == "" && !resume {
+		return errors.New("--window or --resume is required")
+	}
+
+	request := client.NewApiRequest(apiUrl + "/api/drain-kafka")
+	if resume {
+		request.AddParam("resume", "true")
+	} else {
+		request.AddParam("window", window)
+	}
+	if dryRun {
+		request.AddParam("dryRun", "true")
+	}
+	return printResponse(request.Get())
 }
 
-func handleScheduler() error {
+func handleHosts() error {
 	var api string
-	var logLevel string
+	var list string
+	var add string
+	var remove string
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.StringVar(&list, "list", "", "List to change. whitelist|blacklist")
+	flag.StringVar(&add, "add", "", "Hosts to add to the list separated by comma.")
+	flag.StringVar(&remove, "remove", "", "Hosts to remove from the list separated by comma.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+	if (add != "" || remove != "") && list == "" {
+		return errors.New("--list is required")
+	}
+
+	request := client.NewApiRequest(apiUrl + "/api/hosts")
+	request.AddParam("list", list)
+	request.AddParam("add", add)
+	request.AddParam("remove", remove)
+	return printResponse(request.Get())
+}
 
-	flag.StringVar(&statsd.Config.Master, "master", "", "Mesos Master addresses.")
-	flag.StringVar(&api, "api", "", "API host:port for advertizing.")
-	flag.StringVar(&statsd.Config.User, "user", "", "Mesos user. Defaults to current system user")
-	flag.StringVar(&logLevel, "log.level", statsd.Config.LogLevel, "Log level. trace|debug|info|warn|error|critical. Defaults to info.")
-	flag.StringVar(&statsd.Config.FrameworkName, "framework.name", statsd.Config.FrameworkName, "Framework name.")
-	flag.StringVar(&statsd.Config.FrameworkRole, "framework.role", statsd.Config.FrameworkRole, "Framework role.")
-	flag.StringVar(&statsd.Config.Namespace, "namespace", statsd.Config.Namespace, "Namespace.")
+func handleTap() error {
+	var api string
+	var host string
+	var match string
+	var rate int
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.StringVar(&host, "host", "", "Host of the server to tap.")
+	flag.StringVar(&match, "match", "", "Regular expression metric names have to match.")
+	flag.IntVar(&rate, "rate", 10, "Maximum number of metrics per second.")
 
 	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+	if host == "" {
+		return errors.New("--host is required")
+	}
+
+	request := client.NewApiRequest(apiUrl + "/api/tap")
+	request.AddParam("host", host)
+	request.AddParam("match", match)
+	request.AddParam("rate", strconv.Itoa(rate))
+	return request.Stream(func(line string) {
+		fmt.Println(line)
+	})
+}
+
+func handleMaintenance() error {
+	var api string
+	var host string
+	var until string
+	var reason string
+	var end bool
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.StringVar(&host, "host", "", "Host to annotate. Lists annotated hosts if not set.")
+	flag.StringVar(&until, "until", "", "When maintenance ends: a duration from now, e.g. 2h, RFC3339 time or unix seconds.")
+	flag.StringVar(&reason, "reason", "", "Why the host is in maintenance, shown in status and timeline.")
+	flag.BoolVar(&end, "end", false, "End maintenance of the host now.")
 
+	flag.Parse()
 	if err := resolveApi(api); err != nil {
 		return err
 	}
 
-	if err := statsd.InitLogging(logLevel); err != nil {
+	request := client.NewApiRequest(apiUrl + "/api/maintenance")
+	request.AddParam("host", host)
+	if host != "" && !end && until == "" {
+		return errors.New("--until or --end is required")
+	}
+	if end {
+		request.AddParam("end", "true")
+	} else {
+		request.AddParam("until", until)
+		request.AddParam("reason", reason)
+	}
+	return printResponse(request.Get())
+}
+
+func handleScale() error {
+	var api string
+	var instances int
+	var dryRun bool
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.IntVar(&instances, "instances", -1, "Number of servers to run. 0 runs one on every matching host.")
+	flag.BoolVar(&dryRun, "dry.run", false, "Only show what would change without applying it.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
 		return err
 	}
+	if instances < 0 {
+		return errors.New("--instances is required")
+	}
 
-	if statsd.Config.Master == "" {
-		return errors.New("--master flag is required.")
+	request := client.NewApiRequest(apiUrl + "/api/scale")
+	request.AddParam("instances", strconv.Itoa(instances))
+	if dryRun {
+		request.AddParam("dryRun", "true")
 	}
+	return printResponse(request.Get())
+}
+
+func handleTimeline() error {
+	var api string
+	var since string
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.StringVar(&since, "since", "", "Show events after this time. RFC3339 time or unix seconds.")
 
-	return new(statsd.Scheduler).Start()
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+
+	request := client.NewApiRequest(apiUrl + "/api/timeline")
+	request.AddParam("since", since)
+	return printResponse(request.Get())
+}
+
+func handleEvents() error {
+	var api string
+	var since string
+	var types string
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.StringVar(&since, "since", "", "Also show events after this time first. RFC3339 time or unix seconds.")
+	flag.StringVar(&types, "types", "", "Comma separated event types to show, e.g. launched,task-status,offer-declined. All if not set.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+
+	request := client.NewApiRequest(apiUrl + "/api/events")
+	request.AddParam("since", since)
+	request.AddParam("types", types)
+	return request.Stream(func(event string) {
+		fmt.Println(event)
+	})
+}
+
+func handleTeardown() error {
+	var api string
+	var unregister bool
+	var confirm string
+	var dryRun bool
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.BoolVar(&unregister, "unregister", false, "Also unregister the framework from Mesos, clear persisted state and stop the scheduler.")
+	flag.StringVar(&confirm, "confirm", "", "Confirmation token returned by the same command run without it.")
+	flag.BoolVar(&dryRun, "dry.run", false, "Only show what would change without applying it.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+
+	request := client.NewApiRequest(apiUrl + "/api/teardown")
+	if unregister {
+		request.AddParam("unregister", "true")
+	}
+	request.AddParam("confirm", confirm)
+	if dryRun {
+		request.AddParam("dryRun", "true")
+	}
+	return printResponse(request.Get())
+}
+
+func handleGc() error {
+	var api string
+	var enforce bool
+	var dryRun bool
+	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.BoolVar(&enforce, "enforce", false, "Kill orphaned frameworks and tasks instead of only reporting them.")
+	flag.BoolVar(&dryRun, "dry.run", false, "Only show what would change without applying it.")
+
+	flag.Parse()
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+
+	request := client.NewApiRequest(apiUrl + "/api/gc")
+	request.AddParam("enforce", strconv.FormatBool(enforce))
+	if dryRun {
+		request.AddParam("dryRun", "true")
+	}
+	return printResponse(request.Get())
 }
 
 func handleStartStop(start bool) error {
 	var api string
+	var dryRun bool
 	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
+	flag.BoolVar(&dryRun, "dry.run", false, "Only show what would change without applying it.")
 
 	flag.Parse()
 
@@ -128,24 +591,139 @@ func handleStartStop(start bool) error {
 		apiMethod = "stop"
 	}
 
-	request := statsd.NewApiRequest(statsd.Config.Api + "/api/" + apiMethod)
-	response := request.Get()
-
-	fmt.Println(response.Message)
+	request := client.NewApiRequest(apiUrl + "/api/" + apiMethod)
+	if dryRun {
+		request.AddParam("dryRun", "true")
+	}
+	return printResponse(request.Get())
+}
 
-	return nil
+// updateConfig holds the update flags sent to the scheduler as they are.
+type updateConfig struct {
+	ProducerProperties string
+	BrokerList         string
+	Topic              string
+	Destinations       string
+	DestSampling       string
+	TypeTopics         string
+	Transform          string
+	SchemaRegistryUrl  string
+	DualWriteTransform string
+	DualWriteTopic     string
+	Cpus               float64
+	Mem                float64
+	ExecutorImage      string
+	ContainerNetwork   string
+	VolumeSize         float64
+	BufferMaxSize      float64
+	ResourceOverrides  string
+	ExecutorUpload     string
+	Priorities         string
+	Placement          string
+	Spread             string
+	Constraints        string
+	Standby            int
+	Instances          int
+	HealthFailures     int
+	RolloutParallelism int
+	Producers          int
+	QueueSize          int
+	LogTopicRate       int
+	BurstSize          int
+	SamplingThreshold  float64
+	SamplingRate       float64
+	MemorySoftLimit    float64
+	Quotas             string
+	QuotaAction        string
+	OverflowTopic      string
+	DeadLetterTopic    string
+	ControlTopic       string
+	LogTopic           string
+	LogTopicLevel      string
 }
 
 func handleUpdate() error {
 	var api string
+	var validate string
+	var tcp string
+	var reserve string
+	var tcpErrors string
+	var brokerDnsTtl string
+	var produceTimeout string
+	var latencyBudget string
+	var dualWriteWindow string
+	var gaugeTtl string
+	var burstDuration string
+	var killGracePeriod string
+	var healthCheckInterval string
+	var rolloutPause string
+	var bufferMaxAge string
+	var host string
+	var group string
+	var port int
+	var dryRun bool
+	var file string
+	config := new(updateConfig)
 	flag.StringVar(&api, "api", "", "Binding host:port for http/artifact server. Optional if SM_API env is set.")
-	flag.StringVar(&statsd.Config.ProducerProperties, "producer.properties", "", "Producer.properties file name.")
-	flag.StringVar(&statsd.Config.BrokerList, "broker.list", "", "Kafka broker list separated by comma.")
-	flag.StringVar(&statsd.Config.Topic, "topic", "", "Topic to produce data to.")
-	flag.StringVar(&statsd.Config.Transform, "transform", "", "Transofmation to apply to each metric. none|avro|proto")
-	flag.StringVar(&statsd.Config.SchemaRegistryUrl, "schema.registry.url", "", "Avro Schema Registry url for transform=avro")
-	flag.Float64Var(&statsd.Config.Cpus, "cpu", 0.1, "CPUs per task")
-	flag.Float64Var(&statsd.Config.Mem, "mem", 64, "Mem per task")
+	flag.StringVar(&config.ProducerProperties, "producer.properties", "", "Producer.properties file name.")
+	flag.StringVar(&config.BrokerList, "broker.list", "", "Kafka broker list separated by comma.")
+	flag.StringVar(&brokerDnsTtl, "broker.dns.ttl", "", "How often executors re-resolve bootstrap brokers and reconnect if their addresses changed, e.g. 1m. 0 disables reconnects.")
+	flag.StringVar(&config.Topic, "topic", "", "Topic to produce data to.")
+	flag.StringVar(&config.Destinations, "destinations", "", "Topics with metric name filters separated by semicolon, e.g. archive=.*;realtime=latency\\..*. Overrides topic.")
+	flag.StringVar(&config.DestSampling, "destination.sampling", "", "Share of metric names sent to destination topics separated by comma, e.g. archive=0.01. Names are picked by hash, so the same metrics are always sampled.")
+	flag.StringVar(&config.TypeTopics, "type.topics", "", "Topics per metric type separated by comma, e.g. counter=metrics.counters,timer=metrics.timers. Types: counter|gauge|timer|set. Overrides topic and destinations for these types.")
+	flag.StringVar(&config.Transform, "transform", "", "Transofmation to apply to each metric. none|avro|proto")
+	flag.StringVar(&config.SchemaRegistryUrl, "schema.registry.url", "", "Avro Schema Registry url for transform=avro")
+	flag.StringVar(&config.DualWriteTransform, "dual.write.transform", "", "Transformation additionally written to dual.write.topic during dual.write.window, e.g. the previous one. none|avro|proto")
+	flag.StringVar(&config.DualWriteTopic, "dual.write.topic", "", "Topic for the dual.write.transform encoding.")
+	flag.StringVar(&dualWriteWindow, "dual.write.window", "", "How long to keep writing both encodings starting now, e.g. 24h. 0 stops dual write.")
+	flag.Float64Var(&config.Cpus, "cpu", 0.1, "CPUs per task")
+	flag.Float64Var(&config.Mem, "mem", 64, "Mem per task")
+	flag.StringVar(&host, "host", "", "Apply cpu and mem to servers on this host only. 0 removes the override.")
+	flag.StringVar(&group, "group", "", "Apply cpu and mem to servers on hosts with this attribute value only, e.g. rack:large. 0 removes the override.")
+	flag.StringVar(&config.ExecutorUpload, "executor.upload", "", "Uploaded executor version to launch servers with, see the executor command. none uses the executor the scheduler was started with.")
+	flag.StringVar(&config.ExecutorImage, "executor.image", "", "Docker image to run executors in, with the executor binary as entrypoint. none runs executors without a container.")
+	flag.StringVar(&config.ContainerNetwork, "container.network", "", "Docker network of executor containers. host|bridge")
+	flag.StringVar(&reserve, "reserve", "", "Dynamically reserve cpu and mem of servers on their agents so relaunched servers get them back. true|false")
+	flag.Float64Var(&config.VolumeSize, "volume.size", -1, "MB of a persistent volume buffering records servers failed to produce. 0 disables. Requires reserve.")
+	flag.Float64Var(&config.BufferMaxSize, "buffer.max.size", -1, "MB of records each server buffers on disk, newer records are dropped. 0 is unlimited.")
+	flag.StringVar(&bufferMaxAge, "buffer.max.age", "", "How long records are buffered on disk before being dropped instead of produced, e.g. 48h. 0 keeps them.")
+	flag.StringVar(&config.ResourceOverrides, "resource.overrides", "", "Replace all cpu and mem overrides, e.g. hostname:big-node-1=cpu:2,mem:512;rack:large=mem:256. See Resource Overrides.")
+	flag.StringVar(&config.Priorities, "priorities", "", "Priority classes of hosts with attribute values, e.g. rack:ingest=100;rack:batch=-10. See Priorities.")
+	flag.StringVar(&config.Placement, "placement", "", "Which matching offers to use first. spread|binpack|random")
+	flag.StringVar(&config.Spread, "spread", "", "Fault domain servers are spread evenly across. zone|region|hostname")
+	flag.StringVar(&config.Constraints, "constraints", "", "Offer attribute constraints separated by semicolon, e.g. hostname=unique;rack=like:us-east-.*. See Constraints.")
+	flag.IntVar(&config.Standby, "standby", -1, "Number of standby tasks kept next to active ones to take over instantly on failure.")
+	flag.IntVar(&config.Instances, "instances", -1, "Number of servers to run across the cluster. 0 runs one on every matching host.")
+	flag.StringVar(&healthCheckInterval, "health.check.interval", "", "How often executors probe their servers, e.g. 10s. 0 disables health checks.")
+	flag.IntVar(&config.HealthFailures, "health.check.failures", -1, "Consecutive failed health checks after which a server is restarted.")
+	flag.IntVar(&port, "port", -1, "Port servers listen for metrics on. 0 picks a port from each offer.")
+	flag.IntVar(&config.RolloutParallelism, "rollout.parallelism", -1, "Number of servers restarted at once to pick up an updated configuration. 0 disables rolling restarts.")
+	flag.StringVar(&rolloutPause, "rollout.pause", "", "Pause between restarting batches of servers, e.g. 30s.")
+	flag.IntVar(&config.Producers, "producers", 0, "Number of Kafka producers per task. Metrics are sharded between producers by name.")
+	flag.Float64Var(&config.SamplingThreshold, "sampling.threshold", -1, "Queue occupancy (0..1) at which the top counters and timers get sampled. 0 disables adaptive sampling, as by default.")
+	flag.Float64Var(&config.SamplingRate, "sampling.rate", -1, "Sample rate (0..1, more than 0) applied to the top metrics under overload.")
+	flag.Float64Var(&config.MemorySoftLimit, "memory.soft.limit", -1, "Share (0..1) of the mem allocation at which servers sample top metrics and shrink their heap. 0 disables.")
+	flag.StringVar(&config.Quotas, "quotas", "", "Events per second quotas per namespace, e.g. app1=1000,app2=500. Namespace is the first dot-separated part of a metric name.")
+	flag.StringVar(&config.QuotaAction, "quota.action", "", "What to do with metrics over quota. drop|sample|divert")
+	flag.StringVar(&config.OverflowTopic, "overflow.topic", "", "Topic to divert metrics over quota to for quota.action=divert")
+	flag.StringVar(&validate, "validate", "", "Validate encoded records against the transform schema before producing. true|false")
+	flag.StringVar(&tcp, "tcp", "", "Accept metrics over TCP on the statsd port with backpressure when buffers are full. true|false")
+	flag.StringVar(&tcpErrors, "tcp.errors", "", "Send an error line to TCP clients when backpressure is applied. true|false")
+	flag.StringVar(&config.DeadLetterTopic, "dead.letter.topic", "", "Topic for records that failed encoding or validation.")
+	flag.StringVar(&config.ControlTopic, "control.topic", "", "Topic the scheduler produces a JSON notification to whenever servers are added or removed.")
+	flag.StringVar(&config.LogTopic, "log.topic", "", "Topic servers produce their own log lines to as JSON. none stops shipping logs.")
+	flag.StringVar(&config.LogTopicLevel, "log.topic.level", "", "Lowest level of log lines shipped to log.topic. trace|debug|info|warn|error|critical. Defaults to warn.")
+	flag.IntVar(&config.LogTopicRate, "log.topic.rate", -1, "Log lines per second each server ships to log.topic, the rest are dropped. 0 is unlimited. Defaults to 100.")
+	flag.StringVar(&produceTimeout, "produce.timeout", "", "How long a produce request may take before it counts as timed out, e.g. 2s. 0 keeps producer defaults.")
+	flag.StringVar(&latencyBudget, "latency.budget", "", "Drop records queued longer than this instead of delivering them late, e.g. 5s. Dead-lettered if dead.letter.topic is set. 0 disables.")
+	flag.StringVar(&gaugeTtl, "gauge.ttl", "", "Produce an expiry marker for gauges not reporting for this long, e.g. 5m. 0 disables.")
+	flag.IntVar(&config.QueueSize, "queue.size", 0, "Records queued per producer before servers block reading metrics. Defaults to 100.")
+	flag.IntVar(&config.BurstSize, "burst.size", -1, "Records per producer held beyond queue.size to absorb traffic spikes. 0 disables.")
+	flag.StringVar(&burstDuration, "burst.duration", "", "How long a spike is absorbed before the burst buffer has to drain, e.g. 10s.")
+	flag.StringVar(&killGracePeriod, "kill.grace.period", "", "How long stopped servers may produce queued records and flush producers, e.g. 10s. Defaults to 5s.")
+	flag.BoolVar(&dryRun, "dry.run", false, "Only show what would change without applying it.")
+	flag.StringVar(&file, "file", "", "JSON object of update parameters to send along with the flags, e.g. {\"broker.list\": \"kafka-1:9092\"}.")
 
 	flag.Parse()
 
@@ -153,31 +731,137 @@ func handleUpdate() error {
 		return err
 	}
 
-	request := statsd.NewApiRequest(statsd.Config.Api + "/api/update")
-	request.AddParam("producer.properties", statsd.Config.ProducerProperties)
-	request.AddParam("broker.list", statsd.Config.BrokerList)
-	request.AddParam("topic", statsd.Config.Topic)
-	request.AddParam("transform", statsd.Config.Transform)
-	request.AddParam("schema.registry.url", statsd.Config.SchemaRegistryUrl)
-	request.AddParam("cpu", strconv.FormatFloat(statsd.Config.Cpus, 'E', -1, 64))
-	request.AddParam("mem", strconv.FormatFloat(statsd.Config.Mem, 'E', -1, 64))
-	response := request.Get()
-
-	fmt.Println(response.Message)
+	request := client.NewApiRequest(apiUrl + "/api/update")
+	request.AddParam("producer.properties", config.ProducerProperties)
+	request.AddParam("broker.list", config.BrokerList)
+	request.AddParam("broker.dns.ttl", brokerDnsTtl)
+	request.AddParam("produce.timeout", produceTimeout)
+	request.AddParam("latency.budget", latencyBudget)
+	request.AddParam("gauge.ttl", gaugeTtl)
+	request.AddParam("kill.grace.period", killGracePeriod)
+	if config.QueueSize > 0 {
+		request.AddParam("queue.size", strconv.Itoa(config.QueueSize))
+	}
+	if config.BurstSize >= 0 {
+		request.AddParam("burst.size", strconv.Itoa(config.BurstSize))
+	}
+	request.AddParam("burst.duration", burstDuration)
+	request.AddParam("topic", config.Topic)
+	request.AddParam("destinations", config.Destinations)
+	request.AddParam("destination.sampling", config.DestSampling)
+	request.AddParam("type.topics", config.TypeTopics)
+	request.AddParam("transform", config.Transform)
+	request.AddParam("schema.registry.url", config.SchemaRegistryUrl)
+	request.AddParam("dual.write.transform", config.DualWriteTransform)
+	request.AddParam("dual.write.topic", config.DualWriteTopic)
+	request.AddParam("dual.write.window", dualWriteWindow)
+	request.AddParam("placement", config.Placement)
+	request.AddParam("spread", config.Spread)
+	request.AddParam("constraints", config.Constraints)
+	request.AddParam("quotas", config.Quotas)
+	request.AddParam("quota.action", config.QuotaAction)
+	request.AddParam("overflow.topic", config.OverflowTopic)
+	request.AddParam("validate", validate)
+	request.AddParam("tcp", tcp)
+	request.AddParam("tcp.errors", tcpErrors)
+	request.AddParam("dead.letter.topic", config.DeadLetterTopic)
+	request.AddParam("control.topic", config.ControlTopic)
+	request.AddParam("log.topic", config.LogTopic)
+	request.AddParam("log.topic.level", config.LogTopicLevel)
+	if config.LogTopicRate >= 0 {
+		request.AddParam("log.topic.rate", strconv.Itoa(config.LogTopicRate))
+	}
+	request.AddParam("resource.overrides", config.ResourceOverrides)
+	request.AddParam("priorities", config.Priorities)
+	request.AddParam("executor.upload", config.ExecutorUpload)
+	request.AddParam("executor.image", config.ExecutorImage)
+	request.AddParam("container.network", config.ContainerNetwork)
+	request.AddParam("reserve", reserve)
+	if config.VolumeSize >= 0 {
+		request.AddParam("volume.size", strconv.FormatFloat(config.VolumeSize, 'E', -1, 64))
+	}
+	if config.BufferMaxSize >= 0 {
+		request.AddParam("buffer.max.size", strconv.FormatFloat(config.BufferMaxSize, 'E', -1, 64))
+	}
+	request.AddParam("buffer.max.age", bufferMaxAge)
+	if host != "" || group != "" || file != "" {
+		// overrides and update files only change the resources given explicitly
+		request.AddParam("host", host)
+		request.AddParam("group", group)
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "cpu" || f.Name == "mem" {
+				request.AddParam(f.Name, f.Value.String())
+			}
+		})
+	} else {
+		request.AddParam("cpu", strconv.FormatFloat(config.Cpus, 'E', -1, 64))
+		request.AddParam("mem", strconv.FormatFloat(config.Mem, 'E', -1, 64))
+	}
+	if config.Standby >= 0 {
+		request.AddParam("standby", strconv.Itoa(config.Standby))
+	}
+	if config.Instances >= 0 {
+		request.AddParam("instances", strconv.Itoa(config.Instances))
+	}
+	request.AddParam("health.check.interval", healthCheckInterval)
+	if config.HealthFailures >= 0 {
+		request.AddParam("health.check.failures", strconv.Itoa(config.HealthFailures))
+	}
+	if port >= 0 {
+		request.AddParam("port", strconv.Itoa(port))
+	}
+	if config.RolloutParallelism >= 0 {
+		request.AddParam("rollout.parallelism", strconv.Itoa(config.RolloutParallelism))
+	}
+	request.AddParam("rollout.pause", rolloutPause)
+	if config.Producers > 0 {
+		request.AddParam("producers", strconv.Itoa(config.Producers))
+	}
+	if config.SamplingThreshold >= 0 {
+		request.AddParam("sampling.threshold", strconv.FormatFloat(config.SamplingThreshold, 'E', -1, 64))
+	}
+	if config.SamplingRate >= 0 {
+		request.AddParam("sampling.rate", strconv.FormatFloat(config.SamplingRate, 'E', -1, 64))
+	}
+	if config.MemorySoftLimit >= 0 {
+		request.AddParam("memory.soft.limit", strconv.FormatFloat(config.MemorySoftLimit, 'E', -1, 64))
+	}
+	if dryRun {
+		request.AddParam("dryRun", "true")
+	}
+	if file == "" {
+		return printResponse(request.Get())
+	}
 
-	return nil
+	body, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return printResponse(request.Post("application/json", body))
 }
 
 func resolveApi(api string) error {
 	if api != "" {
-		statsd.Config.Api = api
+		apiUrl = api
 		return nil
 	}
 
 	if os.Getenv("SM_API") != "" {
-		statsd.Config.Api = os.Getenv("SM_API")
+		apiUrl = os.Getenv("SM_API")
 		return nil
 	}
 
 	return errors.New("Undefined API url. Please provide either a CLI --api option or SM_API env.")
 }
+
+// printResponse prints the message of a successful response and returns the error of a failed one, so the command
+// exits with a non-zero status.
+func printResponse(response *client.ApiResponse) error {
+	if err := response.Err(); err != nil {
+		return err
+	}
+
+	fmt.Println(response.Message)
+	return nil
+}
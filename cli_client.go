@@ -0,0 +1,40 @@
+// +build client
+
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package main
+
+import "errors"
+
+// The client build only talks to the scheduler API, so it builds on any platform without Mesos and Kafka libraries.
+
+var errClientBuild = errors.New("Not available in the client build, use a cli built without the client tag")
+
+func handleScheduler() error {
+	return errClientBuild
+}
+
+func handleReplay() error {
+	return errClientBuild
+}
+
+func handleSimulate() error {
+	return errClientBuild
+}
+
+func handleBundle() error {
+	return errClientBuild
+}
@@ -0,0 +1,243 @@
+// +build !client
+
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/elodina/statsd-mesos-kafka/statsd"
+	"golang.org/x/net/context"
+)
+
+func handleScheduler() error {
+	var api string
+	var logLevel string
+	var secretFile string
+
+	flag.StringVar(&statsd.Config.Master, "master", "", "Mesos Master addresses.")
+	flag.StringVar(&statsd.Config.MesosApi, "mesos.api", statsd.Config.MesosApi, "How to talk to the master: driver|http. http uses the v1 HTTP scheduler API and needs a master host:port.")
+	flag.StringVar(&api, "api", "", "API host:port for advertizing.")
+	flag.StringVar(&statsd.Config.User, "user", "", "Mesos user. Defaults to current system user")
+	flag.StringVar(&logLevel, "log.level", statsd.Config.LogLevel, "Log level. trace|debug|info|warn|error|critical. Defaults to info.")
+	flag.StringVar(&statsd.Config.FrameworkName, "framework.name", statsd.Config.FrameworkName, "Framework name.")
+	flag.StringVar(&statsd.Config.FrameworkRole, "framework.role", statsd.Config.FrameworkRole, "Framework role.")
+	flag.StringVar(&statsd.Config.FrameworkPrincipal, "framework.principal", "", "Framework principal. Required to reserve resources and to authenticate.")
+	flag.StringVar(&statsd.Config.FrameworkSecret, "framework.secret", "", "Secret the framework authenticates with to masters requiring authentication.")
+	flag.StringVar(&secretFile, "framework.secret.file", "", "File with the framework secret, preferred over framework.secret as it doesn't show in the process list.")
+	flag.StringVar(&statsd.Config.Namespace, "namespace", statsd.Config.Namespace, "Namespace.")
+	flag.StringVar(&statsd.Config.ExecutorPath, "executor.path", "", "Path to the executor binary. Autodetected in current dir if not set.")
+	flag.StringVar(&statsd.Config.ExecutorVersion, "executor.version", "", "Executor version to pick when autodetecting the executor binary.")
+	flag.StringVar(&statsd.Config.ExecutorSha256, "executor.sha256", "", "Expected SHA-256 checksum of the executor binary.")
+	flag.StringVar(&statsd.Config.ArtifactDir, "artifact.dir", "", "Directory producer properties and other files fetched by executors are served from. Required for producer.properties and executor uploads.")
+	flag.StringVar(&statsd.Config.DiscoveryFile, "discovery.file", "", "Agent path servers write their address to for applications on the agent, e.g. /var/run/statsd/address.env. Not written if not set.")
+	flag.DurationVar(&statsd.Config.GcInterval, "gc.interval", statsd.Config.GcInterval, "How often to look for orphaned frameworks and tasks. 0 disables the check.")
+	flag.BoolVar(&statsd.Config.GcEnforce, "gc.enforce", false, "Kill orphaned frameworks and tasks instead of only reporting them.")
+	flag.DurationVar(&statsd.Config.MaintenanceDrain, "maintenance.drain", statsd.Config.MaintenanceDrain, "How long before a Mesos maintenance window servers are moved off the agent.")
+	flag.Float64Var(&statsd.Config.RefuseSeconds, "offer.refuse.seconds", statsd.Config.RefuseSeconds, "How long offers declined for lack of resources are refused.")
+	flag.Float64Var(&statsd.Config.MismatchSeconds, "offer.mismatch.refuse.seconds", statsd.Config.MismatchSeconds, "How long offers of blacklisted, evacuated or constraint mismatching hosts are refused.")
+	flag.DurationVar(&statsd.Config.HistoryMaxAge, "history.max.age", statsd.Config.HistoryMaxAge, "How long timeline events, stats reports and agents that stopped offering are kept.")
+	flag.IntVar(&statsd.Config.HistoryMaxEvents, "history.max.events", statsd.Config.HistoryMaxEvents, "How many timeline events are kept.")
+	flag.StringVar(&statsd.Config.InactiveUpdates, "inactive.updates", statsd.Config.InactiveUpdates, "What happens to configuration updates while servers are stopped: apply|queue|reject. queue applies them on start.")
+	flag.StringVar(&statsd.Config.ApiAuth, "api.auth", "", "API auth provider: token|basic|oidc|ldap. API is unauthenticated if not set.")
+	flag.StringVar(&statsd.Config.ApiTokens, "api.tokens", os.Getenv("SM_API_TOKENS"), "Comma separated bearer tokens accepted by token auth. Defaults to SM_API_TOKENS env.")
+	flag.StringVar(&statsd.Config.ApiReadOnlyTokens, "api.readonly.tokens", os.Getenv("SM_API_READONLY_TOKENS"), "Comma separated bearer tokens with read-only access for token auth. Defaults to SM_API_READONLY_TOKENS env.")
+	flag.StringVar(&statsd.Config.ApiUsers, "api.users", os.Getenv("SM_API_USERS"), "Comma separated user:password pairs accepted by basic auth. Defaults to SM_API_USERS env.")
+	flag.StringVar(&statsd.Config.ApiReadOnlyUsers, "api.readonly.users", os.Getenv("SM_API_READONLY_USERS"), "Comma separated user:password pairs with read-only access for basic auth. Defaults to SM_API_READONLY_USERS env.")
+	flag.StringVar(&statsd.Config.ApiReadOnly, "api.readonly", "", "Comma separated principals with read-only access, e.g. LDAP users or OIDC subjects.")
+	flag.StringVar(&statsd.Config.ApiGroups, "api.groups", "", "Principals only allowed to change cpu and mem of a server group, e.g. alice=team:a;token#1=team:b. See API Authentication.")
+	flag.StringVar(&statsd.Config.OidcIssuer, "api.oidc.issuer", "", "OIDC issuer URL for oidc auth.")
+	flag.StringVar(&statsd.Config.OidcAudience, "api.oidc.audience", "", "Audience OIDC tokens must be issued for.")
+	flag.StringVar(&statsd.Config.OidcJwksUrl, "api.oidc.jwks.url", "", "OIDC JWKS URL. Discovered from the issuer if not set.")
+	flag.StringVar(&statsd.Config.LdapUrl, "api.ldap.url", "", "LDAP server URL for ldap auth, e.g. ldaps://ldap.example.com.")
+	flag.StringVar(&statsd.Config.LdapUserDn, "api.ldap.user.dn", "", "DN template to bind with, %s is replaced with the user name, e.g. uid=%s,ou=people,dc=example,dc=com.")
+	flag.StringVar(&statsd.Config.ApiTlsCert, "api.tls.cert", "", "PEM certificate to serve the API and executor downloads over https with. Requires api.tls.key.")
+	flag.StringVar(&statsd.Config.ApiTlsKey, "api.tls.key", "", "PEM private key of api.tls.cert.")
+	flag.StringVar(&statsd.Config.Storage, "storage", "", "Where to persist scheduler state to pick up running tasks after restarts: file:<path> or zk:<connect>/<path>. State is not persisted if not set.")
+	flag.StringVar(&statsd.Config.LeaderElection, "leader.election", "", "ZooKeeper path schedulers elect a leader at, e.g. zookeeper:2181/statsd-mesos-kafka/leader. Only the leader runs, others wait to take over. Requires storage.")
+	flag.StringVar(&statsd.Config.HandoffFrom, "handoff.from", "", "API url of a running scheduler on this host to take over from without downtime, e.g. http://127.0.0.1:6666. Requires storage.")
+	flag.DurationVar(&statsd.Config.FailoverTimeout, "failover.timeout", statsd.Config.FailoverTimeout, "How long Mesos keeps tasks running while the scheduler is down. Used with storage.")
+	flag.BoolVar(&statsd.Config.Force, "force", false, "Register even if another framework with the same name and role is active.")
+
+	flag.Parse()
+
+	if err := resolveApi(api); err != nil {
+		return err
+	}
+	statsd.Config.Api = apiUrl
+
+	if err := statsd.InitLogging(logLevel); err != nil {
+		return err
+	}
+
+	if statsd.Config.Master == "" {
+		return errors.New("--master flag is required.")
+	}
+	if secretFile != "" {
+		secret, err := ioutil.ReadFile(secretFile)
+		if err != nil {
+			return fmt.Errorf("Failed to read framework secret: %s", err)
+		}
+		statsd.Config.FrameworkSecret = strings.TrimSpace(string(secret))
+	}
+	if statsd.Config.FrameworkSecret != "" && statsd.Config.FrameworkPrincipal == "" {
+		return errors.New("--framework.secret requires --framework.principal")
+	}
+	if statsd.Config.RefuseSeconds <= 0 || statsd.Config.MismatchSeconds <= 0 {
+		return errors.New("--offer.refuse.seconds and --offer.mismatch.refuse.seconds must be positive")
+	}
+	if statsd.Config.HistoryMaxAge <= 0 || statsd.Config.HistoryMaxEvents <= 0 {
+		return errors.New("--history.max.age and --history.max.events must be positive")
+	}
+	switch statsd.Config.InactiveUpdates {
+	case statsd.InactiveUpdatesApply, statsd.InactiveUpdatesQueue, statsd.InactiveUpdatesReject:
+	default:
+		return fmt.Errorf("Invalid inactive.updates %s, expected apply|queue|reject", statsd.Config.InactiveUpdates)
+	}
+	if err := statsd.ValidateDiscoveryFile(statsd.Config.DiscoveryFile); err != nil {
+		return err
+	}
+	if statsd.Config.MesosApi != statsd.MesosApiDriver && statsd.Config.MesosApi != statsd.MesosApiHttp {
+		return fmt.Errorf("Invalid mesos.api %s, expected driver or http", statsd.Config.MesosApi)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		<-interrupts
+		cancel()
+	}()
+
+	return statsd.NewScheduler(statsd.Config, statsd.Logger, nil).Start(ctx)
+}
+
+func handleReplay() error {
+	var topic string
+	var transform string
+	var from string
+	var to string
+	var speed float64
+	var target string
+	var logLevel string
+	flag.StringVar(&statsd.Config.ProducerProperties, "producer.properties", "", "Producer.properties file to take bootstrap.servers from.")
+	flag.StringVar(&statsd.Config.BrokerList, "broker.list", "", "Kafka broker list separated by comma. Used if producer.properties is not set.")
+	flag.StringVar(&topic, "topic", "", "Topic to replay metrics from.")
+	flag.StringVar(&transform, "transform", statsd.TransformNone, "Transformation metrics were produced with. none|avro|proto")
+	flag.StringVar(&statsd.Config.SchemaRegistryUrl, "schema.registry.url", "", "Avro Schema Registry url for transform=avro")
+	flag.StringVar(&from, "from", "", "Replay metrics received after this time. RFC3339 time or unix seconds. Defaults to the earliest offset.")
+	flag.StringVar(&to, "to", "", "Replay metrics received before this time. RFC3339 time or unix seconds. Defaults to the latest offset.")
+	flag.Float64Var(&speed, "speed", 1, "Replay speed relative to the original pace, e.g. 10 for ten times faster. 0 sends as fast as possible.")
+	flag.StringVar(&target, "target", "-", "Statsd host:port to send metrics to over UDP. - writes them to stdout.")
+	flag.StringVar(&logLevel, "log.level", "warn", "Log level. trace|debug|info|warn|error|critical.")
+
+	flag.Parse()
+	if err := statsd.InitLogging(logLevel); err != nil {
+		return err
+	}
+	if statsd.Config.ProducerProperties == "" && statsd.Config.BrokerList == "" {
+		return errors.New("--producer.properties or --broker.list is required")
+	}
+
+	fromTime, err := statsd.ParseReplayTime(from)
+	if err != nil {
+		return err
+	}
+	toTime, err := statsd.ParseReplayTime(to)
+	if err != nil {
+		return err
+	}
+
+	var output io.Writer = os.Stdout
+	if target != "-" {
+		if output, err = statsd.NewUdpOutput(target); err != nil {
+			return err
+		}
+	}
+
+	replay, err := statsd.NewReplay(topic, transform, fromTime, toTime, speed, output)
+	if err != nil {
+		return err
+	}
+	err = replay.Run()
+	fmt.Fprintf(os.Stderr, "Replay finished, %s\n", replay)
+	return err
+}
+
+func handleSimulate() error {
+	var fixture string
+	var update string
+	var logLevel string
+	flag.StringVar(&fixture, "fixture", "", "JSON file with the config and the offers and status updates to replay.")
+	flag.StringVar(&update, "update", "", "Update parameters applied on top of the fixture config, e.g. constraints=rack=unique&placement=spread.")
+	flag.StringVar(&logLevel, "log.level", "error", "Log level. trace|debug|info|warn|error|critical.")
+
+	flag.Parse()
+	if err := statsd.InitLogging(logLevel); err != nil {
+		return err
+	}
+	if fixture == "" {
+		return errors.New("--fixture is required")
+	}
+	overrides, err := url.ParseQuery(update)
+	if err != nil {
+		return fmt.Errorf("Invalid update %s: %s", update, err)
+	}
+
+	recorded, err := statsd.LoadSimulationFixture(fixture)
+	if err != nil {
+		return err
+	}
+	simulation, err := statsd.NewSimulation(recorded, overrides, os.Stdout)
+	if err != nil {
+		return err
+	}
+	return simulation.Run(recorded.Steps)
+}
+
+func handleBundle() error {
+	var scheduler string
+	var files string
+	var version string
+	flag.StringVar(&scheduler, "scheduler", "cli", "Scheduler binary to include.")
+	flag.StringVar(&files, "files", "", "Additional files to include separated by comma, e.g. producer.properties.")
+	flag.StringVar(&version, "version", time.Now().Format("20060102150405"), "Bundle version. Defaults to current timestamp.")
+
+	flag.Parse()
+
+	var extraFiles []string
+	if files != "" {
+		extraFiles = strings.Split(files, ",")
+	}
+
+	name, err := statsd.Bundle(".", scheduler, extraFiles, version)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Bundle created: %s\n", name)
+	return nil
+}
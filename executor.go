@@ -28,15 +28,31 @@ import (
 
 var logLevel = flag.String("log.level", "info", "Log level. trace|debug|info|warn|error|critical. Defaults to info.")
 var host = flag.String("host", "localhost", "Hostname of the executor")
+var standalone = flag.Bool("standalone", false, "Run without Mesos, configured with the flags below, for local development.")
+var configFile = flag.String("config", "", "JSON file with task data as passed by the scheduler, for standalone mode. Flags override it.")
+var adminPort = flag.Uint64("admin.port", 0, "Port for the /health and /stats endpoints in standalone mode. Disabled if not set.")
+var topic = flag.String("topic", "", "Topic to produce data to in standalone mode.")
+var brokerList = flag.String("broker.list", "", "Kafka broker list separated by comma in standalone mode.")
+var producerProperties = flag.String("producer.properties", "", "Producer.properties file name in standalone mode.")
+var transform = flag.String("transform", "", "Transformation to apply to each metric in standalone mode. none|avro|proto")
+var schemaRegistryUrl = flag.String("schema.registry.url", "", "Avro Schema Registry url for transform=avro in standalone mode.")
 
 func main() {
 	flag.Parse()
-	err := statsd.InitLogging(*logLevel)
+	err := statsd.InitExecutorLogging(*logLevel)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
+	if *standalone {
+		if err := runStandalone(); err != nil {
+			statsd.Logger.Error(err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	driverConfig := executor.DriverConfig{
 		Executor: &statsd.Executor{Host: *host},
 	}
@@ -54,3 +70,24 @@ func main() {
 	}
 	driver.Join()
 }
+
+func runStandalone() error {
+	if *configFile != "" {
+		if err := statsd.ReadConfigFile(*configFile); err != nil {
+			return err
+		}
+	}
+	setFlag(*topic, &statsd.Config.Topic)
+	setFlag(*brokerList, &statsd.Config.BrokerList)
+	setFlag(*producerProperties, &statsd.Config.ProducerProperties)
+	setFlag(*transform, &statsd.Config.Transform)
+	setFlag(*schemaRegistryUrl, &statsd.Config.SchemaRegistryUrl)
+
+	return statsd.RunStandalone(*host, *adminPort)
+}
+
+func setFlag(value string, config *string) {
+	if value != "" {
+		*config = value
+	}
+}
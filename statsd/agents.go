@@ -0,0 +1,169 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// Agent is what the last offer from an agent told about it.
+type Agent struct {
+	Hostname    string
+	SlaveId     string
+	Attributes  map[string]string
+	Resources   string // resources available in the last offer
+	LastOffered time.Time
+	LastMatched time.Time // last offer that could run a server
+}
+
+func (a *Agent) String() string {
+	names := make([]string, 0, len(a.Attributes))
+	for name := range a.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	attributes := make([]string, len(names))
+	for i, name := range names {
+		attributes[i] = name + "=" + a.Attributes[name]
+	}
+
+	return fmt.Sprintf("%s (%s) last offered %s\n    resources: %s\n    attributes: %s\n", a.Hostname, a.SlaveId,
+		a.LastOffered.Format(time.RFC3339), a.Resources, strings.Join(attributes, ","))
+}
+
+// AgentInventory keeps every agent seen in offers, including declined ones.
+type AgentInventory struct {
+	agents map[string]*Agent
+	lock   sync.Mutex
+}
+
+func NewAgentInventory() *AgentInventory {
+	return &AgentInventory{agents: make(map[string]*Agent)}
+}
+
+func (i *AgentInventory) Observe(offers []*mesos.Offer) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	for _, offer := range offers {
+		agent := &Agent{
+			Hostname:    offer.GetHostname(),
+			SlaveId:     offer.GetSlaveId().GetValue(),
+			Attributes:  attributeValues(offer.GetAttributes()),
+			Resources:   resourcesString(offer.GetResources()),
+			LastOffered: time.Now(),
+		}
+		if previous, exists := i.agents[offer.GetHostname()]; exists {
+			agent.LastMatched = previous.LastMatched
+		}
+		i.agents[offer.GetHostname()] = agent
+	}
+}
+
+// Matched records that the agent offered enough resources to run a server.
+func (i *AgentInventory) Matched(hostname string) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if agent, exists := i.agents[hostname]; exists {
+		matched := *agent
+		matched.LastMatched = time.Now()
+		i.agents[hostname] = &matched
+	}
+}
+
+// Compact forgets agents that didn't send offers since the given time, except those in keep, and returns how many.
+func (i *AgentInventory) Compact(before time.Time, keep map[string]bool) int {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	dropped := 0
+	for hostname, agent := range i.agents {
+		if agent.LastOffered.Before(before) && !keep[hostname] {
+			delete(i.agents, hostname)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Get returns the agent or nil if it never sent offers.
+func (i *AgentInventory) Get(hostname string) *Agent {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	return i.agents[hostname]
+}
+
+// List returns agents sorted by hostname.
+func (i *AgentInventory) List() []*Agent {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	hostnames := make([]string, 0, len(i.agents))
+	for hostname := range i.agents {
+		hostnames = append(hostnames, hostname)
+	}
+	sort.Strings(hostnames)
+
+	agents := make([]*Agent, len(hostnames))
+	for idx, hostname := range hostnames {
+		agents[idx] = i.agents[hostname]
+	}
+	return agents
+}
+
+// AttributeValues returns each attribute name with the number of agents having each of its values.
+func (i *AgentInventory) AttributeValues() map[string]map[string]int {
+	values := make(map[string]map[string]int)
+	for _, agent := range i.List() {
+		for name, value := range agent.Attributes {
+			if values[name] == nil {
+				values[name] = make(map[string]int)
+			}
+			values[name][value]++
+		}
+	}
+	return values
+}
+
+func attributeValues(attributes []*mesos.Attribute) map[string]string {
+	values := make(map[string]string)
+	for _, attribute := range attributes {
+		switch attribute.GetType() {
+		case mesos.Value_TEXT:
+			values[attribute.GetName()] = attribute.GetText().GetValue()
+		case mesos.Value_SCALAR:
+			values[attribute.GetName()] = fmt.Sprint(attribute.GetScalar().GetValue())
+		case mesos.Value_RANGES:
+			ranges := make([]string, 0)
+			for _, r := range attribute.GetRanges().GetRange() {
+				ranges = append(ranges, fmt.Sprintf("%d-%d", r.GetBegin(), r.GetEnd()))
+			}
+			values[attribute.GetName()] = "[" + strings.Join(ranges, ",") + "]"
+		case mesos.Value_SET:
+			values[attribute.GetName()] = "{" + strings.Join(attribute.GetSet().GetItem(), ",") + "}"
+		}
+	}
+	return values
+}
@@ -0,0 +1,169 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maintenanceAnnotation marks a host an operator does planned work on until a given time.
+type maintenanceAnnotation struct {
+	Until  time.Time
+	Reason string
+}
+
+func (a maintenanceAnnotation) String() string {
+	if a.Reason == "" {
+		return fmt.Sprintf("until %s", a.Until.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("until %s, %s", a.Until.Format(time.RFC3339), a.Reason)
+}
+
+// maintenanceAnnotations keeps hosts annotated in maintenance through the API. Unlike Mesos maintenance windows they
+// don't drain servers, they only stop the scheduler from relaunching and reporting failures on the host.
+type maintenanceAnnotations struct {
+	annotations map[string]maintenanceAnnotation
+	lock        sync.Mutex
+}
+
+func newMaintenanceAnnotations() *maintenanceAnnotations {
+	return &maintenanceAnnotations{annotations: make(map[string]maintenanceAnnotation)}
+}
+
+func (m *maintenanceAnnotations) Set(host string, annotation maintenanceAnnotation) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.annotations[host] = annotation
+}
+
+// Remove removes the annotation and tells whether the host had one.
+func (m *maintenanceAnnotations) Remove(host string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	_, exists := m.annotations[host]
+	delete(m.annotations, host)
+	return exists
+}
+
+// Get returns the annotation of the host if it didn't end yet.
+func (m *maintenanceAnnotations) Get(host string, now time.Time) (maintenanceAnnotation, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	annotation, exists := m.annotations[host]
+	return annotation, exists && now.Before(annotation.Until)
+}
+
+// Snapshot returns the annotations by host.
+func (m *maintenanceAnnotations) Snapshot() map[string]maintenanceAnnotation {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	snapshot := make(map[string]maintenanceAnnotation, len(m.annotations))
+	for host, annotation := range m.annotations {
+		snapshot[host] = annotation
+	}
+	return snapshot
+}
+
+// Expire removes annotations that ended and returns their hosts.
+func (m *maintenanceAnnotations) Expire(now time.Time) []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	hosts := make([]string, 0)
+	for host, annotation := range m.annotations {
+		if !now.Before(annotation.Until) {
+			delete(m.annotations, host)
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func (m *maintenanceAnnotations) String() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	hosts := make([]string, 0, len(m.annotations))
+	for host := range m.annotations {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	status := ""
+	for _, host := range hosts {
+		status += fmt.Sprintf("  %s: %s\n", host, m.annotations[host])
+	}
+	return status
+}
+
+// AnnotateMaintenance marks the host in maintenance until the given time. Servers keep running, but nothing is launched
+// on the host and its failures are not reported until the annotation ends.
+func (s *Scheduler) AnnotateMaintenance(host string, until time.Time, reason string) error {
+	if !until.After(time.Now()) {
+		return fmt.Errorf("Maintenance of %s would end in the past at %s", host, until.Format(time.RFC3339))
+	}
+
+	annotation := maintenanceAnnotation{Until: until, Reason: reason}
+	s.annotations.Set(host, annotation)
+	s.logger.Infof("Host %s is annotated in maintenance %s", host, annotation)
+	s.timeline.Add(EventMaintenance, host, "", fmt.Sprintf("annotated in maintenance %s", annotation))
+	return nil
+}
+
+// EndMaintenance removes the annotation of the host before it ends on its own.
+func (s *Scheduler) EndMaintenance(host string) error {
+	if !s.annotations.Remove(host) {
+		return newError(ErrHostNotFound, "Host %s is not annotated in maintenance", host)
+	}
+
+	s.timeline.Add(EventMaintenance, host, "", "maintenance annotation ended")
+	s.reviveOffers("maintenance annotation ended on " + host)
+	return nil
+}
+
+// inMaintenance tells whether failures on the host are expected as an operator works on it.
+func (s *Scheduler) inMaintenance(host string) bool {
+	_, annotated := s.annotations.Get(host, time.Now())
+	return annotated
+}
+
+func (s *Scheduler) expireAnnotations(now time.Time) {
+	for _, host := range s.annotations.Expire(now) {
+		s.logger.Infof("Maintenance annotation of %s ended, resuming normal handling", host)
+		s.timeline.Add(EventMaintenance, host, "", "maintenance annotation ended")
+		s.reviveOffers("maintenance annotation ended on " + host)
+	}
+}
+
+// parseUntil reads the end of an annotation: a duration from now, RFC3339 time or unix seconds.
+func parseUntil(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("Maintenance end is required")
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(duration), nil
+	}
+	return parseSince(value)
+}
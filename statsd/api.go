@@ -16,67 +16,16 @@ limitations under the License. */
 package statsd
 
 import (
-	"encoding/json"
-	"fmt"
-	"io/ioutil"
-	"net/http"
-	"net/url"
+	"github.com/elodina/statsd-mesos-kafka/statsd/client"
 )
 
-type ApiRequest struct {
-	url    string
-	params map[string]string
-}
-
-func NewApiRequest(url string) *ApiRequest {
-	return &ApiRequest{
-		url:    url,
-		params: make(map[string]string),
-	}
-}
-
-func (r *ApiRequest) AddParam(key string, value interface{}) {
-	str := fmt.Sprintf("%s", value)
-	if str != "" {
-		r.params[key] = str
-	}
-}
-
-func (r *ApiRequest) Get() *ApiResponse {
-	values := url.Values{}
-	for key, value := range r.params {
-		values.Set(key, value)
-	}
-	queryString := values.Encode()
-
-	url := fmt.Sprintf("%s?%s", r.url, queryString)
-	response, err := http.Get(url)
-	if err != nil {
-		return &ApiResponse{false, err.Error()}
-	}
-
-	responseBody, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return &ApiResponse{false, err.Error()}
-	}
-
-	apiResponse := new(ApiResponse)
-	err = json.Unmarshal(responseBody, apiResponse)
-	if err != nil {
-		return &ApiResponse{false, err.Error()}
-	}
-
-	return apiResponse
-}
-
-type ApiResponse struct {
-	Success bool
-	Message string
-}
+// The API client is in package client to build without the scheduler, these keep it available under the usual names.
+type (
+	ApiRequest  = client.ApiRequest
+	ApiResponse = client.ApiResponse
+)
 
-func NewApiResponse(success bool, message string) *ApiResponse {
-	return &ApiResponse{
-		Success: success,
-		Message: message,
-	}
-}
+var (
+	NewApiRequest  = client.NewApiRequest
+	NewApiResponse = client.NewApiResponse
+)
@@ -0,0 +1,90 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Version is the scheduler version reported by /api/v1/info, set when building with
+// -ldflags "-X github.com/elodina/statsd-mesos-kafka/statsd.Version=<version>".
+var Version = "dev"
+
+// apiVersion is the version of the API served under apiVersionPrefix. Its endpoints change only compatibly: fields and
+// endpoints may be added, but are never renamed or removed.
+const (
+	apiVersion       = "v1"
+	apiVersionPrefix = "/api/" + apiVersion + "/"
+)
+
+// ApiInfo describes the scheduler to tooling programming against the API.
+type ApiInfo struct {
+	Version       string
+	ApiVersion    string
+	FrameworkId   string
+	FrameworkName string
+	FrameworkRole string
+	Master        string
+	Capabilities  []string
+}
+
+func (i *ApiInfo) String() string {
+	return fmt.Sprintf("version: %s\napi: %s\nframework: %s (name %s, role %s)\nmaster: %s\ncapabilities: %s",
+		i.Version, i.ApiVersion, i.FrameworkId, i.FrameworkName, i.FrameworkRole, i.Master, strings.Join(i.Capabilities, ", "))
+}
+
+func (s *Scheduler) apiInfo() *ApiInfo {
+	return &ApiInfo{
+		Version:       Version,
+		ApiVersion:    apiVersion,
+		FrameworkId:   s.frameworkId,
+		FrameworkName: s.config.FrameworkName,
+		FrameworkRole: s.config.FrameworkRole,
+		Master:        s.currentMasterUrl(),
+		Capabilities:  s.capabilities(),
+	}
+}
+
+// capabilities lists the optional features this scheduler offers, so tooling can check for one instead of the version.
+func (s *Scheduler) capabilities() []string {
+	capabilities := []string{"structured-responses", "rollout", "tap", "host-lists", "maintenance", "drain-kafka", "scale", "migrate", "rotate"}
+	if s.storage != nil {
+		capabilities = append(capabilities, "state-persistence")
+	}
+	if s.config.LeaderElection != "" {
+		capabilities = append(capabilities, "leader-election")
+	}
+	if s.config.ApiAuth != "" && s.config.ApiAuth != "none" {
+		capabilities = append(capabilities, "auth-"+s.config.ApiAuth)
+	}
+	if s.config.Reserve {
+		capabilities = append(capabilities, "reservations")
+	}
+	return capabilities
+}
+
+// versioned serves versioned endpoints with the unversioned ones they are mapped onto, e.g. /api/v1/status with
+// /api/status.
+func versioned(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mapped := r.Clone(r.Context())
+		mapped.URL.Path = "/api/" + strings.TrimPrefix(r.URL.Path, apiVersionPrefix)
+		mapped.URL.RawPath = ""
+		handler.ServeHTTP(w, mapped)
+	})
+}
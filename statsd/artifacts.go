@@ -0,0 +1,212 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+const checksumSuffix = ".sha256"
+
+var errArtifactNotFound = errors.New("Artifact not found")
+
+var errNoArtifactDir = newError(ErrConfigIncomplete, "--artifact.dir is not set, files other than the executor are not served")
+
+// artifactChecksum is the SHA-256 of a file as of its size and modification time.
+type artifactChecksum struct {
+	size    int64
+	modTime time.Time
+	sum     []byte
+}
+
+// artifactChecksums caches checksums of served files so they are only hashed again once they change.
+type artifactChecksums struct {
+	sums map[string]*artifactChecksum
+	lock sync.Mutex
+}
+
+func newArtifactChecksums() *artifactChecksums {
+	return &artifactChecksums{sums: make(map[string]*artifactChecksum)}
+}
+
+func (a *artifactChecksums) checksum(path string, info os.FileInfo) ([]byte, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if sum, ok := a.sums[path]; ok && sum.size == info.Size() && sum.modTime.Equal(info.ModTime()) {
+		return sum.sum, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+
+	sum := &artifactChecksum{size: info.Size(), modTime: info.ModTime(), sum: hash.Sum(nil)}
+	a.sums[path] = sum
+	return sum.sum, nil
+}
+
+// artifactDir returns the absolute directory artifacts are served from. There is no default, as the working directory
+// usually holds the state file, TLS key or secrets nobody should be able to download.
+func (c *config) artifactDir() (string, error) {
+	if c.ArtifactDir == "" {
+		return "", errNoArtifactDir
+	}
+	dir, err := filepath.Abs(c.ArtifactDir)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(dir)
+}
+
+// artifactPath resolves a resource name to a regular file the API may serve: the executor binary, an uploaded
+// executor or a file directly in the artifact directory. Names with path separators, hidden files and symlinks leading out of the directory are
+// refused.
+func (s *Scheduler) artifactPath(name string) (string, os.FileInfo, error) {
+	if name == s.config.Executor && s.config.ExecutorPath != "" {
+		return artifactFile(s.config.ExecutorPath)
+	}
+	if strings.HasPrefix(name, uploadedExecutorPrefix) {
+		if path, err := s.config.uploadedExecutorPath(strings.TrimPrefix(name, uploadedExecutorPrefix)); err == nil {
+			return artifactFile(path)
+		}
+	}
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) || s.config.ArtifactDir == "" {
+		return "", nil, errArtifactNotFound
+	}
+
+	dir, err := s.config.artifactDir()
+	if err != nil {
+		return "", nil, err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(dir, name))
+	if err != nil || filepath.Dir(path) != dir {
+		return "", nil, errArtifactNotFound
+	}
+	return artifactFile(path)
+}
+
+func artifactFile(path string) (string, os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", nil, errArtifactNotFound
+	}
+	return path, info, nil
+}
+
+// artifactChecksum returns the hex SHA-256 of a servable resource.
+func (s *Scheduler) artifactChecksum(name string) (string, error) {
+	path, info, err := s.artifactPath(name)
+	if err != nil {
+		return "", err
+	}
+	sum, err := s.checksums.checksum(path, info)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sum), nil
+}
+
+// artifactUri builds the URI executors fetch a resource from. With its checksum known the URI is cached by the
+// fetcher, and the checksum in the query makes a changed file a new cache entry.
+func (s *Scheduler) artifactUri(name string) *mesos.CommandInfo_URI {
+	value := fmt.Sprintf("%s/resource/%s", s.config.apiUrl(), url.PathEscape(name))
+	uri := &mesos.CommandInfo_URI{Value: proto.String(value)}
+
+	checksum, err := s.artifactChecksum(name)
+	if err != nil {
+		s.logger.Warnf("Not caching %s, checksum unavailable: %s", name, err)
+		return uri
+	}
+	uri.Value = proto.String(value + "?sha256=" + checksum)
+	uri.Cache = proto.Bool(true)
+	return uri
+}
+
+// serveFile serves executor artifacts with their SHA-256 as ETag and Digest, answering If-None-Match with 304.
+// <name>.sha256 returns the checksum in sha256sum format.
+func (hs *HttpServer) serveFile(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/resource/")
+	if strings.HasSuffix(name, checksumSuffix) {
+		if _, _, err := hs.sched.artifactPath(name); err == errArtifactNotFound {
+			hs.serveChecksum(w, r, strings.TrimSuffix(name, checksumSuffix))
+			return
+		}
+	}
+
+	path, info, err := hs.sched.artifactPath(name)
+	if err != nil {
+		hs.artifactError(w, r, name, err)
+		return
+	}
+	sum, err := hs.sched.checksums.checksum(path, info)
+	if err != nil {
+		hs.artifactError(w, r, name, err)
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		hs.artifactError(w, r, name, err)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum)+`"`)
+	w.Header().Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum))
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+func (hs *HttpServer) serveChecksum(w http.ResponseWriter, r *http.Request, name string) {
+	checksum, err := hs.sched.artifactChecksum(name)
+	if err != nil {
+		hs.artifactError(w, r, name, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s  %s\n", checksum, name)
+}
+
+func (hs *HttpServer) artifactError(w http.ResponseWriter, r *http.Request, name string, err error) {
+	if err == errArtifactNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	hs.sched.logger.Warnf("Failed to serve %s: %s", name, err)
+	http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+}
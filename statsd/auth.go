@@ -0,0 +1,302 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	AuthNone  = ""
+	AuthToken = "token"
+	AuthBasic = "basic"
+	AuthOidc  = "oidc"
+	AuthLdap  = "ldap"
+)
+
+var errNoCredentials = errors.New("No credentials supplied")
+
+// Principal is the authenticated caller of an API request.
+type Principal struct {
+	Name     string
+	ReadOnly bool   // may only use endpoints not changing the cluster or its configuration
+	Group    string // attribute:value of the server group the principal may change, the whole cluster if empty
+}
+
+func (p *Principal) String() string {
+	if p.ReadOnly {
+		return p.Name + " (read-only)"
+	}
+	if p.Group != "" {
+		return fmt.Sprintf("%s (group %s)", p.Name, p.Group)
+	}
+	return p.Name
+}
+
+// Authenticator checks credentials of an API request and returns the authenticated principal.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+	// Challenge is the WWW-Authenticate header value sent with 401 responses.
+	Challenge() string
+}
+
+// NewAuthenticator returns the auth provider selected by c.ApiAuth or nil if the API is open. Principals listed in
+// c.ApiReadOnly get read-only access, those in c.ApiGroups may only change their server group.
+func NewAuthenticator(c *config) (Authenticator, error) {
+	var authenticator Authenticator
+	var err error
+	switch c.ApiAuth {
+	case AuthNone:
+		return nil, nil
+	case AuthToken:
+		authenticator, err = NewTokenAuthenticator(c.ApiTokens, c.ApiReadOnlyTokens)
+	case AuthBasic:
+		authenticator, err = NewBasicAuthenticator(c.ApiUsers, c.ApiReadOnlyUsers)
+	case AuthOidc:
+		authenticator, err = NewOidcAuthenticator(c.OidcIssuer, c.OidcAudience, c.OidcJwksUrl)
+	case AuthLdap:
+		authenticator, err = NewLdapAuthenticator(c.LdapUrl, c.LdapUserDn)
+	default:
+		return nil, fmt.Errorf("Unknown auth provider %s, expected token|basic|oidc|ldap", c.ApiAuth)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ApiReadOnly != "" {
+		authenticator = &readOnlyPrincipals{Authenticator: authenticator, names: splitSet(c.ApiReadOnly)}
+	}
+	if c.ApiGroups != "" {
+		groups, err := ParseApiGroups(c.ApiGroups)
+		if err != nil {
+			return nil, err
+		}
+		authenticator = &groupPrincipals{Authenticator: authenticator, groups: groups}
+	}
+	return authenticator, nil
+}
+
+// ParseApiGroups parses principals scoped to server groups like "alice=team:a;token#1=team:b" into groups by principal.
+func ParseApiGroups(value string) (map[string]string, error) {
+	groups := make(map[string]string)
+	for _, pair := range strings.Split(value, ";") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || !strings.Contains(kv[1], ":") || strings.HasPrefix(kv[1], ":") {
+			return nil, fmt.Errorf("Invalid api group %s, expected principal=attribute:value", pair)
+		}
+		groups[kv[0]] = kv[1]
+	}
+	return groups, nil
+}
+
+// groupPrincipals scopes the listed principals authenticated by any provider to a server group.
+type groupPrincipals struct {
+	Authenticator
+	groups map[string]string
+}
+
+func (ga *groupPrincipals) Authenticate(r *http.Request) (*Principal, error) {
+	principal, err := ga.Authenticator.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	principal.Group = ga.groups[principal.Name]
+	return principal, nil
+}
+
+// groupScopedParams are the update parameters principals scoped to a server group may give, changing the resources
+// of their group.
+var groupScopedParams = map[string]bool{"group": true, "cpu": true, "mem": true, "dryRun": true}
+
+// checkGroupScope tells why a request changing the cluster is outside the server group of the principal, if so. Such
+// principals may only update cpu and mem of their group.
+func checkGroupScope(r *http.Request, principal *Principal) error {
+	if r.URL.Path != "/api/update" {
+		return fmt.Errorf("%s may only update group %s", principal.Name, principal.Group)
+	}
+
+	// the body is read for the check and again by the handler
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxUpdateBody))
+	if err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	checked := r.Clone(r.Context())
+	checked.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	queryParams, err := updateQuery(checked)
+	if err != nil {
+		return err
+	}
+	if group := queryParams.Get("group"); group != principal.Group {
+		return fmt.Errorf("%s may only update group %s, not %q", principal.Name, principal.Group, group)
+	}
+	for name := range queryParams {
+		if !groupScopedParams[name] {
+			return fmt.Errorf("%s may only update cpu and mem of group %s, not %s", principal.Name, principal.Group, name)
+		}
+	}
+	return nil
+}
+
+// readOnlyPrincipals restricts the listed principals authenticated by any provider to read-only access.
+type readOnlyPrincipals struct {
+	Authenticator
+	names map[string]bool
+}
+
+func (ra *readOnlyPrincipals) Authenticate(r *http.Request) (*Principal, error) {
+	principal, err := ra.Authenticator.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if ra.names[principal.Name] {
+		principal.ReadOnly = true
+	}
+	return principal, nil
+}
+
+func splitSet(values string) map[string]bool {
+	set := make(map[string]bool)
+	for _, value := range strings.Split(values, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			set[value] = true
+		}
+	}
+	return set
+}
+
+// TokenAuthenticator accepts bearer tokens from static lists of tokens with full and read-only access.
+type TokenAuthenticator struct {
+	tokens   []string
+	readOnly []string
+}
+
+func NewTokenAuthenticator(tokens string, readOnlyTokens string) (*TokenAuthenticator, error) {
+	authenticator := &TokenAuthenticator{
+		tokens:   splitTokens(tokens),
+		readOnly: splitTokens(readOnlyTokens),
+	}
+
+	if len(authenticator.tokens)+len(authenticator.readOnly) == 0 {
+		return nil, errors.New("--api.tokens or --api.readonly.tokens is required for token auth")
+	}
+	return authenticator, nil
+}
+
+func splitTokens(tokens string) []string {
+	split := make([]string, 0)
+	for _, token := range strings.Split(tokens, ",") {
+		if token != "" {
+			split = append(split, token)
+		}
+	}
+	return split
+}
+
+func (ta *TokenAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, errNoCredentials
+	}
+
+	for i, known := range ta.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+			return &Principal{Name: fmt.Sprintf("token#%d", i)}, nil
+		}
+	}
+	for i, known := range ta.readOnly {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(known)) == 1 {
+			return &Principal{Name: fmt.Sprintf("readonly-token#%d", i), ReadOnly: true}, nil
+		}
+	}
+
+	return nil, errors.New("Invalid token")
+}
+
+func (ta *TokenAuthenticator) Challenge() string {
+	return `Bearer realm="statsd-mesos-kafka"`
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+
+	return strings.TrimSpace(header[len("Bearer "):])
+}
+
+// BasicAuthenticator accepts HTTP basic credentials from static lists of users with full and read-only access.
+type BasicAuthenticator struct {
+	passwords map[string]string
+	readOnly  map[string]bool
+}
+
+// NewBasicAuthenticator takes comma separated user:password pairs.
+func NewBasicAuthenticator(users string, readOnlyUsers string) (*BasicAuthenticator, error) {
+	authenticator := &BasicAuthenticator{
+		passwords: make(map[string]string),
+		readOnly:  make(map[string]bool),
+	}
+	for _, list := range []struct {
+		users    string
+		readOnly bool
+	}{{users, false}, {readOnlyUsers, true}} {
+		for _, pair := range splitTokens(list.users) {
+			user := strings.SplitN(pair, ":", 2)
+			if len(user) != 2 || user[0] == "" || user[1] == "" {
+				return nil, fmt.Errorf("Invalid user %s, expected user:password", user[0])
+			}
+			authenticator.passwords[user[0]] = user[1]
+			authenticator.readOnly[user[0]] = list.readOnly
+		}
+	}
+
+	if len(authenticator.passwords) == 0 {
+		return nil, errors.New("--api.users or --api.readonly.users is required for basic auth")
+	}
+	return authenticator, nil
+}
+
+func (ba *BasicAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, errNoCredentials
+	}
+
+	known, exists := ba.passwords[user]
+	if !exists || subtle.ConstantTimeCompare([]byte(password), []byte(known)) != 1 {
+		return nil, errors.New("Invalid user or password")
+	}
+	return &Principal{Name: user, ReadOnly: ba.readOnly[user]}, nil
+}
+
+func (ba *BasicAuthenticator) Challenge() string {
+	return `Basic realm="statsd-mesos-kafka"`
+}
@@ -0,0 +1,278 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+	ldapBindReq    = 0x60
+	ldapBindResp   = 0x61
+	ldapSimpleAuth = 0x80
+	ldapExtReq     = 0x77
+	ldapExtResp    = 0x78
+	ldapExtName    = 0x80
+
+	ldapStartTlsOid = "1.3.6.1.4.1.1466.20037"
+	// responses to a bind are tiny, anything larger is not read into memory
+	berMaxLength = 64 * 1024
+)
+
+var ldapTimeout = 10 * time.Second
+
+// LdapAuthenticator checks HTTP basic credentials with an LDAP simple bind.
+// Passwords are never sent in clear text: ldaps:// connects with TLS and ldap:// upgrades with StartTLS before binding.
+type LdapAuthenticator struct {
+	address    string
+	serverName string
+	useTls     bool
+	userDn     string // DN template, %s is replaced with the user name
+}
+
+func NewLdapAuthenticator(ldapUrl string, userDn string) (*LdapAuthenticator, error) {
+	if ldapUrl == "" || !strings.Contains(userDn, "%s") {
+		return nil, errors.New("--api.ldap.url and --api.ldap.user.dn containing %s are required for ldap auth")
+	}
+
+	parsed, err := url.Parse(ldapUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	authenticator := &LdapAuthenticator{address: parsed.Host, serverName: parsed.Hostname(), userDn: userDn}
+	switch parsed.Scheme {
+	case "ldap":
+		if parsed.Port() == "" {
+			authenticator.address = net.JoinHostPort(parsed.Host, "389")
+		}
+	case "ldaps":
+		authenticator.useTls = true
+		if parsed.Port() == "" {
+			authenticator.address = net.JoinHostPort(parsed.Host, "636")
+		}
+	default:
+		return nil, fmt.Errorf("Invalid LDAP url %s, expected ldap:// or ldaps://", ldapUrl)
+	}
+
+	return authenticator, nil
+}
+
+func (la *LdapAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, errNoCredentials
+	}
+	// empty password would be an unauthenticated bind which always succeeds
+	if user == "" || password == "" {
+		return nil, errors.New("Empty user or password")
+	}
+
+	if err := la.bind(fmt.Sprintf(la.userDn, escapeDnValue(user)), password); err != nil {
+		return nil, err
+	}
+	return &Principal{Name: user}, nil
+}
+
+func (la *LdapAuthenticator) Challenge() string {
+	return `Basic realm="statsd-mesos-kafka"`
+}
+
+func (la *LdapAuthenticator) bind(dn string, password string) error {
+	var connection net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	if la.useTls {
+		connection, err = tls.DialWithDialer(dialer, "tcp", la.address, nil)
+	} else {
+		connection, err = dialer.Dial("tcp", la.address)
+	}
+	if err != nil {
+		return fmt.Errorf("LDAP connection failed: %s", err)
+	}
+	defer connection.Close()
+	connection.SetDeadline(time.Now().Add(ldapTimeout))
+
+	messageId := byte(1)
+	if !la.useTls {
+		if err := la.startTls(connection); err != nil {
+			return err
+		}
+		tlsConnection := tls.Client(connection, &tls.Config{ServerName: la.serverName})
+		if err := tlsConnection.Handshake(); err != nil {
+			return fmt.Errorf("LDAP StartTLS failed: %s", err)
+		}
+		connection = tlsConnection
+		messageId++
+	}
+
+	bindRequest := berEncode(ldapBindReq, concat(
+		berEncode(berInteger, []byte{3}),
+		berEncode(berOctetString, []byte(dn)),
+		berEncode(ldapSimpleAuth, []byte(password)),
+	))
+	message := berEncode(berSequence, concat(berEncode(berInteger, []byte{messageId}), bindRequest))
+	if _, err := connection.Write(message); err != nil {
+		return fmt.Errorf("LDAP bind failed: %s", err)
+	}
+
+	tag, content, err := berRead(bufio.NewReader(connection))
+	if err != nil || tag != berSequence {
+		return errors.New("Malformed LDAP response")
+	}
+
+	return parseResponse(content, ldapBindResp, "bind")
+}
+
+// startTls asks the server to upgrade a plain ldap:// connection before any credentials are sent.
+func (la *LdapAuthenticator) startTls(connection net.Conn) error {
+	extendedRequest := berEncode(ldapExtReq, berEncode(ldapExtName, []byte(ldapStartTlsOid)))
+	message := berEncode(berSequence, concat(berEncode(berInteger, []byte{1}), extendedRequest))
+	if _, err := connection.Write(message); err != nil {
+		return fmt.Errorf("LDAP StartTLS failed: %s", err)
+	}
+
+	// not buffered: the TLS handshake continues on the same connection
+	tag, content, err := berRead(connection)
+	if err != nil || tag != berSequence {
+		return errors.New("Malformed LDAP response")
+	}
+
+	return parseResponse(content, ldapExtResp, "StartTLS")
+}
+
+func parseResponse(content []byte, responseTag byte, operation string) error {
+	elements, err := berElements(content)
+	if err != nil || len(elements) < 2 || elements[1].tag != responseTag {
+		return fmt.Errorf("Malformed LDAP %s response", operation)
+	}
+
+	result, err := berElements(elements[1].content)
+	if err != nil || len(result) == 0 || result[0].tag != berEnumerated || len(result[0].content) == 0 {
+		return fmt.Errorf("Malformed LDAP %s response", operation)
+	}
+
+	code := 0
+	for _, b := range result[0].content {
+		code = code<<8 | int(b)
+	}
+	if code != 0 {
+		return fmt.Errorf("LDAP %s rejected with result code %d", operation, code)
+	}
+	return nil
+}
+
+type berElement struct {
+	tag     byte
+	content []byte
+}
+
+func berEncode(tag byte, content []byte) []byte {
+	length := len(content)
+	var header []byte
+	switch {
+	case length < 0x80:
+		header = []byte{tag, byte(length)}
+	case length <= 0xff:
+		header = []byte{tag, 0x81, byte(length)}
+	default:
+		header = []byte{tag, 0x82, byte(length >> 8), byte(length)}
+	}
+
+	return append(header, content...)
+}
+
+func berRead(reader io.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, nil, err
+	}
+
+	length := int(header[1])
+	if length&0x80 != 0 {
+		lengthBytes := make([]byte, length&0x7f)
+		if len(lengthBytes) > 4 {
+			return 0, nil, errors.New("BER length is too long")
+		}
+		if _, err := io.ReadFull(reader, lengthBytes); err != nil {
+			return 0, nil, err
+		}
+		length = 0
+		for _, b := range lengthBytes {
+			length = length<<8 | int(b)
+		}
+	}
+	if length > berMaxLength {
+		return 0, nil, fmt.Errorf("BER length %d exceeds %d", length, berMaxLength)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(reader, content); err != nil {
+		return 0, nil, err
+	}
+	return header[0], content, nil
+}
+
+func berElements(content []byte) ([]*berElement, error) {
+	reader := strings.NewReader(string(content))
+	elements := make([]*berElement, 0)
+	for reader.Len() > 0 {
+		tag, elementContent, err := berRead(reader)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, &berElement{tag, elementContent})
+	}
+
+	return elements, nil
+}
+
+func concat(parts ...[]byte) []byte {
+	result := make([]byte, 0)
+	for _, part := range parts {
+		result = append(result, part...)
+	}
+	return result
+}
+
+// escapeDnValue escapes characters with special meaning in a DN attribute value (RFC 4514).
+func escapeDnValue(value string) string {
+	var escaped []rune
+	for i, r := range value {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, r),
+			i == 0 && (r == ' ' || r == '#'),
+			i == len(value)-1 && r == ' ':
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, r)
+	}
+
+	return string(escaped)
+}
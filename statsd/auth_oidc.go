@@ -0,0 +1,270 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+// jwksRefreshInterval limits how often tokens with unknown key ids make the JWKS be fetched again.
+var jwksRefreshInterval = time.Minute
+
+// OidcAuthenticator validates RS256 signed OIDC bearer tokens against the issuer's JWKS.
+type OidcAuthenticator struct {
+	issuer   string
+	audience string
+	jwksUrl  string
+
+	keys       map[string]*rsa.PublicKey
+	refreshed  time.Time // last JWKS fetch
+	refreshing bool
+	keysLock   sync.Mutex
+}
+
+func NewOidcAuthenticator(issuer string, audience string, jwksUrl string) (*OidcAuthenticator, error) {
+	if issuer == "" || audience == "" {
+		return nil, errors.New("--api.oidc.issuer and --api.oidc.audience are required for oidc auth")
+	}
+
+	issuer = strings.TrimSuffix(issuer, "/")
+	if jwksUrl == "" {
+		discovered, err := discoverJwksUrl(issuer)
+		if err != nil {
+			return nil, err
+		}
+		jwksUrl = discovered
+	}
+
+	return &OidcAuthenticator{
+		issuer:   issuer,
+		audience: audience,
+		jwksUrl:  jwksUrl,
+		keys:     make(map[string]*rsa.PublicKey),
+	}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+}
+
+func (oa *OidcAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, errNoCredentials
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("Malformed token")
+	}
+
+	header := new(jwtHeader)
+	if err := decodeJwtPart(parts[0], header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("Unsupported token algorithm %s", header.Alg)
+	}
+
+	key, err := oa.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("Malformed token signature")
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature); err != nil {
+		return nil, errors.New("Invalid token signature")
+	}
+
+	claims := new(jwtClaims)
+	if err := decodeJwtPart(parts[1], claims); err != nil {
+		return nil, err
+	}
+	if err := oa.validate(claims); err != nil {
+		return nil, err
+	}
+
+	return &Principal{Name: claims.Subject}, nil
+}
+
+func (oa *OidcAuthenticator) Challenge() string {
+	return `Bearer realm="statsd-mesos-kafka"`
+}
+
+func (oa *OidcAuthenticator) validate(claims *jwtClaims) error {
+	now := time.Now().Unix()
+	if strings.TrimSuffix(claims.Issuer, "/") != oa.issuer {
+		return fmt.Errorf("Unexpected token issuer %s", claims.Issuer)
+	}
+	if claims.ExpiresAt == 0 || now >= claims.ExpiresAt {
+		return errors.New("Token expired")
+	}
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return errors.New("Token is not valid yet")
+	}
+
+	var audiences []string
+	var audience string
+	if err := json.Unmarshal(claims.Audience, &audience); err == nil {
+		audiences = []string{audience}
+	} else if err := json.Unmarshal(claims.Audience, &audiences); err != nil {
+		return errors.New("Malformed token audience")
+	}
+	for _, aud := range audiences {
+		if aud == oa.audience {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Token is not issued for audience %s", oa.audience)
+}
+
+// key returns the signing key with the given id, refreshing the JWKS if the key is unknown to handle key rotation.
+// Refreshes happen at most once per jwksRefreshInterval and outside the lock, so tokens with made up key ids neither
+// make the issuer be called on every request nor hold up authentication of other requests.
+func (oa *OidcAuthenticator) key(kid string) (*rsa.PublicKey, error) {
+	oa.keysLock.Lock()
+	key, exists := oa.keys[kid]
+	if exists || oa.refreshing || time.Since(oa.refreshed) < jwksRefreshInterval {
+		oa.keysLock.Unlock()
+		if !exists {
+			return nil, fmt.Errorf("Unknown token key id %s", kid)
+		}
+		return key, nil
+	}
+	oa.refreshing = true
+	oa.keysLock.Unlock()
+
+	keys, err := fetchJwks(oa.jwksUrl)
+
+	oa.keysLock.Lock()
+	defer oa.keysLock.Unlock()
+	oa.refreshing = false
+	oa.refreshed = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	oa.keys = keys
+
+	key, exists = oa.keys[kid]
+	if !exists {
+		return nil, fmt.Errorf("Unknown token key id %s", kid)
+	}
+	return key, nil
+}
+
+func discoverJwksUrl(issuer string) (string, error) {
+	discovery := struct {
+		JwksUri string `json:"jwks_uri"`
+	}{}
+	if err := getJson(oidcClient, issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return "", fmt.Errorf("OIDC discovery failed: %s", err)
+	}
+	if discovery.JwksUri == "" {
+		return "", errors.New("OIDC discovery document has no jwks_uri")
+	}
+
+	return discovery.JwksUri, nil
+}
+
+func fetchJwks(url string) (map[string]*rsa.PublicKey, error) {
+	jwks := struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}{}
+	if err := getJson(oidcClient, url, &jwks); err != nil {
+		return nil, fmt.Errorf("Failed to fetch JWKS: %s", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			continue
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return keys, nil
+}
+
+func decodeJwtPart(part string, v interface{}) error {
+	bytes, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("Malformed token")
+	}
+
+	if err := json.Unmarshal(bytes, v); err != nil {
+		return errors.New("Malformed token")
+	}
+	return nil
+}
+
+func getJson(client *http.Client, url string, v interface{}) error {
+	response, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(v)
+}
@@ -0,0 +1,117 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	relaunchBackoffMin = 10 * time.Second
+	relaunchBackoffMax = 5 * time.Minute
+)
+
+// relaunchBackoff delays relaunching servers on hosts where they keep failing. The delay doubles with each failure in
+// a row and resets once the relaunched server reports stats.
+type relaunchBackoff struct {
+	failures map[string]int
+	until    map[string]time.Time
+	lock     sync.Mutex
+}
+
+func newRelaunchBackoff() *relaunchBackoff {
+	return &relaunchBackoff{
+		failures: make(map[string]int),
+		until:    make(map[string]time.Time),
+	}
+}
+
+// Failed records a failure on the host and returns how long relaunching is delayed.
+func (b *relaunchBackoff) Failed(host string) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures[host]++
+	delay := relaunchBackoffMin
+	for i := 1; i < b.failures[host] && delay < relaunchBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > relaunchBackoffMax {
+		delay = relaunchBackoffMax
+	}
+
+	b.until[host] = time.Now().Add(delay)
+	return delay
+}
+
+func (b *relaunchBackoff) Reset(host string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	delete(b.failures, host)
+	delete(b.until, host)
+}
+
+// Compact forgets failures on hosts whose relaunch delay ended before the given time and returns how many.
+func (b *relaunchBackoff) Compact(before time.Time) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	dropped := 0
+	for host := range b.failures {
+		if b.until[host].Before(before) {
+			delete(b.failures, host)
+			delete(b.until, host)
+			dropped++
+		}
+	}
+	return dropped
+}
+
+// Remaining returns how long relaunching on the host is still delayed.
+func (b *relaunchBackoff) Remaining(host string) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if remaining := b.until[host].Sub(time.Now()); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+func (b *relaunchBackoff) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	hosts := make([]string, 0, len(b.failures))
+	for host := range b.failures {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	str := ""
+	for _, host := range hosts {
+		str += fmt.Sprintf("  %s: %d failures in a row", host, b.failures[host])
+		if remaining := b.until[host].Sub(time.Now()); remaining > 0 {
+			str += fmt.Sprintf(", relaunch in %s", (remaining+time.Second-1)/time.Second*time.Second)
+		}
+		str += "\n"
+	}
+	return str
+}
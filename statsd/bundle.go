@@ -0,0 +1,133 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Bundle packages the scheduler binary, executor binaries found in dir and extra files into
+// statsd-mesos-kafka-<version>.tar.gz with a MANIFEST listing SHA-256 checksums of every file.
+// Entries are sorted and share a single modification time so the same inputs give the same tarball. Relative paths are
+// taken from dir, absolute ones as given. Files are stored by base name, which must be unique. Nothing is left behind
+// on failure.
+func Bundle(dir string, scheduler string, files []string, version string) (name string, err error) {
+	entries := []string{scheduler}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	executors := 0
+	for _, info := range infos {
+		if !info.IsDir() && executorMask.MatchString(info.Name()) {
+			entries = append(entries, info.Name())
+			executors++
+		}
+	}
+	if executors == 0 {
+		return "", fmt.Errorf("%s not found in %s", executorMask, dir)
+	}
+	entries = append(entries, files...)
+	sort.Strings(entries[1:])
+
+	names := map[string]string{"MANIFEST": "MANIFEST"}
+	for _, entry := range entries {
+		if previous, exists := names[filepath.Base(entry)]; exists {
+			return "", fmt.Errorf("%s and %s would both be bundled as %s", previous, entry, filepath.Base(entry))
+		}
+		names[filepath.Base(entry)] = entry
+	}
+
+	name = fmt.Sprintf("statsd-mesos-kafka-%s.tar.gz", version)
+	path := filepath.Join(dir, name)
+	out, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if err != nil {
+			out.Close()
+			os.Remove(path)
+		}
+	}()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	modTime := time.Unix(0, 0)
+
+	prefix := fmt.Sprintf("statsd-mesos-kafka-%s/", version)
+	manifest := fmt.Sprintf("version: %s\n", version)
+	for _, entry := range entries {
+		if !filepath.IsAbs(entry) {
+			entry = filepath.Join(dir, entry)
+		}
+		contents, err := ioutil.ReadFile(entry)
+		if err != nil {
+			return "", err
+		}
+		info, err := os.Stat(entry)
+		if err != nil {
+			return "", err
+		}
+
+		checksum := sha256.Sum256(contents)
+		manifest += fmt.Sprintf("%s  %s\n", hex.EncodeToString(checksum[:]), filepath.Base(entry))
+
+		if err := writeTarEntry(tw, prefix+filepath.Base(entry), contents, int64(info.Mode().Perm()), modTime); err != nil {
+			return "", err
+		}
+	}
+
+	if err := writeTarEntry(tw, prefix+"MANIFEST", []byte(manifest), 0644, modTime); err != nil {
+		return "", err
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+func writeTarEntry(tw *tar.Writer, name string, contents []byte, mode int64, modTime time.Time) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    mode,
+		Size:    int64(len(contents)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := tw.Write(contents)
+	return err
+}
@@ -0,0 +1,129 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultQueueSize     = 100
+	defaultBurstDuration = 10 * time.Second
+)
+
+// burstBuffer absorbs traffic spikes in front of a shard queue. Records go to the queue directly while it has room.
+// Once it is full, up to limit records are held in a scratch buffer instead of blocking the server, for at most
+// duration, and moved to the queue in order as it drains. After the burst ends the buffer must drain completely,
+// shrinking back to nothing, before absorbing the next one. Meanwhile the server blocks as without a burst buffer.
+type burstBuffer struct {
+	limit    int
+	duration time.Duration
+	queue    chan *metricRecord
+	records  []*metricRecord
+	moving   bool      // a record taken from records is being moved to the queue
+	started  time.Time // start of the current burst
+	closed   bool
+	changed  *sync.Cond
+	lock     sync.Mutex
+
+	absorbed int64 // records held in the scratch buffer
+	bursts   int64
+	peak     int // most records held at once
+}
+
+func newBurstBuffer(limit int, duration time.Duration, queue chan *metricRecord) *burstBuffer {
+	buffer := &burstBuffer{limit: limit, duration: duration, queue: queue}
+	buffer.changed = sync.NewCond(&buffer.lock)
+	go buffer.drain()
+	return buffer
+}
+
+func (b *burstBuffer) put(record *metricRecord) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for {
+		if len(b.records) == 0 && !b.moving {
+			select {
+			case b.queue <- record:
+				return
+			default:
+			}
+			b.started = time.Now()
+			b.bursts++
+		}
+
+		if len(b.records) < b.limit && time.Since(b.started) < b.duration {
+			b.records = append(b.records, record)
+			b.absorbed++
+			if len(b.records) > b.peak {
+				b.peak = len(b.records)
+			}
+			b.changed.Broadcast()
+			return
+		}
+		b.changed.Wait()
+	}
+}
+
+// drain moves records to the queue and closes it once the buffer is closed and empty.
+func (b *burstBuffer) drain() {
+	b.lock.Lock()
+	for {
+		for len(b.records) == 0 && !b.closed {
+			b.changed.Wait()
+		}
+		if len(b.records) == 0 {
+			b.lock.Unlock()
+			close(b.queue)
+			return
+		}
+
+		record := b.records[0]
+		b.records[0] = nil
+		b.records = b.records[1:]
+		if len(b.records) == 0 {
+			b.records = nil // release the scratch memory
+		}
+		b.moving = true
+		b.changed.Broadcast()
+		b.lock.Unlock()
+
+		b.queue <- record
+
+		b.lock.Lock()
+		b.moving = false
+		b.changed.Broadcast()
+	}
+}
+
+// close closes the queue once the records held are moved to it.
+func (b *burstBuffer) close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.closed = true
+	b.changed.Broadcast()
+}
+
+// stats returns the records held now, ever absorbed, the number of bursts and the most records held at once.
+func (b *burstBuffer) stats() (held int, absorbed int64, bursts int64, peak int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return len(b.records), b.absorbed, b.bursts, b.peak
+}
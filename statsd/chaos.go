@@ -0,0 +1,92 @@
+//go:build chaos
+// +build chaos
+
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/golang/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// Failure injection for development builds. Settings are read from the environment so they reach both the scheduler
+// and executors, which get them forwarded in their command environment:
+//
+//	SM_CHAOS_DROP_STATUS   fraction (0..1) of status updates the scheduler ignores
+//	SM_CHAOS_OFFER_DELAY   duration to sleep before processing each batch of offers
+//	SM_CHAOS_FAIL_PRODUCE  fail every Nth produce of the executor
+var chaosVars = []string{"SM_CHAOS_DROP_STATUS", "SM_CHAOS_OFFER_DELAY", "SM_CHAOS_FAIL_PRODUCE"}
+
+var (
+	chaosDropStatus   float64
+	chaosOfferDelay   time.Duration
+	chaosFailProduce  int64
+	chaosProduceCount int64
+)
+
+func init() {
+	chaosDropStatus, _ = strconv.ParseFloat(os.Getenv("SM_CHAOS_DROP_STATUS"), 64)
+	chaosOfferDelay, _ = time.ParseDuration(os.Getenv("SM_CHAOS_OFFER_DELAY"))
+	chaosFailProduce, _ = strconv.ParseInt(os.Getenv("SM_CHAOS_FAIL_PRODUCE"), 10, 64)
+}
+
+func chaosDropStatusUpdate() bool {
+	return chaosDropStatus > 0 && rand.Float64() < chaosDropStatus
+}
+
+func chaosDelayOffers(logger log.LoggerInterface) {
+	if chaosOfferDelay > 0 {
+		logger.Infof("[chaos] delaying offers for %s", chaosOfferDelay)
+		time.Sleep(chaosOfferDelay)
+	}
+}
+
+func chaosProduceFailure() error {
+	if chaosFailProduce <= 0 {
+		return nil
+	}
+
+	if count := atomic.AddInt64(&chaosProduceCount, 1); count%chaosFailProduce == 0 {
+		return fmt.Errorf("[chaos] injected failure of produce #%d", count)
+	}
+	return nil
+}
+
+func chaosEnvironment() *mesos.Environment {
+	environment := &mesos.Environment{}
+	for _, name := range chaosVars {
+		if value := os.Getenv(name); value != "" {
+			environment.Variables = append(environment.Variables, &mesos.Environment_Variable{
+				Name:  proto.String(name),
+				Value: proto.String(value),
+			})
+		}
+	}
+
+	if len(environment.Variables) == 0 {
+		return nil
+	}
+	return environment
+}
@@ -0,0 +1,34 @@
+//go:build !chaos
+// +build !chaos
+
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	log "github.com/cihub/seelog"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// Failure injection is compiled in only with the chaos build tag.
+
+func chaosDropStatusUpdate() bool { return false }
+
+func chaosDelayOffers(log.LoggerInterface) {}
+
+func chaosProduceFailure() error { return nil }
+
+func chaosEnvironment() *mesos.Environment { return nil }
@@ -0,0 +1,110 @@
+//go:build chaos
+// +build chaos
+
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"testing"
+
+	log "github.com/cihub/seelog"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+func init() {
+	Logger = log.Disabled
+}
+
+// newChaosScheduler returns an active scheduler registered with a fake driver, with its config changed by configure.
+// Its background work stops with s.cancel.
+func newChaosScheduler(configure func(*config)) (*Scheduler, *FakeDriver) {
+	s, driver := NewFakeScheduler()
+	s.config.BrokerList = "kafka:9092"
+	s.config.Topic = "metrics"
+	if configure != nil {
+		configure(s.config)
+	}
+
+	driver.Register()
+	s.SetActive(true)
+	return s, driver
+}
+
+func TestChaosLostTaskIsRelaunchedElsewhere(t *testing.T) {
+	s, driver := newChaosScheduler(func(c *config) { c.Instances = 1 })
+	defer s.cancel()
+
+	driver.Offer("slave0", 4, 4096)
+	if len(driver.Launched) != 1 {
+		t.Fatalf("expected a task launched on slave0, got %d", len(driver.Launched))
+	}
+	taskId := driver.Launched[0].GetTaskId().GetValue()
+	driver.Update(taskId, mesos.TaskState_TASK_RUNNING)
+
+	driver.Offer("slave1", 4, 4096)
+	if len(driver.Launched) != 1 {
+		t.Fatalf("expected no second task while one instance runs, got %d", len(driver.Launched))
+	}
+
+	driver.Update(taskId, mesos.TaskState_TASK_LOST)
+	if s.cluster.Exists("slave0") {
+		t.Fatal("expected the lost task to be removed")
+	}
+
+	driver.Offer("slave0", 4, 4096)
+	if len(driver.Launched) != 1 {
+		t.Fatal("expected slave0 to back off after losing its task")
+	}
+	driver.Offer("slave1", 4, 4096)
+	if len(driver.Launched) != 2 || !s.cluster.Exists("slave1") {
+		t.Fatal("expected the lost task to be relaunched on slave1")
+	}
+}
+
+func TestChaosDroppedStatusUpdatesKeepTasks(t *testing.T) {
+	s, driver := newChaosScheduler(nil)
+	defer s.cancel()
+	defer func(drop float64) { chaosDropStatus = drop }(chaosDropStatus)
+
+	driver.Offer("slave0", 4, 4096)
+	if len(driver.Launched) != 1 {
+		t.Fatalf("expected a task launched on slave0, got %d", len(driver.Launched))
+	}
+
+	chaosDropStatus = 1
+	driver.Update(driver.Launched[0].GetTaskId().GetValue(), mesos.TaskState_TASK_FAILED)
+	if !s.cluster.Exists("slave0") {
+		t.Fatal("expected the dropped failure not to remove the task")
+	}
+}
+
+func TestChaosProduceFailsEveryNth(t *testing.T) {
+	defer func(fail int64, count int64) {
+		chaosFailProduce, chaosProduceCount = fail, count
+	}(chaosFailProduce, chaosProduceCount)
+	chaosFailProduce, chaosProduceCount = 3, 0
+
+	failures := 0
+	for i := 0; i < 9; i++ {
+		if chaosProduceFailure() != nil {
+			failures++
+		}
+	}
+	if failures != 3 {
+		t.Fatalf("expected 3 of 9 produces to fail, got %d", failures)
+	}
+}
@@ -0,0 +1,222 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+// Package client talks to the scheduler HTTP API. It doesn't depend on Mesos or Kafka libraries, so API clients like
+// the CLI build on any platform.
+package client
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+type ApiRequest struct {
+	url    string
+	params map[string]string
+	ctx    context.Context
+}
+
+func NewApiRequest(url string) *ApiRequest {
+	return &ApiRequest{
+		url:    url,
+		params: make(map[string]string),
+	}
+}
+
+func (r *ApiRequest) AddParam(key string, value interface{}) {
+	str := fmt.Sprintf("%s", value)
+	if str != "" {
+		r.params[key] = str
+	}
+}
+
+// WithContext makes Get give up and close the connection once the context is done, which cancels waiting on the server.
+func (r *ApiRequest) WithContext(ctx context.Context) *ApiRequest {
+	r.ctx = ctx
+	return r
+}
+
+func (r *ApiRequest) Get() *ApiResponse {
+	return r.send("GET", "", nil)
+}
+
+// Post sends the body of the given content type along with the params.
+func (r *ApiRequest) Post(contentType string, body io.Reader) *ApiResponse {
+	return r.send("POST", contentType, body)
+}
+
+func (r *ApiRequest) send(method string, contentType string, body io.Reader) *ApiResponse {
+	response, err := r.do(method, contentType, body)
+	if err != nil {
+		return NewApiResponse(false, err.Error())
+	}
+	defer response.Body.Close()
+
+	return readResponse(response)
+}
+
+// Stream reads the server-sent events the request responds with, passing the data of each event to handle until the
+// stream or the context ends. The data of an end event is returned as error.
+func (r *ApiRequest) Stream(handle func(data string)) error {
+	response, err := r.do("GET", "", nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if !strings.HasPrefix(response.Header.Get("Content-Type"), "text/event-stream") {
+		return readResponse(response).Err()
+	}
+
+	event := ""
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data := strings.TrimPrefix(line, "data: ")
+			if event == "end" {
+				return errors.New(data)
+			}
+			handle(data)
+		case line == "":
+			event = ""
+		}
+	}
+
+	if r.ctx != nil && r.ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+func (r *ApiRequest) do(method string, contentType string, body io.Reader) (*http.Response, error) {
+	values := url.Values{}
+	for key, value := range r.params {
+		values.Set(key, value)
+	}
+	queryString := values.Encode()
+
+	url := fmt.Sprintf("%s?%s", r.url, queryString)
+	request, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	setCredentials(request)
+	if r.ctx != nil {
+		request = request.WithContext(r.ctx)
+	}
+
+	client, err := httpClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(request)
+}
+
+// httpClient trusts the PEM certificates in the SM_API_CA file in addition to the system ones if set, e.g. for a
+// scheduler serving the API with a self-signed certificate.
+func httpClient() (*http.Client, error) {
+	file := os.Getenv("SM_API_CA")
+	if file == "" {
+		return http.DefaultClient, nil
+	}
+
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read SM_API_CA: %s", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in SM_API_CA file %s", file)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return &http.Client{Transport: transport}, nil
+}
+
+func readResponse(response *http.Response) *ApiResponse {
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return NewApiResponse(false, err.Error())
+	}
+
+	apiResponse := new(ApiResponse)
+	err = json.Unmarshal(responseBody, apiResponse)
+	if err != nil {
+		return NewApiResponse(false, err.Error())
+	}
+
+	return apiResponse
+}
+
+// setCredentials authenticates requests with SM_API_TOKEN bearer token or SM_API_USER/SM_API_PASSWORD basic auth if set.
+func setCredentials(request *http.Request) {
+	if token := os.Getenv("SM_API_TOKEN"); token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	} else if user := os.Getenv("SM_API_USER"); user != "" {
+		request.SetBasicAuth(user, os.Getenv("SM_API_PASSWORD"))
+	}
+}
+
+type ApiResponse struct {
+	Success bool
+	Message string
+	Code    string          `json:",omitempty"` // identifies the error of failed responses, see ErrorCodes
+	Data    json.RawMessage `json:",omitempty"` // structured result for endpoints having one, Message describes it for humans
+}
+
+func NewApiResponse(success bool, message string) *ApiResponse {
+	return &ApiResponse{
+		Success: success,
+		Message: message,
+	}
+}
+
+// Err returns nil for successful responses, otherwise an error with the message matching the error the scheduler
+// failed with, e.g. errors.Is(response.Err(), ErrHostNotFound).
+func (r *ApiResponse) Err() error {
+	if r.Success {
+		return nil
+	}
+
+	for kind, code := range ErrorCodes {
+		if code == r.Code {
+			return &Error{Kind: kind, Message: r.Message}
+		}
+	}
+	return errors.New(r.Message)
+}
@@ -0,0 +1,50 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package client
+
+import (
+	"errors"
+)
+
+// Errors returned by scheduler operations, matched with errors.Is. Failed API responses carry the error code below, so
+// clients get the same errors back from ApiResponse.Err.
+var (
+	ErrHostNotFound          = errors.New("host not found")
+	ErrConfigIncomplete      = errors.New("configuration incomplete")
+	ErrNotActive             = errors.New("scheduler not active")
+	ErrStateStoreUnavailable = errors.New("state store unavailable")
+)
+
+var ErrorCodes = map[error]string{
+	ErrHostNotFound:          "host-not-found",
+	ErrConfigIncomplete:      "config-incomplete",
+	ErrNotActive:             "not-active",
+	ErrStateStoreUnavailable: "state-store-unavailable",
+}
+
+// Error keeps the message shown to users while matching one of the errors above.
+type Error struct {
+	Kind    error
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
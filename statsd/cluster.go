@@ -18,21 +18,59 @@ package statsd
 import (
 	"fmt"
 	mesos "github.com/mesos/mesos-go/mesosproto"
+	"sort"
 	"sync"
+	"time"
 )
 
-type Cluster struct {
+// statsHistorySize is the number of stats reports kept per host, an hour with the default report interval.
+var statsHistorySize = 120
+
+// ClusterView tells where servers and standby tasks run and what they last reported.
+type ClusterView interface {
+	Exists(hostname string) bool
+	GetStats(hostname string) *ExecutorStats
+	GetStatsHistory(hostname string) []*ExecutorStats
+	GetTasksByHost() map[string]*mesos.TaskInfo
+	GetStandbyByHost() map[string]*mesos.TaskInfo
+	GetAllTasks() []*mesos.TaskInfo
+	GetStandby(hostname string) *mesos.TaskInfo
+	StandbyCount() int
+}
+
+// Cluster is the placement the scheduler maintains as it launches and loses tasks.
+type Cluster interface {
+	ClusterView
+	Add(hostname string, task *mesos.TaskInfo)
+	Remove(hostname string)
+	SetStats(hostname string, stats *ExecutorStats)
+	CompactStats(before time.Time) int
+	AddStandby(hostname string, task *mesos.TaskInfo)
+	RemoveStandby(hostname string)
+	ActivateStandby(hostname string) *mesos.TaskInfo
+}
+
+// memoryCluster keeps the placement in memory.
+type memoryCluster struct {
 	tasks    map[string]*mesos.TaskInfo
+	standby  map[string]*mesos.TaskInfo // idle tasks ready to replace the active task on the same host
+	stats    map[string][]*ExecutorStats
 	taskLock sync.Mutex
 }
 
-func NewCluster() *Cluster {
-	return &Cluster{
-		tasks: make(map[string]*mesos.TaskInfo),
+func NewCluster() Cluster {
+	return newMemoryCluster()
+}
+
+func newMemoryCluster() *memoryCluster {
+	return &memoryCluster{
+		tasks:   make(map[string]*mesos.TaskInfo),
+		standby: make(map[string]*mesos.TaskInfo),
+		stats:   make(map[string][]*ExecutorStats),
 	}
 }
 
-func (c *Cluster) Exists(hostname string) bool {
+func (c *memoryCluster) Exists(hostname string) bool {
 	c.taskLock.Lock()
 	defer c.taskLock.Unlock()
 
@@ -40,7 +78,7 @@ func (c *Cluster) Exists(hostname string) bool {
 	return exists
 }
 
-func (c *Cluster) Add(hostname string, task *mesos.TaskInfo) {
+func (c *memoryCluster) Add(hostname string, task *mesos.TaskInfo) {
 	c.taskLock.Lock()
 	defer c.taskLock.Unlock()
 
@@ -52,14 +90,92 @@ func (c *Cluster) Add(hostname string, task *mesos.TaskInfo) {
 	c.tasks[hostname] = task
 }
 
-func (c *Cluster) Remove(hostname string) {
+func (c *memoryCluster) Remove(hostname string) {
 	c.taskLock.Lock()
 	defer c.taskLock.Unlock()
 
 	delete(c.tasks, hostname)
+	delete(c.stats, hostname)
+}
+
+func (c *memoryCluster) SetStats(hostname string, stats *ExecutorStats) {
+	c.taskLock.Lock()
+	defer c.taskLock.Unlock()
+
+	if _, exists := c.tasks[hostname]; exists {
+		history := append(c.stats[hostname], stats)
+		if len(history) > statsHistorySize {
+			history = history[len(history)-statsHistorySize:]
+		}
+		c.stats[hostname] = history
+	}
+}
+
+// CompactStats drops stats reported before the given time and returns how many were dropped.
+func (c *memoryCluster) CompactStats(before time.Time) int {
+	c.taskLock.Lock()
+	defer c.taskLock.Unlock()
+
+	dropped := 0
+	for hostname, history := range c.stats {
+		kept := history[:0]
+		for _, stats := range history {
+			if stats.Timestamp >= before.Unix() {
+				kept = append(kept, stats)
+			}
+		}
+		dropped += len(history) - len(kept)
+		c.stats[hostname] = kept
+	}
+	return dropped
+}
+
+// GetStats returns the latest stats reported from the host.
+func (c *memoryCluster) GetStats(hostname string) *ExecutorStats {
+	c.taskLock.Lock()
+	defer c.taskLock.Unlock()
+
+	history := c.stats[hostname]
+	if len(history) == 0 {
+		return nil
+	}
+	return history[len(history)-1]
+}
+
+// GetStatsHistory returns stats reported from the host, oldest first.
+func (c *memoryCluster) GetStatsHistory(hostname string) []*ExecutorStats {
+	c.taskLock.Lock()
+	defer c.taskLock.Unlock()
+
+	return append([]*ExecutorStats(nil), c.stats[hostname]...)
+}
+
+func (c *memoryCluster) GetTasksByHost() map[string]*mesos.TaskInfo {
+	c.taskLock.Lock()
+	defer c.taskLock.Unlock()
+
+	tasks := make(map[string]*mesos.TaskInfo)
+	for hostname, task := range c.tasks {
+		tasks[hostname] = task
+	}
+
+	return tasks
+}
+
+func (c *memoryCluster) GetStandbyByHost() map[string]*mesos.TaskInfo {
+	c.taskLock.Lock()
+	defer c.taskLock.Unlock()
+
+	tasks := make(map[string]*mesos.TaskInfo)
+	for hostname, task := range c.standby {
+		tasks[hostname] = task
+	}
+
+	return tasks
 }
 
-func (c *Cluster) GetAllTasks() []*mesos.TaskInfo {
+// GetAllTasks returns active and standby tasks.
+func (c *memoryCluster) GetAllTasks() []*mesos.TaskInfo {
 	c.taskLock.Lock()
 	defer c.taskLock.Unlock()
 
@@ -67,6 +183,101 @@ func (c *Cluster) GetAllTasks() []*mesos.TaskInfo {
 	for _, task := range c.tasks {
 		tasks = append(tasks, task)
 	}
+	for _, task := range c.standby {
+		tasks = append(tasks, task)
+	}
 
 	return tasks
 }
+
+func (c *memoryCluster) AddStandby(hostname string, task *mesos.TaskInfo) {
+	c.taskLock.Lock()
+	defer c.taskLock.Unlock()
+
+	c.standby[hostname] = task
+}
+
+func (c *memoryCluster) RemoveStandby(hostname string) {
+	c.taskLock.Lock()
+	defer c.taskLock.Unlock()
+
+	delete(c.standby, hostname)
+}
+
+func (c *memoryCluster) GetStandby(hostname string) *mesos.TaskInfo {
+	c.taskLock.Lock()
+	defer c.taskLock.Unlock()
+
+	return c.standby[hostname]
+}
+
+func (c *memoryCluster) StandbyCount() int {
+	c.taskLock.Lock()
+	defer c.taskLock.Unlock()
+
+	return len(c.standby)
+}
+
+// ActivateStandby makes the standby task of the host its active task. Returns nil if the host has no standby task.
+func (c *memoryCluster) ActivateStandby(hostname string) *mesos.TaskInfo {
+	c.taskLock.Lock()
+	defer c.taskLock.Unlock()
+
+	task, exists := c.standby[hostname]
+	if !exists {
+		return nil
+	}
+
+	delete(c.standby, hostname)
+	c.tasks[hostname] = task
+	delete(c.stats, hostname)
+	return task
+}
+
+// hostSet is a set of hostnames safe for concurrent use.
+type hostSet struct {
+	hosts map[string]bool
+	lock  sync.Mutex
+}
+
+func newHostSet() *hostSet {
+	return &hostSet{hosts: make(map[string]bool)}
+}
+
+// Add adds the host and tells whether it was not in the set yet.
+func (h *hostSet) Add(host string) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.hosts[host] {
+		return false
+	}
+	h.hosts[host] = true
+	return true
+}
+
+func (h *hostSet) Remove(host string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	delete(h.hosts, host)
+}
+
+func (h *hostSet) Contains(host string) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.hosts[host]
+}
+
+func (h *hostSet) List() []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	hosts := make([]string, 0, len(h.hosts))
+	for host := range h.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
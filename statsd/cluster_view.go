@@ -0,0 +1,165 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+	utils "github.com/elodina/go-mesos-utils"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// clusterViewTtl is how long views outside the scheduler use a placement before loading it again.
+var clusterViewTtl = 5 * time.Second
+
+// ClusterSnapshot is the placement at one point in time, as served at /api/cluster.
+type ClusterSnapshot struct {
+	Tasks   map[string]*mesos.TaskInfo // hostname -> task
+	Standby map[string]*mesos.TaskInfo // hostname -> task
+	Stats   map[string]*ExecutorStats  // hostname -> latest stats, not persisted with state
+}
+
+func snapshotCluster(view ClusterView) *ClusterSnapshot {
+	snapshot := &ClusterSnapshot{
+		Tasks:   view.GetTasksByHost(),
+		Standby: view.GetStandbyByHost(),
+		Stats:   make(map[string]*ExecutorStats),
+	}
+	for hostname := range snapshot.Tasks {
+		if stats := view.GetStats(hostname); stats != nil {
+			snapshot.Stats[hostname] = stats
+		}
+	}
+	return snapshot
+}
+
+// cachedView serves a snapshot loaded elsewhere, reloading it once it is older than clusterViewTtl. Reads between
+// reloads are consistent with each other. The last snapshot is kept if reloading fails.
+type cachedView struct {
+	load   func() (*ClusterSnapshot, error)
+	logger log.LoggerInterface
+
+	cluster *memoryCluster
+	loaded  time.Time
+	lock    sync.Mutex
+}
+
+func newCachedView(load func() (*ClusterSnapshot, error), logger log.LoggerInterface) *cachedView {
+	return &cachedView{load: load, logger: logger, cluster: newMemoryCluster()}
+}
+
+func (v *cachedView) current() *memoryCluster {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if time.Since(v.loaded) < clusterViewTtl {
+		return v.cluster
+	}
+
+	snapshot, err := v.load()
+	if err != nil {
+		v.logger.Warnf("Failed to load cluster view, using the one from %s: %s", v.loaded.Format(time.RFC3339), err)
+		return v.cluster
+	}
+
+	cluster := newMemoryCluster()
+	for hostname, task := range snapshot.Tasks {
+		cluster.Add(hostname, task)
+	}
+	for hostname, task := range snapshot.Standby {
+		cluster.AddStandby(hostname, task)
+	}
+	for hostname, stats := range snapshot.Stats {
+		cluster.SetStats(hostname, stats)
+	}
+	v.cluster = cluster
+	v.loaded = time.Now()
+	return cluster
+}
+
+func (v *cachedView) Exists(hostname string) bool {
+	return v.current().Exists(hostname)
+}
+
+func (v *cachedView) GetStats(hostname string) *ExecutorStats {
+	return v.current().GetStats(hostname)
+}
+
+func (v *cachedView) GetStatsHistory(hostname string) []*ExecutorStats {
+	return v.current().GetStatsHistory(hostname)
+}
+
+func (v *cachedView) GetTasksByHost() map[string]*mesos.TaskInfo {
+	return v.current().GetTasksByHost()
+}
+
+func (v *cachedView) GetStandbyByHost() map[string]*mesos.TaskInfo {
+	return v.current().GetStandbyByHost()
+}
+
+func (v *cachedView) GetAllTasks() []*mesos.TaskInfo {
+	return v.current().GetAllTasks()
+}
+
+func (v *cachedView) GetStandby(hostname string) *mesos.TaskInfo {
+	return v.current().GetStandby(hostname)
+}
+
+func (v *cachedView) StandbyCount() int {
+	return v.current().StandbyCount()
+}
+
+// NewStoredCluster returns the placement last persisted by the leading scheduler, without stats. Schedulers waiting
+// for leadership and tools with access to the state store can use it without talking to the leader.
+func NewStoredCluster(storage utils.Storage) ClusterView {
+	return newStoredCluster(storage, Logger)
+}
+
+func newStoredCluster(storage utils.Storage, logger log.LoggerInterface) ClusterView {
+	return newCachedView(func() (*ClusterSnapshot, error) {
+		data, err := storage.Load()
+		if err != nil {
+			return nil, newError(ErrStateStoreUnavailable, "Failed to load state from %s: %s", storage, err)
+		}
+
+		state := &State{Config: new(config)}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, state); err != nil {
+				return nil, err
+			}
+		}
+		return &ClusterSnapshot{Tasks: state.Tasks, Standby: state.Standby}, nil
+	}, logger)
+}
+
+// NewClusterReplica returns the placement served by the scheduler at the api url, including the latest stats.
+func NewClusterReplica(api string) ClusterView {
+	return newCachedView(func() (*ClusterSnapshot, error) {
+		response := NewApiRequest(api + "/api/cluster").Get()
+		if err := response.Err(); err != nil {
+			return nil, err
+		}
+
+		snapshot := new(ClusterSnapshot)
+		if err := json.Unmarshal([]byte(response.Message), snapshot); err != nil {
+			return nil, err
+		}
+		return snapshot, nil
+	}, Logger)
+}
@@ -16,10 +16,11 @@ limitations under the License. */
 package statsd
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
+	"time"
 
 	log "github.com/cihub/seelog"
 	mesos "github.com/mesos/mesos-go/mesosproto"
@@ -27,13 +28,46 @@ import (
 
 var Logger log.LoggerInterface
 
-var Config *config = &config{
-	FrameworkName: "statsd-kafka",
-	FrameworkRole: "*",
-	Cpus:          0.1,
-	Mem:           64,
-	Transform:     "none",
-	LogLevel:      "info",
+var Config = NewConfig()
+
+// NewConfig returns the default configuration, e.g. for schedulers embedded with NewScheduler.
+func NewConfig() *config {
+	return &config{
+		MesosApi:           MesosApiDriver,
+		FrameworkName:      "statsd-kafka",
+		FrameworkRole:      "*",
+		Cpus:               0.1,
+		Mem:                64,
+		Producers:          1,
+		SamplingRate:       0.1,
+		MemorySoftLimit:    0.8,
+		QuotaAction:        QuotaActionDrop,
+		Placement:          PlacementSpread,
+		KillGracePeriod:    defaultKillGracePeriod,
+		QueueSize:          defaultQueueSize,
+		BurstDuration:      defaultBurstDuration,
+		HealthInterval:     10 * time.Second,
+		HealthFailures:     defaultHealthFailures,
+		Spread:             SpreadHostname,
+		ContainerNetwork:   NetworkHost,
+		Transform:          "none",
+		LogLevel:           "info",
+		LogTopicLevel:      defaultLogTopicLevel,
+		LogTopicRate:       defaultLogTopicRate,
+		GcInterval:         10 * time.Minute,
+		MaintenanceDrain:   10 * time.Minute,
+		RefuseSeconds:      10,
+		MismatchSeconds:    300,
+		HistoryMaxAge:      24 * time.Hour,
+		BufferMaxSize:      1024,
+		BufferMaxAge:       48 * time.Hour,
+		HistoryMaxEvents:   timelineSize,
+		InactiveUpdates:    InactiveUpdatesApply,
+		BrokerDnsTtl:       time.Minute,
+		FailoverTimeout:    7 * 24 * time.Hour,
+		RolloutParallelism: 1,
+		RolloutPause:       30 * time.Second,
+	}
 }
 
 var executorMask = regexp.MustCompile("executor.*")
@@ -41,70 +75,314 @@ var executorMask = regexp.MustCompile("executor.*")
 type config struct {
 	Api                string
 	Master             string
+	MesosApi           string // driver or http, the v1 HTTP scheduler API
 	FrameworkName      string
 	FrameworkRole      string
+	FrameworkPrincipal string
+	FrameworkSecret    string `json:"-"` // not persisted or passed to executors
 	User               string
 	Cpus               float64
 	Mem                float64
+	ResourceOverrides  string        // attribute:value=cpu:<cpus>,mem:<mem> pairs separated by semicolon
+	Priorities         string        // attribute:value=<priority> classes separated by semicolon
+	Reserve            bool          // dynamically reserve resources of servers on their agents
+	VolumeSize         float64       // MB of a persistent volume buffering unsent records, requires reserve
+	BufferPath         string        // where executors buffer unsent records, set per task
+	BufferMaxSize      float64       // MB of unsent records a server buffers on disk, newer ones are dropped, 0 is unlimited
+	BufferMaxAge       time.Duration // buffered records older than this are dropped instead of produced, 0 keeps them
+	Placement          string        // spread, binpack, random
+	Spread             string        // hostname, zone, region servers are spread evenly across
+	Constraints        string        // attribute=constraint pairs separated by semicolon offers must satisfy
+	Standby            int           // number of idle tasks kept next to active ones to take over on failure
+	Instances          int           // number of servers to run across the cluster, 0 runs one on every matching host
+	HealthInterval     time.Duration // how often executors probe their servers, 0 disables health checks
+	HealthFailures     int           // consecutive failed probes after which a server is restarted
+	StatsdPort         uint64        // port servers listen for metrics on, 0 picks one from each offer
+	DiscoveryFile      string        // agent path executors write the address of their server to, set at startup only
+	RolloutParallelism int           // servers restarted at once after a config update, 0 disables rolling restarts
+	RolloutPause       time.Duration // pause between restarted batches
 	Executor           string
+	ExecutorPath       string
+	ExecutorVersion    string
+	ExecutorSha256     string
+	ExecutorUpload     string // uploaded executor version servers are launched with instead of the startup executor
+	ArtifactDir        string // directory files other than the executor are served to executors from
+	ExecutorImage      string // Docker image with the executor as entrypoint, executors run without a container if empty
+	ContainerNetwork   string // host, bridge
 	ProducerProperties string
 	BrokerList         string
+	BrokerDnsTtl       time.Duration // how often executors re-resolve bootstrap brokers, 0 disables reconnects
+	Producers          int
+	SamplingThreshold  float64 // queue occupancy (0..1) at which top metrics get sampled, 0 disables
+	MemorySoftLimit    float64 // share (0..1) of the mem allocation at which servers throttle themselves, 0 disables
+	SamplingRate       float64
+	Quotas             string // namespace=events-per-second pairs separated by comma
+	QuotaAction        string // drop, sample, divert
+	OverflowTopic      string
+	Validate           bool
+	Tcp                bool // accept metrics over TCP in addition to UDP
+	TcpErrors          bool // tell TCP clients about backpressure with an error line
+	DeadLetterTopic    string
+	ControlTopic       string
+	ProduceTimeout     time.Duration // how long a produce request may take, 0 keeps producer defaults
+	LatencyBudget      time.Duration // records queued longer are dropped or dead-lettered, 0 disables
+	GaugeTtl           time.Duration // gauges not reporting for this long get an expiry marker, 0 disables
+	KillGracePeriod    time.Duration // how long a stopped server may produce queued records and flush its producers
+	QueueSize          int           // records queued per producer before the server blocks or absorbs a burst
+	BurstSize          int           // records per producer held beyond the queue size during bursts, 0 disables
+	BurstDuration      time.Duration // how long a burst may be absorbed before the burst buffer has to drain
 	Topic              string
+	Destinations       string // topic=filter pairs separated by semicolon, overrides Topic if set
+	DestSampling       string // topic=fraction pairs separated by comma, share of metric names sent to these topics
+	TypeTopics         string // type=topic pairs separated by comma, override Topic and Destinations for these types
 	Transform          string // none, avro, proto
+	DualWriteTransform string // transform additionally written to DualWriteTopic until DualWriteUntil
+	DualWriteTopic     string
+	DualWriteUntil     time.Time
 	SchemaRegistryUrl  string
 	Namespace          string
 	LogLevel           string
+	LogTopic           string // topic executors produce their own log lines to, not shipped if empty
+	LogTopicLevel      string // lowest level of log lines shipped to the log topic
+	LogTopicRate       int    // log lines shipped per second and executor, 0 is unlimited
+	GcInterval         time.Duration
+	GcEnforce          bool
+	ApiAuth            string // none, token, oidc, ldap
+	ApiTokens          string `json:"-"` // not passed to executors
+	ApiReadOnlyTokens  string `json:"-"`
+	ApiUsers           string `json:"-"` // user:password pairs for basic auth
+	ApiReadOnlyUsers   string `json:"-"`
+	ApiReadOnly        string // principals of any auth provider with read-only access
+	ApiGroups          string // principal=attribute:value pairs separated by semicolon, principals may only change their group
+	OidcIssuer         string
+	OidcAudience       string
+	OidcJwksUrl        string
+	LdapUrl            string
+	LdapUserDn         string
+	ApiTlsCert         string        // PEM certificate the API is served with over https, plain http if empty
+	ApiTlsKey          string        `json:"-"` // not passed to executors
+	Storage            string        // where scheduler state is persisted, file:<path> or zk:<connect>/<path>
+	FailoverTimeout    time.Duration // how long Mesos keeps tasks running while the scheduler is down, used with Storage
+	MaintenanceDrain   time.Duration // how long before a maintenance window servers are moved off the agent
+	RefuseSeconds      float64       // how long declined offers are refused
+	MismatchSeconds    float64       // how long offers of hosts servers may not run on are refused
+	HistoryMaxAge      time.Duration // how long timeline events, stats reports and idle agents are kept
+	HistoryMaxEvents   int           // how many timeline events are kept
+	InactiveUpdates    string        // what happens to updates while the scheduler is stopped: apply, queue or reject
+	LeaderElection     string        // <zk connect>/<path> shared by schedulers running in HA mode
+	HandoffFrom        string        // api url of the scheduler instance this one replaces
+	Force              bool          // register even if another framework with the same name and role is active
 }
 
 func (c *config) CanStart() bool {
 	if c.Transform == TransformAvro && c.SchemaRegistryUrl == "" {
 		return false
 	}
-	return (c.ProducerProperties != "" || c.BrokerList != "") && c.Topic != ""
+	return (c.ProducerProperties != "" || c.BrokerList != "") && (c.Topic != "" || c.Destinations != "" || c.TypeTopics != "")
+}
+
+// checkStart tells why servers can't be started with the configuration, if so.
+func (c *config) checkStart() error {
+	if !c.CanStart() {
+		return newError(ErrConfigIncomplete, "producer.properties or broker.list and topic, destinations or type.topics must be set before starting. schema.registry.url must be set for avro transform.")
+	}
+	return nil
+}
+
+func (c *config) producerCount() int {
+	if c.Producers < 1 {
+		return 1
+	}
+	return c.Producers
+}
+
+func (c *config) healthFailures() int {
+	if c.HealthFailures < 1 {
+		return defaultHealthFailures
+	}
+	return c.HealthFailures
 }
 
-func (c *config) Read(task *mesos.TaskInfo) {
-	config := new(config)
+// killGracePeriod is how long a stopped server may flush, task data of older schedulers has none.
+func (c *config) killGracePeriod() time.Duration {
+	if c.KillGracePeriod <= 0 {
+		return defaultKillGracePeriod
+	}
+	return c.KillGracePeriod
+}
+
+// listenPort is the port the executor listens for metrics on.
+func (c *config) logTopicLevel() string {
+	if c.LogTopicLevel == "" {
+		return defaultLogTopicLevel
+	}
+	return c.LogTopicLevel
+}
+
+func (c *config) queueSize() int {
+	if c.QueueSize <= 0 {
+		return defaultQueueSize
+	}
+	return c.QueueSize
+}
+
+func (c *config) burstDuration() time.Duration {
+	if c.BurstDuration <= 0 {
+		return defaultBurstDuration
+	}
+	return c.BurstDuration
+}
+
+func (c *config) listenPort() uint64 {
+	if c.StatsdPort == 0 {
+		return statsdPort
+	}
+	return c.StatsdPort
+}
+
+func (c *config) Read(task *mesos.TaskInfo) error {
 	Logger.Debugf("Task data: %s", string(task.GetData()))
-	err := json.Unmarshal(task.GetData(), config)
+	taskData, err := ParseTaskData(task.GetData())
 	if err != nil {
-		Logger.Critical(err)
-		os.Exit(1)
+		return err
+	}
+	taskData.apply(c)
+	// producer properties are fetched into the sandbox by file name, wherever the scheduler keeps them
+	if c.ProducerProperties != "" {
+		c.ProducerProperties = filepath.Base(c.ProducerProperties)
 	}
-	*c = *config
+	return nil
 }
 
 func (c *config) String() string {
 	return fmt.Sprintf(`api:                 %s
 master:              %s
+mesos api:           %s
 framework name:      %s
 framework role:      %s
+framework principal: %s
 user:                %s
 cpus:                %.2f
 mem:                 %.2f
+resource overrides:  %s
+priorities:          %s
+reserve:             %t
+volume size:         %.2f
+disk buffer:         %.2f MB, %s max age
+placement:           %s
+spread:              %s
+constraints:         %s
+standby:             %d
+instances:           %d
+health check:        every %s, %d failures
+statsd port:         %d
+discovery file:      %s
+rollout:             %d at a time, %s pause
 executor:            %s
+executor path:       %s
+executor sha256:     %s
+executor upload:     %s
+executor image:      %s
+container network:   %s
 producer properties: %s
 broker list:         %s
+broker dns ttl:      %s
+producers:           %d
+sampling threshold:  %.2f
+sampling rate:       %.2f
+memory soft limit:   %.2f
+quotas:              %s
+quota action:        %s
+overflow topic:      %s
+validate:            %t
+tcp:                 %t
+tcp errors:          %t
+dead letter topic:   %s
+control topic:       %s
+produce timeout:     %s
+latency budget:      %s
+gauge ttl:           %s
+kill grace period:   %s
+queue size:          %d
+burst:               %d for %s
 topic:               %s
+destinations:        %s
+dest sampling:       %s
+type topics:         %s
 transform:           %s
+dual write:          %s
 namespace:           %s
 log level:           %s
-`, c.Api, c.Master, c.FrameworkName, c.FrameworkRole, c.User, c.Cpus, c.Mem,
-		c.Executor, c.ProducerProperties, c.BrokerList, c.Topic, c.Transform, c.Namespace, c.LogLevel)
+log topic:           %s
+gc interval:         %s
+gc enforce:          %t
+api auth:            %s
+storage:             %s
+`, c.Api, c.Master, c.MesosApi, c.FrameworkName, c.FrameworkRole, c.FrameworkPrincipal, c.User, c.Cpus, c.Mem, c.ResourceOverrides, c.Priorities, c.Reserve, c.VolumeSize, c.BufferMaxSize, c.BufferMaxAge, c.Placement, c.Spread, c.Constraints, c.Standby, c.Instances, c.HealthInterval, c.healthFailures(), c.StatsdPort, c.DiscoveryFile, c.RolloutParallelism, c.RolloutPause,
+		c.Executor, c.ExecutorPath, c.ExecutorSha256, c.ExecutorUpload, c.ExecutorImage, c.ContainerNetwork, c.ProducerProperties, c.BrokerList, c.BrokerDnsTtl, c.Producers, c.SamplingThreshold, c.SamplingRate, c.MemorySoftLimit, c.Quotas, c.QuotaAction, c.OverflowTopic, c.Validate, c.Tcp, c.TcpErrors, c.DeadLetterTopic, c.ControlTopic, c.ProduceTimeout, c.LatencyBudget, c.GaugeTtl, c.KillGracePeriod, c.queueSize(), c.BurstSize, c.burstDuration(), c.Topic, c.Destinations, c.DestSampling, c.TypeTopics, c.Transform, c.dualWrite(), c.Namespace, c.LogLevel, c.logShipping(), c.GcInterval, c.GcEnforce, c.ApiAuth, c.Storage)
+}
+
+func (c *config) dualWrite() string {
+	if c.DualWriteTransform == "" || c.DualWriteTopic == "" || c.DualWriteUntil.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%s to %s until %s", c.DualWriteTransform, c.DualWriteTopic, c.DualWriteUntil.Format(time.RFC3339))
+}
+
+func (c *config) logShipping() string {
+	if c.LogTopic == "" {
+		return ""
+	}
+	rate := "unlimited"
+	if c.LogTopicRate > 0 {
+		rate = fmt.Sprintf("%d lines/s", c.LogTopicRate)
+	}
+	return fmt.Sprintf("%s, %s and above, %s", c.LogTopic, c.logTopicLevel(), rate)
+}
+
+// Diff lists settings that differ from the other configuration as "setting: old -> new" lines.
+func (c *config) Diff(other *config) string {
+	before := strings.Split(c.String(), "\n")
+	after := strings.Split(other.String(), "\n")
+
+	diff := ""
+	for i := range before {
+		if i >= len(after) || before[i] == after[i] {
+			continue
+		}
+
+		kv := strings.SplitN(before[i], ":", 2)
+		otherKv := strings.SplitN(after[i], ":", 2)
+		if len(kv) != 2 || len(otherKv) != 2 {
+			continue
+		}
+		diff += fmt.Sprintf("  %s: %s -> %s\n", kv[0], strings.TrimSpace(kv[1]), strings.TrimSpace(otherKv[1]))
+	}
+
+	if diff == "" {
+		return "  no changes\n"
+	}
+	return diff
 }
 
 func InitLogging(level string) error {
+	return initLogging(level, "", nil)
+}
+
+func initLogging(level string, outputs string, params *log.CfgParseParams) error {
 	config := fmt.Sprintf(`<seelog minlevel="%s">
     <outputs formatid="main">
         <console />
+        %s
     </outputs>
 
     <formats>
         <format id="main" format="%%Date/%%Time [%%LEVEL] %%Msg%%n"/>
+        <format id="message" format="%%Msg"/>
     </formats>
-</seelog>`, level)
+</seelog>`, level, outputs)
 
-	logger, err := log.LoggerFromConfigAsBytes([]byte(config))
+	logger, err := log.LoggerFromParamConfigAsBytes([]byte(config), params)
 	Config.LogLevel = level
 	Logger = logger
 
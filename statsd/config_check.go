@@ -0,0 +1,197 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elodina/siesta"
+)
+
+// Checks problems found by validation belong to.
+const (
+	CheckConfig         = "config"
+	CheckTransform      = "transform"
+	CheckBroker         = "broker"
+	CheckTopic          = "topic"
+	CheckSchemaRegistry = "schema-registry"
+)
+
+// validationTimeout bounds each connection made to validate a configuration.
+var validationTimeout = 5 * time.Second
+
+var validationClient = &http.Client{Timeout: validationTimeout}
+
+// Problem is something keeping servers from producing with a configuration.
+type Problem struct {
+	Check   string
+	Subject string `json:",omitempty"` // the broker, topic or url the problem is about
+	Message string
+}
+
+func (p *Problem) String() string {
+	if p.Subject == "" {
+		return fmt.Sprintf("%s: %s", p.Check, p.Message)
+	}
+	return fmt.Sprintf("%s %s: %s", p.Check, p.Subject, p.Message)
+}
+
+// FindProblems checks the configuration is complete and its transforms exist, then connects to the brokers and schema
+// registry it uses from the scheduler and checks the topics it produces to exist. Nothing is created or changed, topics
+// are looked up in the metadata of all topics as asking for missing ones may create them.
+func FindProblems(c *config) []*Problem {
+	problems := make([]*Problem, 0)
+	if err := c.checkStart(); err != nil {
+		problems = append(problems, &Problem{Check: CheckConfig, Message: err.Error()})
+	}
+	problems = append(problems, transformProblems(c)...)
+	problems = append(problems, kafkaProblems(c)...)
+	problems = append(problems, schemaRegistryProblems(c)...)
+	return problems
+}
+
+func transformProblems(c *config) []*Problem {
+	problems := make([]*Problem, 0)
+	for _, transform := range []string{c.Transform, c.DualWriteTransform} {
+		if _, exists := transformFunctions[transform]; transform != "" && !exists {
+			problems = append(problems, &Problem{Check: CheckTransform, Subject: transform, Message: "unknown transform, expected none|avro|proto"})
+		}
+		if transform == TransformAvro && c.SchemaRegistryUrl == "" {
+			problems = append(problems, &Problem{Check: CheckTransform, Subject: transform, Message: "schema.registry.url is not set"})
+		}
+	}
+	return problems
+}
+
+func kafkaProblems(c *config) []*Problem {
+	if c.ProducerProperties == "" && c.BrokerList == "" {
+		return nil
+	}
+
+	brokers, err := c.bootstrapBrokers()
+	if err != nil {
+		return []*Problem{{Check: CheckBroker, Subject: c.ProducerProperties, Message: err.Error()}}
+	}
+
+	problems := make([]*Problem, 0)
+	reachable := make([]string, 0)
+	for _, broker := range brokers {
+		connection, err := net.DialTimeout("tcp", strings.TrimSpace(broker), validationTimeout)
+		if err != nil {
+			problems = append(problems, &Problem{Check: CheckBroker, Subject: broker, Message: err.Error()})
+			continue
+		}
+		connection.Close()
+		reachable = append(reachable, strings.TrimSpace(broker))
+	}
+	if len(reachable) == 0 {
+		return problems
+	}
+
+	return append(problems, topicProblems(c, reachable)...)
+}
+
+func topicProblems(c *config, brokers []string) []*Problem {
+	connectorConfig := siesta.NewConnectorConfig()
+	connectorConfig.BrokerList = brokers
+	connectorConfig.ClientID = "statsd-mesos-kafka-validate"
+	connectorConfig.ConnectTimeout = validationTimeout
+	connectorConfig.ReadTimeout = validationTimeout
+	connectorConfig.MetadataRetries = 1
+	connector, err := siesta.NewDefaultConnector(connectorConfig)
+	if err != nil {
+		return []*Problem{{Check: CheckBroker, Subject: strings.Join(brokers, ","), Message: err.Error()}}
+	}
+	defer func() { <-connector.Close() }()
+
+	metadata, err := connector.GetTopicMetadata([]string{})
+	if err != nil {
+		return []*Problem{{Check: CheckBroker, Subject: strings.Join(brokers, ","), Message: err.Error()}}
+	}
+
+	existing := make(map[string]*siesta.TopicMetadata)
+	for _, topicMetadata := range metadata.TopicsMetadata {
+		existing[topicMetadata.Topic] = topicMetadata
+	}
+
+	problems := make([]*Problem, 0)
+	for _, topic := range producedTopics(c) {
+		topicMetadata, exists := existing[topic]
+		switch {
+		case !exists:
+			problems = append(problems, &Problem{Check: CheckTopic, Subject: topic, Message: "doesn't exist"})
+		case topicMetadata.Error != siesta.ErrNoError:
+			problems = append(problems, &Problem{Check: CheckTopic, Subject: topic, Message: topicMetadata.Error.Error()})
+		case len(topicMetadata.PartitionsMetadata) == 0:
+			problems = append(problems, &Problem{Check: CheckTopic, Subject: topic, Message: "has no partitions"})
+		}
+	}
+	return problems
+}
+
+// producedTopics lists the topics servers produce to with the configuration.
+func producedTopics(c *config) []string {
+	topics := destinationTopics(c)
+	typeTopics, _ := ParseTypeTopics(c.TypeTopics)
+	for _, topic := range typeTopics {
+		topics = append(topics, topic)
+	}
+	if c.QuotaAction == QuotaActionDivert {
+		topics = append(topics, c.OverflowTopic)
+	}
+	if c.dualWrite() != "" {
+		topics = append(topics, c.DualWriteTopic)
+	}
+	topics = append(topics, c.DeadLetterTopic, c.LogTopic, c.ControlTopic)
+
+	unique := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		if topic != "" && !contains(unique, topic) {
+			unique = append(unique, topic)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+func schemaRegistryProblems(c *config) []*Problem {
+	if c.SchemaRegistryUrl == "" || (c.Transform != TransformAvro && c.DualWriteTransform != TransformAvro) {
+		return nil
+	}
+
+	subjects := make([]string, 0)
+	if err := getJson(validationClient, strings.TrimRight(c.SchemaRegistryUrl, "/")+"/subjects", &subjects); err != nil {
+		return []*Problem{{Check: CheckSchemaRegistry, Subject: c.SchemaRegistryUrl, Message: err.Error()}}
+	}
+	return nil
+}
+
+func problemsReport(problems []*Problem) string {
+	if len(problems) == 0 {
+		return ""
+	}
+
+	report := "errors:\n"
+	for _, problem := range problems {
+		report += fmt.Sprintf("  %s\n", problem)
+	}
+	return report
+}
@@ -0,0 +1,252 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// configPushTimeout is how long executors may take to acknowledge a pushed config delta.
+var configPushTimeout = time.Minute
+
+const (
+	pushPending = "pending"
+	pushApplied = "applied"
+)
+
+// ConfigPush tracks executors applying a config delta without a restart.
+type ConfigPush struct {
+	Version int
+	Delta   *ConfigDelta
+	Started time.Time
+
+	hosts    map[string]string // host -> pending, applied or the failure reason
+	finished bool
+	lock     sync.Mutex
+}
+
+func newConfigPush(version int, delta *ConfigDelta) *ConfigPush {
+	return &ConfigPush{
+		Version: version,
+		Delta:   delta,
+		Started: time.Now(),
+		hosts:   make(map[string]string),
+	}
+}
+
+func (p *ConfigPush) set(host string, state string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.hosts[host] = state
+}
+
+// acknowledge records the result reported by the host. Returns false if the host wasn't waited for.
+func (p *ConfigPush) acknowledge(host string, err string) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.hosts[host] != pushPending {
+		return false
+	}
+
+	if err != "" {
+		p.hosts[host] = err
+	} else {
+		p.hosts[host] = pushApplied
+	}
+	return true
+}
+
+// expire fails hosts still pending and returns the hosts that didn't apply the delta.
+func (p *ConfigPush) expire() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.finished = true
+	failed := make([]string, 0)
+	for host, state := range p.hosts {
+		if state == pushApplied {
+			continue
+		}
+		if state == pushPending {
+			p.hosts[host] = "no acknowledgement"
+		}
+		failed = append(failed, host)
+	}
+	sort.Strings(failed)
+	return failed
+}
+
+func (p *ConfigPush) pending() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	pending := 0
+	for _, state := range p.hosts {
+		if state == pushPending {
+			pending++
+		}
+	}
+	return pending
+}
+
+func (p *ConfigPush) String() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	hosts := make([]string, 0, len(p.hosts))
+	for host := range p.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	state := "in progress"
+	if p.finished {
+		state = "finished"
+	}
+	result := fmt.Sprintf("live update to config version %d (%s) started %s, %s:\n", p.Version, p.Delta, p.Started.Format(time.RFC3339), state)
+	for _, host := range hosts {
+		result += fmt.Sprintf("  %s: %s\n", host, p.hosts[host])
+	}
+	return result
+}
+
+func (d *ConfigDelta) String() string {
+	changes := make([]string, 0)
+	if d.Topic != "" {
+		changes = append(changes, "topic: "+d.Topic)
+	}
+	if d.BrokerList != "" {
+		changes = append(changes, "broker list: "+d.BrokerList)
+	}
+	if d.Transform != "" {
+		changes = append(changes, "transform: "+d.Transform)
+	}
+	return strings.Join(changes, ", ")
+}
+
+// liveDelta returns the changes executors can apply without a restart, or nil if the update changes anything else.
+func liveDelta(before *config, after *config) *ConfigDelta {
+	compared := *before
+	compared.Topic = after.Topic
+	compared.BrokerList = after.BrokerList
+	compared.Transform = after.Transform
+	if needsRollout(&compared, after) {
+		return nil
+	}
+
+	delta := new(ConfigDelta)
+	if before.Topic != after.Topic {
+		delta.Topic = after.Topic
+	}
+	if before.BrokerList != after.BrokerList {
+		delta.BrokerList = after.BrokerList
+	}
+	if before.Transform != after.Transform {
+		delta.Transform = after.Transform
+	}
+	if *delta == (ConfigDelta{}) {
+		return nil
+	}
+	return delta
+}
+
+// PushConfig sends the delta to running executors, which apply it live and acknowledge. Standby tasks are killed to be
+// relaunched with the new configuration, as are servers failing to apply the delta or not acknowledging it in time.
+func (s *Scheduler) PushConfig(delta *ConfigDelta) *ConfigPush {
+	driver := s.currentDriver()
+	if driver == nil {
+		return nil
+	}
+
+	s.activeLock.Lock()
+	version := s.configVersion
+	s.activeLock.Unlock()
+
+	push := newConfigPush(version, delta)
+	s.pushLock.Lock()
+	s.push = push
+	s.pushLock.Unlock()
+
+	message := NewConfigMessage(delta, version).String()
+	for host, task := range s.cluster.GetTasksByHost() {
+		if standby := s.cluster.GetStandby(host); standby != nil {
+			s.logger.Infof("Killing standby task %s to relaunch it with config version %d", standby.GetTaskId().GetValue(), version)
+			driver.KillTask(standby.GetTaskId())
+		}
+
+		push.set(host, pushPending)
+		if _, err := driver.SendFrameworkMessage(task.GetExecutor().GetExecutorId(), task.GetSlaveId(), message); err != nil {
+			push.acknowledge(host, err.Error())
+		}
+	}
+	s.timeline.Add(EventConfigPush, "", "", fmt.Sprintf("pushing %s to servers as config version %d", delta, version))
+
+	go s.awaitPush(push, configPushTimeout)
+	return push
+}
+
+func (s *Scheduler) awaitPush(push *ConfigPush, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for push.pending() > 0 && time.Now().Before(deadline) {
+		if err := sleepContext(s.ctx, migrationCheckInterval); err != nil {
+			return
+		}
+	}
+
+	failed := push.expire()
+	if len(failed) > 0 {
+		driver := s.awaitDriver(s.ctx, timeout)
+		if driver == nil {
+			s.timeline.Add(EventConfigPush, "", "", fmt.Sprintf("config version %d pushed, %d servers not restarted: disconnected from master", push.Version, len(failed)))
+			return
+		}
+		for _, host := range failed {
+			if task, exists := s.cluster.GetTasksByHost()[host]; exists {
+				s.logger.Infof("Killing task %s to relaunch it with config version %d", task.GetTaskId().GetValue(), push.Version)
+				driver.KillTask(task.GetTaskId())
+			}
+		}
+	}
+	s.timeline.Add(EventConfigPush, "", "", fmt.Sprintf("config version %d pushed, %d servers restarted instead", push.Version, len(failed)))
+}
+
+// configApplied records the acknowledgement of a pushed config delta sent by an executor.
+func (s *Scheduler) configApplied(host string, version int, err string) {
+	push := s.ConfigPush()
+	if push == nil || push.Version != version || !push.acknowledge(host, err) {
+		return
+	}
+
+	if err != "" {
+		s.timeline.Add(EventConfigPush, host, "", fmt.Sprintf("failed to apply config version %d: %s", version, err))
+	} else {
+		s.timeline.Add(EventConfigPush, host, "", fmt.Sprintf("config version %d applied", version))
+	}
+}
+
+// ConfigPush returns the last live config update or nil if there was none.
+func (s *Scheduler) ConfigPush() *ConfigPush {
+	s.pushLock.Lock()
+	defer s.pushLock.Unlock()
+
+	return s.push
+}
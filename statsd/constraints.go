@@ -0,0 +1,97 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"strings"
+
+	utils "github.com/elodina/go-mesos-utils"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// ParseConstraints parses constraints like "hostname=unique;rack=like:us-east-.*" where each constraint applies to an
+// offer attribute, hostname included: like:<regex>, unlike:<regex>, unique, cluster[:<value>] or groupBy[:<groups>].
+func ParseConstraints(value string) (map[string][]utils.Constraint, error) {
+	constraints := make(map[string][]utils.Constraint)
+	if value == "" {
+		return constraints, nil
+	}
+
+	for _, rawConstraint := range strings.Split(value, ";") {
+		kv := strings.SplitN(rawConstraint, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Invalid constraint %s, expected attribute=constraint", rawConstraint)
+		}
+
+		constraint, err := utils.ParseConstraint(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid constraint for attribute %s: %s", kv[0], err)
+		}
+		constraints[kv[0]] = append(constraints[kv[0]], constraint)
+	}
+
+	return constraints, nil
+}
+
+// checkConstraints tells why the offer doesn't satisfy the constraints, if so. Servers on other hosts are the ones
+// unique and groupBy constraints are checked against, so a standby can join the active server on its host.
+func (s *Scheduler) checkConstraints(offer *mesos.Offer) *Decline {
+	constraints, err := ParseConstraints(s.config.Constraints)
+	if err != nil {
+		return declined(DeclineInvalidConfig, "%s", err)
+	}
+
+	attributes := offerAttributes(offer)
+	for name, nameConstraints := range constraints {
+		value, exists := attributes[name]
+		if !exists {
+			return declined(DeclineConstraintMismatch, "no %s", name)
+		}
+
+		others := s.serverAttributes(name, offer.GetHostname())
+		for _, constraint := range nameConstraints {
+			if !constraint.Matches(value, others) {
+				return declined(DeclineConstraintMismatch, "%s doesn't match %s", name, constraint)
+			}
+		}
+	}
+
+	return nil
+}
+
+// serverAttributes returns the attribute of hosts running servers, except the given host.
+func (s *Scheduler) serverAttributes(name string, except string) []string {
+	values := make([]string, 0)
+	for host := range s.cluster.GetTasksByHost() {
+		if host == except {
+			continue
+		}
+
+		if name == "hostname" {
+			values = append(values, host)
+		} else if agent := s.agents.Get(host); agent != nil && agent.Attributes[name] != "" {
+			values = append(values, agent.Attributes[name])
+		}
+	}
+	return values
+}
+
+func offerAttributes(offer *mesos.Offer) map[string]string {
+	attributes := attributeValues(offer.GetAttributes())
+	attributes["hostname"] = offer.GetHostname()
+	return attributes
+}
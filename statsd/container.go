@@ -0,0 +1,116 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/golang/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+const (
+	NetworkHost   = "host"
+	NetworkBridge = "bridge"
+)
+
+// containerInfo runs the executor in a Docker container from the executor image, or returns nil without one.
+// With bridge networking the task ports are mapped to the same ports in the container, so executors bind as usual.
+func (s *Scheduler) containerInfo(ports ...uint64) *mesos.ContainerInfo {
+	if s.config.ExecutorImage == "" {
+		return nil
+	}
+
+	docker := &mesos.ContainerInfo_DockerInfo{
+		Image:   proto.String(s.config.ExecutorImage),
+		Network: mesos.ContainerInfo_DockerInfo_HOST.Enum(),
+	}
+	if s.config.ContainerNetwork == NetworkBridge {
+		docker.Network = mesos.ContainerInfo_DockerInfo_BRIDGE.Enum()
+		docker.PortMappings = s.portMappings(ports...)
+	}
+
+	container := &mesos.ContainerInfo{
+		Type:   mesos.ContainerInfo_DOCKER.Enum(),
+		Docker: docker,
+	}
+	if s.config.DiscoveryFile != "" {
+		container.Volumes = []*mesos.Volume{s.discoveryVolume()}
+	}
+	return container
+}
+
+// portMappings maps the admin port over tcp and the statsd port over udp, and tcp as well if enabled.
+func (s *Scheduler) portMappings(ports ...uint64) []*mesos.ContainerInfo_DockerInfo_PortMapping {
+	mappings := make([]*mesos.ContainerInfo_DockerInfo_PortMapping, 0)
+	add := func(port uint64, protocol string) {
+		mappings = append(mappings, &mesos.ContainerInfo_DockerInfo_PortMapping{
+			HostPort:      proto.Uint32(uint32(port)),
+			ContainerPort: proto.Uint32(uint32(port)),
+			Protocol:      proto.String(protocol),
+		})
+	}
+
+	for i, port := range ports {
+		if i == 0 {
+			add(port, "tcp")
+			continue
+		}
+		add(port, "udp")
+		if s.config.Tcp {
+			add(port, "tcp")
+		}
+	}
+	return mappings
+}
+
+// executorCommand runs the executor fetched from the scheduler, or the entrypoint of the executor image.
+func (s *Scheduler) executorCommand(hostname string, uris []*mesos.CommandInfo_URI) *mesos.CommandInfo {
+	if s.config.ExecutorImage == "" {
+		return &mesos.CommandInfo{
+			Value:       proto.String(fmt.Sprintf("./%s --log.level %s --host %s", s.config.executorName(), s.config.LogLevel, hostname)),
+			Uris:        uris,
+			Environment: chaosEnvironment(),
+		}
+	}
+
+	return &mesos.CommandInfo{
+		Shell:       proto.Bool(false),
+		Arguments:   []string{"--log.level", s.config.LogLevel, "--host", hostname},
+		Uris:        uris[1:], // the image brings the executor
+		Environment: chaosEnvironment(),
+	}
+}
+
+func validateNetwork(network string) error {
+	if network != NetworkHost && network != NetworkBridge {
+		return fmt.Errorf("Invalid container network %s, expected host|bridge", network)
+	}
+	return nil
+}
+
+// setContainerConfig updates the executor image, none runs executors without a container again, and its network.
+func setContainerConfig(queryParams url.Values, config *config) {
+	switch image := queryParams.Get("executor.image"); image {
+	case "":
+	case "none":
+		config.ExecutorImage = ""
+	default:
+		config.ExecutorImage = image
+	}
+	setConfig(queryParams, "container.network", &config.ContainerNetwork)
+}
@@ -0,0 +1,55 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import "fmt"
+
+// DeclineReason classifies why an offer was declined, so placement problems can be diagnosed without parsing messages.
+type DeclineReason string
+
+const (
+	DeclineInsufficientCpu    DeclineReason = "INSUFFICIENT_CPU"
+	DeclineInsufficientMem    DeclineReason = "INSUFFICIENT_MEM"
+	DeclineInsufficientPorts  DeclineReason = "INSUFFICIENT_PORTS"
+	DeclineInsufficientDisk   DeclineReason = "INSUFFICIENT_DISK"
+	DeclineConstraintMismatch DeclineReason = "CONSTRAINT_MISMATCH"
+	DeclineSpread             DeclineReason = "SPREAD"            // the host's fault domain runs more servers than another
+	DeclineHostOccupied       DeclineReason = "HOST_OCCUPIED"     // a server runs on the host already
+	DeclineBlacklisted        DeclineReason = "BLACKLISTED"       // blacklisted or missing from the whitelist
+	DeclineSuspended          DeclineReason = "SUSPENDED"         // servers are stopped
+	DeclineInstancesRunning   DeclineReason = "INSTANCES_RUNNING" // nothing to launch
+	DeclinePreempting         DeclineReason = "PREEMPTING"        // waiting for a preempted server to stop
+	DeclineReserved           DeclineReason = "RESERVED"          // the free instance is kept for a preempting host or migration target
+	DeclineBackoff            DeclineReason = "BACKOFF"
+	DeclineMaintenance        DeclineReason = "MAINTENANCE"
+	DeclineEvacuated          DeclineReason = "EVACUATED"
+	DeclineDiagnosing         DeclineReason = "DIAGNOSING" // the sandbox of a lost executor is being captured
+	DeclineInvalidConfig      DeclineReason = "INVALID_CONFIG"
+)
+
+// Decline is why an offer is declined: a reason of the taxonomy above and a message with the details for humans.
+type Decline struct {
+	Reason  DeclineReason
+	Message string
+}
+
+func declined(reason DeclineReason, format string, args ...interface{}) *Decline {
+	return &Decline{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+func (d *Decline) String() string {
+	return fmt.Sprintf("%s: %s", d.Reason, d.Message)
+}
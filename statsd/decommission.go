@@ -0,0 +1,80 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+var decommissionTimeout = time.Minute
+
+// checkDecommission tells why the server on the host can't be removed, if so.
+func (s *Scheduler) checkDecommission(host string) error {
+	if host == "" {
+		return errors.New("host is required")
+	}
+	if !s.cluster.Exists(host) {
+		return newError(ErrHostNotFound, "No server running on host %s", host)
+	}
+	if s.migrating.Contains(host) {
+		return fmt.Errorf("Server on host %s is being migrated", host)
+	}
+
+	return nil
+}
+
+// Decommission kills the server and standby task on the host and waits until the active task is terminal and removed
+// from the cluster or the context is done. With blacklist the host is added to the persisted blacklist, so no server
+// is launched there again.
+func (s *Scheduler) Decommission(ctx context.Context, host string, blacklist bool, timeout time.Duration) error {
+	if err := s.checkDecommission(host); err != nil {
+		return err
+	}
+
+	if blacklist {
+		if err := s.UpdateHostList(HostBlacklist, []string{host}, nil); err != nil {
+			return err
+		}
+	}
+	s.timeline.Add(EventDecommission, host, "", fmt.Sprintf("removing server, blacklist: %t", blacklist))
+
+	driver := s.currentDriver()
+	if task, exists := s.cluster.GetTasksByHost()[host]; exists {
+		s.logger.Infof("Killing task %s to decommission %s", task.GetTaskId().GetValue(), host)
+		driver.KillTask(task.GetTaskId())
+	}
+	if standby := s.cluster.GetStandby(host); standby != nil {
+		driver.KillTask(standby.GetTaskId())
+	}
+
+	deadline := time.Now().Add(timeout)
+	for s.cluster.Exists(host) {
+		if time.Now().After(deadline) {
+			s.timeline.Add(EventDecommission, host, "", fmt.Sprintf("no terminal status within %s", timeout))
+			return fmt.Errorf("Server on host %s was killed but didn't stop within %s", host, timeout)
+		}
+		if err := sleepContext(ctx, migrationCheckInterval); err != nil {
+			return fmt.Errorf("Server on host %s was killed, stopped waiting for it to stop: %s", host, err)
+		}
+	}
+
+	s.timeline.Add(EventDecommission, host, "", "server removed")
+	return nil
+}
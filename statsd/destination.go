@@ -0,0 +1,203 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	MetricCounter = "counter"
+	MetricGauge   = "gauge"
+	MetricTimer   = "timer"
+	MetricSet     = "set"
+)
+
+// metricTypes maps statsd type codes to metric types, histograms are produced as timers.
+var metricTypes = map[string]string{
+	"c":  MetricCounter,
+	"g":  MetricGauge,
+	"ms": MetricTimer,
+	"h":  MetricTimer,
+	"s":  MetricSet,
+}
+
+// samplingBuckets is the resolution of destination sampling fractions.
+const samplingBuckets = 10000
+
+// Destination is an output topic receiving metrics whose names match its filter.
+type Destination struct {
+	Topic    string
+	Filter   string
+	Fraction float64 // share of metric names sampled into the topic, 1 for all
+
+	pattern *regexp.Regexp
+}
+
+func NewDestination(topic string, filter string) (*Destination, error) {
+	pattern, err := regexp.Compile("^(?:" + filter + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("Invalid filter for topic %s: %s", topic, err)
+	}
+
+	return &Destination{
+		Topic:    topic,
+		Filter:   filter,
+		Fraction: 1,
+		pattern:  pattern,
+	}, nil
+}
+
+// Matches tells whether the metric goes to the topic. Sampled destinations always get the same metric names.
+func (d *Destination) Matches(name string) bool {
+	return d.pattern.MatchString(name) && (d.Fraction >= 1 || sampledName(name, d.Fraction))
+}
+
+// sampledName picks metric names by their hash so every server samples the same names.
+func sampledName(name string, fraction float64) bool {
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	return float64(hash.Sum64()%samplingBuckets) < fraction*samplingBuckets
+}
+
+func (d *Destination) String() string {
+	return fmt.Sprintf("%s=%s", d.Topic, d.Filter)
+}
+
+// ParseDestinations parses destinations like "archive=.*;realtime=latency\..*" where each filter is a regular expression
+// matched against the whole metric name. A destination without filter receives all metrics.
+func ParseDestinations(value string) ([]*Destination, error) {
+	destinations := make([]*Destination, 0)
+	if value == "" {
+		return destinations, nil
+	}
+
+	for _, rawDestination := range strings.Split(value, ";") {
+		kv := strings.SplitN(rawDestination, "=", 2)
+		if kv[0] == "" {
+			return nil, fmt.Errorf("Invalid destination %s, expected topic=filter", rawDestination)
+		}
+
+		filter := ".*"
+		if len(kv) == 2 && kv[1] != "" {
+			filter = kv[1]
+		}
+
+		destination, err := NewDestination(kv[0], filter)
+		if err != nil {
+			return nil, err
+		}
+		destinations = append(destinations, destination)
+	}
+
+	return destinations, nil
+}
+
+// ParseDestinationSampling parses sampling fractions per destination topic like "archive=0.01".
+func ParseDestinationSampling(value string) (map[string]float64, error) {
+	sampling := make(map[string]float64)
+	if value == "" {
+		return sampling, nil
+	}
+
+	for _, rawSampling := range strings.Split(value, ",") {
+		kv := strings.SplitN(rawSampling, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Invalid destination sampling %s, expected topic=fraction", rawSampling)
+		}
+
+		fraction, err := strconv.ParseFloat(kv[1], 64)
+		if err != nil || fraction <= 0 || fraction > 1 {
+			return nil, fmt.Errorf("Invalid sampling fraction %s for topic %s, expected 0..1", kv[1], kv[0])
+		}
+		sampling[kv[0]] = fraction
+	}
+
+	return sampling, nil
+}
+
+// destinationsFromConfig returns configured destinations or a single destination for the global topic if none are set.
+func destinationsFromConfig() []*Destination {
+	destinations, err := ParseDestinations(Config.Destinations)
+	if err != nil {
+		Logger.Warnf("Ignoring destinations: %s", err)
+	}
+
+	if len(destinations) == 0 && Config.Topic != "" {
+		destination, _ := NewDestination(Config.Topic, ".*")
+		destinations = append(destinations, destination)
+	}
+
+	sampling, err := ParseDestinationSampling(Config.DestSampling)
+	if err != nil {
+		Logger.Warnf("Ignoring destination sampling: %s", err)
+	}
+	for _, destination := range destinations {
+		if fraction, exists := sampling[destination.Topic]; exists {
+			destination.Fraction = fraction
+		}
+	}
+
+	return destinations
+}
+
+// metricType returns the type of a statsd line, e.g. "timer" for "api.latency:12|ms", or an empty string if unknown.
+func metricType(line string) string {
+	parts := strings.Split(line, "|")
+	if len(parts) < 2 {
+		return ""
+	}
+
+	return metricTypes[parts[1]]
+}
+
+// ParseTypeTopics parses per metric type topics like "counter=metrics.counters,timer=metrics.timers".
+func ParseTypeTopics(value string) (map[string]string, error) {
+	typeTopics := make(map[string]string)
+	if value == "" {
+		return typeTopics, nil
+	}
+
+	for _, rawTypeTopic := range strings.Split(value, ",") {
+		kv := strings.SplitN(rawTypeTopic, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("Invalid type topic %s, expected type=topic", rawTypeTopic)
+		}
+
+		switch kv[0] {
+		case MetricCounter, MetricGauge, MetricTimer, MetricSet:
+			typeTopics[kv[0]] = kv[1]
+		default:
+			return nil, fmt.Errorf("Invalid metric type %s, expected counter|gauge|timer|set", kv[0])
+		}
+	}
+
+	return typeTopics, nil
+}
+
+func typeTopicsFromConfig() map[string]string {
+	typeTopics, err := ParseTypeTopics(Config.TypeTopics)
+	if err != nil {
+		Logger.Warnf("Ignoring type topics: %s", err)
+		return make(map[string]string)
+	}
+
+	return typeTopics
+}
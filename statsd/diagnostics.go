@@ -0,0 +1,143 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var agentClient = &http.Client{Timeout: 10 * time.Second}
+
+// sandboxTailBytes is how much of the end of each sandbox log is archived when an executor is lost.
+var sandboxTailBytes int64 = 4096
+
+var sandboxLogs = []string{"stdout", "stderr"}
+
+type agentState struct {
+	Frameworks          []*agentFramework `json:"frameworks"`
+	CompletedFrameworks []*agentFramework `json:"completed_frameworks"`
+}
+
+type agentFramework struct {
+	Id                 string           `json:"id"`
+	Executors          []*agentExecutor `json:"executors"`
+	CompletedExecutors []*agentExecutor `json:"completed_executors"`
+}
+
+type agentExecutor struct {
+	Id        string `json:"id"`
+	Directory string `json:"directory"`
+}
+
+type fileChunk struct {
+	Data   string `json:"data"`
+	Offset int64  `json:"offset"`
+}
+
+// captureSandbox returns the tail of the executor's sandbox logs read through the agent files API.
+func (s *Scheduler) captureSandbox(executorId string, slaveId string) (string, error) {
+	state, err := fetchMasterState(s.currentMasterUrl())
+	if err != nil {
+		return "", err
+	}
+
+	var slave *MasterSlave
+	for _, candidate := range state.Slaves {
+		if candidate.Id == slaveId {
+			slave = candidate
+		}
+	}
+	if slave == nil {
+		return "", fmt.Errorf("Agent %s is unknown to master", slaveId)
+	}
+
+	directory, err := s.sandboxDirectory(slave.Url(), executorId)
+	if err != nil {
+		return "", err
+	}
+
+	tail := ""
+	for _, log := range sandboxLogs {
+		data, err := readFileTail(slave.Url(), directory+"/"+log, sandboxTailBytes)
+		if err != nil {
+			tail += fmt.Sprintf("--- %s: %s\n", log, err)
+			continue
+		}
+		tail += fmt.Sprintf("--- %s:\n%s\n", log, strings.TrimRight(data, "\n"))
+	}
+
+	return tail, nil
+}
+
+// sandboxDirectory looks the executor up in the agent state, preferring the most recently completed run.
+func (s *Scheduler) sandboxDirectory(agent string, executorId string) (string, error) {
+	state := new(agentState)
+	if err := getJson(agentClient, agent+"/state.json", state); err != nil {
+		return "", err
+	}
+
+	directory := ""
+	for _, framework := range append(state.Frameworks, state.CompletedFrameworks...) {
+		if framework.Id != s.frameworkId {
+			continue
+		}
+
+		for _, executor := range append(framework.Executors, framework.CompletedExecutors...) {
+			if executor.Id == executorId {
+				directory = executor.Directory
+			}
+		}
+	}
+
+	if directory == "" {
+		return "", fmt.Errorf("Sandbox of executor %s not found on agent %s", executorId, agent)
+	}
+	return directory, nil
+}
+
+func readFileTail(agent string, path string, length int64) (string, error) {
+	size := new(fileChunk)
+	if err := getJson(agentClient, fileReadUrl(agent, path, -1, 0), size); err != nil {
+		return "", err
+	}
+
+	offset := size.Offset - length
+	if offset < 0 {
+		offset = 0
+	}
+
+	chunk := new(fileChunk)
+	if err := getJson(agentClient, fileReadUrl(agent, path, offset, length), chunk); err != nil {
+		return "", err
+	}
+	return chunk.Data, nil
+}
+
+// fileReadUrl builds an agent files API url. Offset -1 returns the file size as offset without data.
+func fileReadUrl(agent string, path string, offset int64, length int64) string {
+	values := url.Values{}
+	values.Set("path", path)
+	values.Set("offset", fmt.Sprint(offset))
+	if length > 0 {
+		values.Set("length", fmt.Sprint(length))
+	}
+
+	return agent + "/files/read.json?" + values.Encode()
+}
@@ -0,0 +1,86 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/golang/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// ValidateDiscoveryFile checks the discovery file given at scheduler startup. It is not updatable through the API, as
+// executors replace it as root on every agent and its directory is mounted read-write into executor containers.
+func ValidateDiscoveryFile(path string) error {
+	if path != "" && (!filepath.IsAbs(path) || filepath.Clean(path) != path || filepath.Dir(path) == "/") {
+		return fmt.Errorf("Invalid discovery.file %s, expected an absolute path outside of /", path)
+	}
+	return nil
+}
+
+// discoveryVolume mounts the directory of the discovery file into executor containers, so executors write it on the
+// agent.
+func (s *Scheduler) discoveryVolume() *mesos.Volume {
+	dir := filepath.Dir(s.config.DiscoveryFile)
+	return &mesos.Volume{
+		ContainerPath: proto.String(dir),
+		HostPath:      proto.String(dir),
+		Mode:          mesos.Volume_RW.Enum(),
+	}
+}
+
+// advertise writes the address of the server to the discovery file, so applications on the agent can source it to
+// find their local statsd. The file is replaced atomically, readers never see it half written.
+func (e *Executor) advertise(port uint64) {
+	if Config.DiscoveryFile == "" {
+		return
+	}
+
+	contents := fmt.Sprintf("STATSD_HOST=%s\nSTATSD_PORT=%d\nSTATSD_ADDRESS=%s:%d\n", e.Host, port, e.Host, port)
+	if err := writeFileAtomically(Config.DiscoveryFile, []byte(contents)); err != nil {
+		Logger.Warnf("Failed to write discovery file %s: %s", Config.DiscoveryFile, err)
+		return
+	}
+	Logger.Infof("Advertised %s:%d in %s", e.Host, port, Config.DiscoveryFile)
+}
+
+func writeFileAtomically(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,381 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elodina/siesta-producer"
+)
+
+// bufferResendInterval is how often buffered records are produced again while producers don't fail.
+var bufferResendInterval = 30 * time.Second
+
+const (
+	bufferReplayBatch  = 1000     // records read into memory and produced at once when replaying
+	maxBufferedLine    = 1 << 20  // longer lines in a buffer file can't be records and are counted as corrupt
+	maxQuarantineBytes = 16 << 20 // corrupt lines beyond are only counted
+)
+
+// diskBuffer keeps encoded records in a file in the sandbox, or on the persistent volume mounted there, while Kafka is
+// drained or records fail to produce. Records are produced again afterwards, also by a server relaunched on the agent.
+// Records over the size limit are dropped, records older than the age limit are dropped instead of being replayed and
+// lines that can't be read are moved to a quarantine file, each counted in stats.
+type diskBuffer struct {
+	dir       string
+	maxBytes  int64         // buffered bytes at most, 0 is unlimited
+	maxAge    time.Duration // how long records are kept, 0 keeps them until replayed
+	file      *os.File      // records are appended to, opened with the first one
+	bytes     int64         // bytes of buffered records, including those not replayed yet
+	replaying bool
+	lock      sync.Mutex
+
+	records int64
+	dropped int64
+	expired int64
+	corrupt int64
+}
+
+type bufferedRecord struct {
+	Topic string
+	Value []byte
+	Name  string `json:",omitempty"` // metric name, routes the replayed record to the shard of the name
+	Time  int64  `json:",omitempty"` // unix nanos the record was buffered at
+}
+
+// newDiskBuffer returns a buffer in the directory, picking up records buffered by a previous server.
+func newDiskBuffer(dir string, maxBytes int64, maxAge time.Duration) *diskBuffer {
+	b := &diskBuffer{dir: dir, maxBytes: maxBytes, maxAge: maxAge}
+	b.check(b.replayPath())
+	b.check(b.path())
+	if b.records > 0 {
+		Logger.Infof("Found %d records buffered by a previous server", b.records)
+	}
+	return b
+}
+
+// path is the file records are appended to.
+func (b *diskBuffer) path() string {
+	return filepath.Join(b.dir, "unsent.log")
+}
+
+// replayPath is the file buffered records are moved to while they are replayed.
+func (b *diskBuffer) replayPath() string {
+	return filepath.Join(b.dir, "replaying.log")
+}
+
+// quarantinePath is the file lines that can't be read as records are moved to.
+func (b *diskBuffer) quarantinePath() string {
+	return filepath.Join(b.dir, "corrupt.log")
+}
+
+// check counts the records of a buffer file left by a previous server. A record cut off by a crash while it was
+// written is truncated, so records appended afterwards stay readable.
+func (b *diskBuffer) check(path string) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, maxBufferedLine)
+	var size int64
+	for {
+		line, n, err := readLine(reader)
+		if err == io.EOF && n > 0 {
+			b.corrupt++
+			if err := file.Truncate(size); err != nil {
+				Logger.Warnf("Failed to truncate incomplete buffered record: %s", err)
+				size += int64(n)
+			}
+			break
+		}
+		if err != nil {
+			break
+		}
+		size += int64(n)
+		if _, ok := parseBufferedRecord(line); ok {
+			b.records++
+		}
+	}
+	b.bytes += size
+}
+
+// Add appends the record to the buffer. Records are dropped if the buffer is full or the disk is.
+func (b *diskBuffer) Add(record *producer.ProducerRecord, name string) {
+	value, ok := record.Value.([]byte)
+	if !ok {
+		return
+	}
+	b.add(&bufferedRecord{Topic: record.Topic, Value: value, Name: name, Time: time.Now().UnixNano()})
+}
+
+func (b *diskBuffer) add(record *bufferedRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.maxBytes > 0 && b.bytes+int64(len(line)) > b.maxBytes {
+		atomic.AddInt64(&b.dropped, 1)
+		return
+	}
+	if b.file == nil {
+		if err := os.MkdirAll(b.dir, 0755); err != nil {
+			Logger.Warnf("Failed to buffer unsent record: %s", err)
+			return
+		}
+		file, err := os.OpenFile(b.path(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			Logger.Warnf("Failed to buffer unsent record: %s", err)
+			return
+		}
+		b.file = file
+	}
+
+	if _, err := b.file.Write(line); err != nil {
+		Logger.Warnf("Failed to buffer unsent record: %s", err)
+		return
+	}
+	b.bytes += int64(len(line))
+	atomic.AddInt64(&b.records, 1)
+}
+
+// Close closes the file records are appended to. Records added afterwards open it again.
+func (b *diskBuffer) Close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.closeFile()
+}
+
+func (b *diskBuffer) closeFile() {
+	if b.file != nil {
+		b.file.Close()
+		b.file = nil
+	}
+}
+
+// Len returns the number of buffered records.
+func (b *diskBuffer) Len() int64 {
+	return atomic.LoadInt64(&b.records)
+}
+
+// stats returns the number of records dropped over the size limit, dropped over the age limit and found corrupt.
+func (b *diskBuffer) stats() (int64, int64, int64) {
+	return atomic.LoadInt64(&b.dropped), atomic.LoadInt64(&b.expired), atomic.LoadInt64(&b.corrupt)
+}
+
+// Replay takes the buffered records out of the buffer and passes them to produce in batches of at most
+// bufferReplayBatch records, so a long outage isn't replayed from memory. Records added meanwhile, e.g. failing again,
+// are left for the next replay. A replay interrupted by a crash is continued by the next server, replaying the batches
+// produced before the crash once more. Does nothing while another replay is running.
+func (b *diskBuffer) Replay(produce func([]*bufferedRecord)) {
+	b.lock.Lock()
+	if b.replaying {
+		b.lock.Unlock()
+		return
+	}
+	if _, err := os.Stat(b.replayPath()); err != nil {
+		b.closeFile()
+		if err := os.Rename(b.path(), b.replayPath()); err != nil {
+			b.lock.Unlock()
+			return
+		}
+	}
+	b.replaying = true
+	b.lock.Unlock()
+
+	defer func() {
+		b.lock.Lock()
+		b.replaying = false
+		b.lock.Unlock()
+	}()
+
+	file, err := os.Open(b.replayPath())
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, maxBufferedLine)
+	batch := make([]*bufferedRecord, 0, bufferReplayBatch)
+	for {
+		line, n, err := readLine(reader)
+		if n > 0 {
+			b.replayed(line, n, &batch)
+		}
+		if len(batch) == bufferReplayBatch || err != nil && len(batch) > 0 {
+			produce(batch)
+			batch = make([]*bufferedRecord, 0, bufferReplayBatch)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			Logger.Warnf("Failed to replay buffered records: %s", err)
+			return
+		}
+	}
+
+	file.Close()
+	os.Remove(b.replayPath())
+}
+
+// replayed accounts for a line read from the replayed file, adding it to the batch unless it is expired or corrupt.
+func (b *diskBuffer) replayed(line []byte, n int, batch *[]*bufferedRecord) {
+	b.lock.Lock()
+	b.bytes -= int64(n)
+	b.lock.Unlock()
+
+	record, ok := parseBufferedRecord(line)
+	if !ok {
+		atomic.AddInt64(&b.corrupt, 1)
+		b.quarantine(line)
+		return
+	}
+	atomic.AddInt64(&b.records, -1)
+	if b.maxAge > 0 && record.Time > 0 && time.Since(time.Unix(0, record.Time)) > b.maxAge {
+		atomic.AddInt64(&b.expired, 1)
+		return
+	}
+	*batch = append(*batch, record)
+}
+
+// quarantine appends a line that can't be read as a record to the quarantine file for inspection.
+func (b *diskBuffer) quarantine(line []byte) {
+	if len(line) == 0 {
+		return
+	}
+	if info, err := os.Stat(b.quarantinePath()); err == nil && info.Size()+int64(len(line)) > maxQuarantineBytes {
+		return
+	}
+	file, err := os.OpenFile(b.quarantinePath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	if line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+	file.Write(line)
+}
+
+// readLine returns the next line of a buffer file and the number of bytes it took. Lines longer than the reader
+// buffer are skipped and returned empty, so they fail to parse.
+func readLine(reader *bufio.Reader) ([]byte, int, error) {
+	line, err := reader.ReadSlice('\n')
+	n := len(line)
+	for err == bufio.ErrBufferFull {
+		line = nil
+		var rest []byte
+		rest, err = reader.ReadSlice('\n')
+		n += len(rest)
+	}
+	return line, n, err
+}
+
+func parseBufferedRecord(line []byte) (*bufferedRecord, bool) {
+	record := new(bufferedRecord)
+	if err := json.Unmarshal(line, record); err != nil || record.Topic == "" {
+		return nil, false
+	}
+	return record, true
+}
+
+// resendBuffered produces buffered records again on start and then periodically while producers don't fail and
+// Kafka isn't drained. Records failing again are buffered again.
+func (s *StatsDServer) resendBuffered() {
+	ticker := time.NewTicker(bufferResendInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.isClosed() {
+			return
+		}
+		if !s.failing(1) && !s.draining() && s.buffer.Len() > 0 {
+			s.resend()
+		}
+		<-ticker.C
+	}
+}
+
+// resend replays buffered records, each through the shard of its metric name. The close lock is held per batch so
+// shards stay open while it is produced, records of a server closed meanwhile are buffered again.
+func (s *StatsDServer) resend() {
+	if buffered := s.buffer.Len(); buffered > 0 {
+		Logger.Infof("Producing %d buffered records", buffered)
+	}
+	s.buffer.Replay(func(records []*bufferedRecord) {
+		s.closeLock.Lock()
+		defer s.closeLock.Unlock()
+
+		for _, record := range records {
+			if s.closed {
+				s.buffer.add(record)
+				continue
+			}
+			shard := s.shards[shardFor(record.Name, len(s.shards))]
+			shard.produce(&producer.ProducerRecord{Topic: record.Topic, Value: record.Value}, record.Name)
+		}
+	})
+}
+
+// drainKafka makes the server buffer records on disk instead of producing them until the given time, e.g. during
+// broker maintenance. A time in the past resumes producing right away, replaying the buffered records.
+func (s *StatsDServer) drainKafka(until time.Time) error {
+	if s.isClosed() {
+		return errors.New("server is stopped")
+	}
+
+	for _, shard := range s.shards {
+		atomic.StoreInt64(&shard.drainUntil, until.UnixNano())
+	}
+	if until.After(time.Now()) {
+		Logger.Infof("Buffering records on disk instead of producing them until %s", until.Format(time.RFC3339))
+		go s.resumeAt(until)
+	} else {
+		Logger.Info("Resuming producing to Kafka")
+		go s.resend()
+	}
+	return nil
+}
+
+// resumeAt replays buffered records once the drain window ends, unless the drain was extended or resumed meanwhile.
+func (s *StatsDServer) resumeAt(until time.Time) {
+	time.Sleep(until.Sub(time.Now()))
+	if atomic.LoadInt64(&s.shards[0].drainUntil) == until.UnixNano() && !s.isClosed() {
+		Logger.Info("Kafka drain window ended, resuming producing")
+		s.resend()
+	}
+}
+
+func (s *StatsDServer) draining() bool {
+	return len(s.shards) > 0 && s.shards[0].draining()
+}
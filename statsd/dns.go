@@ -0,0 +1,72 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// brokerFailureThreshold is the number of produce failures in a row that makes the executor reconnect to Kafka.
+var brokerFailureThreshold int64 = 10
+
+var brokerFailureCheckInterval = time.Second
+
+// bootstrapResolver remembers addresses bootstrap brokers resolved to, to notice DNS changes.
+type bootstrapResolver struct {
+	hosts     []string
+	addresses map[string]string
+}
+
+func newBootstrapResolver(brokers []string) *bootstrapResolver {
+	resolver := &bootstrapResolver{addresses: make(map[string]string)}
+	for _, broker := range brokers {
+		host, _, err := net.SplitHostPort(strings.TrimSpace(broker))
+		if err != nil {
+			Logger.Warnf("Ignoring bootstrap broker %s: %s", broker, err)
+			continue
+		}
+		resolver.hosts = append(resolver.hosts, host)
+	}
+	resolver.changed()
+
+	return resolver
+}
+
+// changed re-resolves bootstrap hosts and tells whether any of them resolves to different addresses than before.
+// Hosts failing to resolve keep their previous addresses.
+func (r *bootstrapResolver) changed() bool {
+	changed := false
+	for _, host := range r.hosts {
+		addresses, err := net.LookupHost(host)
+		if err != nil {
+			Logger.Warnf("Failed to resolve bootstrap broker %s: %s", host, err)
+			continue
+		}
+
+		sort.Strings(addresses)
+		resolved := strings.Join(addresses, ",")
+		if previous, exists := r.addresses[host]; exists && previous != resolved {
+			Logger.Infof("Bootstrap broker %s moved from %s to %s", host, previous, resolved)
+			changed = true
+		}
+		r.addresses[host] = resolved
+	}
+
+	return changed
+}
@@ -0,0 +1,91 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"time"
+)
+
+// DualWrite produces every metric a second time with another transform, e.g. the previous one while consumers migrate
+// to a new encoding. It ends by itself once the overlap window set by the scheduler passes.
+type DualWrite struct {
+	Topic string
+	Until time.Time
+
+	transform  func(string, string) interface{}
+	serializer func(string, interface{}) ([]byte, error)
+	validator  func([]byte) error
+}
+
+// NewDualWrite returns nil if dual write is not configured or its window has already passed.
+func NewDualWrite(transform string, topic string, until time.Time, serializer func(string) func(string, interface{}) ([]byte, error)) (*DualWrite, error) {
+	if transform == "" || topic == "" || !time.Now().Before(until) {
+		return nil, nil
+	}
+
+	transformFunc, exists := transformFunctions[transform]
+	if !exists {
+		return nil, fmt.Errorf("Invalid dual write transformation mode: %s", transform)
+	}
+
+	return &DualWrite{
+		Topic:      topic,
+		Until:      until,
+		transform:  transformFunc,
+		serializer: serializer(transform),
+		validator:  validateFunctions[transform],
+	}, nil
+}
+
+func (d *DualWrite) active() bool {
+	return d != nil && time.Now().Before(d.Until)
+}
+
+func (d *DualWrite) encode(line string, host string) ([]byte, error) {
+	value, err := d.serializer(d.Topic, d.transform(line, host))
+	if err != nil {
+		return nil, err
+	}
+
+	if Config.Validate && d.validator != nil {
+		if err := d.validator(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
+
+// scheduleDualWriteEnd clears dual write settings once the window passes, so relaunched tasks write the new encoding only.
+func (s *Scheduler) scheduleDualWriteEnd(transform string, topic string, until time.Time) {
+	if transform == "" || topic == "" || until.IsZero() {
+		return
+	}
+
+	s.timeline.Add(EventDualWrite, "", "", fmt.Sprintf("writing %s encoding to %s until %s", transform, topic, until.Format(time.RFC3339)))
+	time.AfterFunc(until.Sub(time.Now()), func() {
+		if !s.config.DualWriteUntil.Equal(until) { // window changed meanwhile
+			return
+		}
+
+		s.config.DualWriteTransform = ""
+		s.config.DualWriteTopic = ""
+		s.config.DualWriteUntil = time.Time{}
+		s.ConfigUpdated()
+		s.timeline.Add(EventDualWrite, "", "", fmt.Sprintf("dual write of %s encoding to %s ended", transform, topic))
+	})
+}
@@ -0,0 +1,51 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// checkDuplicateFramework refuses to start while another framework with the same name and role is active, e.g. a
+// scheduler started twice by accident, as both would place servers. The framework this scheduler fails over is
+// not a duplicate, Mesos disconnects its previous scheduler. Only masters given as host:port can be checked.
+func (s *Scheduler) checkDuplicateFramework() error {
+	if s.config.Force {
+		return nil
+	}
+	if strings.HasPrefix(s.config.Master, "zk://") {
+		s.logger.Infof("Not checking for duplicate frameworks, master %s is not a host:port", s.config.Master)
+		return nil
+	}
+
+	master := "http://" + strings.TrimSuffix(strings.TrimPrefix(s.config.Master, "http://"), "/")
+	state, err := fetchMasterState(master)
+	if err != nil {
+		s.logger.Warnf("Failed to check for duplicate frameworks: %s", err)
+		return nil
+	}
+
+	for _, framework := range state.Frameworks {
+		if !framework.Active || framework.Id == s.frameworkId {
+			continue
+		}
+		if framework.Name == s.config.FrameworkName && framework.Role == s.config.FrameworkRole {
+			return fmt.Errorf("Framework %s named %s with role %s is already active, is another scheduler running? Use --force to register anyway", framework.Id, framework.Name, framework.Role)
+		}
+	}
+	return nil
+}
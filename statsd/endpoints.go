@@ -0,0 +1,123 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/elodina/siesta-producer"
+)
+
+var endpointCheckInterval = 5 * time.Second
+
+// EndpointChange is produced to the control topic whenever the set of active statsd endpoints changes, so consumers
+// of the endpoints can react without polling the API.
+type EndpointChange struct {
+	Framework string
+	Timestamp int64
+	Endpoints []string // host:port of every active server
+	Added     []string
+	Removed   []string
+}
+
+// activeEndpoints returns statsd endpoints of active servers, standby tasks don't listen for metrics.
+func (s *Scheduler) activeEndpoints() map[string]bool {
+	endpoints := make(map[string]bool)
+	for host, task := range s.cluster.GetTasksByHost() {
+		endpoints[fmt.Sprintf("%s:%d", host, taskStatsdPort(task))] = true
+	}
+	return endpoints
+}
+
+func (s *Scheduler) newEndpointChange(previous map[string]bool, current map[string]bool) *EndpointChange {
+	change := &EndpointChange{
+		Framework: s.config.FrameworkName,
+		Timestamp: time.Now().Unix(),
+		Endpoints: make([]string, 0, len(current)),
+		Added:     make([]string, 0),
+		Removed:   make([]string, 0),
+	}
+	for endpoint := range current {
+		change.Endpoints = append(change.Endpoints, endpoint)
+		if !previous[endpoint] {
+			change.Added = append(change.Added, endpoint)
+		}
+	}
+	for endpoint := range previous {
+		if !current[endpoint] {
+			change.Removed = append(change.Removed, endpoint)
+		}
+	}
+	sort.Strings(change.Endpoints)
+	sort.Strings(change.Added)
+	sort.Strings(change.Removed)
+	return change
+}
+
+// watchEndpoints produces an EndpointChange to the control topic when endpoints change. The first change after
+// start lists all endpoints as added. Changes failing to be produced are retried on the next check.
+func (s *Scheduler) watchEndpoints() {
+	ticker := time.NewTicker(endpointCheckInterval)
+	defer ticker.Stop()
+
+	var notifier *producer.KafkaProducer
+	var previous map[string]bool
+	for range ticker.C {
+		if s.config.ControlTopic == "" {
+			continue
+		}
+
+		current := s.activeEndpoints()
+		change := s.newEndpointChange(previous, current)
+		if previous != nil && len(change.Added) == 0 && len(change.Removed) == 0 {
+			continue
+		}
+
+		if notifier == nil {
+			var err error
+			if notifier, err = s.config.newProducer(); err != nil {
+				s.logger.Warnf("Failed to create producer for control topic: %s", err)
+				continue
+			}
+		}
+		if err := s.notifyEndpoints(notifier, change); err != nil {
+			s.logger.Warnf("Failed to produce endpoint change to %s: %s", s.config.ControlTopic, err)
+			notifier.Close(time.Second)
+			notifier = nil
+			continue
+		}
+		previous = current
+	}
+}
+
+func (s *Scheduler) notifyEndpoints(notifier *producer.KafkaProducer, change *EndpointChange) error {
+	value, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	s.logger.Infof("Endpoints changed, added: %v, removed: %v", change.Added, change.Removed)
+	ack := notifier.Send(&producer.ProducerRecord{Topic: s.config.ControlTopic, Key: []byte(change.Framework), Value: value})
+	select {
+	case metadata := <-ack:
+		return metadata.Error
+	case <-time.After(endpointCheckInterval):
+		return fmt.Errorf("not acknowledged within %s", endpointCheckInterval)
+	}
+}
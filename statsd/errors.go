@@ -0,0 +1,69 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/elodina/statsd-mesos-kafka/statsd/client"
+)
+
+// Errors returned by scheduler operations, matched with errors.Is. The API responds with the status code below and
+// the error code from client.ErrorCodes, so clients get the same errors back from ApiResponse.Err.
+var (
+	ErrHostNotFound          = client.ErrHostNotFound
+	ErrConfigIncomplete      = client.ErrConfigIncomplete
+	ErrNotActive             = client.ErrNotActive
+	ErrStateStoreUnavailable = client.ErrStateStoreUnavailable
+)
+
+var errorStatuses = map[error]int{
+	ErrHostNotFound:          http.StatusNotFound,
+	ErrConfigIncomplete:      http.StatusConflict,
+	ErrNotActive:             http.StatusServiceUnavailable,
+	ErrStateStoreUnavailable: http.StatusServiceUnavailable,
+}
+
+type Error = client.Error
+
+func newError(kind error, format string, args ...interface{}) error {
+	return &Error{Kind: kind, Message: fmt.Sprintf(format, args...)}
+}
+
+// errorKind returns the error above the given one matches or nil.
+func errorKind(err error) error {
+	for kind := range client.ErrorCodes {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
+
+// respondError responds with the status code of the error kind, 500 for other errors.
+func respondError(err error, w http.ResponseWriter) {
+	kind := errorKind(err)
+	if kind == nil {
+		respond(false, err.Error(), w)
+		return
+	}
+
+	response := NewApiResponse(false, err.Error())
+	response.Code = client.ErrorCodes[kind]
+	writeResponse(errorStatuses[kind], response, w)
+}
@@ -0,0 +1,108 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// eventsKeepAlive is how often an idle event stream gets a comment, so proxies don't close it.
+var eventsKeepAlive = 15 * time.Second
+
+const eventsBuffer = 100
+
+// handleEvents streams cluster events as server-sent events until the client disconnects. Events since the given time,
+// or after the Last-Event-ID of a reconnecting client, are sent first. types limits the stream to some event types.
+func (hs *HttpServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	since := time.Now()
+	if value := queryParams.Get("since"); value != "" {
+		var err error
+		if since, err = parseSince(value); err != nil {
+			respondWithStatus(400, false, err.Error(), w)
+			return
+		}
+	}
+	if lastId := r.Header.Get("Last-Event-ID"); lastId != "" {
+		nanos, err := strconv.ParseInt(lastId, 10, 64)
+		if err != nil {
+			respondWithStatus(400, false, fmt.Sprintf("Invalid Last-Event-ID %s", lastId), w)
+			return
+		}
+		since = time.Unix(0, nanos)
+	}
+
+	types := make(map[string]bool)
+	for _, eventType := range strings.Split(queryParams.Get("types"), ",") {
+		if eventType = strings.TrimSpace(eventType); eventType != "" {
+			types[eventType] = true
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respond(false, "Streaming is not supported", w)
+		return
+	}
+
+	// subscribe before reading history, so no event falls in between
+	events, unsubscribe := hs.sched.timeline.Subscribe(eventsBuffer)
+	defer unsubscribe()
+	history := hs.sched.timeline.Since(since)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+
+	last := since
+	send := func(event *Event) {
+		if !event.Time.After(last) || len(types) > 0 && !types[event.Type] {
+			return
+		}
+		last = event.Time
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Time.UnixNano(), event.Type, data)
+	}
+
+	for _, event := range history {
+		send(event)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			send(event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -16,20 +16,37 @@ limitations under the License. */
 package statsd
 
 import (
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/elodina/go-kafka-avro"
 	"github.com/elodina/siesta"
 	"github.com/elodina/siesta-producer"
+	"github.com/golang/protobuf/proto"
 	"github.com/jimlawless/cfg"
 	"github.com/mesos/mesos-go/executor"
 	mesos "github.com/mesos/mesos-go/mesosproto"
 )
 
+// rejectStopDelay is how long an executor lingers after rejecting a task.
+var rejectStopDelay = 5 * time.Second
+
 type Executor struct {
 	server *StatsDServer
 	Host   string
+
+	activate     chan struct{} // closed when a standby task gets activated
+	activateOnce sync.Once
+	stop         chan struct{} // closed when a standby task is killed before activation
+	stopOnce     sync.Once
+	subjects     *schemaSubjects
+	subjectsOnce sync.Once
+	lock         sync.Mutex
 }
 
 func (e *Executor) Registered(driver executor.ExecutorDriver, executor *mesos.ExecutorInfo, framework *mesos.FrameworkInfo, slave *mesos.SlaveInfo) {
@@ -47,20 +64,36 @@ func (e *Executor) Disconnected(executor.ExecutorDriver) {
 func (e *Executor) LaunchTask(driver executor.ExecutorDriver, task *mesos.TaskInfo) {
 	Logger.Infof("[LaunchTask] %s", task)
 
-	Config.Read(task)
+	if err := Config.Read(task); err != nil {
+		e.rejectTask(driver, task, mesos.TaskState_TASK_ERROR, err.Error())
+		return
+	}
 
 	transformFunc, exists := transformFunctions[Config.Transform]
 	if !exists {
-		Logger.Errorf("Invalid transformation mode: %s", Config.Transform)
-		os.Exit(1)
+		e.rejectTask(driver, task, mesos.TaskState_TASK_ERROR, fmt.Sprintf("Invalid transformation mode: %s", Config.Transform))
+		return
 	}
 
 	transformSerializer := e.serializer(Config.Transform)
 
-	producer, err := e.newProducer(transformSerializer) //create producer before sending the running status
+	dualWrite, err := NewDualWrite(Config.DualWriteTransform, Config.DualWriteTopic, Config.DualWriteUntil, e.serializer)
 	if err != nil {
-		Logger.Errorf("Failed to create producer: %s", err)
-		os.Exit(1)
+		e.rejectTask(driver, task, mesos.TaskState_TASK_ERROR, err.Error())
+		return
+	}
+
+	producers, err := e.newProducers(Config.producerCount()) //create producers before sending the running status
+	if err != nil {
+		e.rejectTask(driver, task, mesos.TaskState_TASK_FAILED, fmt.Sprintf("Failed to create producer: %s", err))
+		return
+	}
+
+	e.activate = make(chan struct{})
+	e.stop = make(chan struct{})
+	standby := isStandby(task)
+	if port := taskPort(task); port > 0 {
+		e.startAdminServer(port)
 	}
 
 	runStatus := &mesos.TaskStatus{
@@ -72,88 +105,432 @@ func (e *Executor) LaunchTask(driver executor.ExecutorDriver, task *mesos.TaskIn
 		Logger.Errorf("Failed to send status update: %s", runStatus)
 		os.Exit(1) //TODO not sure if we should exit in this case, but probably yes
 	}
+	if task.GetHealthCheck() != nil {
+		go e.watchHealth(driver, task)
+	}
 
 	go func() {
-		e.server = NewStatsDServer("0.0.0.0:8125", producer, transformFunc, e.Host) //TODO I know we want to listen to 8125 only in our case but still this should be configurable
-		e.server.Start()
+		if standby {
+			e.awaitActivation()
+		}
 
-		// finish task
-		Logger.Infof("Finishing task %s", task.GetName())
-		finStatus := &mesos.TaskStatus{
-			TaskId: task.GetTaskId(),
-			State:  mesos.TaskState_TASK_FINISHED.Enum(),
+		e.lock.Lock()
+		select {
+		case <-e.stop: // killed before the server got started
+			e.lock.Unlock()
+			for _, producer := range producers {
+				producer.Close(time.Second)
+			}
+			e.finishTask(driver, task, mesos.TaskState_TASK_KILLED)
+			return
+		default:
 		}
-		if _, err := driver.SendStatusUpdate(finStatus); err != nil {
-			Logger.Errorf("Failed to send status update: %s", finStatus)
-			os.Exit(1)
+		e.server = NewStatsDServer(fmt.Sprintf("0.0.0.0:%d", Config.listenPort()), producers, transformFunc, transformSerializer, e.Host)
+		e.server.dualWrite = dualWrite
+		e.server.subjects = e.schemaSubjects()
+		e.server.memoryLimit = taskMemory(task)
+		e.lock.Unlock()
+		e.shipLogs()
+		e.advertise(Config.listenPort())
+		go e.reportStats(driver)
+		if Config.BrokerDnsTtl > 0 {
+			go e.watchBrokers()
 		}
-		Logger.Infof("Task %s has finished", task.GetName())
+		e.server.Start()
+
+		e.finishTask(driver, task, mesos.TaskState_TASK_FINISHED)
 	}()
 }
 
+func (e *Executor) finishTask(driver executor.ExecutorDriver, task *mesos.TaskInfo, state mesos.TaskState) {
+	Logger.Infof("Finishing task %s", task.GetName())
+	finStatus := &mesos.TaskStatus{
+		TaskId: task.GetTaskId(),
+		State:  state.Enum(),
+	}
+	if _, err := driver.SendStatusUpdate(finStatus); err != nil {
+		Logger.Errorf("Failed to send status update: %s", finStatus)
+		os.Exit(1)
+	}
+	Logger.Infof("Task %s has finished", task.GetName())
+}
+
+// rejectTask reports a task that could not be started and stops the executor. TASK_ERROR means the task data is
+// invalid and relaunching it won't help, TASK_FAILED is used for errors that may go away on retry.
+func (e *Executor) rejectTask(driver executor.ExecutorDriver, task *mesos.TaskInfo, state mesos.TaskState, message string) {
+	Logger.Errorf("Rejecting task %s: %s", task.GetName(), message)
+	status := &mesos.TaskStatus{
+		TaskId:  task.GetTaskId(),
+		State:   state.Enum(),
+		Message: proto.String(message),
+	}
+	if _, err := driver.SendStatusUpdate(status); err != nil {
+		Logger.Errorf("Failed to send status update: %s", status)
+		os.Exit(1)
+	}
+	// give the agent time to receive the update before the executor exits
+	time.AfterFunc(rejectStopDelay, func() { driver.Stop() })
+}
+
+// awaitActivation keeps a standby task idle with producers connected until the scheduler activates or kills it.
+func (e *Executor) awaitActivation() {
+	Logger.Info("Running as standby, waiting for activation")
+	select {
+	case <-e.activate:
+		Logger.Info("Standby task activated")
+	case <-e.stop:
+	}
+}
+
+func isStandby(task *mesos.TaskInfo) bool {
+	for _, label := range task.GetLabels().GetLabels() {
+		if label.GetKey() == standbyLabel && label.GetValue() == "true" {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Executor) KillTask(driver executor.ExecutorDriver, id *mesos.TaskID) {
 	Logger.Infof("[KillTask] %s", id.GetValue())
-	e.server.Stop()
+	e.stopServer()
 }
 
 func (e *Executor) FrameworkMessage(driver executor.ExecutorDriver, message string) {
 	Logger.Infof("[FrameworkMessage] %s", message)
+
+	executorMessage, err := ParseExecutorMessage(message)
+	if err != nil {
+		Logger.Warnf("Failed to parse framework message: %s", err)
+		return
+	}
+
+	switch executorMessage.Type {
+	case MessageActivate:
+		if e.activate != nil {
+			e.activateOnce.Do(func() { close(e.activate) })
+		}
+	case MessageRotate:
+		err := e.rotate(executorMessage.File, executorMessage.Properties)
+		if err != nil {
+			Logger.Warnf("Failed to reload producer properties: %s", err)
+		}
+		if _, err := driver.SendFrameworkMessage(NewRotatedMessage(e.Host, err).String()); err != nil {
+			Logger.Warnf("Failed to report reloaded producer properties: %s", err)
+		}
+	case MessageConfig:
+		err := e.applyConfig(executorMessage.Config)
+		if err != nil {
+			Logger.Warnf("Failed to apply config version %d: %s", executorMessage.Version, err)
+		}
+		if _, err := driver.SendFrameworkMessage(NewAppliedMessage(e.Host, executorMessage.Version, err).String()); err != nil {
+			Logger.Warnf("Failed to acknowledge config version %d: %s", executorMessage.Version, err)
+		}
+	case MessageDrain:
+		err := e.drainKafka(executorMessage.Until)
+		if err != nil {
+			Logger.Warnf("Failed to drain Kafka: %s", err)
+		}
+		if _, err := driver.SendFrameworkMessage(NewDrainedMessage(e.Host, err).String()); err != nil {
+			Logger.Warnf("Failed to acknowledge Kafka drain: %s", err)
+		}
+	case MessageTap:
+		e.tap(driver, executorMessage.Tap)
+	default:
+		Logger.Warnf("Unknown framework message type: %s", executorMessage.Type)
+	}
+}
+
+// drainKafka makes the running server buffer records until the unix time, resuming right away for 0.
+func (e *Executor) drainKafka(until int64) error {
+	server := e.runningServer()
+	if server == nil {
+		return errors.New("server is not running")
+	}
+
+	if until == 0 {
+		return server.drainKafka(time.Time{})
+	}
+	return server.drainKafka(time.Unix(until, 0))
 }
 
 func (e *Executor) Shutdown(driver executor.ExecutorDriver) {
 	Logger.Infof("[Shutdown]")
-	e.server.Stop()
+	e.stopServer()
+
+	// the executor exits once the driver stops, give producers the grace period to flush first
+	e.lock.Lock()
+	server := e.server
+	e.lock.Unlock()
+	if server != nil && !server.Wait(Config.killGracePeriod()) {
+		Logger.Warnf("Server did not flush within the kill grace period %s", Config.killGracePeriod())
+	}
+}
+
+// stopServer stops the running server or, for a standby task not activated yet, makes it finish without starting one.
+func (e *Executor) stopServer() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.server != nil {
+		e.server.Stop()
+	} else if e.stop != nil {
+		e.stopOnce.Do(func() { close(e.stop) })
+	}
 }
 
 func (e *Executor) Error(driver executor.ExecutorDriver, message string) {
 	Logger.Errorf("[Error] %s", message)
 }
 
-func (e *Executor) newProducer(valueSerializer func(interface{}) ([]byte, error)) (*producer.KafkaProducer, error) {
-	if Config.ProducerProperties != "" {
-		producerConfig, err := producer.ProducerConfigFromFile(Config.ProducerProperties)
-		if err != nil {
-			return nil, err
+func (e *Executor) reportStats(driver executor.ExecutorDriver) {
+	ticker := time.NewTicker(statsReportInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if e.server.isClosed() {
+			return
+		}
+
+		message := NewStatsMessage(e.server.Stats())
+		Logger.Debugf("Reporting stats: %s", message)
+		if _, err := driver.SendFrameworkMessage(message.String()); err != nil {
+			Logger.Warnf("Failed to send stats: %s", err)
 		}
+	}
+}
 
-		c, err := cfg.LoadNewMap(Config.ProducerProperties)
+// newProducer creates a producer for already encoded values, serialization and validation happen before records are sent.
+func newProducer() (*producer.KafkaProducer, error) {
+	return Config.newProducer()
+}
+
+func (c *config) newProducer() (*producer.KafkaProducer, error) {
+	producerConfig := producer.NewProducerConfig()
+	if c.ProducerProperties != "" {
+		var err error
+		producerConfig, err = producer.ProducerConfigFromFile(c.ProducerProperties)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		connectorConfig := siesta.NewConnectorConfig()
-		connectorConfig.BrokerList = strings.Split(c["bootstrap.servers"], ",")
+	if c.ProduceTimeout > 0 {
+		limitProduceTimeout(producerConfig, c.ProduceTimeout)
+	}
 
-		connector, err := siesta.NewDefaultConnector(connectorConfig)
+	brokers, err := c.bootstrapBrokers()
+	if err != nil {
+		return nil, err
+	}
+
+	connectorConfig := siesta.NewConnectorConfig()
+	connectorConfig.BrokerList = brokers
+
+	connector, err := siesta.NewDefaultConnector(connectorConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return producer.NewKafkaProducer(producerConfig, producer.ByteSerializer, producer.ByteSerializer, connector), nil
+}
+
+// limitProduceTimeout caps producer timeouts and linger so a produce request completes or fails within the timeout.
+func limitProduceTimeout(producerConfig *producer.ProducerConfig, timeout time.Duration) {
+	if producerConfig.Linger > timeout {
+		producerConfig.Linger = timeout
+	}
+	if producerConfig.ReadTimeout > timeout {
+		producerConfig.ReadTimeout = timeout
+	}
+	if producerConfig.WriteTimeout > timeout {
+		producerConfig.WriteTimeout = timeout
+	}
+	if timeoutMs := int32(timeout / time.Millisecond); producerConfig.AckTimeoutMs > timeoutMs {
+		producerConfig.AckTimeoutMs = timeoutMs
+	}
+}
+
+// bootstrapBrokers returns bootstrap.servers from producer properties if set, otherwise the broker list.
+func bootstrapBrokers() ([]string, error) {
+	return Config.bootstrapBrokers()
+}
+
+func (c *config) bootstrapBrokers() ([]string, error) {
+	if c.ProducerProperties != "" {
+		properties, err := cfg.LoadNewMap(c.ProducerProperties)
 		if err != nil {
 			return nil, err
 		}
 
-		return producer.NewKafkaProducer(producerConfig, producer.ByteSerializer, valueSerializer, connector), nil
-	} else {
-		producerConfig := producer.NewProducerConfig()
-		connectorConfig := siesta.NewConnectorConfig()
-		connectorConfig.BrokerList = strings.Split(Config.BrokerList, ",")
+		return strings.Split(properties["bootstrap.servers"], ","), nil
+	}
+
+	return strings.Split(c.BrokerList, ","), nil
+}
+
+// watchBrokers reconnects producers when bootstrap brokers resolve to new addresses or producing keeps failing.
+// Connections are resolved on creation only, so without this executors stay connected to dead addresses.
+func (e *Executor) watchBrokers() {
+	brokers, err := bootstrapBrokers()
+	if err != nil {
+		Logger.Warnf("Not watching bootstrap brokers: %s", err)
+		return
+	}
+	resolver := newBootstrapResolver(brokers)
+
+	ticker := time.NewTicker(brokerFailureCheckInterval)
+	defer ticker.Stop()
+
+	lastCheck := time.Now()
+	for range ticker.C {
+		if e.server.isClosed() {
+			return
+		}
+
+		reason := ""
+		if e.server.failing(brokerFailureThreshold) {
+			resolver.changed()
+			reason = "produce requests keep failing"
+		} else if time.Since(lastCheck) >= Config.BrokerDnsTtl {
+			lastCheck = time.Now()
+			if resolver.changed() {
+				reason = "bootstrap broker addresses changed"
+			}
+		}
+
+		if reason != "" {
+			if err := e.reconnect(reason); err != nil {
+				Logger.Warnf("Failed to reconnect to Kafka: %s", err)
+			}
+			lastCheck = time.Now()
+		}
+	}
+}
+
+func (e *Executor) reconnect(reason string) error {
+	Logger.Infof("Reconnecting to Kafka: %s", reason)
+	producers, err := e.newProducers(len(e.server.shards))
+	if err != nil {
+		return err
+	}
 
-		connector, err := siesta.NewDefaultConnector(connectorConfig)
+	e.server.replaceProducers(producers)
+	return nil
+}
+
+// newProducers creates count producers, closing the ones already created if any fails.
+func (e *Executor) newProducers(count int) ([]*producer.KafkaProducer, error) {
+	producers := make([]*producer.KafkaProducer, count)
+	for i := range producers {
+		producer, err := newProducer()
 		if err != nil {
+			for _, created := range producers[:i] {
+				created.Close(time.Second)
+			}
 			return nil, err
 		}
+		producers[i] = producer
+	}
+	return producers, nil
+}
 
-		return producer.NewKafkaProducer(producerConfig, producer.ByteSerializer, valueSerializer, connector), nil
+// rotate writes new producer properties to the sandbox and reconnects with them, keeping the previous ones on failure.
+func (e *Executor) rotate(file string, properties string) error {
+	e.lock.Lock()
+	running := e.server != nil
+	e.lock.Unlock()
+	if !running {
+		return errors.New("server is not running")
 	}
+
+	file = filepath.Base(file)
+	previousFile := Config.ProducerProperties
+	previous, readErr := ioutil.ReadFile(file)
+	if err := ioutil.WriteFile(file, []byte(properties), 0600); err != nil {
+		return err
+	}
+	Config.ProducerProperties = file
+
+	if err := e.reconnect("producer properties rotated"); err != nil {
+		if readErr == nil {
+			ioutil.WriteFile(file, previous, 0600)
+		}
+		Config.ProducerProperties = previousFile
+		return err
+	}
+	return nil
 }
 
-func (e *Executor) serializer(transform string) func(interface{}) ([]byte, error) {
+// applyConfig applies a config delta pushed by the scheduler to the running server, keeping previous settings on failure.
+func (e *Executor) applyConfig(delta *ConfigDelta) error {
+	e.lock.Lock()
+	server := e.server
+	e.lock.Unlock()
+	if server == nil {
+		return errors.New("server is not running")
+	}
+	if delta == nil {
+		return errors.New("no config in message")
+	}
+
+	transformFunc, exists := transformFunctions[delta.Transform]
+	if delta.Transform != "" {
+		if !exists {
+			return fmt.Errorf("Invalid transformation mode: %s", delta.Transform)
+		}
+		if delta.Transform == TransformAvro && Config.SchemaRegistryUrl == "" {
+			return errors.New("schema.registry.url is required for avro transform")
+		}
+	}
+
+	if delta.BrokerList != "" {
+		previous := Config.BrokerList
+		Config.BrokerList = delta.BrokerList
+		if err := e.reconnect("broker list changed"); err != nil {
+			Config.BrokerList = previous
+			return err
+		}
+	}
+	if delta.Topic != "" {
+		Config.Topic = delta.Topic
+		server.setDestinations(destinationsFromConfig())
+	}
+	if delta.Transform != "" {
+		Config.Transform = delta.Transform
+		server.setTransform(transformFunc, e.serializer(delta.Transform), validateFunctions[delta.Transform])
+	}
+	return nil
+}
+
+// serializer returns how records are encoded for a topic.
+func (e *Executor) serializer(transform string) func(string, interface{}) ([]byte, error) {
 	switch transform {
 	case TransformNone:
-		return producer.StringSerializer
+		return anyTopic(producer.StringSerializer)
 	case TransformAvro:
-		return avro.NewKafkaAvroEncoder(Config.SchemaRegistryUrl).Encode
+		return e.schemaSubjects().encode
 	case TransformProto:
-		return producer.ByteSerializer
+		return anyTopic(producer.ByteSerializer)
 	}
 
 	// should not happen
 	panic("Unknown transformation type")
 }
+
+// schemaSubjects returns the subjects avro encodings register their schema under, shared by all serializers so ids
+// are looked up once per topic. Nil without a schema registry.
+func (e *Executor) schemaSubjects() *schemaSubjects {
+	e.subjectsOnce.Do(func() {
+		if Config.SchemaRegistryUrl != "" {
+			e.subjects = newSchemaSubjects(Config.SchemaRegistryUrl)
+		}
+	})
+	return e.subjects
+}
+
+func anyTopic(serializer func(interface{}) ([]byte, error)) func(string, interface{}) ([]byte, error) {
+	return func(topic string, value interface{}) ([]byte, error) {
+		return serializer(value)
+	}
+}
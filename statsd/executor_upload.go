@@ -0,0 +1,254 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// uploadedExecutorsDir keeps uploaded executors apart from the artifact directory, where the executor is detected
+	// at startup.
+	uploadedExecutorsDir   = "executors"
+	uploadedExecutorPrefix = "executor-"
+)
+
+// maxExecutorSize limits uploaded executor binaries.
+var maxExecutorSize int64 = 512 * 1024 * 1024
+
+var executorVersionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// UploadedExecutor is an executor binary stored by the upload API.
+type UploadedExecutor struct {
+	Version  string
+	Sha256   string
+	Size     int64
+	Uploaded time.Time
+	Current  bool // used for servers launched from now on
+}
+
+func uploadedExecutorName(version string) string {
+	return uploadedExecutorPrefix + version
+}
+
+func (c *config) uploadedExecutorsDir() (string, error) {
+	dir, err := c.artifactDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, uploadedExecutorsDir), nil
+}
+
+// uploadedExecutorPath returns the path of a stored executor version, errArtifactNotFound if there is none.
+func (c *config) uploadedExecutorPath(version string) (string, error) {
+	if !executorVersionPattern.MatchString(version) {
+		return "", errArtifactNotFound
+	}
+	dir, err := c.uploadedExecutorsDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, uploadedExecutorName(version))
+	if _, _, err := artifactFile(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// executorName is the executor servers are launched with: the uploaded version in use, the startup executor otherwise.
+func (c *config) executorName() string {
+	if c.ExecutorUpload != "" {
+		return uploadedExecutorName(c.ExecutorUpload)
+	}
+	return c.Executor
+}
+
+func validateExecutorUpload(config *config, version string) error {
+	if version == "none" {
+		return nil
+	}
+	if _, err := config.uploadedExecutorPath(version); err != nil {
+		return fmt.Errorf("Executor version %s is not uploaded", version)
+	}
+	return nil
+}
+
+// setExecutorUploadConfig switches servers launched from now on to an uploaded executor version, none switches back
+// to the executor the scheduler was started with.
+func setExecutorUploadConfig(queryParams url.Values, config *config) {
+	switch version := queryParams.Get("executor.upload"); version {
+	case "":
+	case "none":
+		config.ExecutorUpload = ""
+	default:
+		config.ExecutorUpload = version
+	}
+}
+
+// storeExecutor saves the uploaded binary as the version if its SHA-256 matches. Versions can't be replaced, storing
+// the same binary again succeeds. Returns whether the version was stored by this call.
+func (s *Scheduler) storeExecutor(version string, sha256sum string, body io.Reader) (bool, error) {
+	dir, err := s.config.uploadedExecutorsDir()
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, err
+	}
+
+	file, err := ioutil.TempFile(dir, ".upload-")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(file.Name())
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to receive executor: %s", err)
+	}
+
+	checksum := hex.EncodeToString(hash.Sum(nil))
+	if !strings.EqualFold(checksum, sha256sum) {
+		return false, fmt.Errorf("Executor checksum mismatch: expected %s, actual %s", sha256sum, checksum)
+	}
+	if version == "" {
+		version = checksum[:12]
+	}
+
+	path := filepath.Join(dir, uploadedExecutorName(version))
+	if _, info, err := artifactFile(path); err == nil {
+		existing, err := s.checksums.checksum(path, info)
+		if err != nil {
+			return false, err
+		}
+		if hex.EncodeToString(existing) != checksum {
+			return false, fmt.Errorf("Executor version %s is already uploaded with sha256 %s", version, hex.EncodeToString(existing))
+		}
+		return false, nil
+	}
+
+	if err := os.Chmod(file.Name(), 0755); err != nil {
+		return false, err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return false, err
+	}
+	s.logger.Infof("Stored executor version %s (sha256 %s)", version, checksum)
+	return true, nil
+}
+
+// uploadedExecutors lists stored executor versions, the most recently uploaded first.
+func (s *Scheduler) uploadedExecutors() ([]*UploadedExecutor, error) {
+	dir, err := s.config.uploadedExecutorsDir()
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	executors := make([]*UploadedExecutor, 0)
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || !strings.HasPrefix(info.Name(), uploadedExecutorPrefix) {
+			continue
+		}
+		sum, err := s.checksums.checksum(filepath.Join(dir, info.Name()), info)
+		if err != nil {
+			return nil, err
+		}
+		version := strings.TrimPrefix(info.Name(), uploadedExecutorPrefix)
+		executors = append(executors, &UploadedExecutor{
+			Version:  version,
+			Sha256:   hex.EncodeToString(sum),
+			Size:     info.Size(),
+			Uploaded: info.ModTime(),
+			Current:  version == s.config.ExecutorUpload,
+		})
+	}
+	sort.Slice(executors, func(i, j int) bool { return executors[i].Uploaded.After(executors[j].Uploaded) })
+	return executors, nil
+}
+
+// handleExecutor stores an executor binary posted as request body, or lists stored versions on GET.
+func (hs *HttpServer) handleExecutor(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		hs.mutating(hs.uploadExecutor)(w, r)
+		return
+	}
+	hs.authenticated(hs.listExecutors)(w, r)
+}
+
+func (hs *HttpServer) uploadExecutor(w http.ResponseWriter, r *http.Request) {
+	version, sha256sum := r.URL.Query().Get("version"), r.URL.Query().Get("sha256")
+	if sha256sum == "" {
+		respond(false, "sha256 of the executor is required", w)
+		return
+	}
+	if version != "" && !executorVersionPattern.MatchString(version) {
+		respond(false, fmt.Sprintf("Invalid executor version %s, expected letters, digits, dots, dashes and underscores", version), w)
+		return
+	}
+
+	stored, err := hs.sched.storeExecutor(version, sha256sum, http.MaxBytesReader(w, r.Body, maxExecutorSize))
+	if err != nil {
+		respondError(err, w)
+		return
+	}
+	if version == "" {
+		version = strings.ToLower(sha256sum)[:12]
+	}
+	message := fmt.Sprintf("Executor version %s is already uploaded", version)
+	if stored {
+		message = fmt.Sprintf("Executor version %s uploaded", version)
+	}
+	respond(true, fmt.Sprintf("%s, launch servers with it using update --executor.upload %s", message, version), w)
+}
+
+func (hs *HttpServer) listExecutors(w http.ResponseWriter, r *http.Request) {
+	executors, err := hs.sched.uploadedExecutors()
+	if err != nil {
+		respondError(err, w)
+		return
+	}
+
+	message := fmt.Sprintf("%d uploaded executors, servers are launched with %s\n", len(executors), hs.sched.config.executorName())
+	for _, executor := range executors {
+		current := ""
+		if executor.Current {
+			current = " (current)"
+		}
+		message += fmt.Sprintf("  %s%s: sha256 %s, %d bytes, uploaded %s\n", executor.Version, current, executor.Sha256,
+			executor.Size, executor.Uploaded.Format(time.RFC3339))
+	}
+	respondData(message, executors, w)
+}
@@ -0,0 +1,155 @@
+//go:build chaos
+// +build chaos
+
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sync"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+)
+
+// FakeDriver is an in-memory SchedulerDriver recording the calls made by the scheduler. It feeds offers and status
+// updates to the scheduler so failure scenarios can be exercised without a Mesos master.
+type FakeDriver struct {
+	scheduler *Scheduler
+
+	Launched []*mesos.TaskInfo
+	Killed   []string
+	Declined []string
+	Messages []string
+	revives  int
+	offerId  int
+	lock     sync.Mutex
+}
+
+// NewFakeScheduler returns a scheduler wired to a fake driver, ready to receive offers once registered. It gets a copy
+// of the package configuration, so tests can change it without affecting each other.
+func NewFakeScheduler() (*Scheduler, *FakeDriver) {
+	config := *Config
+	s := NewScheduler(&config, Logger, nil)
+	return s, &FakeDriver{scheduler: s}
+}
+
+// Register makes the scheduler registered with a fake master.
+func (d *FakeDriver) Register() {
+	d.scheduler.Registered(d, util.NewFrameworkID("fake-framework"), util.NewMasterInfo("fake-master", 0, 5050))
+}
+
+// Offer sends an offer with given resources on the host to the scheduler and returns its id.
+func (d *FakeDriver) Offer(hostname string, cpus float64, mem float64) string {
+	d.lock.Lock()
+	d.offerId++
+	id := fmt.Sprintf("offer-%d", d.offerId)
+	d.lock.Unlock()
+
+	offer := util.NewOffer(util.NewOfferID(id), util.NewFrameworkID("fake-framework"), util.NewSlaveID("slave-"+hostname), hostname)
+	offer.Resources = []*mesos.Resource{
+		util.NewScalarResource("cpus", cpus),
+		util.NewScalarResource("mem", mem),
+		util.NewRangesResource("ports", []*mesos.Value_Range{util.NewValueRange(31000, 32000)}),
+	}
+	d.scheduler.ResourceOffers(d, []*mesos.Offer{offer})
+	return id
+}
+
+// Update sends a status update for the task to the scheduler.
+func (d *FakeDriver) Update(taskId string, state mesos.TaskState) {
+	d.scheduler.StatusUpdate(d, util.NewTaskStatus(util.NewTaskID(taskId), state))
+}
+
+func (d *FakeDriver) Revives() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.revives
+}
+
+func (d *FakeDriver) Start() (mesos.Status, error) { return mesos.Status_DRIVER_RUNNING, nil }
+
+func (d *FakeDriver) Stop(failover bool) (mesos.Status, error) {
+	return mesos.Status_DRIVER_STOPPED, nil
+}
+
+func (d *FakeDriver) Abort() (mesos.Status, error) { return mesos.Status_DRIVER_ABORTED, nil }
+
+func (d *FakeDriver) Join() (mesos.Status, error) { return mesos.Status_DRIVER_STOPPED, nil }
+
+func (d *FakeDriver) Run() (mesos.Status, error) { return mesos.Status_DRIVER_STOPPED, nil }
+
+func (d *FakeDriver) RequestResources(requests []*mesos.Request) (mesos.Status, error) {
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *FakeDriver) AcceptOffers(offerIds []*mesos.OfferID, operations []*mesos.Offer_Operation, filters *mesos.Filters) (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, operation := range operations {
+		if operation.GetType() == mesos.Offer_Operation_LAUNCH {
+			d.Launched = append(d.Launched, operation.GetLaunch().GetTaskInfos()...)
+		}
+	}
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *FakeDriver) LaunchTasks(offerIds []*mesos.OfferID, tasks []*mesos.TaskInfo, filters *mesos.Filters) (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.Launched = append(d.Launched, tasks...)
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *FakeDriver) KillTask(taskId *mesos.TaskID) (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.Killed = append(d.Killed, taskId.GetValue())
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *FakeDriver) DeclineOffer(offerId *mesos.OfferID, filters *mesos.Filters) (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.Declined = append(d.Declined, offerId.GetValue())
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *FakeDriver) ReviveOffers() (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.revives++
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *FakeDriver) SendFrameworkMessage(executorId *mesos.ExecutorID, slaveId *mesos.SlaveID, data string) (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.Messages = append(d.Messages, data)
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *FakeDriver) ReconcileTasks(statuses []*mesos.TaskStatus) (mesos.Status, error) {
+	return mesos.Status_DRIVER_RUNNING, nil
+}
@@ -0,0 +1,211 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+const (
+	SpreadHostname = "hostname"
+	SpreadZone     = "zone"
+	SpreadRegion   = "region"
+)
+
+const unknownDomain = "unknown"
+
+var faultDomainCheckInterval = time.Minute
+
+// spreadWindow is how recently an agent must have matched an offer to count as a place a server could go.
+var spreadWindow = time.Minute
+
+func validateSpread(spread string) error {
+	switch spread {
+	case SpreadHostname, SpreadZone, SpreadRegion:
+		return nil
+	}
+
+	return fmt.Errorf("Invalid spread %s, expected zone|region|hostname", spread)
+}
+
+// spreadsDomains tells whether servers are spread across zones or regions rather than just hosts.
+func spreadsDomains(c *config) bool {
+	return c.Spread == SpreadZone || c.Spread == SpreadRegion
+}
+
+type faultDomain struct {
+	Region string
+	Zone   string
+}
+
+// faultDomains holds the fault domains the master reports for its agents, keyed by hostname.
+type faultDomains struct {
+	domains map[string]faultDomain
+	lock    sync.Mutex
+}
+
+func newFaultDomains() *faultDomains {
+	return &faultDomains{domains: make(map[string]faultDomain)}
+}
+
+func (d *faultDomains) Replace(domains map[string]faultDomain) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.domains = domains
+}
+
+func (d *faultDomains) Get(hostname string) faultDomain {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.domains[hostname]
+}
+
+func masterFaultDomains(state *MasterState) map[string]faultDomain {
+	domains := make(map[string]faultDomain)
+	for _, slave := range state.Slaves {
+		if slave.Domain == nil || slave.Domain.FaultDomain == nil {
+			continue
+		}
+
+		domain := faultDomain{}
+		if region := slave.Domain.FaultDomain.Region; region != nil {
+			domain.Region = region.Name
+		}
+		if zone := slave.Domain.FaultDomain.Zone; zone != nil {
+			domain.Zone = zone.Name
+		}
+		domains[slave.Hostname] = domain
+	}
+	return domains
+}
+
+// watchFaultDomains keeps agent fault domains in sync with the master. The vendored scheduler API doesn't carry
+// domains in offers, so they are read from the master state.
+func (s *Scheduler) watchFaultDomains() {
+	ticker := time.NewTicker(faultDomainCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if spreadsDomains(s.config) {
+			if state, err := fetchMasterState(s.currentMasterUrl()); err != nil {
+				s.logger.Debugf("Failed to fetch agent fault domains: %s", err)
+			} else {
+				s.domains.Replace(masterFaultDomains(state))
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// spreadDomain returns the zone or region servers on the host count towards. Agents the master reports no fault
+// domain for fall back to their attribute of the same name.
+func (s *Scheduler) spreadDomain(hostname string) string {
+	var domain string
+	switch s.config.Spread {
+	case SpreadZone:
+		domain = s.domains.Get(hostname).Zone
+	case SpreadRegion:
+		domain = s.domains.Get(hostname).Region
+	default:
+		return hostname
+	}
+
+	if domain == "" {
+		if agent := s.agents.Get(hostname); agent != nil {
+			domain = agent.Attributes[s.config.Spread]
+		}
+	}
+	if domain == "" {
+		return unknownDomain
+	}
+	return domain
+}
+
+func (s *Scheduler) spreadCounts() map[string]int {
+	counts := make(map[string]int)
+	for host := range s.cluster.GetTasksByHost() {
+		counts[s.spreadDomain(host)]++
+	}
+	return counts
+}
+
+// checkSpread returns why no new server should be launched with the offer: its zone or region already runs more
+// servers than another one with an agent that recently matched and doesn't run a server yet.
+func (s *Scheduler) checkSpread(offer *mesos.Offer) *Decline {
+	if !spreadsDomains(s.config) || s.config.Instances == InstancesUnlimited {
+		return nil
+	}
+
+	counts := s.spreadCounts()
+	domain := s.spreadDomain(offer.GetHostname())
+	for _, agent := range s.agents.List() {
+		if agent.Hostname == offer.GetHostname() || time.Since(agent.LastMatched) > spreadWindow ||
+			s.cluster.Exists(agent.Hostname) || s.evacuated.Contains(agent.Hostname) {
+			continue
+		}
+
+		if other := s.spreadDomain(agent.Hostname); counts[other] < counts[domain] {
+			return declined(DeclineSpread, "%s %s runs %d servers, %s %s runs %d.", s.config.Spread, domain, counts[domain],
+				s.config.Spread, other, counts[other])
+		}
+	}
+	return nil
+}
+
+// observeMatches marks agents whose offers could run a server, they are the candidates checkSpread balances across.
+func (s *Scheduler) observeMatches(offers []*mesos.Offer) {
+	if !spreadsDomains(s.config) {
+		return
+	}
+
+	for _, offer := range offers {
+		if s.match(offer) == nil {
+			s.agents.Matched(offer.GetHostname())
+		}
+	}
+}
+
+func (s *Scheduler) spreadStatus() string {
+	if !spreadsDomains(s.config) {
+		return ""
+	}
+
+	counts := s.spreadCounts()
+	domains := make([]string, 0, len(counts))
+	for domain := range counts {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	distribution := make([]string, len(domains))
+	for i, domain := range domains {
+		distribution[i] = fmt.Sprintf("%s: %d", domain, counts[domain])
+	}
+	return fmt.Sprintf("spread by %s: %s\n", s.config.Spread, strings.Join(distribution, ", "))
+}
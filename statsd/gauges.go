@@ -0,0 +1,102 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"sync"
+	"time"
+)
+
+// gaugeTrackerCapacity limits how many gauges are tracked for expiry, gauges beyond it never expire.
+var gaugeTrackerCapacity = 100000
+
+var gaugeExpiryCheckInterval = time.Second
+
+type trackedGauge struct {
+	lastSeen time.Time
+	topics   map[string]struct{}
+}
+
+// GaugeTracker remembers when gauges were last received and to which topics they went.
+type GaugeTracker struct {
+	ttl     time.Duration
+	gauges  map[string]*trackedGauge
+	expired int64
+	lock    sync.Mutex
+}
+
+func NewGaugeTracker(ttl time.Duration) *GaugeTracker {
+	return &GaugeTracker{
+		ttl:    ttl,
+		gauges: make(map[string]*trackedGauge),
+	}
+}
+
+func (gt *GaugeTracker) enabled() bool {
+	return gt.ttl > 0
+}
+
+func (gt *GaugeTracker) Seen(name string, topic string) {
+	gt.lock.Lock()
+	defer gt.lock.Unlock()
+
+	gauge, exists := gt.gauges[name]
+	if !exists {
+		if len(gt.gauges) >= gaugeTrackerCapacity {
+			return
+		}
+		gauge = &trackedGauge{topics: make(map[string]struct{})}
+		gt.gauges[name] = gauge
+	}
+
+	gauge.lastSeen = time.Now()
+	gauge.topics[topic] = struct{}{}
+}
+
+// Expire forgets gauges not seen for the ttl and returns them with the topics they were produced to.
+func (gt *GaugeTracker) Expire() map[string][]string {
+	gt.lock.Lock()
+	defer gt.lock.Unlock()
+
+	expired := make(map[string][]string)
+	for name, gauge := range gt.gauges {
+		if time.Since(gauge.lastSeen) < gt.ttl {
+			continue
+		}
+
+		topics := make([]string, 0, len(gauge.topics))
+		for topic := range gauge.topics {
+			topics = append(topics, topic)
+		}
+		expired[name] = topics
+		delete(gt.gauges, name)
+	}
+
+	gt.expired += int64(len(expired))
+	return expired
+}
+
+func (gt *GaugeTracker) Expired() int64 {
+	gt.lock.Lock()
+	defer gt.lock.Unlock()
+
+	return gt.expired
+}
+
+// gaugeExpiry returns the marker produced for a gauge that stopped reporting, e.g. "queue.size:expired|g".
+func gaugeExpiry(name string) string {
+	return name + ":expired|g"
+}
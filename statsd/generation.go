@@ -0,0 +1,132 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesos/mesos-go/scheduler"
+)
+
+// taskGroup prefixes task ids and names of servers.
+const taskGroup = "statsd-kafka"
+
+// generationCounter counts tasks launched per host. Counters are persisted, so task ids stay unique and comparable
+// across scheduler restarts and failovers.
+type generationCounter struct {
+	last map[string]int // hostname -> generation of the last task launched there
+	lock sync.Mutex
+}
+
+// Next returns the generation of a task about to be launched on the host.
+func (g *generationCounter) Next(host string) int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.last == nil {
+		g.last = make(map[string]int)
+	}
+	g.last[host]++
+	return g.last[host]
+}
+
+// Observe raises the counter to a generation seen in a status update, e.g. launched by a previous leader after it last
+// saved the state. Returns false if the generation was already counted.
+func (g *generationCounter) Observe(host string, generation int) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.last == nil {
+		g.last = make(map[string]int)
+	}
+	if generation <= g.last[host] {
+		return false
+	}
+	g.last[host] = generation
+	return true
+}
+
+func (g *generationCounter) Snapshot() map[string]int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	snapshot := make(map[string]int)
+	for host, generation := range g.last {
+		snapshot[host] = generation
+	}
+	return snapshot
+}
+
+func (g *generationCounter) Restore(last map[string]int) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.last = make(map[string]int)
+	for host, generation := range last {
+		g.last[host] = generation
+	}
+}
+
+// formatTaskId formats ids like statsd-kafka.slave1.3, i.e. group.host.generation.
+func formatTaskId(host string, generation int) string {
+	return fmt.Sprintf("%s.%s.%d", taskGroup, host, generation)
+}
+
+// parseTaskId returns the host and generation of a task id. Tasks launched before generations were introduced have
+// ids like statsd-kafka-slave1-<uuid> and generation 0.
+func parseTaskId(id string) (string, int) {
+	if strings.HasPrefix(id, taskGroup+".") {
+		rest := strings.TrimPrefix(id, taskGroup+".")
+		if idx := strings.LastIndex(rest, "."); idx != -1 {
+			if generation, err := strconv.Atoi(rest[idx+1:]); err == nil {
+				return rest[:idx], generation
+			}
+		}
+	}
+
+	tokens := strings.SplitN(id, "-", 3)
+	hostname := tokens[len(tokens)-1]
+	if len(hostname) > 37 {
+		hostname = hostname[:len(hostname)-37] //strip uuid part
+	}
+	return hostname, 0
+}
+
+// checkDuplicate kills a running task the scheduler doesn't know although its generation is known, e.g. launched by
+// a previous leader after it last saved the state, as the host already has a task of a newer generation or gets one.
+func (s *Scheduler) checkDuplicate(driver scheduler.SchedulerDriver, status *mesos.TaskStatus) {
+	id := status.GetTaskId().GetValue()
+	host, generation := parseTaskId(id)
+	if generation == 0 || status.GetState() != mesos.TaskState_TASK_RUNNING {
+		return
+	}
+
+	if task, exists := s.cluster.GetTasksByHost()[host]; exists && task.GetTaskId().GetValue() == id {
+		return
+	}
+	if standby := s.cluster.GetStandby(host); standby != nil && standby.GetTaskId().GetValue() == id {
+		return
+	}
+
+	s.generations.Observe(host, generation)
+	s.logger.Warnf("Task %s of generation %d on %s is unknown, killing the duplicate", id, generation, host)
+	s.timeline.Add(EventTaskStatus, host, id, fmt.Sprintf("killing duplicate generation %d", generation))
+	driver.KillTask(status.GetTaskId())
+}
@@ -0,0 +1,188 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Handoff lets a new scheduler instance take over from a running one without an API gap:
+//  1. new instance asks the old one to prepare: it rejects changes and saves its state for the last time
+//  2. new instance loads the state, starts its API and registers with Mesos using the same framework id
+//  3. once its API is healthy and it is registered, it tells the old instance to stop serving
+//
+// If the new instance is not ready within the handoff timeout, it tells the old instance to resume instead.
+const (
+	HandoffPrepare = "prepare"
+	HandoffStop    = "stop"
+	HandoffAbort   = "abort"
+)
+
+var handoffTimeout = 2 * time.Minute
+
+var handoffCheckInterval = time.Second
+
+// prepareHandoff asks the scheduler being replaced to stop changing state before it is loaded.
+func (s *Scheduler) prepareHandoff() error {
+	s.logger.Infof("Taking over from scheduler at %s", s.config.HandoffFrom)
+	response := callHandoff(s.config.HandoffFrom, HandoffPrepare)
+	if !response.Success {
+		return fmt.Errorf("Scheduler at %s refused handoff: %s", s.config.HandoffFrom, response.Message)
+	}
+	return nil
+}
+
+// completeHandoff stops the replaced scheduler once this one serves the API and is registered, or resumes it on timeout.
+func (s *Scheduler) completeHandoff(stopDriver func()) {
+	deadline := time.Now().Add(handoffTimeout)
+	for !s.handoffReady() {
+		if time.Now().After(deadline) {
+			s.logger.Errorf("Not ready to take over within %s, resuming scheduler at %s", handoffTimeout, s.config.HandoffFrom)
+			callHandoff(s.config.HandoffFrom, HandoffAbort)
+			stopDriver()
+			return
+		}
+		time.Sleep(handoffCheckInterval)
+	}
+
+	response := callHandoff(s.config.HandoffFrom, HandoffStop)
+	if !response.Success {
+		s.logger.Warnf("Failed to stop scheduler at %s: %s", s.config.HandoffFrom, response.Message)
+	}
+	s.timeline.Add(EventHandoff, "", "", fmt.Sprintf("took over from %s", s.config.HandoffFrom))
+}
+
+func (s *Scheduler) handoffReady() bool {
+	if s.currentMasterUrl() == "" {
+		return false
+	}
+
+	client, err := s.config.localApiClient()
+	if err != nil {
+		s.logger.Warnf("Failed to probe API health: %s", err)
+		return false
+	}
+
+	address := s.listenAddr()
+	scheme := s.config.apiUrl()[:strings.Index(s.config.apiUrl(), "://")]
+	response, err := client.Get(scheme + "://127.0.0.1" + address[strings.LastIndex(address, ":"):] + "/health")
+	if err != nil {
+		s.logger.Debugf("API is not healthy yet: %s", err)
+		return false
+	}
+	response.Body.Close()
+	return response.StatusCode == http.StatusOK
+}
+
+func callHandoff(api string, action string) *ApiResponse {
+	request := NewApiRequest(api + "/admin/handoff")
+	request.AddParam("action", action)
+	return request.Get()
+}
+
+// handingOff tells whether a new instance is taking over, in which case changes are rejected and state is not saved.
+func (s *Scheduler) handingOff() bool {
+	s.handoffLock.Lock()
+	defer s.handoffLock.Unlock()
+
+	return s.handoff != nil
+}
+
+// handleHandoff serves handoff requests of a new scheduler instance running on the same host.
+func (hs *HttpServer) handleHandoff(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		respondWithStatus(http.StatusForbidden, false, "Handoff is only accepted from localhost", w)
+		return
+	}
+
+	if err := hs.sched.Handoff(r.URL.Query().Get("action")); err != nil {
+		respond(false, err.Error(), w)
+		return
+	}
+	respond(true, "ok", w)
+}
+
+func (s *Scheduler) Handoff(action string) error {
+	s.handoffLock.Lock()
+	defer s.handoffLock.Unlock()
+
+	switch action {
+	case HandoffPrepare:
+		if s.handoff != nil {
+			return errors.New("Handoff is already in progress")
+		}
+		if s.storage == nil {
+			return errors.New("Handoff requires --storage to pass state")
+		}
+		s.handoff = make(chan struct{})
+		s.saveState()
+		s.timeline.Add(EventHandoff, "", "", "handing off to a new instance")
+	case HandoffStop:
+		if s.handoff == nil {
+			return errors.New("Handoff is not prepared")
+		}
+		close(s.handoff)
+	case HandoffAbort:
+		if s.handoff == nil {
+			return errors.New("Handoff is not prepared")
+		}
+		s.handoff = nil
+		s.stateChanged()
+		s.timeline.Add(EventHandoff, "", "", "handoff aborted, resuming")
+	default:
+		return fmt.Errorf("Invalid handoff action %s, expected prepare|stop|abort", action)
+	}
+
+	return nil
+}
+
+// awaitHandoffStop keeps a scheduler failed over by the new instance serving until it is told to stop.
+func (s *Scheduler) awaitHandoffStop() {
+	s.handoffLock.Lock()
+	handoff := s.handoff
+	s.handoffLock.Unlock()
+	if handoff == nil {
+		return
+	}
+
+	s.logger.Info("Waiting for the new instance to finish handoff")
+	select {
+	case <-handoff:
+	case <-time.After(handoffTimeout):
+	}
+}
+
+// unlessHandingOff rejects changes while a new instance is taking over as they would be lost.
+func (hs *HttpServer) unlessHandingOff(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if hs.sched.handingOff() && !isDryRun(r) {
+			respondWithStatus(http.StatusServiceUnavailable, false, "Scheduler is handing off to a new instance, retry shortly", w)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	respond(true, "ok", w)
+}
@@ -0,0 +1,213 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/mesos/mesos-go/executor"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesos/mesos-go/scheduler"
+)
+
+// livenessPath is the admin endpoint health checks probe.
+const livenessPath = "/live"
+
+const defaultHealthFailures = 3
+
+var (
+	healthCheckTimeout     = 5 * time.Second
+	healthCheckGracePeriod = 30 * time.Second // failed probes right after launch don't count
+)
+
+// healthCheck describes how the server of a task is probed, nil if health checks are disabled. Mesos only runs health
+// checks of tasks started by its own executors, so the executor runs this one itself and reports the result.
+func (s *Scheduler) healthCheck(adminPort uint64) *mesos.HealthCheck {
+	if s.config.HealthInterval <= 0 || adminPort == 0 {
+		return nil
+	}
+
+	return &mesos.HealthCheck{
+		Http: &mesos.HealthCheck_HTTP{
+			Port:     proto.Uint32(uint32(adminPort)),
+			Path:     proto.String(livenessPath),
+			Statuses: []uint32{http.StatusOK},
+		},
+		DelaySeconds:        proto.Float64(0),
+		IntervalSeconds:     proto.Float64(s.config.HealthInterval.Seconds()),
+		TimeoutSeconds:      proto.Float64(healthCheckTimeout.Seconds()),
+		ConsecutiveFailures: proto.Uint32(uint32(s.config.healthFailures())),
+		GracePeriodSeconds:  proto.Float64(healthCheckGracePeriod.Seconds()),
+	}
+}
+
+// checkHealth kills tasks reported unhealthy, they get relaunched like failed ones.
+func (s *Scheduler) checkHealth(driver scheduler.SchedulerDriver, status *mesos.TaskStatus) {
+	if status.Healthy == nil || status.GetHealthy() || status.GetState() != mesos.TaskState_TASK_RUNNING {
+		return
+	}
+
+	taskId := status.GetTaskId().GetValue()
+	if hostname := s.hostnameFromTaskId(taskId); s.inMaintenance(hostname) {
+		s.logger.Infof("Task %s on %s in maintenance is unhealthy: %s", taskId, hostname, status.GetMessage())
+		return
+	}
+	s.logger.Warnf("Killing unhealthy task %s: %s", taskId, status.GetMessage())
+	s.timeline.Add(EventUnhealthy, s.hostnameFromTaskId(taskId), taskId, status.GetMessage())
+	driver.KillTask(status.GetTaskId())
+}
+
+// watchHealth runs the health check of the task until its server stops, reporting when the server becomes unhealthy
+// after the configured number of consecutive failed probes and when it recovers.
+func (e *Executor) watchHealth(driver executor.ExecutorDriver, task *mesos.TaskInfo) {
+	check := task.GetHealthCheck()
+	if check.GetHttp() == nil {
+		return
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", check.GetHttp().GetPort(), check.GetHttp().GetPath())
+	client := &http.Client{Timeout: seconds(check.GetTimeoutSeconds())}
+	launched := time.Now()
+	time.Sleep(seconds(check.GetDelaySeconds()))
+
+	ticker := time.NewTicker(seconds(check.GetIntervalSeconds()))
+	defer ticker.Stop()
+
+	healthy := true
+	failures := uint32(0)
+	for range ticker.C {
+		if e.taskStopped() {
+			return
+		}
+
+		err := probeHealth(client, url, check.GetHttp().GetStatuses())
+		if err == nil {
+			failures = 0
+			if !healthy {
+				healthy = true
+				e.reportHealth(driver, task, true, "")
+			}
+			continue
+		}
+		if time.Since(launched) < seconds(check.GetGracePeriodSeconds()) {
+			continue
+		}
+
+		failures++
+		Logger.Warnf("Health check %d/%d failed: %s", failures, check.GetConsecutiveFailures(), err)
+		if healthy && failures >= check.GetConsecutiveFailures() {
+			healthy = false
+			e.reportHealth(driver, task, false, err.Error())
+		}
+	}
+}
+
+func (e *Executor) taskStopped() bool {
+	if server := e.runningServer(); server != nil {
+		return server.isClosed()
+	}
+
+	select {
+	case <-e.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (e *Executor) reportHealth(driver executor.ExecutorDriver, task *mesos.TaskInfo, healthy bool, message string) {
+	status := &mesos.TaskStatus{
+		TaskId:  task.GetTaskId(),
+		State:   mesos.TaskState_TASK_RUNNING.Enum(),
+		Healthy: proto.Bool(healthy),
+		Message: proto.String(message),
+	}
+	if _, err := driver.SendStatusUpdate(status); err != nil {
+		Logger.Warnf("Failed to report health: %s", err)
+	}
+}
+
+func probeHealth(client *http.Client, url string, statuses []uint32) error {
+	response, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if len(statuses) == 0 {
+		return nil
+	}
+	for _, status := range statuses {
+		if uint32(response.StatusCode) == status {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s responded %s", url, response.Status)
+}
+
+// handleLive responds 200 while the server accepts metrics on the statsd port, and for standby tasks awaiting activation.
+func (e *Executor) handleLive(w http.ResponseWriter, r *http.Request) {
+	server := e.runningServer()
+	if server == nil {
+		fmt.Fprintln(w, "standby")
+		return
+	}
+
+	if err := server.probe(); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// probe checks the server still holds its UDP port, which can't be bound while the server listens, and accepts TCP
+// connections if enabled.
+func (s *StatsDServer) probe() error {
+	if s.isClosed() {
+		return errors.New("server stopped")
+	}
+
+	udpAddr, err := net.ResolveUDPAddr("udp", s.addr)
+	if err != nil {
+		return err
+	}
+	if connection, err := net.ListenUDP("udp", udpAddr); err == nil {
+		connection.Close()
+		return fmt.Errorf("Nothing listens on UDP %s", s.addr)
+	}
+
+	if Config.Tcp {
+		_, port, err := net.SplitHostPort(s.addr)
+		if err != nil {
+			return err
+		}
+		connection, err := net.DialTimeout("tcp", "127.0.0.1:"+port, time.Second)
+		if err != nil {
+			return err
+		}
+		connection.Close()
+	}
+	return nil
+}
+
+func seconds(value float64) time.Duration {
+	return time.Duration(value * float64(time.Second))
+}
@@ -0,0 +1,140 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	HostWhitelist = "whitelist"
+	HostBlacklist = "blacklist"
+)
+
+// hostLists pins servers to whitelisted hosts, if any, and keeps them off blacklisted ones. Unlike evacuated hosts
+// the lists are persisted with the state.
+type hostLists struct {
+	lists map[string]map[string]bool // list -> hosts
+	lock  sync.Mutex
+}
+
+func newHostLists() *hostLists {
+	return &hostLists{lists: map[string]map[string]bool{
+		HostWhitelist: make(map[string]bool),
+		HostBlacklist: make(map[string]bool),
+	}}
+}
+
+func validateHostList(list string) error {
+	if list != HostWhitelist && list != HostBlacklist {
+		return fmt.Errorf("Invalid list %s, expected whitelist|blacklist", list)
+	}
+	return nil
+}
+
+// Update adds and removes hosts of the list and tells whether it changed.
+func (h *hostLists) Update(list string, add []string, remove []string) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	changed := false
+	for _, host := range add {
+		if !h.lists[list][host] {
+			h.lists[list][host] = true
+			changed = true
+		}
+	}
+	for _, host := range remove {
+		if h.lists[list][host] {
+			delete(h.lists[list], host)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Check returns why no server may run on the host or an empty string if it may.
+func (h *hostLists) Check(host string) *Decline {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.lists[HostBlacklist][host] {
+		return declined(DeclineBlacklisted, "Host %s is blacklisted.", host)
+	}
+	if len(h.lists[HostWhitelist]) > 0 && !h.lists[HostWhitelist][host] {
+		return declined(DeclineBlacklisted, "Host %s is not whitelisted.", host)
+	}
+	return nil
+}
+
+// Snapshot returns the sorted hosts of the list.
+func (h *hostLists) Snapshot(list string) []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	hosts := make([]string, 0, len(h.lists[list]))
+	for host := range h.lists[list] {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+func (h *hostLists) Restore(list string, hosts []string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.lists[list] = make(map[string]bool)
+	for _, host := range hosts {
+		h.lists[list][host] = true
+	}
+}
+
+func (h *hostLists) String() string {
+	status := ""
+	for _, list := range []string{HostWhitelist, HostBlacklist} {
+		if hosts := h.Snapshot(list); len(hosts) > 0 {
+			status += fmt.Sprintf("%s: %s\n", list, strings.Join(hosts, ", "))
+		}
+	}
+	return status
+}
+
+// UpdateHostList changes the whitelist or blacklist. Running servers are not affected, the lists are consulted when
+// servers are launched.
+func (s *Scheduler) UpdateHostList(list string, add []string, remove []string) error {
+	if err := validateHostList(list); err != nil {
+		return err
+	}
+	if !s.hosts.Update(list, add, remove) {
+		return nil
+	}
+
+	s.stateChanged()
+	s.timeline.Add(EventHostLists, "", "", fmt.Sprintf("%s added %s, removed %s", list, hostsString(add), hostsString(remove)))
+	s.reviveOffers(list + " updated")
+	return nil
+}
+
+func hostsString(hosts []string) string {
+	if len(hosts) == 0 {
+		return "none"
+	}
+	return strings.Join(hosts, ", ")
+}
@@ -0,0 +1,436 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/cihub/seelog"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	schedproto "github.com/mesos/mesos-go/mesosproto/scheduler"
+	util "github.com/mesos/mesos-go/mesosutil"
+	"github.com/mesos/mesos-go/scheduler"
+)
+
+const (
+	MesosApiDriver = "driver"
+	MesosApiHttp   = "http"
+)
+
+// httpDriverRetryInterval is how long the HTTP driver waits before subscribing again after losing the master.
+var httpDriverRetryInterval = 2 * time.Second
+
+// httpDriverMissedHeartbeats is how many heartbeats may be missed before the subscription is considered broken.
+var httpDriverMissedHeartbeats = 5
+
+var callClient = &http.Client{Timeout: 10 * time.Second, CheckRedirect: noRedirects}
+var subscribeClient = &http.Client{CheckRedirect: noRedirects}
+
+func noRedirects(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// httpDriver runs the scheduler against the master's v1 HTTP scheduler API instead of the libprocess protocol, so
+// it works with HTTP-only masters. Events are delivered to the same callbacks the driver calls.
+type httpDriver struct {
+	scheduler  scheduler.Scheduler
+	logger     log.LoggerInterface
+	framework  *mesos.FrameworkInfo
+	credential *mesos.Credential // sent as basic auth to masters requiring authentication, if set
+
+	master     string // host:port of the leading master, followed on redirects
+	streamId   string
+	subscribed bool
+	body       io.Closer // subscription stream, closed to stop the driver or resubscribe
+	status     mesos.Status
+	err        error
+	done       chan struct{}
+	lock       sync.Mutex
+}
+
+// newHttpDriver returns a driver for the master at host:port. ZooKeeper master urls are only supported by the
+// libprocess driver.
+func newHttpDriver(s scheduler.Scheduler, logger log.LoggerInterface, framework *mesos.FrameworkInfo, master string) (*httpDriver, error) {
+	if strings.HasPrefix(master, "zk://") {
+		return nil, fmt.Errorf("Master %s: the HTTP scheduler API needs a master host:port", master)
+	}
+
+	master = strings.TrimSuffix(strings.TrimPrefix(master, "http://"), "/")
+	if _, _, err := net.SplitHostPort(master); err != nil {
+		return nil, fmt.Errorf("Invalid master %s: %s", master, err)
+	}
+
+	return &httpDriver{
+		scheduler: s,
+		logger:    logger,
+		framework: framework,
+		master:    master,
+		status:    mesos.Status_DRIVER_NOT_STARTED,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+func (d *httpDriver) Start() (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.status != mesos.Status_DRIVER_NOT_STARTED {
+		return d.status, errors.New("Driver is already started")
+	}
+	d.status = mesos.Status_DRIVER_RUNNING
+	go d.run()
+	return d.status, nil
+}
+
+func (d *httpDriver) Join() (mesos.Status, error) {
+	<-d.done
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.status, d.err
+}
+
+func (d *httpDriver) Run() (mesos.Status, error) {
+	if status, err := d.Start(); err != nil {
+		return status, err
+	}
+	return d.Join()
+}
+
+// Stop ends the subscription. Without failover the framework is torn down, killing its tasks.
+func (d *httpDriver) Stop(failover bool) (mesos.Status, error) {
+	if !failover {
+		if _, err := d.call(newCall(schedproto.Call_TEARDOWN)); err != nil {
+			d.logger.Warnf("Failed to tear down framework: %s", err)
+		}
+	}
+	return d.finish(mesos.Status_DRIVER_STOPPED, nil)
+}
+
+func (d *httpDriver) Abort() (mesos.Status, error) {
+	return d.finish(mesos.Status_DRIVER_ABORTED, nil)
+}
+
+func (d *httpDriver) finish(status mesos.Status, err error) (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.status != mesos.Status_DRIVER_RUNNING {
+		return d.status, errors.New("Driver is not running")
+	}
+	d.status = status
+	d.err = err
+	if d.body != nil {
+		d.body.Close()
+	}
+	close(d.done)
+	return d.status, nil
+}
+
+func (d *httpDriver) running() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.status == mesos.Status_DRIVER_RUNNING
+}
+
+// run keeps the driver subscribed, resubscribing with the same framework id after the master was lost.
+func (d *httpDriver) run() {
+	for d.running() {
+		err := d.subscribe()
+		if !d.running() {
+			return
+		}
+
+		d.logger.Warnf("Subscription to master %s ended: %s", d.getMaster(), err)
+		d.lock.Lock()
+		subscribed := d.subscribed
+		d.lock.Unlock()
+		if subscribed {
+			d.scheduler.Disconnected(d)
+		}
+		time.Sleep(httpDriverRetryInterval)
+	}
+}
+
+func (d *httpDriver) subscribe() error {
+	call := newCall(schedproto.Call_SUBSCRIBE)
+	call.Subscribe = &schedproto.Call_Subscribe{FrameworkInfo: d.framework}
+	call.FrameworkId = d.framework.GetId()
+
+	response, err := d.post(subscribeClient, call)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return responseError(response)
+	}
+
+	d.lock.Lock()
+	if d.status != mesos.Status_DRIVER_RUNNING {
+		d.lock.Unlock()
+		return errors.New("Driver is not running")
+	}
+	d.streamId = response.Header.Get("Mesos-Stream-Id")
+	d.body = response.Body
+	d.lock.Unlock()
+
+	// the master sends heartbeats, a silent stream is closed to resubscribe
+	timeout := 15 * time.Second * time.Duration(httpDriverMissedHeartbeats)
+	watchdog := time.AfterFunc(timeout, func() { response.Body.Close() })
+	defer watchdog.Stop()
+
+	reader := bufio.NewReader(response.Body)
+	for {
+		event, err := readEvent(reader)
+		if err != nil {
+			return err
+		}
+		if interval := event.GetSubscribed().GetHeartbeatIntervalSeconds(); interval > 0 {
+			timeout = time.Duration(interval*float64(time.Second)) * time.Duration(httpDriverMissedHeartbeats)
+		}
+		watchdog.Reset(timeout)
+
+		d.handle(event)
+	}
+}
+
+// readEvent reads one RecordIO framed event: its length in bytes on a line, followed by the protobuf message.
+func readEvent(reader *bufio.Reader) (*schedproto.Event, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid record length %q", line)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+
+	event := new(schedproto.Event)
+	if err := event.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+func (d *httpDriver) handle(event *schedproto.Event) {
+	switch event.GetType() {
+	case schedproto.Event_SUBSCRIBED:
+		id := event.GetSubscribed().GetFrameworkId()
+		d.lock.Lock()
+		d.framework.Id = id
+		resubscribed := d.subscribed
+		d.subscribed = true
+		d.lock.Unlock()
+
+		if resubscribed {
+			d.scheduler.Reregistered(d, d.masterInfo())
+		} else {
+			d.scheduler.Registered(d, id, d.masterInfo())
+		}
+	case schedproto.Event_OFFERS:
+		d.scheduler.ResourceOffers(d, event.GetOffers().GetOffers())
+	case schedproto.Event_RESCIND:
+		d.scheduler.OfferRescinded(d, event.GetRescind().GetOfferId())
+	case schedproto.Event_UPDATE:
+		status := event.GetUpdate().GetStatus()
+		d.scheduler.StatusUpdate(d, status)
+		if status.GetUuid() != nil {
+			d.acknowledge(status)
+		}
+	case schedproto.Event_MESSAGE:
+		message := event.GetMessage()
+		d.scheduler.FrameworkMessage(d, message.GetExecutorId(), message.GetSlaveId(), string(message.GetData()))
+	case schedproto.Event_FAILURE:
+		failure := event.GetFailure()
+		if failure.GetExecutorId() != nil {
+			d.scheduler.ExecutorLost(d, failure.GetExecutorId(), failure.GetSlaveId(), int(failure.GetStatus()))
+		} else if failure.GetSlaveId() != nil {
+			d.scheduler.SlaveLost(d, failure.GetSlaveId())
+		}
+	case schedproto.Event_ERROR:
+		message := event.GetError().GetMessage()
+		d.scheduler.Error(d, message)
+		d.finish(mesos.Status_DRIVER_ABORTED, errors.New(message))
+	}
+}
+
+// acknowledge confirms a status update to the master, which the libprocess driver does implicitly.
+func (d *httpDriver) acknowledge(status *mesos.TaskStatus) {
+	call := newCall(schedproto.Call_ACKNOWLEDGE)
+	call.Acknowledge = &schedproto.Call_Acknowledge{
+		SlaveId: status.GetSlaveId(),
+		TaskId:  status.GetTaskId(),
+		Uuid:    status.GetUuid(),
+	}
+	if _, err := d.call(call); err != nil {
+		d.logger.Warnf("Failed to acknowledge status update of task %s: %s", status.GetTaskId().GetValue(), err)
+	}
+}
+
+func (d *httpDriver) masterInfo() *mesos.MasterInfo {
+	host, portValue, _ := net.SplitHostPort(d.getMaster())
+	port, _ := strconv.ParseUint(portValue, 10, 32)
+
+	master := &mesos.MasterInfo{Hostname: &host, Port: new(uint32)}
+	*master.Port = uint32(port)
+	return master
+}
+
+func (d *httpDriver) getMaster() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.master
+}
+
+// post sends the call to the leading master, following redirects from other masters.
+func (d *httpDriver) post(client *http.Client, call *schedproto.Call) (*http.Response, error) {
+	data, err := call.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	for redirects := 0; ; redirects++ {
+		d.lock.Lock()
+		master, streamId := d.master, d.streamId
+		d.lock.Unlock()
+
+		request, err := http.NewRequest("POST", "http://"+master+"/api/v1/scheduler", bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Content-Type", "application/x-protobuf")
+		request.Header.Set("Accept", "application/x-protobuf")
+		if d.credential != nil {
+			request.SetBasicAuth(d.credential.GetPrincipal(), d.credential.GetSecret())
+		}
+		if streamId != "" && call.GetType() != schedproto.Call_SUBSCRIBE {
+			request.Header.Set("Mesos-Stream-Id", streamId)
+		}
+
+		response, err := client.Do(request)
+		if err != nil || response.StatusCode != http.StatusTemporaryRedirect || redirects >= 3 {
+			return response, err
+		}
+		response.Body.Close()
+
+		location, err := url.Parse(response.Header.Get("Location"))
+		if err != nil || location.Host == "" {
+			return nil, fmt.Errorf("Invalid redirect from master %s to %q", master, response.Header.Get("Location"))
+		}
+		d.logger.Infof("Master %s redirected to leading master %s", master, location.Host)
+		d.lock.Lock()
+		d.master = location.Host
+		d.lock.Unlock()
+	}
+}
+
+// call sends a call other than subscribe, which the master accepts without a response body.
+func (d *httpDriver) call(call *schedproto.Call) (mesos.Status, error) {
+	d.lock.Lock()
+	status := d.status
+	call.FrameworkId = d.framework.GetId()
+	d.lock.Unlock()
+	if status != mesos.Status_DRIVER_RUNNING {
+		return status, errors.New("Driver is not running")
+	}
+
+	response, err := d.post(callClient, call)
+	if err != nil {
+		return status, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusAccepted {
+		return status, responseError(response)
+	}
+	return status, nil
+}
+
+func responseError(response *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	return fmt.Errorf("Master responded %s: %s", response.Status, strings.TrimSpace(string(body)))
+}
+
+func newCall(callType schedproto.Call_Type) *schedproto.Call {
+	return &schedproto.Call{Type: &callType}
+}
+
+func (d *httpDriver) RequestResources(requests []*mesos.Request) (mesos.Status, error) {
+	call := newCall(schedproto.Call_REQUEST)
+	call.Request = &schedproto.Call_Request{Requests: requests}
+	return d.call(call)
+}
+
+func (d *httpDriver) AcceptOffers(offerIds []*mesos.OfferID, operations []*mesos.Offer_Operation, filters *mesos.Filters) (mesos.Status, error) {
+	call := newCall(schedproto.Call_ACCEPT)
+	call.Accept = &schedproto.Call_Accept{OfferIds: offerIds, Operations: operations, Filters: filters}
+	return d.call(call)
+}
+
+func (d *httpDriver) LaunchTasks(offerIds []*mesos.OfferID, tasks []*mesos.TaskInfo, filters *mesos.Filters) (mesos.Status, error) {
+	return d.AcceptOffers(offerIds, []*mesos.Offer_Operation{util.NewLaunchOperation(tasks)}, filters)
+}
+
+func (d *httpDriver) KillTask(taskId *mesos.TaskID) (mesos.Status, error) {
+	call := newCall(schedproto.Call_KILL)
+	call.Kill = &schedproto.Call_Kill{TaskId: taskId}
+	return d.call(call)
+}
+
+func (d *httpDriver) DeclineOffer(offerId *mesos.OfferID, filters *mesos.Filters) (mesos.Status, error) {
+	call := newCall(schedproto.Call_DECLINE)
+	call.Decline = &schedproto.Call_Decline{OfferIds: []*mesos.OfferID{offerId}, Filters: filters}
+	return d.call(call)
+}
+
+func (d *httpDriver) ReviveOffers() (mesos.Status, error) {
+	return d.call(newCall(schedproto.Call_REVIVE))
+}
+
+func (d *httpDriver) SendFrameworkMessage(executorId *mesos.ExecutorID, slaveId *mesos.SlaveID, data string) (mesos.Status, error) {
+	call := newCall(schedproto.Call_MESSAGE)
+	call.Message = &schedproto.Call_Message{SlaveId: slaveId, ExecutorId: executorId, Data: []byte(data)}
+	return d.call(call)
+}
+
+func (d *httpDriver) ReconcileTasks(statuses []*mesos.TaskStatus) (mesos.Status, error) {
+	call := newCall(schedproto.Call_RECONCILE)
+	call.Reconcile = &schedproto.Call_Reconcile{Tasks: make([]*schedproto.Call_Reconcile_Task, 0, len(statuses))}
+	for _, status := range statuses {
+		call.Reconcile.Tasks = append(call.Reconcile.Tasks, &schedproto.Call_Reconcile_Task{TaskId: status.GetTaskId(), SlaveId: status.GetSlaveId()})
+	}
+	return d.call(call)
+}
@@ -18,91 +18,1038 @@ package statsd
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"time"
 
 	mesos "github.com/mesos/mesos-go/mesosproto"
+	"golang.org/x/net/context"
 	"strconv"
 )
 
+// apiShutdownTimeout bounds waiting for requests in flight once the scheduler stops.
+var apiShutdownTimeout = 10 * time.Second
+
 type HttpServer struct {
-	address string
+	address       string
+	authenticator Authenticator
+	sched         *Scheduler
+	server        *http.Server
 }
 
-func NewHttpServer(address string) *HttpServer {
+func NewHttpServer(address string, sched *Scheduler) *HttpServer {
 	if strings.HasPrefix(address, "http://") {
 		address = address[len("http://"):]
 	}
-	return &HttpServer{
+	hs := &HttpServer{
 		address: address,
+		sched:   sched,
 	}
+	hs.server = &http.Server{Addr: address, Handler: hs.counted(hs.routes())}
+	return hs
 }
 
+// Start serves the API over https if the server has a TLS config, plain http otherwise.
 func (hs *HttpServer) Start() {
-	http.HandleFunc("/resource/", serveFile)
-	http.HandleFunc("/api/start", handleStart)
-	http.HandleFunc("/api/stop", handleStop)
-	http.HandleFunc("/api/update", handleUpdate)
-	http.HandleFunc("/api/status", handleStatus)
-	http.ListenAndServe(hs.address, nil)
+	var err error
+	if hs.server.TLSConfig != nil {
+		err = hs.server.ListenAndServeTLS("", "")
+	} else {
+		err = hs.server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		hs.sched.logger.Errorf("API server failed: %s", err)
+	}
 }
 
-func serveFile(w http.ResponseWriter, r *http.Request) {
-	resourceTokens := strings.Split(r.URL.Path, "/")
-	resource := resourceTokens[len(resourceTokens)-1]
-	http.ServeFile(w, r, resource)
+// Stop closes the listener and waits for requests in flight to complete until the context is done.
+func (hs *HttpServer) Stop(ctx context.Context) error {
+	return hs.server.Shutdown(ctx)
 }
 
-func handleStart(w http.ResponseWriter, r *http.Request) {
-	if Config.CanStart() {
-		sched.SetActive(true)
-		respond(true, "Servers started", w)
-	} else {
-		respond(false, "producer.properties and topic must be set before starting. schema.registry.url must be set for avro transform.", w)
+func (hs *HttpServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/resource/", hs.serveFile)
+	mux.HandleFunc("/api/start", hs.mutating(hs.unlessHandingOff(hs.handleStart)))
+	mux.HandleFunc("/api/stop", hs.mutating(hs.unlessHandingOff(hs.handleStop)))
+	mux.HandleFunc("/api/update", hs.mutating(hs.unlessHandingOff(hs.handleUpdate)))
+	mux.HandleFunc("/api/status", hs.authenticated(hs.handleStatus))
+	mux.HandleFunc("/api/validate", hs.authenticated(hs.handleValidate))
+	mux.HandleFunc("/api/gc", hs.mutating(hs.unlessHandingOff(hs.handleGc)))
+	mux.HandleFunc("/api/timeline", hs.authenticated(hs.handleTimeline))
+	mux.HandleFunc("/api/recommendations", hs.authenticated(hs.handleRecommendations))
+	mux.HandleFunc("/api/migrate", hs.mutating(hs.unlessHandingOff(hs.handleMigrate)))
+	mux.HandleFunc("/api/rotate", hs.mutating(hs.unlessHandingOff(hs.handleRotate)))
+	mux.HandleFunc("/api/scale", hs.mutating(hs.unlessHandingOff(hs.handleScale)))
+	mux.HandleFunc("/api/remove", hs.mutating(hs.unlessHandingOff(hs.handleRemove)))
+	mux.HandleFunc("/api/teardown", hs.mutating(hs.unlessHandingOff(hs.handleTeardown)))
+	mux.HandleFunc("/api/rollout/status", hs.authenticated(hs.handleRolloutStatus))
+	mux.HandleFunc("/api/rollout/cancel", hs.mutating(hs.unlessHandingOff(hs.handleRolloutCancel)))
+	mux.HandleFunc("/api/drain-kafka", hs.mutating(hs.unlessHandingOff(hs.handleDrainKafka)))
+	mux.HandleFunc("/api/drain-kafka/status", hs.authenticated(hs.handleDrainKafkaStatus))
+	mux.HandleFunc("/api/tap", hs.authenticated(hs.handleTap))
+	mux.HandleFunc("/api/events", hs.authenticated(hs.handleEvents))
+	mux.HandleFunc("/metrics", hs.authenticated(hs.handleMetrics))
+	mux.HandleFunc("/api/executor", hs.handleExecutor)
+	mux.HandleFunc("/api/hosts", hs.mutating(hs.unlessHandingOff(hs.handleHosts)))
+	mux.HandleFunc("/api/maintenance", hs.mutating(hs.unlessHandingOff(hs.handleMaintenance)))
+	mux.HandleFunc("/api/agents", hs.authenticated(hs.handleAgents))
+	mux.HandleFunc("/api/cluster", hs.authenticated(hs.handleCluster))
+	mux.HandleFunc("/api/pipeline", hs.authenticated(hs.handlePipeline))
+	mux.HandleFunc(apiVersionPrefix+"info", hs.authenticated(hs.handleInfo))
+	mux.Handle(apiVersionPrefix, versioned(mux))
+	mux.HandleFunc("/health", handleHealth)
+	mux.HandleFunc("/admin/handoff", hs.handleHandoff)
+	return mux
+}
+
+// authenticated rejects requests not accepted by the configured auth provider. Resources stay open as executors fetch them.
+func (hs *HttpServer) authenticated(handler http.HandlerFunc) http.HandlerFunc {
+	return hs.authorized(false, handler)
+}
+
+// mutating additionally rejects read-only principals, for endpoints changing the cluster or its configuration.
+func (hs *HttpServer) mutating(handler http.HandlerFunc) http.HandlerFunc {
+	return hs.authorized(true, handler)
+}
+
+func (hs *HttpServer) authorized(mutating bool, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if hs.authenticator != nil {
+			principal, err := hs.authenticator.Authenticate(r)
+			if err != nil {
+				hs.sched.logger.Infof("Rejected %s from %s: %s", r.URL.Path, r.RemoteAddr, err)
+				w.Header().Set("WWW-Authenticate", hs.authenticator.Challenge())
+				respondWithStatus(http.StatusUnauthorized, false, "Unauthorized", w)
+				return
+			}
+			if mutating && principal.ReadOnly {
+				hs.sched.logger.Infof("Rejected %s by %s from %s", r.URL.Path, principal, r.RemoteAddr)
+				respondWithStatus(http.StatusForbidden, false, "Forbidden: read-only access", w)
+				return
+			}
+			if mutating && principal.Group != "" {
+				if err := checkGroupScope(r, principal); err != nil {
+					hs.sched.logger.Infof("Rejected %s by %s from %s: %s", r.URL.Path, principal, r.RemoteAddr, err)
+					hs.sched.timeline.Add(EventApiAccess, "", "", fmt.Sprintf("rejected %s by %s: %s", r.URL.Path, principal, err))
+					respondWithStatus(http.StatusForbidden, false, "Forbidden: "+err.Error(), w)
+					return
+				}
+				hs.sched.timeline.Add(EventApiAccess, "", "", fmt.Sprintf("allowed %s?%s by %s", r.URL.Path, r.URL.RawQuery, principal))
+			}
+			hs.sched.logger.Debugf("%s requested by %s", r.URL.Path, principal)
+		}
+
+		handler(w, r)
 	}
 }
 
-func handleStop(w http.ResponseWriter, r *http.Request) {
-	sched.SetActive(false)
+func (hs *HttpServer) handleStart(w http.ResponseWriter, r *http.Request) {
+	if isDryRun(r) {
+		if queued := hs.sched.queuedUpdateCount(); queued > 0 {
+			respond(true, fmt.Sprintf("dry run: %d queued updates would be applied and servers started on matching offers", queued), w)
+			return
+		}
+		if err := hs.sched.config.checkStart(); err != nil {
+			respondError(err, w)
+			return
+		}
+		respond(true, "dry run: servers would be started on matching offers", w)
+		return
+	}
+
+	response := "Servers started"
+	if applied := hs.sched.applyQueuedUpdates(); applied > 0 {
+		response = fmt.Sprintf("Applied %d queued updates, servers started", applied)
+	}
+	if err := hs.sched.config.checkStart(); err != nil {
+		respondError(err, w)
+		return
+	}
+	hs.sched.SetActive(true)
+	respond(true, response, w)
+}
+
+func (hs *HttpServer) handleStop(w http.ResponseWriter, r *http.Request) {
+	if isDryRun(r) {
+		respond(true, "dry run: servers would be stopped\n"+hs.tasksSummary("killed"), w)
+		return
+	}
+
+	hs.sched.SetActive(false)
 	respond(true, "Servers stopped", w)
 }
 
-func handleUpdate(w http.ResponseWriter, r *http.Request) {
-	queryParams := r.URL.Query()
-	setConfig(queryParams, "producer.properties", &Config.ProducerProperties)
-	setConfig(queryParams, "broker.list", &Config.BrokerList)
-	setConfig(queryParams, "topic", &Config.Topic)
-	setConfig(queryParams, "transform", &Config.Transform)
-	setConfig(queryParams, "schema.registry.url", &Config.SchemaRegistryUrl)
-	setFloatConfig(queryParams, "cpu", &Config.Cpus)
-	setFloatConfig(queryParams, "mem", &Config.Mem)
+func (hs *HttpServer) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	queryParams, err := updateQuery(r)
+	if err != nil {
+		respondError(err, w)
+		return
+	}
+	if err := hs.validateUpdate(queryParams); err != nil {
+		respondError(err, w)
+		return
+	}
+
+	if isDryRun(r) {
+		remove, err := hs.sched.config.storePostedProperties(queryParams, true)
+		if err != nil {
+			respondError(err, w)
+			return
+		}
+		defer remove()
+
+		updated := *hs.sched.config
+		applyUpdate(queryParams, &updated)
+		effect := "kept running with the previous configuration until relaunched"
+		if delta := liveDelta(hs.sched.config, &updated); delta != nil {
+			effect = fmt.Sprintf("updated live with %s", delta)
+		} else if needsRollout(hs.sched.config, &updated) && updated.RolloutParallelism > 0 {
+			effect = fmt.Sprintf("restarted %d at a time", updated.RolloutParallelism)
+		}
+		problems := FindProblems(&updated)
+		response := "dry run: configuration would change\n" + hs.sched.config.Diff(&updated) + hs.tasksSummary(effect)
+		respondData(response+problemsReport(problems)+lintReport(&updated), &updatePreview{Config: &updated, Problems: problems}, w)
+		return
+	}
 
-	Logger.Infof("Scheduler configuration updated: \n%s", Config)
-	respond(true, "Configuration updated", w)
+	if _, err := hs.sched.config.storePostedProperties(queryParams, false); err != nil {
+		respondError(err, w)
+		return
+	}
+
+	if queued, err := hs.sched.holdUpdate(queryParams); err != nil {
+		respondError(err, w)
+		return
+	} else if queued > 0 {
+		respond(true, fmt.Sprintf("Scheduler is stopped, update queued to be applied on start, %d updates queued", queued), w)
+		return
+	}
+
+	before := *hs.sched.config
+	applyUpdate(queryParams, hs.sched.config)
+	hs.sched.ConfigUpdated()
+	if queryParams.Get("instances") != "" {
+		hs.sched.scaleDown()
+	}
+	if queryParams.Get("dual.write.window") != "" {
+		hs.sched.scheduleDualWriteEnd(hs.sched.config.DualWriteTransform, hs.sched.config.DualWriteTopic, hs.sched.config.DualWriteUntil)
+	}
+	hs.sched.logger.Infof("Scheduler configuration updated: \n%s", hs.sched.config)
+	response := "Configuration updated"
+	if delta := liveDelta(&before, hs.sched.config); delta != nil {
+		if push := hs.sched.PushConfig(delta); push != nil {
+			response += fmt.Sprintf(", pushing %s to running servers", delta)
+		}
+	} else if needsRollout(&before, hs.sched.config) {
+		if rollout := hs.sched.RollOut(); rollout != nil {
+			_, total := rollout.progress()
+			response += fmt.Sprintf(", restarting %d servers, see rollout status for progress", total)
+		}
+	}
+	if warnings := lintReport(hs.sched.config); warnings != "" {
+		response += "\n" + warnings
+	}
+	respondData(response, hs.sched.config, w)
 }
 
-func handleStatus(w http.ResponseWriter, r *http.Request) {
-	tasks := sched.cluster.GetAllTasks()
-	response := "cluster:\n"
+// validateUpdate checks update parameters before anything is applied.
+func (hs *HttpServer) validateUpdate(queryParams url.Values) error {
+	if err := validateUpdateValues(queryParams); err != nil {
+		return err
+	}
+	if queryParams.Get("producer.properties.content") != "" && hs.sched.config.ArtifactDir == "" {
+		return errNoArtifactDir
+	}
+	if queryParams.Get("producer.properties") != "" && hs.sched.config.ArtifactDir == "" {
+		return errNoArtifactDir
+	}
+	if _, err := ParseQuotas(queryParams.Get("quotas")); err != nil {
+		return err
+	}
+	if _, err := ParseDestinations(queryParams.Get("destinations")); err != nil {
+		return err
+	}
+	if _, err := ParseDestinationSampling(queryParams.Get("destination.sampling")); err != nil {
+		return err
+	}
+	if _, err := ParseTypeTopics(queryParams.Get("type.topics")); err != nil {
+		return err
+	}
+	if _, err := ParseConstraints(queryParams.Get("constraints")); err != nil {
+		return err
+	}
+	if _, err := ParseResourceOverrides(queryParams.Get("resource.overrides")); err != nil {
+		return err
+	}
+	if _, err := ParsePriorities(queryParams.Get("priorities")); err != nil {
+		return err
+	}
+	if selector, err := overrideSelector(queryParams); err != nil {
+		return err
+	} else if selector != "" {
+		if _, err := setResourceOverride(hs.sched.config.ResourceOverrides, selector, queryParams.Get("cpu"), queryParams.Get("mem")); err != nil {
+			return err
+		}
+	}
+	if placement := queryParams.Get("placement"); placement != "" {
+		if err := validatePlacement(placement); err != nil {
+			return err
+		}
+	}
+	if spread := queryParams.Get("spread"); spread != "" {
+		if err := validateSpread(spread); err != nil {
+			return err
+		}
+	}
+	if network := queryParams.Get("container.network"); network != "" {
+		if err := validateNetwork(network); err != nil {
+			return err
+		}
+	}
+	if level := queryParams.Get("log.topic.level"); level != "" {
+		if err := validateLogTopicLevel(level); err != nil {
+			return err
+		}
+	}
+	if rate := queryParams.Get("log.topic.rate"); rate != "" {
+		if value, err := strconv.Atoi(rate); err != nil || value < 0 {
+			return fmt.Errorf("Invalid log topic rate %s, expected a number, 0 is unlimited", rate)
+		}
+	}
+	if version := queryParams.Get("executor.upload"); version != "" {
+		if err := validateExecutorUpload(hs.sched.config, version); err != nil {
+			return err
+		}
+	}
+	if transform := queryParams.Get("transform"); transform != "" {
+		if _, exists := transformFunctions[transform]; !exists {
+			return fmt.Errorf("Invalid transform %s, expected none|avro|proto", transform)
+		}
+	}
+	if transform := queryParams.Get("dual.write.transform"); transform != "" {
+		if _, exists := transformFunctions[transform]; !exists {
+			return fmt.Errorf("Invalid dual write transform %s, expected none|avro|proto", transform)
+		}
+	}
+	if window := queryParams.Get("dual.write.window"); window != "" {
+		if _, err := time.ParseDuration(window); err != nil {
+			return fmt.Errorf("Invalid dual write window %s", window)
+		}
+	}
+	if instances := queryParams.Get("instances"); instances != "" {
+		if value, err := strconv.Atoi(instances); err != nil || value < 0 {
+			return fmt.Errorf("Invalid instances %s, expected a number, 0 for one per matching host", instances)
+		}
+	}
+	if port := queryParams.Get("port"); port != "" {
+		if value, err := strconv.Atoi(port); err != nil || value < 0 || value > 65535 {
+			return fmt.Errorf("Invalid port %s, expected 1..65535, 0 picks one from offers", port)
+		}
+	}
+	if rate := queryParams.Get("sampling.rate"); rate != "" {
+		if value, err := strconv.ParseFloat(rate, 64); err != nil || value <= 0 || value > 1 {
+			return fmt.Errorf("Invalid sampling rate %s, expected more than 0 and at most 1", rate)
+		}
+	}
+	if limit := queryParams.Get("memory.soft.limit"); limit != "" {
+		if value, err := strconv.ParseFloat(limit, 64); err != nil || value < 0 || value > 1 {
+			return fmt.Errorf("Invalid memory soft limit %s, expected 0..1, 0 disables throttling", limit)
+		}
+	}
+	if size := queryParams.Get("buffer.max.size"); size != "" {
+		if value, err := strconv.ParseFloat(size, 64); err != nil || value < 0 {
+			return fmt.Errorf("Invalid buffer max size %s, expected MB, 0 for no limit", size)
+		}
+	}
+	if age := queryParams.Get("buffer.max.age"); age != "" {
+		if value, err := time.ParseDuration(age); err != nil || value < 0 {
+			return fmt.Errorf("Invalid buffer max age %s, expected a duration, 0 for no limit", age)
+		}
+	}
+	if reserve, _ := strconv.ParseBool(queryParams.Get("reserve")); reserve {
+		if err := validateReservation(hs.sched.config); err != nil {
+			return err
+		}
+	}
+	if size := queryParams.Get("queue.size"); size != "" {
+		if value, err := strconv.Atoi(size); err != nil || value < 1 {
+			return fmt.Errorf("Invalid queue size %s, expected a positive number", size)
+		}
+	}
+	if size := queryParams.Get("burst.size"); size != "" {
+		if value, err := strconv.Atoi(size); err != nil || value < 0 {
+			return fmt.Errorf("Invalid burst size %s, expected a number, 0 disables burst buffers", size)
+		}
+	}
+	if parallelism := queryParams.Get("rollout.parallelism"); parallelism != "" {
+		if value, err := strconv.Atoi(parallelism); err != nil || value < 0 {
+			return fmt.Errorf("Invalid rollout parallelism %s, expected a number, 0 disables rolling restarts", parallelism)
+		}
+	}
+	switch queryParams.Get("quota.action") {
+	case "", QuotaActionDrop, QuotaActionSample, QuotaActionDivert:
+	default:
+		return fmt.Errorf("Invalid quota action %s, expected drop|sample|divert", queryParams.Get("quota.action"))
+	}
+	return nil
+}
+
+func applyUpdate(queryParams url.Values, config *config) {
+	setConfig(queryParams, "producer.properties", &config.ProducerProperties)
+	setConfig(queryParams, "broker.list", &config.BrokerList)
+	setDurationConfig(queryParams, "broker.dns.ttl", &config.BrokerDnsTtl)
+	setDurationConfig(queryParams, "produce.timeout", &config.ProduceTimeout)
+	setDurationConfig(queryParams, "latency.budget", &config.LatencyBudget)
+	setDurationConfig(queryParams, "gauge.ttl", &config.GaugeTtl)
+	setDurationConfig(queryParams, "kill.grace.period", &config.KillGracePeriod)
+	setIntConfig(queryParams, "queue.size", &config.QueueSize)
+	setIntConfig(queryParams, "burst.size", &config.BurstSize)
+	setDurationConfig(queryParams, "burst.duration", &config.BurstDuration)
+	setConfig(queryParams, "topic", &config.Topic)
+	setConfig(queryParams, "destinations", &config.Destinations)
+	setConfig(queryParams, "destination.sampling", &config.DestSampling)
+	setConfig(queryParams, "type.topics", &config.TypeTopics)
+	setConfig(queryParams, "transform", &config.Transform)
+	setConfig(queryParams, "dual.write.transform", &config.DualWriteTransform)
+	setConfig(queryParams, "dual.write.topic", &config.DualWriteTopic)
+	setDualWriteWindow(queryParams, config)
+	setConfig(queryParams, "schema.registry.url", &config.SchemaRegistryUrl)
+	setConfig(queryParams, "resource.overrides", &config.ResourceOverrides)
+	setConfig(queryParams, "priorities", &config.Priorities)
+	setResourceConfig(queryParams, config)
+	setContainerConfig(queryParams, config)
+	setExecutorUploadConfig(queryParams, config)
+	setBoolConfig(queryParams, "reserve", &config.Reserve)
+	setFloatConfig(queryParams, "volume.size", &config.VolumeSize)
+	setFloatConfig(queryParams, "buffer.max.size", &config.BufferMaxSize)
+	setDurationConfig(queryParams, "buffer.max.age", &config.BufferMaxAge)
+	setConfig(queryParams, "placement", &config.Placement)
+	setConfig(queryParams, "spread", &config.Spread)
+	setConfig(queryParams, "constraints", &config.Constraints)
+	setIntConfig(queryParams, "standby", &config.Standby)
+	setIntConfig(queryParams, "instances", &config.Instances)
+	setDurationConfig(queryParams, "health.check.interval", &config.HealthInterval)
+	setIntConfig(queryParams, "health.check.failures", &config.HealthFailures)
+	setPortConfig(queryParams, "port", &config.StatsdPort)
+	setIntConfig(queryParams, "rollout.parallelism", &config.RolloutParallelism)
+	setDurationConfig(queryParams, "rollout.pause", &config.RolloutPause)
+	setIntConfig(queryParams, "producers", &config.Producers)
+	setFloatConfig(queryParams, "sampling.threshold", &config.SamplingThreshold)
+	setFloatConfig(queryParams, "sampling.rate", &config.SamplingRate)
+	setFloatConfig(queryParams, "memory.soft.limit", &config.MemorySoftLimit)
+	setConfig(queryParams, "quotas", &config.Quotas)
+	setConfig(queryParams, "quota.action", &config.QuotaAction)
+	setConfig(queryParams, "overflow.topic", &config.OverflowTopic)
+	setBoolConfig(queryParams, "validate", &config.Validate)
+	setBoolConfig(queryParams, "tcp", &config.Tcp)
+	setBoolConfig(queryParams, "tcp.errors", &config.TcpErrors)
+	setConfig(queryParams, "dead.letter.topic", &config.DeadLetterTopic)
+	setConfig(queryParams, "control.topic", &config.ControlTopic)
+	setLogTopicConfig(queryParams, config)
+	setConfig(queryParams, "log.topic.level", &config.LogTopicLevel)
+	setIntConfig(queryParams, "log.topic.rate", &config.LogTopicRate)
+}
+
+// isDryRun tells whether a mutating request should only report its planned effect.
+func isDryRun(r *http.Request) bool {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+	return dryRun
+}
+
+// tasksSummary lists running tasks a request would affect.
+func (hs *HttpServer) tasksSummary(effect string) string {
+	tasks := hs.sched.cluster.GetTasksByHost()
+	if len(tasks) == 0 {
+		return "no running tasks\n"
+	}
+
+	summary := fmt.Sprintf("tasks that would be %s:\n", effect)
 	for host, task := range tasks {
-		response += fmt.Sprintf("  server: %s", host)
-		response += fmt.Sprintf("    id: %s", task.GetTaskId())
-		response += fmt.Sprintf("    slave id: %s", task.GetSlaveId())
+		summary += fmt.Sprintf("  %s on %s\n", task.GetTaskId().GetValue(), host)
+	}
+	return summary
+}
+
+// validation is the structured result of /api/validate. Errors describe the problems for humans.
+type validation struct {
+	Errors   []string
+	Problems []*Problem
+	Warnings []string
+}
+
+// updatePreview is the structured result of a dry run of /api/update.
+type updatePreview struct {
+	Config   *config
+	Problems []*Problem
+}
+
+func (hs *HttpServer) handleValidate(w http.ResponseWriter, r *http.Request) {
+	config := *hs.sched.config
+	problems := FindProblems(&config)
+	validation := &validation{Errors: []string{}, Problems: problems, Warnings: Lint(&config)}
+	for _, problem := range problems {
+		validation.Errors = append(validation.Errors, problem.String())
+	}
+	response := problemsReport(problems) + lintReport(&config)
+	if response == "" {
+		response = "configuration looks fine\n"
+	}
+	respondData(response, validation, w)
+}
+
+func (hs *HttpServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if rollup := r.URL.Query().Get("rollup"); rollup != "" {
+		hs.handleRollup(rollup, r.URL.Query().Get("group.by"), w)
+		return
+	}
+
+	tasks := hs.sched.cluster.GetTasksByHost()
+	status := hs.sched.clusterStatus()
+	response := "cluster:\n"
+	for _, server := range status.Servers {
+		host, task := server.Host, tasks[server.Host]
+		if task == nil { // removed since the status was taken
+			continue
+		}
+		response += fmt.Sprintf("  server: %s\n", host)
+		response += fmt.Sprintf("    id: %s\n", task.GetTaskId().GetValue())
+		response += fmt.Sprintf("    slave id: %s\n", task.GetSlaveId().GetValue())
 		for _, resource := range task.GetResources() {
 			switch *resource.Type {
 			case mesos.Value_SCALAR:
-				response += fmt.Sprintf("    %s: %s", resource.GetName(), resource.GetScalar())
+				response += fmt.Sprintf("    %s: %s\n", resource.GetName(), resource.GetScalar())
 			case mesos.Value_RANGES:
-				response += fmt.Sprintf("    %s: %s", resource.GetName(), resource.GetRanges())
+				response += fmt.Sprintf("    %s: %s\n", resource.GetName(), resource.GetRanges())
 			case mesos.Value_SET:
-				response += fmt.Sprintf("    %s: %s", resource.GetName(), resource.GetSet())
+				response += fmt.Sprintf("    %s: %s\n", resource.GetName(), resource.GetSet())
+			}
+		}
+		response += fmt.Sprintf("    endpoints: statsd udp %s:%d, admin http://%s:%d\n", host, server.StatsdPort, host, server.AdminPort)
+		if server.Usage != nil {
+			response += fmt.Sprintf("    usage: %s\n", server.Usage)
+		}
+		if standby := hs.sched.cluster.GetStandby(host); standby != nil {
+			response += fmt.Sprintf("    standby: %s, admin http://%s:%d\n", standby.GetTaskId().GetValue(), host, taskPort(standby))
+		}
+		if server.Stats != nil {
+			response += server.Stats.String()
+		}
+	}
+	if len(status.Evacuated) > 0 {
+		response += fmt.Sprintf("evacuated hosts: %s\n", strings.Join(status.Evacuated, ", "))
+	}
+	response += hs.sched.spreadStatus()
+	response += hs.sched.hosts.String()
+	response += hs.sched.maintenanceStatus()
+	if backoff := hs.sched.backoff.String(); backoff != "" {
+		response += "failing hosts:\n" + backoff
+	}
+	if rotation := hs.sched.Rotation(); rotation != nil {
+		response += rotation.String()
+	}
+	if push := hs.sched.ConfigPush(); push != nil {
+		response += push.String()
+	}
+	if drain := hs.sched.KafkaDrain(); drain != nil {
+		response += drain.String()
+	}
+	if rollout := hs.sched.Rollout(); rollout != nil && rollout.inProgress() {
+		response += rollout.String()
+	}
+	if status.ConfigError != "" {
+		response += fmt.Sprintf("not launching tasks, invalid config: %s\n", status.ConfigError)
+	}
+	if status.QueuedUpdates > 0 {
+		response += fmt.Sprintf("stopped, %d updates queued to be applied on start\n", status.QueuedUpdates)
+	}
+	respondData(response, status, w)
+}
+
+func (hs *HttpServer) handleRollup(rollup string, attribute string, w http.ResponseWriter) {
+	key, err := hs.sched.rollupKey(rollup, attribute)
+	if err != nil {
+		respondError(err, w)
+		return
+	}
+
+	rollups := hs.sched.Rollups(key)
+	if len(rollups) == 0 {
+		respondData("no running servers", rollups, w)
+		return
+	}
+
+	response := fmt.Sprintf("cluster by %s:\n", rollup)
+	for _, r := range rollups {
+		response += r.String()
+	}
+	respondData(response, rollups, w)
+}
+
+func (hs *HttpServer) handleRolloutStatus(w http.ResponseWriter, r *http.Request) {
+	rollout := hs.sched.Rollout()
+	if rollout == nil {
+		respond(true, "no rollout since the scheduler started\n", w)
+		return
+	}
+
+	status := rollout.Status()
+	respondData(fmt.Sprintf("%s%d of %d servers restarted\n", rollout.String(), status.Done, status.Total), status, w)
+}
+
+func (hs *HttpServer) handleRolloutCancel(w http.ResponseWriter, r *http.Request) {
+	if err := hs.sched.CancelRollout(); err != nil {
+		respondError(err, w)
+		return
+	}
+
+	done, total := hs.sched.Rollout().progress()
+	respond(true, fmt.Sprintf("Rollout cancelled, %d of %d servers restarted", done, total), w)
+}
+
+func (hs *HttpServer) handleDrainKafka(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	if queryParams.Get("resume") == "true" {
+		if isDryRun(r) {
+			respond(true, "dry run: "+hs.tasksSummary("told to resume producing and replay buffered records"), w)
+			return
+		}
+
+		drain, err := hs.sched.ResumeKafka()
+		if err != nil {
+			respondError(err, w)
+			return
+		}
+		respond(true, fmt.Sprintf("Resuming Kafka drain started %s, see drain-kafka status for replay progress", drain.Started.Format(time.RFC3339)), w)
+		return
+	}
+
+	window, err := time.ParseDuration(queryParams.Get("window"))
+	if err != nil || window <= 0 || window > maxDrainWindow {
+		respond(false, fmt.Sprintf("Invalid window %s, expected a duration up to %s", queryParams.Get("window"), maxDrainWindow), w)
+		return
+	}
+
+	if isDryRun(r) {
+		respond(true, fmt.Sprintf("dry run: servers would buffer records on disk for %s\n%s", window, hs.tasksSummary("told to drain Kafka")), w)
+		return
+	}
+
+	drain, err := hs.sched.DrainKafka(window)
+	if err != nil {
+		respondError(err, w)
+		return
+	}
+	respond(true, fmt.Sprintf("Draining Kafka until %s, see drain-kafka status for per-host progress", drain.Until.Format(time.RFC3339)), w)
+}
+
+func (hs *HttpServer) handleDrainKafkaStatus(w http.ResponseWriter, r *http.Request) {
+	drain := hs.sched.KafkaDrain()
+	if drain == nil {
+		respond(true, "no Kafka drain since the scheduler started\n", w)
+		return
+	}
+	respondData(drain.String(), drain.Status(), w)
+}
+
+// handleTap streams lines received by the server on a host as server-sent events until the client disconnects.
+func (hs *HttpServer) handleTap(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	rate := defaultTapRate
+	if value := queryParams.Get("rate"); value != "" {
+		var err error
+		if rate, err = strconv.Atoi(value); err != nil {
+			respondWithStatus(400, false, fmt.Sprintf("Invalid rate: %s", err), w)
+			return
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		respond(false, "Streaming is not supported", w)
+		return
+	}
+
+	stream, err := hs.sched.Tap(queryParams.Get("host"), queryParams.Get("match"), rate)
+	if err != nil {
+		respondError(err, w)
+		return
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case lines, open := <-stream.Lines:
+			if !open {
+				fmt.Fprintf(w, "event: end\ndata: %s\n\n", stream.Err())
+				flusher.Flush()
+				return
+			}
+			for _, line := range lines {
+				fmt.Fprintf(w, "data: %s\n\n", line)
 			}
+			flusher.Flush()
 		}
 	}
+}
+
+// handleHosts adds and removes hosts of the whitelist or blacklist and shows both lists.
+func (hs *HttpServer) handleHosts(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	add := splitHosts(queryParams.Get("add"))
+	remove := splitHosts(queryParams.Get("remove"))
+	if len(add) > 0 || len(remove) > 0 {
+		if err := hs.sched.UpdateHostList(queryParams.Get("list"), add, remove); err != nil {
+			respondError(err, w)
+			return
+		}
+	}
+
+	lists := hs.sched.hosts.String()
+	if lists == "" {
+		lists = "no hosts whitelisted or blacklisted\n"
+	}
+	respondData(lists, map[string][]string{
+		HostWhitelist: hs.sched.hosts.Snapshot(HostWhitelist),
+		HostBlacklist: hs.sched.hosts.Snapshot(HostBlacklist),
+	}, w)
+}
+
+func splitHosts(value string) []string {
+	hosts := make([]string, 0)
+	for _, host := range strings.Split(value, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// handleMaintenance annotates a host in maintenance until a time, ends an annotation or lists annotated hosts.
+func (hs *HttpServer) handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	host := queryParams.Get("host")
+	if host == "" {
+		message := "no hosts annotated in maintenance\n"
+		if annotations := hs.sched.annotations.String(); annotations != "" {
+			message = "annotated in maintenance:\n" + annotations
+		}
+		respondData(message, hs.sched.annotations.Snapshot(), w)
+		return
+	}
+
+	if queryParams.Get("end") == "true" {
+		if err := hs.sched.EndMaintenance(host); err != nil {
+			respondError(err, w)
+			return
+		}
+		respond(true, fmt.Sprintf("Maintenance of %s ended", host), w)
+		return
+	}
+
+	until, err := parseUntil(queryParams.Get("until"))
+	if err != nil {
+		respondError(err, w)
+		return
+	}
+	if err := hs.sched.AnnotateMaintenance(host, until, queryParams.Get("reason")); err != nil {
+		respondError(err, w)
+		return
+	}
+	respond(true, fmt.Sprintf("Host %s is in maintenance until %s", host, until.Format(time.RFC3339)), w)
+}
+
+// handleCluster serves the placement as JSON for cluster replicas and external tools.
+func (hs *HttpServer) handleCluster(w http.ResponseWriter, r *http.Request) {
+	snapshot := snapshotCluster(hs.sched.cluster)
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		respondError(err, w)
+		return
+	}
+	respondData(string(data), snapshot, w)
+}
+
+func (hs *HttpServer) handleInfo(w http.ResponseWriter, r *http.Request) {
+	info := hs.sched.apiInfo()
+	respondData(info.String(), info, w)
+}
+
+func (hs *HttpServer) handleAgents(w http.ResponseWriter, r *http.Request) {
+	agents := hs.sched.agents.List()
+	if len(agents) == 0 {
+		respondData("no offers received yet", agents, w)
+		return
+	}
+
+	response := "agents:\n"
+	for _, agent := range agents {
+		response += "  " + agent.String()
+	}
+
+	attributeValues := hs.sched.agents.AttributeValues()
+	names := make([]string, 0, len(attributeValues))
+	for name := range attributeValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	response += "attributes:\n"
+	for _, name := range names {
+		values := make([]string, 0, len(attributeValues[name]))
+		for value, count := range attributeValues[name] {
+			values = append(values, fmt.Sprintf("%s (%d)", value, count))
+		}
+		sort.Strings(values)
+		response += fmt.Sprintf("  %s: %s\n", name, strings.Join(values, ", "))
+	}
+	respondData(response, agents, w)
+}
+
+func (hs *HttpServer) handlePipeline(w http.ResponseWriter, r *http.Request) {
+	respond(true, describePipeline(hs.sched.config), w)
+}
+
+func (hs *HttpServer) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r.URL.Query().Get("since"))
+	if err != nil {
+		respondError(err, w)
+		return
+	}
+
+	events := hs.sched.timeline.Since(since)
+	response := "timeline:\n"
+	for _, event := range events {
+		response += fmt.Sprintf("  %s\n", event)
+	}
+	respondData(response, events, w)
+}
+
+// sizing is the structured result of /api/recommendations.
+type sizing struct {
+	Loads           []*HostLoad
+	Recommendations []*Recommendation
+}
+
+func (hs *HttpServer) handleRecommendations(w http.ResponseWriter, r *http.Request) {
+	loads := hs.sched.hostLoads()
+	if len(loads) == 0 {
+		respondData("no stats reported yet", &sizing{Loads: loads, Recommendations: []*Recommendation{}}, w)
+		return
+	}
+
+	response := "load:\n"
+	for _, load := range loads {
+		response += fmt.Sprintf("  %s: p99 buffer occupancy %.0f%%, %.1f events/s, memory %.0f MB over %d reports\n",
+			load.Host, load.P99Occupancy*100, load.EventsPerSec, load.MemoryMb, load.Samples)
+	}
+
+	recommendations := Recommend(hs.sched.config, loads)
+	if len(recommendations) == 0 {
+		response += "current sizing looks right\n"
+	} else {
+		response += "recommendations:\n"
+		for _, recommendation := range recommendations {
+			response += fmt.Sprintf("  %s\n", recommendation)
+		}
+	}
+	respondData(response, &sizing{Loads: loads, Recommendations: recommendations}, w)
+}
+
+func (hs *HttpServer) handleMigrate(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	from, to := queryParams.Get("from"), queryParams.Get("to")
+	timeout := migrationTimeout
+	if value := queryParams.Get("timeout"); value != "" {
+		var err error
+		if timeout, err = time.ParseDuration(value); err != nil {
+			respond(false, fmt.Sprintf("Invalid timeout %s", value), w)
+			return
+		}
+	}
+
+	if isDryRun(r) {
+		if err := hs.sched.checkMigration(from, to); err != nil {
+			respondError(err, w)
+			return
+		}
+		respond(true, fmt.Sprintf("dry run: a server would be launched on %s and the server on %s killed once the new one is healthy", to, from), w)
+		return
+	}
+
+	if err := hs.sched.Migrate(from, to, timeout); err != nil {
+		respondError(err, w)
+		return
+	}
+	respond(true, fmt.Sprintf("Migrating server from %s to %s, see timeline for progress", from, to), w)
+}
+
+func (hs *HttpServer) handleRemove(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	host := queryParams.Get("host")
+	blacklist, _ := strconv.ParseBool(queryParams.Get("blacklist"))
+	timeout := decommissionTimeout
+	if value := queryParams.Get("timeout"); value != "" {
+		var err error
+		if timeout, err = time.ParseDuration(value); err != nil {
+			respond(false, fmt.Sprintf("Invalid timeout %s", value), w)
+			return
+		}
+	}
+
+	if isDryRun(r) {
+		if err := hs.sched.checkDecommission(host); err != nil {
+			respondError(err, w)
+			return
+		}
+		response := fmt.Sprintf("dry run: the server on %s would be killed", host)
+		if blacklist {
+			response += " and the host blacklisted"
+		}
+		respond(true, response, w)
+		return
+	}
+
+	if err := hs.sched.Decommission(r.Context(), host, blacklist, timeout); err != nil {
+		respondError(err, w)
+		return
+	}
+	response := fmt.Sprintf("Server on %s removed", host)
+	if blacklist {
+		response += ", host is blacklisted"
+	}
+	respond(true, response, w)
+}
+
+func (hs *HttpServer) handleRotate(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	file := queryParams.Get("producer.properties")
+	timeout := rotationTimeout
+	if value := queryParams.Get("timeout"); value != "" {
+		var err error
+		if timeout, err = time.ParseDuration(value); err != nil {
+			respond(false, fmt.Sprintf("Invalid timeout %s", value), w)
+			return
+		}
+	}
+
+	if isDryRun(r) {
+		if err := hs.sched.checkRotation(file); err != nil {
+			respondError(err, w)
+			return
+		}
+		respond(true, fmt.Sprintf("dry run: producer.properties would be set to %s\n%s", file, hs.tasksSummary("told to reload producer properties")), w)
+		return
+	}
+
+	if err := hs.sched.Rotate(file, timeout); err != nil {
+		respondError(err, w)
+		return
+	}
+	respond(true, fmt.Sprintf("Rotating producer properties to %s, see status for per-host progress", file), w)
+}
+
+func (hs *HttpServer) handleScale(w http.ResponseWriter, r *http.Request) {
+	instances, err := strconv.Atoi(r.URL.Query().Get("instances"))
+	if err != nil || instances < 0 {
+		respond(false, fmt.Sprintf("Invalid instances %s, expected a number, 0 for one per matching host", r.URL.Query().Get("instances")), w)
+		return
+	}
+
+	if isDryRun(r) {
+		response := fmt.Sprintf("dry run: instances would change from %d to %d, %d running\n", hs.sched.config.Instances, instances, hs.sched.instanceCount())
+		if hosts := hs.sched.excessHosts(instances); len(hosts) > 0 {
+			response += fmt.Sprintf("servers that would be killed: %s\n", strings.Join(hosts, ", "))
+		}
+		respond(true, response, w)
+		return
+	}
+
+	killed, err := hs.sched.Scale(instances)
+	if err != nil {
+		respondError(err, w)
+		return
+	}
+	response := fmt.Sprintf("Scaled to %d instances", instances)
+	if len(killed) > 0 {
+		response += fmt.Sprintf(", killing servers on %s", strings.Join(killed, ", "))
+	}
 	respond(true, response, w)
 }
 
+func (hs *HttpServer) handleTeardown(w http.ResponseWriter, r *http.Request) {
+	queryParams := r.URL.Query()
+	unregister, _ := strconv.ParseBool(queryParams.Get("unregister"))
+
+	summary := fmt.Sprintf("teardown kills %d tasks", len(hs.sched.cluster.GetAllTasks()))
+	if unregister {
+		summary += fmt.Sprintf(", unregisters framework %s", hs.sched.frameworkId)
+		if hs.sched.storage != nil {
+			summary += fmt.Sprintf(", clears state in %s", hs.sched.storage)
+		}
+		summary += " and stops the scheduler"
+	}
+
+	if isDryRun(r) {
+		respond(true, "dry run: "+summary+"\n", w)
+		return
+	}
+	confirm := queryParams.Get("confirm")
+	if confirm == "" {
+		token := hs.sched.teardown.issue()
+		respond(true, fmt.Sprintf("%s\nrepeat the request with confirm=%s within %s to proceed\n", summary, token, teardownTokenTtl), w)
+		return
+	}
+	if err := hs.sched.teardown.check(confirm); err != nil {
+		respondError(err, w)
+		return
+	}
+
+	if err := hs.sched.Teardown(r.Context(), unregister); err != nil {
+		respondError(err, w)
+		return
+	}
+	if unregister {
+		respond(true, "All tasks stopped, framework unregistered", w)
+	} else {
+		respond(true, "All tasks stopped", w)
+	}
+}
+
+func (hs *HttpServer) handleGc(w http.ResponseWriter, r *http.Request) {
+	report, err := hs.sched.findOrphans()
+	if err != nil {
+		respondError(err, w)
+		return
+	}
+
+	enforce, _ := strconv.ParseBool(r.URL.Query().Get("enforce"))
+	if !enforce || report.Empty() {
+		respond(true, report.String(), w)
+		return
+	}
+	if isDryRun(r) {
+		respond(true, "dry run: would kill:\n"+report.String(), w)
+		return
+	}
+
+	if err := hs.sched.killOrphans(report); err != nil {
+		respondError(err, w)
+		return
+	}
+	respond(true, "killed:\n"+report.String(), w)
+}
+
 func setConfig(queryParams url.Values, name string, config *string) {
 	value := queryParams.Get(name)
 	if value != "" {
@@ -110,6 +1057,20 @@ func setConfig(queryParams url.Values, name string, config *string) {
 	}
 }
 
+// setResourceConfig updates cpu and mem of the host or group override if one is given, the defaults otherwise.
+func setResourceConfig(queryParams url.Values, config *config) {
+	selector, _ := overrideSelector(queryParams)
+	if selector == "" {
+		setFloatConfig(queryParams, "cpu", &config.Cpus)
+		setFloatConfig(queryParams, "mem", &config.Mem)
+		return
+	}
+
+	if overrides, err := setResourceOverride(config.ResourceOverrides, selector, queryParams.Get("cpu"), queryParams.Get("mem")); err == nil {
+		config.ResourceOverrides = overrides
+	}
+}
+
 func setFloatConfig(queryParams url.Values, name string, config *float64) {
 	value := queryParams.Get(name)
 	floatValue, err := strconv.ParseFloat(value, 64)
@@ -121,16 +1082,118 @@ func setFloatConfig(queryParams url.Values, name string, config *float64) {
 	}
 }
 
-func respond(success bool, message string, w http.ResponseWriter) {
-	response := NewApiResponse(success, message)
-	bytes, err := json.Marshal(response)
+func setBoolConfig(queryParams url.Values, name string, config *bool) {
+	value := queryParams.Get(name)
+	boolValue, err := strconv.ParseBool(value)
 	if err != nil {
-		panic(err) //this shouldn't happen
+		return
+	}
+	*config = boolValue
+}
+
+func setIntConfig(queryParams url.Values, name string, config *int) {
+	value := queryParams.Get(name)
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		return
+	}
+	*config = intValue
+}
+
+func setPortConfig(queryParams url.Values, name string, config *uint64) {
+	value := queryParams.Get(name)
+	port, err := strconv.ParseUint(value, 10, 16)
+	if err != nil {
+		return
+	}
+	*config = port
+}
+
+func setDurationConfig(queryParams url.Values, name string, config *time.Duration) {
+	value := queryParams.Get(name)
+	durationValue, err := time.ParseDuration(value)
+	if err != nil {
+		return
+	}
+	*config = durationValue
+}
+
+// setDualWriteWindow starts the dual write window now, 0 ends dual write.
+func setDualWriteWindow(queryParams url.Values, config *config) {
+	window, err := time.ParseDuration(queryParams.Get("dual.write.window"))
+	if err != nil {
+		return
 	}
+
+	if window > 0 {
+		config.DualWriteUntil = time.Now().Add(window)
+	} else {
+		config.DualWriteUntil = time.Time{}
+	}
+}
+
+func respond(success bool, message string, w http.ResponseWriter) {
 	if success {
-		w.WriteHeader(200)
+		respondWithStatus(200, success, message, w)
 	} else {
-		w.WriteHeader(500)
+		respondWithStatus(500, success, message, w)
 	}
+}
+
+func respondWithStatus(status int, success bool, message string, w http.ResponseWriter) {
+	writeResponse(status, NewApiResponse(success, message), w)
+}
+
+// respondData responds with the structured data along with a message describing it for humans.
+func respondData(message string, data interface{}, w http.ResponseWriter) {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		respondError(err, w)
+		return
+	}
+
+	response := NewApiResponse(true, message)
+	response.Data = bytes
+	writeResponse(200, response, w)
+}
+
+func writeResponse(status int, response *ApiResponse, w http.ResponseWriter) {
+	if _, text := w.(*textResponseWriter); text {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		io.WriteString(w, response.Message)
+		if !strings.HasSuffix(response.Message, "\n") {
+			io.WriteString(w, "\n")
+		}
+		return
+	}
+
+	bytes, err := json.Marshal(response)
+	if err != nil {
+		panic(err) //this shouldn't happen
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
 	w.Write(bytes)
 }
+
+// textResponseWriter makes writeResponse write the message of responses as plain text.
+type textResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *textResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// formatted serves ?format=text requests with the message for humans instead of JSON.
+func formatted(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") == "text" {
+			w = &textResponseWriter{w}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
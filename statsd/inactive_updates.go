@@ -0,0 +1,77 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import "net/url"
+
+// What happens to configuration updates while the scheduler is stopped.
+const (
+	InactiveUpdatesApply  = "apply"  // change the configuration right away, servers launched on start use it
+	InactiveUpdatesQueue  = "queue"  // keep updates and apply them in order on start
+	InactiveUpdatesReject = "reject" // refuse updates until the scheduler is started
+)
+
+// holdUpdate queues or rejects the update as configured if the scheduler was stopped. Updates of a scheduler not
+// started yet are always applied, as they are needed to complete the configuration. Returns the number of queued
+// updates, 0 if the update should be applied right away.
+func (s *Scheduler) holdUpdate(params url.Values) (int, error) {
+	s.activeLock.Lock()
+	defer s.activeLock.Unlock()
+
+	if s.active || !s.halted {
+		return 0, nil
+	}
+
+	switch s.config.InactiveUpdates {
+	case InactiveUpdatesQueue:
+		s.queuedUpdates = append(s.queuedUpdates, params)
+		s.stateChanged()
+		return len(s.queuedUpdates), nil
+	case InactiveUpdatesReject:
+		return 0, newError(ErrNotActive, "Scheduler is stopped, start it before updating the configuration")
+	}
+	return 0, nil
+}
+
+// applyQueuedUpdates applies updates queued while the scheduler was stopped, in the order they were made.
+func (s *Scheduler) applyQueuedUpdates() int {
+	s.activeLock.Lock()
+	updates := s.queuedUpdates
+	s.queuedUpdates = nil
+	for _, params := range updates {
+		applyUpdate(params, s.config)
+	}
+	s.activeLock.Unlock()
+
+	if len(updates) == 0 {
+		return 0
+	}
+	for _, params := range updates {
+		if params.Get("dual.write.window") != "" {
+			s.scheduleDualWriteEnd(s.config.DualWriteTransform, s.config.DualWriteTopic, s.config.DualWriteUntil)
+		}
+	}
+	s.logger.Infof("Applied %d updates queued while stopped: \n%s", len(updates), s.config)
+	s.ConfigUpdated()
+	return len(updates)
+}
+
+func (s *Scheduler) queuedUpdateCount() int {
+	s.activeLock.Lock()
+	defer s.activeLock.Unlock()
+
+	return len(s.queuedUpdates)
+}
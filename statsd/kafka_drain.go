@@ -0,0 +1,207 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxDrainWindow bounds how long executors may keep buffering on disk instead of producing.
+var maxDrainWindow = 24 * time.Hour
+
+const (
+	drainPending  = "pending"
+	drainDraining = "draining"
+	drainResumed  = "resumed"
+)
+
+// KafkaDrain tracks executors buffering records on disk while the Kafka brokers are under maintenance.
+type KafkaDrain struct {
+	Until   time.Time
+	Started time.Time
+
+	hosts   map[string]string // host -> pending, draining, resumed or the failure reason
+	cluster ClusterView       // reports buffered records of draining hosts
+	lock    sync.Mutex
+}
+
+func newKafkaDrain(until time.Time, cluster ClusterView) *KafkaDrain {
+	return &KafkaDrain{
+		Until:   until,
+		Started: time.Now(),
+		hosts:   make(map[string]string),
+		cluster: cluster,
+	}
+}
+
+func (d *KafkaDrain) set(host string, state string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.hosts[host] = state
+}
+
+// acknowledge records the result reported by the host. Returns false if the host isn't part of the drain.
+func (d *KafkaDrain) acknowledge(host string, err string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if _, exists := d.hosts[host]; !exists {
+		return false
+	}
+
+	if err != "" {
+		d.hosts[host] = err
+	} else if d.resumed() {
+		d.hosts[host] = drainResumed
+	} else {
+		d.hosts[host] = drainDraining
+	}
+	return true
+}
+
+func (d *KafkaDrain) resumed() bool {
+	return !time.Now().Before(d.Until)
+}
+
+// KafkaDrainStatus is the structured result of /api/drain-kafka/status.
+type KafkaDrainStatus struct {
+	Started time.Time
+	Until   time.Time
+	Resumed bool
+	Hosts   map[string]string // host -> pending, draining, resumed or the failure reason
+}
+
+func (d *KafkaDrain) Status() *KafkaDrainStatus {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	status := &KafkaDrainStatus{Started: d.Started, Until: d.Until, Resumed: d.resumed(), Hosts: make(map[string]string, len(d.hosts))}
+	for host, state := range d.hosts {
+		status.Hosts[host] = state
+	}
+	return status
+}
+
+func (d *KafkaDrain) String() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	hosts := make([]string, 0, len(d.hosts))
+	for host := range d.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	state := fmt.Sprintf("until %s", d.Until.Format(time.RFC3339))
+	if d.resumed() {
+		state = fmt.Sprintf("resumed at %s", d.Until.Format(time.RFC3339))
+	}
+	result := fmt.Sprintf("kafka drain started %s, %s:\n", d.Started.Format(time.RFC3339), state)
+	for _, host := range hosts {
+		progress := d.hosts[host]
+		if stats := d.cluster.GetStats(host); stats != nil && (progress == drainDraining || progress == drainResumed) {
+			switch {
+			case stats.Draining:
+				progress = fmt.Sprintf("buffering, %d records on disk", stats.Buffered)
+			case stats.Buffered > 0:
+				progress = fmt.Sprintf("replaying, %d records left", stats.Buffered)
+			case progress == drainResumed:
+				progress = "replayed"
+			}
+		}
+		result += fmt.Sprintf("  %s: %s\n", host, progress)
+	}
+	return result
+}
+
+// DrainKafka tells running servers to buffer records on disk instead of producing until the window ends, then
+// replay them. Servers launched during the window produce normally.
+func (s *Scheduler) DrainKafka(window time.Duration) (*KafkaDrain, error) {
+	if window <= 0 || window > maxDrainWindow {
+		return nil, fmt.Errorf("Drain window %s must be positive and at most %s", window, maxDrainWindow)
+	}
+	if s.currentDriver() == nil {
+		return nil, newError(ErrNotActive, "Scheduler is not registered")
+	}
+
+	drain := newKafkaDrain(time.Now().Add(window), s.cluster)
+	s.kafkaDrainLock.Lock()
+	s.kafkaDrain = drain
+	s.kafkaDrainLock.Unlock()
+
+	s.sendDrain(drain)
+	s.timeline.Add(EventKafkaDrain, "", "", fmt.Sprintf("draining Kafka for %s until %s", window, drain.Until.Format(time.RFC3339)))
+	return drain, nil
+}
+
+// ResumeKafka ends the current drain early, making servers produce and replay their buffered records.
+func (s *Scheduler) ResumeKafka() (*KafkaDrain, error) {
+	drain := s.KafkaDrain()
+	if drain == nil || drain.resumed() {
+		return nil, fmt.Errorf("Kafka is not being drained")
+	}
+
+	drain.lock.Lock()
+	drain.Until = time.Now()
+	drain.lock.Unlock()
+
+	s.sendDrain(drain)
+	s.timeline.Add(EventKafkaDrain, "", "", "Kafka drain ended, replaying buffered records")
+	return drain, nil
+}
+
+func (s *Scheduler) sendDrain(drain *KafkaDrain) {
+	message := NewDrainMessage(drain.Until)
+	if drain.resumed() {
+		message = NewDrainMessage(time.Time{})
+	}
+
+	driver := s.currentDriver()
+	for host, task := range s.cluster.GetTasksByHost() {
+		drain.set(host, drainPending)
+		if driver == nil {
+			drain.acknowledge(host, "scheduler is disconnected from master")
+			continue
+		}
+		if _, err := driver.SendFrameworkMessage(task.GetExecutor().GetExecutorId(), task.GetSlaveId(), message.String()); err != nil {
+			drain.acknowledge(host, err.Error())
+		}
+	}
+}
+
+// kafkaDrained records the acknowledgement of a drain or resume sent by an executor.
+func (s *Scheduler) kafkaDrained(host string, err string) {
+	drain := s.KafkaDrain()
+	if drain == nil || !drain.acknowledge(host, err) {
+		return
+	}
+
+	if err != "" {
+		s.timeline.Add(EventKafkaDrain, host, "", fmt.Sprintf("failed to drain Kafka: %s", err))
+	}
+}
+
+// KafkaDrain returns the last Kafka drain or nil if there was none.
+func (s *Scheduler) KafkaDrain() *KafkaDrain {
+	s.kafkaDrainLock.Lock()
+	defer s.kafkaDrainLock.Unlock()
+
+	return s.kafkaDrain
+}
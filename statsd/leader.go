@@ -0,0 +1,85 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/samuel/go-zookeeper/zk"
+)
+
+var zkSessionTimeout = 30 * time.Second
+
+// LeaderElection elects one of the schedulers sharing a ZooKeeper path as leader using the ZooKeeper lock recipe.
+// Leadership lasts as long as the ZooKeeper session.
+type LeaderElection struct {
+	conn *zk.Conn
+	lock *zk.Lock
+
+	lost     chan struct{}
+	lostOnce sync.Once
+}
+
+// NewLeaderElection connects to ZooKeeper given like zookeeper:2181/statsd-mesos-kafka/leader.
+func NewLeaderElection(value string) (*LeaderElection, error) {
+	idx := strings.Index(value, "/")
+	if idx == -1 || idx == len(value)-1 {
+		return nil, fmt.Errorf("Invalid leader election path %s, expected <zk connect>/<path>", value)
+	}
+
+	conn, events, err := zk.Connect(strings.Split(value[:idx], ","), zkSessionTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	election := &LeaderElection{
+		conn: conn,
+		lock: zk.NewLock(conn, value[idx:], zk.WorldACL(zk.PermAll)),
+		lost: make(chan struct{}),
+	}
+	go election.watchSession(events)
+	return election, nil
+}
+
+// Await blocks until this scheduler holds the leader lock.
+func (le *LeaderElection) Await() error {
+	return le.lock.Lock()
+}
+
+// Lost is closed when the session expires and another scheduler may have become the leader.
+func (le *LeaderElection) Lost() <-chan struct{} {
+	return le.lost
+}
+
+func (le *LeaderElection) IsLost() bool {
+	select {
+	case <-le.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+func (le *LeaderElection) watchSession(events <-chan zk.Event) {
+	for event := range events {
+		if event.State == zk.StateExpired {
+			le.lostOnce.Do(func() { close(le.lost) })
+		}
+	}
+}
@@ -0,0 +1,140 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elodina/siesta-producer"
+)
+
+// gaugeTtlMin is the gauge ttl below which gauges reporting at common flush intervals get expired between reports.
+var gaugeTtlMin = 30 * time.Second
+
+// Lint returns warnings about legal but risky settings, e.g. ones that lose metrics silently or have no effect. Unlike
+// validation errors, warnings don't stop the configuration from being applied.
+func Lint(c *config) []string {
+	warnings := make([]string, 0)
+	warn := func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+
+	if c.ProducerProperties != "" {
+		producerConfig, err := producer.ProducerConfigFromFile(c.ProducerProperties)
+		if err != nil {
+			warn("producer.properties can't be read by the scheduler: %s", err)
+		} else {
+			if producerConfig.RequiredAcks == 0 {
+				warn("acks=0 in producer.properties: records lost by brokers are not reported as failed")
+			}
+			if producerConfig.RequiredAcks == 0 && producerConfig.Retries == 0 && c.DeadLetterTopic == "" {
+				warn("acks=0 and retries=0 without dead.letter.topic: nothing is retried or kept when producing fails")
+			}
+			if c.LatencyBudget > 0 && producerConfig.Linger >= c.LatencyBudget {
+				warn("linger %s in producer.properties is not below latency.budget %s: batched records expire before being sent", producerConfig.Linger, c.LatencyBudget)
+			}
+		}
+	}
+
+	if c.QuotaAction == QuotaActionDivert && c.OverflowTopic == "" {
+		warn("quota.action=divert without overflow.topic: metrics over quota are dropped")
+	}
+	if c.ContainerNetwork == NetworkBridge && c.ExecutorImage == "" {
+		warn("container.network has no effect without executor.image")
+	}
+	if c.ContainerNetwork == NetworkBridge && c.ExecutorImage != "" && c.Standby > 0 && c.StatsdPort > 0 {
+		warn("standby servers in bridge networking can't take over the fixed statsd port, use host networking")
+	}
+	if spreadsDomains(c) && c.Instances == InstancesUnlimited {
+		warn("spread=%s has no effect with instances 0: a server runs on every matching host", c.Spread)
+	}
+	if c.Priorities != "" && c.Instances == InstancesUnlimited {
+		warn("priorities have no effect with instances 0: a server runs on every matching host")
+	}
+	if c.VolumeSize > 0 && !c.Reserve {
+		warn("volume.size has no effect without reserve")
+	}
+	if c.VolumeSize > 0 && c.Reserve && (c.BufferMaxSize == 0 || c.BufferMaxSize > c.VolumeSize) {
+		warn("buffer.max.size is unlimited or over volume.size %.0f MB: the volume fills up before records are dropped", c.VolumeSize)
+	}
+	if c.TcpErrors && !c.Tcp {
+		warn("tcp.errors has no effect without tcp")
+	}
+	if c.Validate && (c.Transform == "" || c.Transform == TransformNone) {
+		warn("validate has no effect with transform none")
+	}
+	if c.GaugeTtl > 0 && c.GaugeTtl < gaugeTtlMin {
+		warn("gauge.ttl %s is below %s: gauges flushed every 10-30s get expiry markers between reports", c.GaugeTtl, gaugeTtlMin)
+	}
+	if c.SamplingThreshold > 0 && c.SamplingRate >= 1 {
+		warn("sampling.rate %.2f keeps all events: adaptive sampling has no effect", c.SamplingRate)
+	}
+
+	topics := append([]string{c.Topic, c.OverflowTopic, c.DualWriteTopic}, destinationTopics(c)...)
+	if c.DeadLetterTopic != "" && contains(topics, c.DeadLetterTopic) {
+		warn("dead.letter.topic %s also receives metrics: consumers get invalid records mixed in", c.DeadLetterTopic)
+	}
+	if c.DualWriteTopic != "" && contains(append([]string{c.Topic}, destinationTopics(c)...), c.DualWriteTopic) {
+		warn("dual.write.topic %s also receives metrics in the main encoding: consumers get both encodings mixed", c.DualWriteTopic)
+	}
+	if c.ControlTopic != "" && contains(append(topics, c.DeadLetterTopic), c.ControlTopic) {
+		warn("control.topic %s also receives metrics: endpoint changes get mixed with records", c.ControlTopic)
+	}
+	if c.LogTopic != "" && contains(append(topics, c.DeadLetterTopic, c.ControlTopic), c.LogTopic) {
+		warn("log.topic %s also receives metrics: log lines get mixed with records", c.LogTopic)
+	}
+
+	if sampling, err := ParseDestinationSampling(c.DestSampling); err == nil {
+		for topic := range sampling {
+			if !contains(destinationTopics(c), topic) {
+				warn("destination.sampling for %s has no effect: not a destination", topic)
+			}
+		}
+	}
+
+	return warnings
+}
+
+func destinationTopics(c *config) []string {
+	topics := make([]string, 0)
+	destinations, _ := ParseDestinations(c.Destinations)
+	for _, destination := range destinations {
+		topics = append(topics, destination.Topic)
+	}
+	if len(destinations) == 0 && c.Topic != "" {
+		topics = append(topics, c.Topic)
+	}
+	return topics
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func lintReport(c *config) string {
+	warnings := Lint(c)
+	if len(warnings) == 0 {
+		return ""
+	}
+	return "warnings:\n  " + strings.Join(warnings, "\n  ") + "\n"
+}
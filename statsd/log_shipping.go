@@ -0,0 +1,181 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/cihub/seelog"
+	"github.com/elodina/siesta-producer"
+)
+
+const (
+	defaultLogTopicLevel = "warn"
+	defaultLogTopicRate  = 100
+)
+
+// logShipping forwards executor log lines to the log topic once enabled. It is part of the executor logger from the
+// start, so enabling it doesn't replace the logger while it's in use.
+var logShipping = newLogShipper()
+
+// shippedLog is the JSON record produced to the log topic for every shipped log line.
+type shippedLog struct {
+	Host      string
+	Level     string
+	Timestamp int64 // unix millis
+	Message   string
+}
+
+// logShipper is a seelog receiver producing log lines to a Kafka topic. Lines below the level are skipped and lines
+// over the rate per second dropped. Lines are produced from a separate goroutine, so logging never waits for Kafka.
+type logShipper struct {
+	lines chan *producer.ProducerRecord
+
+	topic  string
+	host   string
+	level  log.LogLevel
+	rate   int
+	second int64 // unix second the rate is counted for
+	count  int   // lines shipped in that second
+	lock   sync.Mutex
+
+	shipped int64
+	dropped int64 // lines over the rate or not fitting the queue
+}
+
+func newLogShipper() *logShipper {
+	return &logShipper{lines: make(chan *producer.ProducerRecord, 1000)}
+}
+
+// InitExecutorLogging initializes logging like InitLogging and lets executors ship log lines to Kafka.
+func InitExecutorLogging(level string) error {
+	outputs := `<custom name="kafka" formatid="message" />`
+	params := &log.CfgParseParams{
+		CustomReceiverProducers: map[string]log.CustomReceiverProducer{
+			"kafka": func(log.CustomReceiverInitArgs) (log.CustomReceiver, error) { return logShipping, nil },
+		},
+	}
+	return initLogging(level, outputs, params)
+}
+
+// ship starts producing lines at or above level to topic with send, at most rate lines a second.
+func (l *logShipper) ship(topic string, level string, rate int, host string, send func(*producer.ProducerRecord)) error {
+	minLevel, found := log.LogLevelFromString(level)
+	if !found {
+		return fmt.Errorf("Invalid log topic level %s", level)
+	}
+
+	l.lock.Lock()
+	started := l.topic != ""
+	l.topic, l.level, l.rate, l.host = topic, minLevel, rate, host
+	l.lock.Unlock()
+
+	if !started {
+		go func() {
+			for record := range l.lines {
+				send(record)
+			}
+		}()
+	}
+	return nil
+}
+
+func (l *logShipper) ReceiveMessage(message string, level log.LogLevel, context log.LogContextInterface) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.topic == "" || level < l.level {
+		return nil
+	}
+
+	now := time.Now()
+	if second := now.Unix(); second != l.second {
+		l.second, l.count = second, 0
+	}
+	if l.rate > 0 && l.count >= l.rate {
+		atomic.AddInt64(&l.dropped, 1)
+		return nil
+	}
+	l.count++
+
+	value, err := json.Marshal(&shippedLog{Host: l.host, Level: level.String(), Timestamp: now.UnixNano() / int64(time.Millisecond), Message: message})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case l.lines <- &producer.ProducerRecord{Topic: l.topic, Key: []byte(l.host), Value: value}:
+		atomic.AddInt64(&l.shipped, 1)
+	default:
+		atomic.AddInt64(&l.dropped, 1)
+	}
+	return nil
+}
+
+func (l *logShipper) AfterParse(initArgs log.CustomReceiverInitArgs) error {
+	return nil
+}
+
+func (l *logShipper) Flush() {}
+
+func (l *logShipper) Close() error {
+	return nil
+}
+
+// stats returns lines shipped and dropped so far.
+func (l *logShipper) stats() (int64, int64) {
+	return atomic.LoadInt64(&l.shipped), atomic.LoadInt64(&l.dropped)
+}
+
+func validateLogTopicLevel(level string) error {
+	if _, found := log.LogLevelFromString(level); !found || level == "off" {
+		return fmt.Errorf("Invalid log topic level %s, expected trace|debug|info|warn|error|critical", level)
+	}
+	return nil
+}
+
+// setLogTopicConfig updates the log topic, none stops shipping logs.
+func setLogTopicConfig(queryParams url.Values, config *config) {
+	switch topic := queryParams.Get("log.topic"); topic {
+	case "":
+	case "none":
+		config.LogTopic = ""
+	default:
+		config.LogTopic = topic
+	}
+}
+
+// shipLogs starts producing executor log lines to the log topic with the producer of the first shard.
+func (e *Executor) shipLogs() {
+	if Config.LogTopic == "" {
+		return
+	}
+
+	shard := e.server.shards[0]
+	send := func(record *producer.ProducerRecord) {
+		shard.currentProducer().Send(record)
+	}
+	if err := logShipping.ship(Config.LogTopic, Config.logTopicLevel(), Config.LogTopicRate, e.Host, send); err != nil {
+		Logger.Warnf("Not shipping logs: %s", err)
+		return
+	}
+	Logger.Infof("Shipping %s and above log lines to %s", Config.logTopicLevel(), Config.LogTopic)
+}
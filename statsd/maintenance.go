@@ -0,0 +1,201 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+var maintenanceCheckInterval = time.Minute
+
+// maintenanceWindow is when an agent is scheduled to be unavailable. Zero End means indefinitely.
+type maintenanceWindow struct {
+	Start time.Time
+	End   time.Time
+}
+
+func newMaintenanceWindow(unavailability *mesos.Unavailability) maintenanceWindow {
+	window := maintenanceWindow{Start: time.Unix(0, unavailability.GetStart().GetNanoseconds())}
+	if unavailability.GetDuration() != nil {
+		window.End = window.Start.Add(time.Duration(unavailability.GetDuration().GetNanoseconds()))
+	}
+	return window
+}
+
+func (w maintenanceWindow) String() string {
+	if w.End.IsZero() {
+		return fmt.Sprintf("from %s", w.Start.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("from %s to %s", w.Start.Format(time.RFC3339), w.End.Format(time.RFC3339))
+}
+
+// maintenanceSchedule keeps maintenance windows of agents learned from offers and the master maintenance schedule.
+type maintenanceSchedule struct {
+	offered   map[string]maintenanceWindow // hostname -> window from the last offer
+	scheduled map[string]maintenanceWindow // hostname -> window from the master schedule
+	lock      sync.Mutex
+}
+
+func newMaintenanceSchedule() *maintenanceSchedule {
+	return &maintenanceSchedule{
+		offered:   make(map[string]maintenanceWindow),
+		scheduled: make(map[string]maintenanceWindow),
+	}
+}
+
+// Observe records windows offers tell about. An offer without unavailability means its agent has no maintenance
+// scheduled anymore.
+func (m *maintenanceSchedule) Observe(offers []*mesos.Offer) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, offer := range offers {
+		if unavailability := offer.GetUnavailability(); unavailability != nil {
+			m.offered[offer.GetHostname()] = newMaintenanceWindow(unavailability)
+		} else {
+			delete(m.offered, offer.GetHostname())
+		}
+	}
+}
+
+// Replace sets the schedule fetched from the master.
+func (m *maintenanceSchedule) Replace(windows map[string]maintenanceWindow) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.scheduled = windows
+}
+
+// Draining tells whether the host is within the drain period before its window or in the window.
+func (m *maintenanceSchedule) Draining(host string, now time.Time, drain time.Duration) (maintenanceWindow, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	window, exists := m.scheduled[host]
+	if !exists {
+		if window, exists = m.offered[host]; !exists {
+			return window, false
+		}
+	}
+	return window, !now.Before(window.Start.Add(-drain)) && (window.End.IsZero() || now.Before(window.End))
+}
+
+type masterMaintenanceSchedule struct {
+	Windows []struct {
+		MachineIds []struct {
+			Hostname string `json:"hostname"`
+		} `json:"machine_ids"`
+		Unavailability struct {
+			Start struct {
+				Nanoseconds int64 `json:"nanoseconds"`
+			} `json:"start"`
+			Duration *struct {
+				Nanoseconds int64 `json:"nanoseconds"`
+			} `json:"duration"`
+		} `json:"unavailability"`
+	} `json:"windows"`
+}
+
+// fetchMaintenanceSchedule reads maintenance windows from the master, so agents without spare resources to offer
+// are known too.
+func fetchMaintenanceSchedule(master string) (map[string]maintenanceWindow, error) {
+	schedule := new(masterMaintenanceSchedule)
+	if err := getJson(masterClient, master+"/maintenance/schedule", schedule); err != nil {
+		return nil, err
+	}
+
+	windows := make(map[string]maintenanceWindow)
+	for _, scheduled := range schedule.Windows {
+		window := maintenanceWindow{Start: time.Unix(0, scheduled.Unavailability.Start.Nanoseconds)}
+		if scheduled.Unavailability.Duration != nil {
+			window.End = window.Start.Add(time.Duration(scheduled.Unavailability.Duration.Nanoseconds))
+		}
+		for _, machine := range scheduled.MachineIds {
+			windows[machine.Hostname] = window
+		}
+	}
+	return windows, nil
+}
+
+// watchMaintenance drains servers off agents before their maintenance windows begin. Replacements are launched on
+// other agents by offers as usual, as agents in maintenance are declined.
+func (s *Scheduler) watchMaintenance() {
+	ticker := time.NewTicker(maintenanceCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+
+		if windows, err := fetchMaintenanceSchedule(s.currentMasterUrl()); err != nil {
+			s.logger.Debugf("Failed to fetch maintenance schedule: %s", err)
+		} else {
+			s.windows.Replace(windows)
+		}
+		s.drainForMaintenance(time.Now())
+		s.expireAnnotations(time.Now())
+	}
+}
+
+// drainForMaintenance kills servers on agents due for maintenance. While disconnected from the master nothing is
+// killed, hosts are drained on the first check after re-registration.
+func (s *Scheduler) drainForMaintenance(now time.Time) {
+	driver := s.currentDriver()
+	for host, task := range s.cluster.GetTasksByHost() {
+		window, draining := s.windows.Draining(host, now, s.config.MaintenanceDrain)
+		if driver == nil || !draining || !s.draining.Add(host) {
+			continue
+		}
+
+		s.logger.Infof("Killing task %s to drain %s before maintenance %s", task.GetTaskId().GetValue(), host, window)
+		s.timeline.Add(EventMaintenance, host, task.GetTaskId().GetValue(), fmt.Sprintf("draining for maintenance %s", window))
+		if standby := s.cluster.GetStandby(host); standby != nil {
+			driver.KillTask(standby.GetTaskId())
+		}
+		driver.KillTask(task.GetTaskId())
+	}
+
+	for _, host := range s.draining.List() {
+		if _, draining := s.windows.Draining(host, now, s.config.MaintenanceDrain); !draining {
+			s.draining.Remove(host)
+			s.timeline.Add(EventMaintenance, host, "", "maintenance over")
+			s.reviveOffers("maintenance over on " + host)
+		}
+	}
+}
+
+// maintenanceStatus lists hosts drained for maintenance and hosts annotated in maintenance.
+func (s *Scheduler) maintenanceStatus() string {
+	status := ""
+	if hosts := s.draining.List(); len(hosts) > 0 {
+		status += "drained for maintenance:\n"
+		for _, host := range hosts {
+			window, _ := s.windows.Draining(host, time.Now(), s.config.MaintenanceDrain)
+			status += fmt.Sprintf("  %s: %s\n", host, window)
+		}
+	}
+	if annotations := s.annotations.String(); annotations != "" {
+		status += "annotated in maintenance:\n" + annotations
+	}
+	return status
+}
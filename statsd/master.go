@@ -0,0 +1,129 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+var masterClient = &http.Client{Timeout: 10 * time.Second}
+
+// MasterState is the subset of the Mesos master state endpoint used by the scheduler.
+type MasterState struct {
+	Frameworks          []*MasterFramework `json:"frameworks"`
+	CompletedFrameworks []*MasterFramework `json:"completed_frameworks"`
+	Slaves              []*MasterSlave     `json:"slaves"`
+}
+
+type MasterSlave struct {
+	Id       string        `json:"id"`
+	Pid      string        `json:"pid"` // slave(1)@ip:port
+	Hostname string        `json:"hostname"`
+	Domain   *MasterDomain `json:"domain"`
+}
+
+type MasterDomain struct {
+	FaultDomain *MasterFaultDomain `json:"fault_domain"`
+}
+
+type MasterFaultDomain struct {
+	Region *MasterDomainName `json:"region"`
+	Zone   *MasterDomainName `json:"zone"`
+}
+
+type MasterDomainName struct {
+	Name string `json:"name"`
+}
+
+// Url returns the agent HTTP endpoint derived from its pid.
+func (s *MasterSlave) Url() string {
+	address := s.Pid
+	if idx := strings.Index(address, "@"); idx != -1 {
+		address = address[idx+1:]
+	}
+	return "http://" + address
+}
+
+type MasterFramework struct {
+	Id     string        `json:"id"`
+	Name   string        `json:"name"`
+	Role   string        `json:"role"`
+	Active bool          `json:"active"`
+	Tasks  []*MasterTask `json:"tasks"`
+}
+
+type MasterTask struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	State      string `json:"state"`
+	SlaveId    string `json:"slave_id"`
+	ExecutorId string `json:"executor_id"`
+}
+
+func masterUrl(master *mesos.MasterInfo) string {
+	host := master.GetHostname()
+	if host == "" {
+		ip := master.GetIp()
+		host = fmt.Sprintf("%d.%d.%d.%d", byte(ip), byte(ip>>8), byte(ip>>16), byte(ip>>24))
+	}
+
+	return fmt.Sprintf("http://%s:%d", host, master.GetPort())
+}
+
+func fetchMasterState(master string) (*MasterState, error) {
+	response, err := masterClient.Get(master + "/master/state.json")
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Master state request failed with status %d: %s", response.StatusCode, body)
+	}
+
+	state := new(MasterState)
+	err = json.Unmarshal(body, state)
+	return state, err
+}
+
+func teardownFramework(master string, frameworkId string) error {
+	values := url.Values{}
+	values.Set("frameworkId", frameworkId)
+	response, err := masterClient.Post(master+"/master/teardown", "application/x-www-form-urlencoded", strings.NewReader(values.Encode()))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("Teardown of framework %s failed with status %d: %s", frameworkId, response.StatusCode, body)
+	}
+
+	return nil
+}
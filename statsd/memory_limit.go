@@ -0,0 +1,109 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// pressureGcPercent is the GC target used under memory pressure, trading cpu for a smaller heap.
+const pressureGcPercent = 20
+
+// taskMemory returns the memory allocated to the task in bytes, 0 if it has no mem resource.
+func taskMemory(task *mesos.TaskInfo) uint64 {
+	mem := 0.0
+	for _, resource := range task.GetResources() {
+		if resource.GetName() == "mem" {
+			mem += resource.GetScalar().GetValue()
+		}
+	}
+	return uint64(mem * 1024 * 1024)
+}
+
+// residentMemory returns the resident set size of the executor, or the memory obtained from the OS by the Go runtime
+// where /proc is not available.
+func residentMemory() uint64 {
+	statm, err := ioutil.ReadFile("/proc/self/statm")
+	if err == nil {
+		fields := strings.Fields(string(statm))
+		if len(fields) > 1 {
+			if pages, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				return pages * uint64(os.Getpagesize())
+			}
+		}
+	}
+
+	memStats := new(runtime.MemStats)
+	runtime.ReadMemStats(memStats)
+	return memStats.Sys
+}
+
+// watchMemory throttles the server while its resident memory is over the soft limit of the allocation, so it slows
+// down instead of being OOM-killed with everything in flight: top metrics get sampled and the heap is kept small.
+// Throttling stops once memory is below 90% of the soft limit.
+func (s *StatsDServer) watchMemory() {
+	ticker := time.NewTicker(samplerCheckInterval)
+	defer ticker.Stop()
+
+	softLimit := uint64(float64(s.memoryLimit) * Config.MemorySoftLimit)
+	for range ticker.C {
+		if s.isClosed() {
+			return
+		}
+
+		rss := residentMemory()
+		switch {
+		case !s.underPressure() && rss >= softLimit:
+			Logger.Warnf("Resident memory %d MB reached soft limit %d MB of %d MB allocated, sampling top metrics and shrinking heap",
+				rss>>20, softLimit>>20, s.memoryLimit>>20)
+			s.setPressure(true)
+			s.sampler.Force(true)
+			debug.SetGCPercent(pressureGcPercent)
+			debug.FreeOSMemory()
+		case s.underPressure() && rss < softLimit/10*9:
+			Logger.Infof("Resident memory %d MB is below soft limit %d MB again, restoring full fidelity", rss>>20, softLimit>>20)
+			s.setPressure(false)
+			s.sampler.Force(false)
+			debug.SetGCPercent(100)
+		}
+
+		if s.underPressure() && !s.sampler.enabled() {
+			// the occupancy watcher doesn't refresh sampled metrics when adaptive sampling is off
+			s.sampler.Update(s.occupancy(), s.topMetrics.Top(topKReported))
+		}
+	}
+}
+
+func (s *StatsDServer) underPressure() bool {
+	return atomic.LoadInt32(&s.memoryPressure) == 1
+}
+
+func (s *StatsDServer) setPressure(pressure bool) {
+	if pressure {
+		atomic.StoreInt32(&s.memoryPressure, 1)
+	} else {
+		atomic.StoreInt32(&s.memoryPressure, 0)
+	}
+}
@@ -0,0 +1,261 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// statusLatencyBuckets are the upper bounds in seconds of the status update latency histogram.
+var statusLatencyBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+// schedulerMetrics counts what the scheduler does for the Prometheus endpoint.
+type schedulerMetrics struct {
+	offers        int64
+	declines      map[string]int64 // by DeclineReason
+	statuses      map[string]int64 // status updates by task state
+	latencyCounts []int64          // status updates per latency bucket, the last one is +Inf
+	latencySum    float64
+	apiRequests   map[[2]string]int64 // by endpoint and status code
+	lock          sync.Mutex
+}
+
+func newSchedulerMetrics() *schedulerMetrics {
+	return &schedulerMetrics{
+		declines:      make(map[string]int64),
+		statuses:      make(map[string]int64),
+		latencyCounts: make([]int64, len(statusLatencyBuckets)+1),
+		apiRequests:   make(map[[2]string]int64),
+	}
+}
+
+func (m *schedulerMetrics) offersReceived(count int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.offers += int64(count)
+}
+
+func (m *schedulerMetrics) offersDeclined(reason DeclineReason, count int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.declines[string(reason)] += int64(count)
+}
+
+// statusUpdate counts the update by state and how long it took from the agent to the scheduler.
+func (m *schedulerMetrics) statusUpdate(status *mesos.TaskStatus) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.statuses[status.GetState().String()]++
+	if status.GetTimestamp() <= 0 {
+		return
+	}
+	latency := float64(time.Now().UnixNano())/float64(time.Second) - status.GetTimestamp()
+	if latency < 0 {
+		latency = 0
+	}
+	bucket := sort.SearchFloat64s(statusLatencyBuckets, latency)
+	m.latencyCounts[bucket]++
+	m.latencySum += latency
+}
+
+func (m *schedulerMetrics) apiRequest(endpoint string, code int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.apiRequests[[2]string{endpoint, fmt.Sprint(code)}]++
+}
+
+// metricsWriter writes metrics in the Prometheus text exposition format. The format is written by hand because
+// prometheus/client_golang isn't among the vendored dependencies in Godeps and its releases need Go modules and protobuf
+// versions conflicting with the vendored mesos-go ones.
+type metricsWriter struct {
+	w io.Writer
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func (mw *metricsWriter) family(name string, metricType string, help string) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, metricType)
+}
+
+// sample writes a value with labels given as name, value pairs.
+func (mw *metricsWriter) sample(name string, value float64, labels ...string) {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+	if len(pairs) > 0 {
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(mw.w, "%s %g\n", name, value)
+}
+
+func boolValue(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func sortedKeys(values map[string]int64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeMetrics writes scheduler metrics, the configuration state and the resource usage of executors.
+func (s *Scheduler) writeMetrics(w io.Writer) {
+	mw := &metricsWriter{w}
+	m := s.metrics
+
+	m.lock.Lock()
+	mw.family("statsd_mesos_offers_received_total", "counter", "Offers received from Mesos.")
+	mw.sample("statsd_mesos_offers_received_total", float64(m.offers))
+	mw.family("statsd_mesos_offers_declined_total", "counter", "Offers declined by reason.")
+	for _, reason := range sortedKeys(m.declines) {
+		mw.sample("statsd_mesos_offers_declined_total", float64(m.declines[reason]), "reason", reason)
+	}
+	mw.family("statsd_mesos_status_updates_total", "counter", "Task status updates by state.")
+	for _, state := range sortedKeys(m.statuses) {
+		mw.sample("statsd_mesos_status_updates_total", float64(m.statuses[state]), "state", state)
+	}
+	mw.family("statsd_mesos_tasks_failed_total", "counter", "Tasks that failed, got lost or were rejected by executors.")
+	mw.sample("statsd_mesos_tasks_failed_total", float64(m.statuses["TASK_FAILED"]+m.statuses["TASK_LOST"]+m.statuses["TASK_ERROR"]))
+
+	mw.family("statsd_mesos_status_update_latency_seconds", "histogram", "Time from a status update being created on the agent to the scheduler receiving it.")
+	var cumulative int64
+	for i, bound := range statusLatencyBuckets {
+		cumulative += m.latencyCounts[i]
+		mw.sample("statsd_mesos_status_update_latency_seconds_bucket", float64(cumulative), "le", fmt.Sprint(bound))
+	}
+	cumulative += m.latencyCounts[len(statusLatencyBuckets)]
+	mw.sample("statsd_mesos_status_update_latency_seconds_bucket", float64(cumulative), "le", "+Inf")
+	mw.sample("statsd_mesos_status_update_latency_seconds_sum", m.latencySum)
+	mw.sample("statsd_mesos_status_update_latency_seconds_count", float64(cumulative))
+
+	mw.family("statsd_mesos_api_requests_total", "counter", "API requests by endpoint and status code.")
+	requests := make([][2]string, 0, len(m.apiRequests))
+	for request := range m.apiRequests {
+		requests = append(requests, request)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i][0] < requests[j][0] || requests[i][0] == requests[j][0] && requests[i][1] < requests[j][1]
+	})
+	for _, request := range requests {
+		mw.sample("statsd_mesos_api_requests_total", float64(m.apiRequests[request]), "endpoint", request[0], "code", request[1])
+	}
+	m.lock.Unlock()
+
+	mw.family("statsd_mesos_active", "gauge", "Whether servers are started.")
+	mw.sample("statsd_mesos_active", boolValue(s.isActive()))
+	mw.family("statsd_mesos_tasks_running", "gauge", "Servers running, standby tasks not included.")
+	mw.sample("statsd_mesos_tasks_running", float64(len(s.cluster.GetTasksByHost())))
+	mw.family("statsd_mesos_standby_tasks", "gauge", "Standby tasks running.")
+	mw.sample("statsd_mesos_standby_tasks", float64(s.cluster.StandbyCount()))
+
+	mw.family("statsd_mesos_kafka_config_valid", "gauge", "Whether the Kafka configuration is complete and executors accepted it.")
+	mw.sample("statsd_mesos_kafka_config_valid", boolValue(s.config.checkStart() == nil && s.configError == ""))
+	mw.family("statsd_mesos_config_warnings", "gauge", "Risky settings found in the configuration, see validate.")
+	mw.sample("statsd_mesos_config_warnings", float64(len(Lint(s.config))))
+
+	hosts := make([]string, 0)
+	for host := range s.cluster.GetTasksByHost() {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	usages := make([]*ResourceUsage, 0, len(hosts))
+	for _, host := range hosts {
+		if usage := s.usages.Get(host); usage != nil {
+			usages = append(usages, usage)
+		}
+	}
+	resources := []struct {
+		name  string
+		help  string
+		value func(*ResourceUsage) float64
+	}{
+		{"statsd_mesos_executor_cpus_used", "Cpus used by the executor on average over the last sampling interval.", func(u *ResourceUsage) float64 { return u.CpusUsed }},
+		{"statsd_mesos_executor_cpus_limit", "Cpus allocated to the executor.", func(u *ResourceUsage) float64 { return u.CpusLimit }},
+		{"statsd_mesos_executor_mem_used_bytes", "Resident memory of the executor.", func(u *ResourceUsage) float64 { return u.MemUsedMb * 1024 * 1024 }},
+		{"statsd_mesos_executor_mem_limit_bytes", "Memory allocated to the executor.", func(u *ResourceUsage) float64 { return u.MemLimitMb * 1024 * 1024 }},
+	}
+	for _, resource := range resources {
+		mw.family(resource.name, "gauge", resource.help)
+		for _, usage := range usages {
+			mw.sample(resource.name, resource.value(usage), "host", usage.Host)
+		}
+	}
+}
+
+func (hs *HttpServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	hs.sched.writeMetrics(w)
+}
+
+// statusRecorder remembers the status code of a response, passing flushes on for streamed responses.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// counted counts requests by the endpoint pattern they are routed to, so unknown paths don't make a label value each.
+// It wraps the formatted mux, so handlers still get the text response writer of ?format=text requests.
+func (hs *HttpServer) counted(mux *http.ServeMux) http.Handler {
+	handler := formatted(mux)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, endpoint := mux.Handler(r)
+		if endpoint == apiVersionPrefix {
+			mapped := r.Clone(r.Context())
+			mapped.URL.Path = "/api/" + strings.TrimPrefix(r.URL.Path, apiVersionPrefix)
+			_, endpoint = mux.Handler(mapped)
+		}
+		if endpoint == "" {
+			endpoint = "unknown"
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		handler.ServeHTTP(recorder, r)
+		hs.sched.metrics.apiRequest(endpoint, recorder.code)
+	})
+}
@@ -0,0 +1,79 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetricsWriterEscapes(t *testing.T) {
+	var buf bytes.Buffer
+	mw := &metricsWriter{&buf}
+	mw.family("requests_total", "counter", "Requests by path\\query,\nsplit.")
+	mw.sample("requests_total", 3, "path", `C:\tmp "x"`+"\n", "code", "200")
+	mw.sample("requests_total", 0.5)
+
+	expected := `# HELP requests_total Requests by path\\query,\nsplit.
+# TYPE requests_total counter
+requests_total{path="C:\\tmp \"x\"\n",code="200"} 3
+requests_total 0.5
+`
+	if buf.String() != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteMetricsFamilies(t *testing.T) {
+	config := *Config
+	s := NewScheduler(&config, Logger, nil)
+	s.metrics.offersDeclined(DeclineReason("no \"ports\""), 2)
+	s.metrics.apiRequest("/api/status", 200)
+
+	var buf bytes.Buffer
+	s.writeMetrics(&buf)
+
+	family := ""
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "# HELP "):
+			family = strings.Fields(line)[2]
+			if i+1 == len(lines) || !strings.HasPrefix(lines[i+1], "# TYPE "+family+" ") {
+				t.Fatalf("expected a TYPE line after %q", line)
+			}
+		case strings.HasPrefix(line, "# TYPE "):
+			switch metricType := strings.Fields(line)[3]; metricType {
+			case "counter", "gauge", "histogram":
+			default:
+				t.Fatalf("unexpected type %s in %q", metricType, line)
+			}
+		default:
+			name := strings.FieldsFunc(line, func(r rune) bool { return r == '{' || r == ' ' })[0]
+			if family == "" || !strings.HasPrefix(name, family) {
+				t.Fatalf("expected %q to belong to family %s", line, family)
+			}
+		}
+	}
+
+	if !strings.Contains(buf.String(), `statsd_mesos_offers_declined_total{reason="no \"ports\""} 2`) {
+		t.Fatalf("expected the escaped decline reason in\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), `statsd_mesos_api_requests_total{endpoint="/api/status",code="200"} 1`) {
+		t.Fatalf("expected the api request in\n%s", buf.String())
+	}
+}
@@ -0,0 +1,121 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+var migrationTimeout = 5 * time.Minute
+
+var migrationCheckInterval = time.Second
+
+// checkMigration tells why a server can't be migrated between the hosts, if so.
+func (s *Scheduler) checkMigration(from string, to string) error {
+	if from == "" || to == "" {
+		return errors.New("from and to hosts are required")
+	}
+	if from == to {
+		return errors.New("from and to hosts must differ")
+	}
+	if !s.isActive() {
+		return newError(ErrNotActive, "Scheduler is inactive")
+	}
+	if !s.cluster.Exists(from) {
+		return newError(ErrHostNotFound, "No server running on host %s", from)
+	}
+	if s.cluster.Exists(to) {
+		return fmt.Errorf("Server on host %s is already running", to)
+	}
+	if s.migrating.Contains(from) {
+		return fmt.Errorf("Server on host %s is already being migrated", from)
+	}
+
+	return nil
+}
+
+// Migrate launches a replacement server on the target host and kills the source server once the replacement reports
+// stats. The source host stays evacuated afterwards. Progress is recorded in the timeline.
+func (s *Scheduler) Migrate(from string, to string, timeout time.Duration) error {
+	if err := s.checkMigration(from, to); err != nil {
+		return err
+	}
+	if !s.migrating.Add(from) {
+		return fmt.Errorf("Server on host %s is already being migrated", from)
+	}
+
+	s.evacuated.Add(from)
+	s.evacuated.Remove(to)
+	s.targets.Add(to)
+	s.timeline.Add(EventMigration, from, "", fmt.Sprintf("migrating to %s", to))
+
+	s.reviveOffers("migrating")
+	go s.migrate(from, to, timeout)
+	return nil
+}
+
+func (s *Scheduler) migrate(from string, to string, timeout time.Duration) {
+	defer s.migrating.Remove(from)
+	defer s.targets.Remove(to)
+
+	deadline := time.Now().Add(timeout)
+	for s.cluster.GetStats(to) == nil {
+		if time.Now().After(deadline) {
+			s.evacuated.Remove(from)
+			s.timeline.Add(EventMigration, from, "", fmt.Sprintf("migration to %s failed: replacement is not healthy after %s", to, timeout))
+			return
+		}
+		if err := sleepContext(s.ctx, migrationCheckInterval); err != nil {
+			return
+		}
+	}
+
+	// killing the task stops the statsd listener and flushes queued metrics before the executor exits
+	if task, exists := s.cluster.GetTasksByHost()[from]; exists {
+		driver := s.awaitDriver(s.ctx, timeout)
+		if driver == nil {
+			s.timeline.Add(EventMigration, from, "", fmt.Sprintf("migration to %s failed: disconnected from master, source server is still running", to))
+			return
+		}
+		s.logger.Infof("Killing task %s migrated to %s", task.GetTaskId().GetValue(), to)
+		driver.KillTask(task.GetTaskId())
+	}
+	s.timeline.Add(EventMigration, from, "", fmt.Sprintf("migrated to %s", to))
+}
+
+// checkMigrationTargets declines offers of other hosts while the instance freed by a migration is kept for its target,
+// so a capped number of instances doesn't let another host take it.
+func (s *Scheduler) checkMigrationTargets(offer *mesos.Offer) *Decline {
+	if s.config.Instances == InstancesUnlimited || s.targets.Contains(offer.GetHostname()) {
+		return nil
+	}
+
+	pending := make([]string, 0)
+	for _, target := range s.targets.List() {
+		if !s.cluster.Exists(target) {
+			pending = append(pending, target)
+		}
+	}
+	if len(pending) > 0 && s.config.Instances-s.instanceCount() <= len(pending) {
+		return declined(DeclineReserved, "Instance is reserved for migration to %s.", strings.Join(pending, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"time"
+
+	util "github.com/mesos/mesos-go/mesosutil"
+)
+
+// OrphanReport lists what is running in Mesos on behalf of this framework but is not part of the desired state:
+// inactive frameworks with the same name and role left by previous framework ids and unknown tasks of the current
+// framework. Active frameworks are left alone, they belong to schedulers started on purpose, e.g. with --force.
+type OrphanReport struct {
+	Frameworks []*MasterFramework
+	Tasks      []*MasterTask
+}
+
+func (r *OrphanReport) Empty() bool {
+	return len(r.Frameworks) == 0 && len(r.Tasks) == 0
+}
+
+func (r *OrphanReport) String() string {
+	if r.Empty() {
+		return "no orphans\n"
+	}
+
+	var s string
+	for _, framework := range r.Frameworks {
+		s += fmt.Sprintf("framework: %s (%d tasks)\n", framework.Id, len(framework.Tasks))
+	}
+	for _, task := range r.Tasks {
+		s += fmt.Sprintf("task: %s %s slave: %s\n", task.Id, task.State, task.SlaveId)
+	}
+
+	return s
+}
+
+func (s *Scheduler) findOrphans() (*OrphanReport, error) {
+	master := s.currentMasterUrl()
+	if master == "" || s.frameworkId == "" {
+		return nil, newError(ErrNotActive, "Scheduler is not registered")
+	}
+
+	state, err := fetchMasterState(master)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool)
+	for _, task := range s.cluster.GetAllTasks() {
+		known[task.GetTaskId().GetValue()] = true
+	}
+
+	report := new(OrphanReport)
+	for _, framework := range state.Frameworks {
+		if framework.Id == s.frameworkId {
+			for _, task := range framework.Tasks {
+				if !known[task.Id] {
+					report.Tasks = append(report.Tasks, task)
+				}
+			}
+		} else if !framework.Active && framework.Name == s.config.FrameworkName && framework.Role == s.config.FrameworkRole {
+			report.Frameworks = append(report.Frameworks, framework)
+		}
+	}
+
+	return report, nil
+}
+
+func (s *Scheduler) killOrphans(report *OrphanReport) error {
+	for _, framework := range report.Frameworks {
+		s.logger.Infof("Tearing down orphaned framework %s", framework.Id)
+		if err := teardownFramework(s.currentMasterUrl(), framework.Id); err != nil {
+			return err
+		}
+		s.timeline.Add(EventOrphanKilled, "", "", "framework: "+framework.Id)
+	}
+
+	driver := s.currentDriver()
+	if driver == nil && len(report.Tasks) > 0 {
+		return newError(ErrNotActive, "Scheduler is disconnected from master")
+	}
+	for _, task := range report.Tasks {
+		s.logger.Infof("Killing orphaned task %s", task.Id)
+		if _, err := driver.KillTask(util.NewTaskID(task.Id)); err != nil {
+			return err
+		}
+		s.timeline.Add(EventOrphanKilled, "", task.Id, "")
+	}
+
+	return nil
+}
+
+// collectOrphans looks for orphans periodically, killing them if enforcement is enabled and only logging them otherwise.
+// The first pass is one interval after registering, so restored tasks are reconciled and not mistaken for orphans.
+func (s *Scheduler) collectOrphans() {
+	if s.config.GcInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.config.GcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+		s.collectOrphansOnce()
+	}
+}
+
+func (s *Scheduler) collectOrphansOnce() {
+	report, err := s.findOrphans()
+	if err != nil {
+		s.logger.Warnf("Failed to look for orphans: %s", err)
+		return
+	}
+	if report.Empty() {
+		return
+	}
+
+	if s.config.GcEnforce {
+		if err := s.killOrphans(report); err != nil {
+			s.logger.Warnf("Failed to kill orphans: %s", err)
+		}
+	} else {
+		s.logger.Warnf("Found orphans, use /api/gc?enforce=true or --gc.enforce to kill them:\n%s", report)
+	}
+}
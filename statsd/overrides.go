@@ -0,0 +1,178 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// ResourceOverride sizes servers on hosts with the given attribute value differently. Zero keeps the default.
+type ResourceOverride struct {
+	Attribute string // offer attribute, hostname included
+	Value     string
+	Cpus      float64
+	Mem       float64
+}
+
+func (o *ResourceOverride) Selector() string {
+	return o.Attribute + ":" + o.Value
+}
+
+func (o *ResourceOverride) String() string {
+	resources := make([]string, 0)
+	if o.Cpus > 0 {
+		resources = append(resources, "cpu:"+strconv.FormatFloat(o.Cpus, 'f', -1, 64))
+	}
+	if o.Mem > 0 {
+		resources = append(resources, "mem:"+strconv.FormatFloat(o.Mem, 'f', -1, 64))
+	}
+	return o.Selector() + "=" + strings.Join(resources, ",")
+}
+
+// ParseResourceOverrides parses overrides like "hostname:big-node-1=cpu:2,mem:512;rack:ingest=mem:256".
+func ParseResourceOverrides(value string) ([]*ResourceOverride, error) {
+	overrides := make([]*ResourceOverride, 0)
+	if value == "" {
+		return overrides, nil
+	}
+
+	for _, rawOverride := range strings.Split(value, ";") {
+		kv := strings.SplitN(rawOverride, "=", 2)
+		selector := strings.SplitN(kv[0], ":", 2)
+		if len(kv) != 2 || len(selector) != 2 || selector[0] == "" || selector[1] == "" {
+			return nil, fmt.Errorf("Invalid resource override %s, expected attribute:value=cpu:<cpus>,mem:<mem>", rawOverride)
+		}
+
+		override := &ResourceOverride{Attribute: selector[0], Value: selector[1]}
+		for _, rawResource := range strings.Split(kv[1], ",") {
+			resource := strings.SplitN(rawResource, ":", 2)
+			if len(resource) != 2 {
+				return nil, fmt.Errorf("Invalid resource %s in override %s, expected cpu:<cpus> or mem:<mem>", rawResource, kv[0])
+			}
+			amount, err := strconv.ParseFloat(resource[1], 64)
+			if err != nil || amount < 0 {
+				return nil, fmt.Errorf("Invalid amount %s in override %s", resource[1], kv[0])
+			}
+
+			switch resource[0] {
+			case "cpu":
+				override.Cpus = amount
+			case "mem":
+				override.Mem = amount
+			default:
+				return nil, fmt.Errorf("Unknown resource %s in override %s, expected cpu or mem", resource[0], kv[0])
+			}
+		}
+		overrides = append(overrides, override)
+	}
+
+	return overrides, nil
+}
+
+// setResourceOverride returns overrides with the selector's resources replaced. Empty amounts keep current values, an
+// override with both resources zero is removed.
+func setResourceOverride(value string, selector string, cpus string, mem string) (string, error) {
+	overrides, err := ParseResourceOverrides(value)
+	if err != nil {
+		return "", err
+	}
+	attributeValue := strings.SplitN(selector, ":", 2)
+	if len(attributeValue) != 2 || attributeValue[0] == "" || attributeValue[1] == "" || strings.ContainsAny(selector, "=;") {
+		return "", fmt.Errorf("Invalid group %s, expected attribute:value", selector)
+	}
+	override := &ResourceOverride{Attribute: attributeValue[0], Value: attributeValue[1]}
+
+	result := make([]string, 0)
+	for _, existing := range overrides {
+		if existing.Selector() == selector {
+			override = existing
+			continue
+		}
+		result = append(result, existing.String())
+	}
+
+	if cpus != "" {
+		if override.Cpus, err = strconv.ParseFloat(cpus, 64); err != nil || override.Cpus < 0 {
+			return "", fmt.Errorf("Invalid cpu %s", cpus)
+		}
+	}
+	if mem != "" {
+		if override.Mem, err = strconv.ParseFloat(mem, 64); err != nil || override.Mem < 0 {
+			return "", fmt.Errorf("Invalid mem %s", mem)
+		}
+	}
+	if override.Cpus > 0 || override.Mem > 0 {
+		result = append(result, override.String())
+	}
+	return strings.Join(result, ";"), nil
+}
+
+// taskResources returns cpus and mem for a server launched with the offer. A hostname override takes precedence over
+// attribute overrides, which apply in the order given.
+func (s *Scheduler) taskResources(offer *mesos.Offer) (float64, float64) {
+	cpus, mem := s.config.Cpus, s.config.Mem
+	overrides, err := ParseResourceOverrides(s.config.ResourceOverrides)
+	if err != nil {
+		s.logger.Warnf("Ignoring resource overrides: %s", err)
+		return cpus, mem
+	}
+
+	attributes := offerAttributes(offer)
+	var hostOverride *ResourceOverride
+	for _, override := range overrides {
+		if attributes[override.Attribute] != override.Value {
+			continue
+		}
+		if override.Attribute == "hostname" {
+			hostOverride = override
+			continue
+		}
+		cpus, mem = overriddenResources(override, cpus, mem)
+	}
+	if hostOverride != nil {
+		cpus, mem = overriddenResources(hostOverride, cpus, mem)
+	}
+	return cpus, mem
+}
+
+func overriddenResources(override *ResourceOverride, cpus float64, mem float64) (float64, float64) {
+	if override.Cpus > 0 {
+		cpus = override.Cpus
+	}
+	if override.Mem > 0 {
+		mem = override.Mem
+	}
+	return cpus, mem
+}
+
+// overrideSelector returns the override an update targets with host or group parameters, if any.
+func overrideSelector(queryParams url.Values) (string, error) {
+	host, group := queryParams.Get("host"), queryParams.Get("group")
+	if host != "" && group != "" {
+		return "", errors.New("Only one of host and group can be given")
+	}
+
+	if host != "" {
+		return "hostname:" + host, nil
+	}
+	return group, nil
+}
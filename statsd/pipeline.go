@@ -0,0 +1,196 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elodina/siesta-producer"
+)
+
+// recordFormats describe what consumers read from topics for each transform.
+var recordFormats = map[string]string{
+	TransformNone:  "plain statsd lines, e.g. api.latency:12|ms",
+	TransformAvro:  "Avro LogLine records with the line, source host, namespace tag and received timing",
+	TransformProto: "protobuf LogLine records with the line, source host, namespace tag and received timing",
+}
+
+// describePipeline renders what servers do with received metrics under the configuration, stage by stage, followed
+// by what lands on each topic.
+func describePipeline(c *config) string {
+	transform := c.Transform
+	if transform == "" {
+		transform = TransformNone
+	}
+
+	port := "picked from each offer, listed by status"
+	if c.StatsdPort > 0 {
+		port = fmt.Sprint(c.StatsdPort)
+	}
+
+	response := "listeners:\n"
+	response += fmt.Sprintf("  udp port %s\n", port)
+	if c.Tcp {
+		slowDown := ""
+		if c.TcpErrors {
+			slowDown = ", clients told to slow down on full buffers"
+		}
+		response += fmt.Sprintf("  tcp port %s, newline separated%s\n", port, slowDown)
+	}
+
+	response += "filters:\n"
+	if c.SamplingThreshold > 0 {
+		response += fmt.Sprintf("  top metric names sampled at rate %.2f while queues are over %.0f%% full\n", c.SamplingRate, c.SamplingThreshold*100)
+	}
+	if quotas, err := ParseQuotas(c.Quotas); err == nil && len(quotas) > 0 {
+		response += fmt.Sprintf("  namespace quotas %s (events/s), over quota: %s\n", c.Quotas, quotaEffect(c))
+	}
+	if c.SamplingThreshold <= 0 && c.Quotas == "" {
+		response += "  none, every received line is kept\n"
+	}
+
+	response += "enrichments:\n"
+	if transform == TransformNone {
+		response += "  none, lines are produced as received\n"
+	} else {
+		response += fmt.Sprintf("  source host, namespace tag %q, received timestamp\n", c.Namespace)
+	}
+	if c.GaugeTtl > 0 {
+		response += fmt.Sprintf("  gauges not reported for %s get an expiry marker, e.g. %s\n", c.GaugeTtl, gaugeExpiry("queue.size"))
+	}
+
+	response += "transform:\n"
+	response += fmt.Sprintf("  %s: %s\n", transform, recordFormats[transform])
+	if transform == TransformAvro {
+		response += fmt.Sprintf("  schema registry %s, schemas registered under a <topic>-value subject per topic\n", c.SchemaRegistryUrl)
+	}
+	if c.Validate {
+		response += "  records are validated against the encoding before producing\n"
+	}
+
+	response += "topics:\n"
+	for _, route := range pipelineRoutes(c) {
+		response += fmt.Sprintf("  %s\n", route)
+	}
+
+	response += "partitioner:\n"
+	response += "  lines are spread over producers by metric name hash\n"
+	response += "  records have no key, partitions are picked at random\n"
+
+	response += "producer:\n"
+	response += fmt.Sprintf("  %d producers per server\n", c.producerCount())
+	if c.BrokerList != "" {
+		response += fmt.Sprintf("  brokers %s\n", c.BrokerList)
+	}
+	response += describeProducerProperties(c)
+	if c.LatencyBudget > 0 {
+		response += fmt.Sprintf("  records older than %s are dropped instead of produced\n", c.LatencyBudget)
+	}
+
+	return response
+}
+
+// pipelineRoutes lists which metrics go to which topic in which format, in the order servers apply the routing.
+func pipelineRoutes(c *config) []string {
+	format := c.Transform
+	if format == "" {
+		format = TransformNone
+	}
+
+	routes := make([]string, 0)
+	typeTopics, _ := ParseTypeTopics(c.TypeTopics)
+	types := make([]string, 0, len(typeTopics))
+	for metricType := range typeTopics {
+		types = append(types, metricType)
+	}
+	sort.Strings(types)
+	for _, metricType := range types {
+		routes = append(routes, fmt.Sprintf("%s: %s metrics as %s", typeTopics[metricType], metricType, format))
+	}
+
+	other := ""
+	if len(types) > 0 {
+		other = fmt.Sprintf("other than %s ", strings.Join(types, ", "))
+	}
+	destinations, _ := ParseDestinations(c.Destinations)
+	if len(destinations) == 0 && c.Topic != "" {
+		destination, _ := NewDestination(c.Topic, ".*")
+		destinations = append(destinations, destination)
+	}
+	sampling, _ := ParseDestinationSampling(c.DestSampling)
+	for _, destination := range destinations {
+		sampled := ""
+		if fraction, exists := sampling[destination.Topic]; exists {
+			sampled = fmt.Sprintf(", %.0f%% of names", fraction*100)
+		}
+		routes = append(routes, fmt.Sprintf("%s: metrics %snamed %s%s as %s", destination.Topic, other, destination.Filter, sampled, format))
+	}
+
+	if c.QuotaAction == QuotaActionDivert && c.OverflowTopic != "" {
+		routes = append(routes, fmt.Sprintf("%s: metrics over namespace quota as %s", c.OverflowTopic, format))
+	}
+	if c.dualWrite() != "" {
+		routes = append(routes, fmt.Sprintf("%s: all routed metrics as %s until %s", c.DualWriteTopic, c.DualWriteTransform, c.DualWriteUntil.Format(time.RFC3339)))
+	}
+	if c.DeadLetterTopic != "" {
+		routes = append(routes, fmt.Sprintf("%s: JSON dead letters with host, line and reason for records that failed to encode or expired", c.DeadLetterTopic))
+	}
+	if c.LogTopic != "" {
+		routes = append(routes, fmt.Sprintf("%s: JSON log lines of servers, %s and above", c.LogTopic, c.logTopicLevel()))
+	}
+	if c.ControlTopic != "" {
+		routes = append(routes, fmt.Sprintf("%s: JSON endpoint changes of servers", c.ControlTopic))
+	}
+
+	if len(routes) == 0 {
+		routes = append(routes, "none, metrics are dropped")
+	}
+	return routes
+}
+
+func quotaEffect(c *config) string {
+	switch c.QuotaAction {
+	case QuotaActionSample:
+		return fmt.Sprintf("sampled at rate %.2f", c.SamplingRate)
+	case QuotaActionDivert:
+		if c.OverflowTopic != "" {
+			return "diverted to " + c.OverflowTopic
+		}
+	}
+	return "dropped"
+}
+
+// describeProducerProperties lists the producer settings affecting delivery as far as the scheduler can read them.
+func describeProducerProperties(c *config) string {
+	if c.ProducerProperties == "" {
+		return "  producer defaults\n"
+	}
+
+	producerConfig, err := producer.ProducerConfigFromFile(c.ProducerProperties)
+	if err != nil {
+		return fmt.Sprintf("  settings from %s, not readable by the scheduler: %s\n", c.ProducerProperties, err)
+	}
+
+	compression := producerConfig.CompressionType
+	if compression == "" {
+		compression = "none"
+	}
+	return fmt.Sprintf("  acks %d, retries %d, compression %s, batch size %d, linger %s\n", producerConfig.RequiredAcks,
+		producerConfig.Retries, compression, producerConfig.BatchSize, producerConfig.Linger)
+}
@@ -0,0 +1,83 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+const (
+	PlacementSpread  = "spread"
+	PlacementBinPack = "binpack"
+	PlacementRandom  = "random"
+)
+
+func validatePlacement(placement string) error {
+	switch placement {
+	case PlacementSpread, PlacementBinPack, PlacementRandom:
+		return nil
+	}
+
+	return fmt.Errorf("Invalid placement %s, expected spread|binpack|random", placement)
+}
+
+// orderOffers sorts offers in the order they should be used by the placement strategy. Spread prefers agents with
+// the most free resources to keep tasks isolated, bin-pack prefers the fullest agents so fewer agents are used.
+// Offers of higher priority hosts come first regardless of the strategy.
+func (s *Scheduler) orderOffers(offers []*mesos.Offer, placement string) []*mesos.Offer {
+	ordered := append([]*mesos.Offer(nil), offers...)
+	switch placement {
+	case PlacementRandom:
+		for i := range ordered {
+			j := rand.Intn(i + 1)
+			ordered[i], ordered[j] = ordered[j], ordered[i]
+		}
+	case PlacementBinPack:
+		sort.Stable(sort.Reverse(byCapacity{ordered, s.offerCapacity}))
+	default:
+		sort.Stable(byCapacity{ordered, s.offerCapacity})
+	}
+	s.byPriority(ordered)
+
+	return ordered
+}
+
+// offerCapacity is the number of tasks the offer could fit, used to compare free resources of agents.
+func (s *Scheduler) offerCapacity(offer *mesos.Offer) float64 {
+	capacity := 0.0
+	cpus, mem := s.taskResources(offer)
+	if cpus > 0 {
+		capacity += getScalarResources(offer, "cpus") / cpus
+	}
+	if mem > 0 {
+		capacity += getScalarResources(offer, "mem") / mem
+	}
+	return capacity
+}
+
+// byCapacity orders offers with the most free resources first.
+type byCapacity struct {
+	offers   []*mesos.Offer
+	capacity func(*mesos.Offer) float64
+}
+
+func (c byCapacity) Len() int           { return len(c.offers) }
+func (c byCapacity) Swap(i, j int)      { c.offers[i], c.offers[j] = c.offers[j], c.offers[i] }
+func (c byCapacity) Less(i, j int) bool { return c.capacity(c.offers[i]) > c.capacity(c.offers[j]) }
@@ -0,0 +1,189 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	utils "github.com/elodina/go-mesos-utils"
+	"github.com/golang/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+)
+
+// statsdPort is where servers listen for metrics if task data names no port, e.g. when launched by older schedulers.
+const statsdPort = 8125
+
+// selectPorts picks the admin and statsd ports for a task from the offer, 0 for ports the offer doesn't have. A
+// standby task doesn't reserve a fixed statsd port, as the active server on the host holds it until failing over.
+func (s *Scheduler) selectPorts(offer *mesos.Offer, standby bool) (uint64, uint64) {
+	if s.config.StatsdPort == 0 {
+		ports := offeredPorts(offer, 2, 0)
+		if len(ports) < 2 {
+			return 0, 0
+		}
+		return ports[0], ports[1]
+	}
+
+	var admin, listen uint64
+	if standby || portOffered(offer, s.config.StatsdPort) {
+		listen = s.config.StatsdPort
+	}
+	for _, port := range offeredPorts(offer, 2, 0) {
+		if port != s.config.StatsdPort && admin == 0 {
+			admin = port
+		}
+	}
+	return admin, listen
+}
+
+func portOffered(offer *mesos.Offer, port uint64) bool {
+	ports := offeredPorts(offer, 1, port-1)
+	return len(ports) == 1 && ports[0] == port
+}
+
+// offeredPorts returns up to count of the lowest ports in the offer above the given one.
+func offeredPorts(offer *mesos.Offer, count int, above uint64) []uint64 {
+	ranges := make([]*mesos.Value_Range, 0)
+	for _, resource := range offer.GetResources() {
+		if resource.GetName() == "ports" {
+			ranges = append(ranges, resource.GetRanges().GetRange()...)
+		}
+	}
+	sort.Sort(byBegin(ranges))
+
+	ports := make([]uint64, 0, count)
+	for _, r := range ranges {
+		for port := r.GetBegin(); port <= r.GetEnd() && len(ports) < count; port++ {
+			if port > above {
+				ports = append(ports, port)
+			}
+		}
+	}
+	return ports
+}
+
+type byBegin []*mesos.Value_Range
+
+func (r byBegin) Len() int           { return len(r) }
+func (r byBegin) Less(i, j int) bool { return r[i].GetBegin() < r[j].GetBegin() }
+func (r byBegin) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// portsResource reserves the given ports, the admin port first so taskPort finds it in tasks of any version.
+func portsResource(ports ...uint64) *mesos.Resource {
+	ranges := make([]*mesos.Value_Range, 0, len(ports))
+	for _, port := range ports {
+		if port > 0 {
+			ranges = append(ranges, util.NewValueRange(port, port))
+		}
+	}
+	return util.NewRangesResource("ports", ranges)
+}
+
+// taskPort returns the admin port reserved for the task, 0 for tasks launched by schedulers not reserving one.
+func taskPort(task *mesos.TaskInfo) uint64 {
+	for _, resource := range task.GetResources() {
+		if resource.GetName() == "ports" {
+			for _, r := range resource.GetRanges().GetRange() {
+				return r.GetBegin()
+			}
+		}
+	}
+	return 0
+}
+
+// taskStatsdPort returns the port the task listens for metrics on.
+func taskStatsdPort(task *mesos.TaskInfo) uint64 {
+	taskData, err := ParseTaskData(task.GetData())
+	if err != nil || taskData.StatsdPort == 0 {
+		return statsdPort
+	}
+	return taskData.StatsdPort
+}
+
+// discoveryInfo advertises the statsd and admin ports of the task to service discovery. All tasks share the task
+// group as name, so e.g. Mesos-DNS resolves statsd-kafka.<framework>.mesos to every server.
+func (s *Scheduler) discoveryInfo(hostname string, generation int, adminPort uint64, listenPort uint64) *mesos.DiscoveryInfo {
+	discovery := &mesos.DiscoveryInfo{
+		Visibility: mesos.DiscoveryInfo_FRAMEWORK.Enum(),
+		Name:       proto.String(taskGroup),
+		Version:    proto.String(fmt.Sprint(s.configVersion)),
+		Ports: &mesos.Ports{Ports: []*mesos.Port{
+			{Number: proto.Uint32(uint32(listenPort)), Name: proto.String("statsd"), Protocol: proto.String("udp")},
+			{Number: proto.Uint32(uint32(adminPort)), Name: proto.String("admin"), Protocol: proto.String("tcp")},
+		}},
+		Labels: s.taskLabels(hostname, generation),
+	}
+	if s.config.Namespace != "" {
+		discovery.Environment = proto.String(s.config.Namespace)
+	}
+	return discovery
+}
+
+// taskLabels returns the STACK_LABELS labels along with the host, generation and config version of the task.
+func (s *Scheduler) taskLabels(hostname string, generation int) *mesos.Labels {
+	labels := utils.StringToLabels(s.labels)
+	labels.Labels = append(labels.Labels,
+		&mesos.Label{Key: proto.String("host"), Value: proto.String(hostname)},
+		&mesos.Label{Key: proto.String("generation"), Value: proto.String(fmt.Sprint(generation))},
+		&mesos.Label{Key: proto.String("config.version"), Value: proto.String(fmt.Sprint(s.configVersion))},
+	)
+	return labels
+}
+
+// startAdminServer serves the executor health and stats on the reserved port.
+func (e *Executor) startAdminServer(port uint64) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", e.handleHealth)
+	mux.HandleFunc(livenessPath, e.handleLive)
+	mux.HandleFunc("/stats", e.handleStats)
+
+	go func() {
+		if err := http.ListenAndServe(fmt.Sprintf("0.0.0.0:%d", port), mux); err != nil {
+			Logger.Errorf("Admin endpoint on port %d failed: %s", port, err)
+		}
+	}()
+}
+
+// handleHealth responds 200 once the server listens for metrics and 503 for standby tasks not activated yet.
+func (e *Executor) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if server := e.runningServer(); server == nil || server.isClosed() {
+		http.Error(w, "standby", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+func (e *Executor) handleStats(w http.ResponseWriter, r *http.Request) {
+	server := e.runningServer()
+	if server == nil {
+		http.Error(w, "standby", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(server.Stats())
+}
+
+func (e *Executor) runningServer() *StatsDServer {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.server
+}
@@ -0,0 +1,271 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesos/mesos-go/scheduler"
+)
+
+// preemptionTimeout is how long an instance freed by preemption is kept for the preempting host. Other hosts may take
+// it afterwards, e.g. when the preempting host stopped offering.
+var preemptionTimeout = 2 * time.Minute
+
+// PriorityClass gives servers on hosts with the attribute value a priority. Hosts matching no class have priority 0.
+type PriorityClass struct {
+	Attribute string // offer attribute, hostname included
+	Value     string
+	Priority  int
+}
+
+func (c *PriorityClass) String() string {
+	return fmt.Sprintf("%s:%s=%d", c.Attribute, c.Value, c.Priority)
+}
+
+// ParsePriorities parses priority classes like "rack:ingest=100;rack:batch=-10".
+func ParsePriorities(value string) ([]*PriorityClass, error) {
+	classes := make([]*PriorityClass, 0)
+	if value == "" {
+		return classes, nil
+	}
+
+	for _, rawClass := range strings.Split(value, ";") {
+		kv := strings.SplitN(rawClass, "=", 2)
+		selector := strings.SplitN(kv[0], ":", 2)
+		if len(kv) != 2 || len(selector) != 2 || selector[0] == "" || selector[1] == "" {
+			return nil, fmt.Errorf("Invalid priority class %s, expected attribute:value=<priority>", rawClass)
+		}
+		priority, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid priority %s of %s, expected a number", kv[1], kv[0])
+		}
+		classes = append(classes, &PriorityClass{Attribute: selector[0], Value: selector[1], Priority: priority})
+	}
+
+	return classes, nil
+}
+
+// priority returns the highest priority of the classes the attributes match.
+func priority(classes []*PriorityClass, attributes map[string]string) int {
+	result := 0
+	matched := false
+	for _, class := range classes {
+		if attributes[class.Attribute] == class.Value && (!matched || class.Priority > result) {
+			result = class.Priority
+			matched = true
+		}
+	}
+	return result
+}
+
+func (s *Scheduler) priorityClasses() []*PriorityClass {
+	classes, err := ParsePriorities(s.config.Priorities)
+	if err != nil {
+		s.logger.Warnf("Ignoring priorities: %s", err)
+		return nil
+	}
+	return classes
+}
+
+// hostPriority returns the priority of a host running a server, matched against the attributes of its last offer.
+func (s *Scheduler) hostPriority(classes []*PriorityClass, host string) int {
+	attributes := map[string]string{}
+	if agent := s.agents.Get(host); agent != nil {
+		for name, value := range agent.Attributes {
+			attributes[name] = value
+		}
+	}
+	attributes["hostname"] = host
+	return priority(classes, attributes)
+}
+
+// byPriority orders offers of higher priority hosts first, keeping the placement order within a priority.
+func (s *Scheduler) byPriority(offers []*mesos.Offer) {
+	classes := s.priorityClasses()
+	if len(classes) == 0 {
+		return
+	}
+
+	priorities := make(map[string]int, len(offers))
+	for _, offer := range offers {
+		priorities[offer.GetHostname()] = priority(classes, offerAttributes(offer))
+	}
+	sort.SliceStable(offers, func(i, j int) bool {
+		return priorities[offers[i].GetHostname()] > priorities[offers[j].GetHostname()]
+	})
+}
+
+// preemption is an instance freed for a higher priority host by killing a lower priority server.
+type preemption struct {
+	host     string
+	priority int
+	victim   string
+	started  time.Time
+}
+
+// preemptions keeps instances freed by preemption for the preempting hosts until servers launch on them.
+type preemptions struct {
+	pending map[string]*preemption // by preempting host
+	lock    sync.Mutex
+}
+
+func newPreemptions() *preemptions {
+	return &preemptions{pending: make(map[string]*preemption)}
+}
+
+func (p *preemptions) add(preemption *preemption) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.pending[preemption.host] = preemption
+}
+
+func (p *preemptions) get(host string) *preemption {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.expire()
+	return p.pending[host]
+}
+
+func (p *preemptions) done(host string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.pending, host)
+}
+
+// reservedFor returns the pending preemption of the highest priority above the given one, nil if there is none.
+func (p *preemptions) reservedFor(host string, priority int) *preemption {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.expire()
+	var reserved *preemption
+	for _, pending := range p.pending {
+		if pending.host != host && pending.priority > priority && (reserved == nil || pending.priority > reserved.priority) {
+			reserved = pending
+		}
+	}
+	return reserved
+}
+
+// expire drops preemptions older than the preemption timeout. Called with lock held.
+func (p *preemptions) expire() {
+	for host, pending := range p.pending {
+		if time.Since(pending.started) > preemptionTimeout {
+			delete(p.pending, host)
+		}
+	}
+}
+
+// checkReserved declines offers of hosts while an instance is kept for a preempting host of higher priority.
+func (s *Scheduler) checkReserved(offer *mesos.Offer) *Decline {
+	classes := s.priorityClasses()
+	if len(classes) == 0 {
+		return nil
+	}
+
+	if reserved := s.preemptions.reservedFor(offer.GetHostname(), priority(classes, offerAttributes(offer))); reserved != nil {
+		return declined(DeclineReserved, "Instance is reserved for %s of priority %d preempting %s.", reserved.host, reserved.priority, reserved.victim)
+	}
+	return nil
+}
+
+// preempt kills the lowest priority server to make room for a server on the offer's host when all instances are
+// running and the host has a higher priority. Returns why the offer is declined: the offer is not used right away as
+// the instance is freed once the killed server stopped.
+func (s *Scheduler) preempt(driver scheduler.SchedulerDriver, offer *mesos.Offer) *Decline {
+	decline := declined(DeclineInstancesRunning, "All %d instances are running.", s.config.Instances)
+	classes := s.priorityClasses()
+	if len(classes) == 0 {
+		return decline
+	}
+
+	host := offer.GetHostname()
+	if pending := s.preemptions.get(host); pending != nil {
+		return declined(DeclinePreempting, "Waiting for preempted server on %s to stop.", pending.victim)
+	}
+	if s.checkSpread(offer) != nil || s.match(offer) != nil {
+		return decline
+	}
+
+	offerPriority := priority(classes, offerAttributes(offer))
+	victim, victimPriority := "", offerPriority
+	for running := range s.cluster.GetTasksByHost() {
+		if s.migrating.Contains(running) || s.preempted(running) {
+			continue
+		}
+		if p := s.hostPriority(classes, running); p < victimPriority || p == victimPriority && victim != "" && running < victim {
+			victim, victimPriority = running, p
+		}
+	}
+	if victim == "" {
+		return decline
+	}
+
+	task := s.cluster.GetTasksByHost()[victim]
+	s.logger.Warnf("Preempting server %s on %s of priority %d for %s of priority %d", task.GetTaskId().GetValue(), victim, victimPriority, host, offerPriority)
+	s.preemptions.add(&preemption{host: host, priority: offerPriority, victim: victim, started: time.Now()})
+	s.timeline.Add(EventPreempted, victim, task.GetTaskId().GetValue(), fmt.Sprintf("priority %d preempted by %s of priority %d", victimPriority, host, offerPriority))
+	driver.KillTask(task.GetTaskId())
+	if standby := s.cluster.GetStandby(victim); standby != nil {
+		driver.KillTask(standby.GetTaskId())
+	}
+	return declined(DeclinePreempting, "Preempting server on %s of priority %d.", victim, victimPriority)
+}
+
+// preempted tells whether the server on the host is being killed for a preempting host.
+func (s *Scheduler) preempted(host string) bool {
+	s.preemptions.lock.Lock()
+	defer s.preemptions.lock.Unlock()
+
+	for _, pending := range s.preemptions.pending {
+		if pending.victim == host {
+			return true
+		}
+	}
+	return false
+}
+
+// mayPreempt tells whether a server of lower priority than the highest priority class runs, so offers are needed
+// even with all instances running.
+func (s *Scheduler) mayPreempt() bool {
+	classes := s.priorityClasses()
+	if len(classes) == 0 {
+		return false
+	}
+
+	highest := classes[0].Priority
+	for _, class := range classes {
+		if class.Priority > highest {
+			highest = class.Priority
+		}
+	}
+	for host := range s.cluster.GetTasksByHost() {
+		if s.hostPriority(classes, host) < highest {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,277 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elodina/siesta-producer"
+)
+
+var errLatencyBudget = errors.New("latency budget exceeded")
+
+// metricRecord is a single statsd line waiting to be produced to topic.
+type metricRecord struct {
+	topic    string
+	line     string
+	received time.Time
+	dual     bool // encoded with the dual write transform
+}
+
+// pendingAck is a produce request waiting for acknowledgement.
+type pendingAck struct {
+	ack    <-chan *producer.RecordMetadata
+	sent   time.Time
+	record *producer.ProducerRecord
+	name   string // metric name of the record
+}
+
+// producerShard owns a single Kafka producer and the queue of metrics routed to it.
+// Metrics are assigned to shards by metric name so that each name is always produced by the same producer.
+type producerShard struct {
+	id           int
+	producer     *producer.KafkaProducer
+	producerLock sync.Mutex
+	incoming     chan *metricRecord
+	burst        *burstBuffer // absorbs spikes once incoming is full, nil if disabled
+	acks         chan *pendingAck
+	buffer       *diskBuffer // keeps records while draining and, with bufferFailed, records failing to produce
+	bufferFailed bool
+	drainUntil   int64 // unix nanos until which records are buffered instead of produced
+	closeUntil   int64 // unix nanos until which queued records are still produced after close
+
+	received            int64
+	produced            int64
+	invalid             int64
+	failed              int64
+	timedOut            int64
+	expired             int64
+	consecutiveFailures int64
+}
+
+func newProducerShard(id int, kafkaProducer *producer.KafkaProducer) *producerShard {
+	shard := &producerShard{
+		id:       id,
+		producer: kafkaProducer,
+		incoming: make(chan *metricRecord, Config.queueSize()),
+		acks:     make(chan *pendingAck, 1000),
+	}
+	if Config.BurstSize > 0 {
+		shard.burst = newBurstBuffer(Config.BurstSize, Config.burstDuration(), shard.incoming)
+	}
+	return shard
+}
+
+func (ps *producerShard) currentProducer() *producer.KafkaProducer {
+	ps.producerLock.Lock()
+	defer ps.producerLock.Unlock()
+
+	return ps.producer
+}
+
+// replaceProducer swaps the shard producer, closing the previous one in background so queued records get flushed.
+func (ps *producerShard) replaceProducer(newProducer *producer.KafkaProducer) {
+	ps.producerLock.Lock()
+	oldProducer := ps.producer
+	ps.producer = newProducer
+	ps.producerLock.Unlock()
+
+	atomic.StoreInt64(&ps.consecutiveFailures, 0)
+	go oldProducer.Close(5 * time.Second)
+}
+
+// produce sends the record unless Kafka is drained, when it is buffered on disk to be produced after the drain.
+// Returns false for buffered records.
+func (ps *producerShard) produce(record *producer.ProducerRecord, name string) bool {
+	if ps.draining() {
+		ps.buffer.Add(record, name)
+		return false
+	}
+	ps.send(record, name)
+	return true
+}
+
+func (ps *producerShard) draining() bool {
+	return ps.buffer != nil && time.Now().UnixNano() < atomic.LoadInt64(&ps.drainUntil)
+}
+
+func (ps *producerShard) send(record *producer.ProducerRecord, name string) {
+	ack := &pendingAck{ack: ps.currentProducer().Send(record), sent: time.Now(), record: record, name: name}
+	if ps.bufferFailed {
+		ps.acks <- ack // records can only be buffered if their acks are watched
+		return
+	}
+	select {
+	case ps.acks <- ack:
+	default: // acks are only used for failure tracking, skip when falling behind
+	}
+}
+
+// watchAcks counts failed produce requests and requests not acknowledged within the produce timeout. Requests timing
+// out count as failed and are buffered with bufferFailed without waiting any longer, so a stuck request doesn't hold up
+// the acks of the following ones. A late acknowledgement is ignored, a buffered record may then be produced twice.
+func (ps *producerShard) watchAcks() {
+	for pending := range ps.acks {
+		metadata := ps.awaitAck(pending)
+		if metadata == nil {
+			atomic.AddInt64(&ps.timedOut, 1)
+		}
+
+		if metadata == nil || metadata.Error != nil {
+			atomic.AddInt64(&ps.failed, 1)
+			atomic.AddInt64(&ps.consecutiveFailures, 1)
+			if ps.bufferFailed {
+				ps.buffer.Add(pending.record, pending.name)
+			}
+		} else {
+			atomic.StoreInt64(&ps.consecutiveFailures, 0)
+		}
+	}
+}
+
+// maxAckWait is how long acknowledgements are awaited without a produce timeout.
+const maxAckWait = time.Minute
+
+// awaitAck returns the acknowledgement or nil if it didn't arrive within the produce timeout.
+func (ps *producerShard) awaitAck(pending *pendingAck) *producer.RecordMetadata {
+	timeout := Config.ProduceTimeout
+	if timeout <= 0 {
+		timeout = maxAckWait
+	}
+
+	timer := time.NewTimer(timeout - time.Since(pending.sent))
+	defer timer.Stop()
+	select {
+	case metadata := <-pending.ack:
+		return metadata
+	case <-timer.C:
+		return nil
+	}
+}
+
+// expiredRecord tells whether the record waited longer than the latency budget, so consumers would get it too late to be useful.
+func (ps *producerShard) expiredRecord(record *metricRecord) bool {
+	return Config.LatencyBudget > 0 && time.Since(record.received) > Config.LatencyBudget
+}
+
+func (ps *producerShard) enqueue(record *metricRecord) {
+	atomic.AddInt64(&ps.received, 1)
+	if ps.burst != nil {
+		ps.burst.put(record)
+		return
+	}
+	ps.incoming <- record
+}
+
+// start produces queued records encoded with encode. Records that fail encoding go to the dead-letter topic if one is configured.
+func (ps *producerShard) start(encode func(*metricRecord) ([]byte, error), host string) {
+	go ps.watchAcks()
+	defer close(ps.acks)
+
+	dropped := 0
+	for record := range ps.incoming {
+		if ps.pastCloseDeadline() {
+			dropped++
+			continue
+		}
+		if ps.expiredRecord(record) {
+			atomic.AddInt64(&ps.expired, 1)
+			if Config.DeadLetterTopic != "" {
+				ps.produce(&producer.ProducerRecord{Topic: Config.DeadLetterTopic, Value: newDeadLetter(host, record.line, errLatencyBudget)}, metricName(record.line))
+			}
+			continue
+		}
+
+		value, err := encode(record)
+		if err == nil {
+			err = chaosProduceFailure()
+		}
+		if err != nil {
+			atomic.AddInt64(&ps.invalid, 1)
+			Logger.Debugf("Invalid record %s: %s", record.line, err)
+			if Config.DeadLetterTopic != "" {
+				ps.produce(&producer.ProducerRecord{Topic: Config.DeadLetterTopic, Value: newDeadLetter(host, record.line, err)}, metricName(record.line))
+			}
+			continue
+		}
+
+		if ps.produce(&producer.ProducerRecord{Topic: record.topic, Value: value}, metricName(record.line)) {
+			atomic.AddInt64(&ps.produced, 1)
+		}
+	}
+
+	if dropped > 0 {
+		Logger.Warnf("Shard %d dropped %d queued records not produced within the kill grace period", ps.id, dropped)
+	}
+	ps.currentProducer().Close(time.Unix(0, atomic.LoadInt64(&ps.closeUntil)).Sub(time.Now()))
+}
+
+// close stops accepting records. Records already queued are produced and the producer flushed until the deadline.
+func (ps *producerShard) close(deadline time.Time) {
+	atomic.StoreInt64(&ps.closeUntil, deadline.UnixNano())
+	if ps.burst != nil {
+		ps.burst.close()
+		return
+	}
+	close(ps.incoming)
+}
+
+func (ps *producerShard) pastCloseDeadline() bool {
+	closeUntil := atomic.LoadInt64(&ps.closeUntil)
+	return closeUntil > 0 && time.Now().UnixNano() > closeUntil
+}
+
+func (ps *producerShard) occupancy() float64 {
+	return float64(len(ps.incoming)) / float64(cap(ps.incoming))
+}
+
+func (ps *producerShard) stats() *ShardStats {
+	stats := &ShardStats{
+		Shard:    ps.id,
+		Received: atomic.LoadInt64(&ps.received),
+		Produced: atomic.LoadInt64(&ps.produced),
+		Invalid:  atomic.LoadInt64(&ps.invalid),
+		Failed:   atomic.LoadInt64(&ps.failed),
+		TimedOut: atomic.LoadInt64(&ps.timedOut),
+		Expired:  atomic.LoadInt64(&ps.expired),
+		Queued:   len(ps.incoming),
+		Capacity: cap(ps.incoming),
+	}
+	if ps.burst != nil {
+		stats.Burst, stats.Absorbed, stats.Bursts, stats.BurstPeak = ps.burst.stats()
+	}
+	return stats
+}
+
+// metricName returns the metric name part of a statsd line, e.g. "api.latency" for "api.latency:12|ms".
+func metricName(line string) string {
+	if idx := strings.Index(line, ":"); idx != -1 {
+		return line[:idx]
+	}
+
+	return line
+}
+
+func shardFor(line string, shards int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(metricName(line)))
+	return int(hash.Sum32() % uint32(shards))
+}
@@ -0,0 +1,156 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	QuotaActionDrop   = "drop"
+	QuotaActionSample = "sample"
+	QuotaActionDivert = "divert"
+)
+
+type QuotaStats struct {
+	Namespace string
+	Limit     int64
+	Rate      int64 // events seen during the last full second
+	Accepted  int64
+	Exceeded  int64
+}
+
+type namespaceQuota struct {
+	limit    int64
+	second   int64
+	current  int64
+	previous int64
+	accepted int64
+	exceeded int64
+}
+
+// NamespaceQuotas enforces events-per-second limits per namespace, which is the first dot-separated segment of a metric name.
+type NamespaceQuotas struct {
+	quotas map[string]*namespaceQuota
+	lock   sync.Mutex
+}
+
+// ParseQuotas parses a quota definition like "app1=1000,app2=500" into namespace limits.
+func ParseQuotas(value string) (map[string]int64, error) {
+	limits := make(map[string]int64)
+	if value == "" {
+		return limits, nil
+	}
+
+	for _, quota := range strings.Split(value, ",") {
+		kv := strings.SplitN(quota, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("Invalid quota %s, expected namespace=events-per-second", quota)
+		}
+
+		limit, err := strconv.ParseInt(kv[1], 10, 64)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("Invalid quota limit for namespace %s: %s", kv[0], kv[1])
+		}
+		limits[kv[0]] = limit
+	}
+
+	return limits, nil
+}
+
+func NewNamespaceQuotas(limits map[string]int64) *NamespaceQuotas {
+	quotas := make(map[string]*namespaceQuota)
+	for namespace, limit := range limits {
+		quotas[namespace] = &namespaceQuota{limit: limit}
+	}
+
+	return &NamespaceQuotas{
+		quotas: quotas,
+	}
+}
+
+// Allow records an event for the namespace of the given metric name and returns false if the namespace is over its quota.
+func (nq *NamespaceQuotas) Allow(name string) bool {
+	if len(nq.quotas) == 0 {
+		return true
+	}
+
+	nq.lock.Lock()
+	defer nq.lock.Unlock()
+
+	quota, exists := nq.quotas[namespaceOf(name)]
+	if !exists {
+		return true
+	}
+
+	now := time.Now().Unix()
+	if now != quota.second {
+		if now == quota.second+1 {
+			quota.previous = quota.current
+		} else {
+			quota.previous = 0
+		}
+		quota.second = now
+		quota.current = 0
+	}
+
+	quota.current++
+	if quota.current > quota.limit {
+		quota.exceeded++
+		return false
+	}
+
+	quota.accepted++
+	return true
+}
+
+func (nq *NamespaceQuotas) Stats() []*QuotaStats {
+	nq.lock.Lock()
+	defer nq.lock.Unlock()
+
+	stats := make([]*QuotaStats, 0, len(nq.quotas))
+	for namespace, quota := range nq.quotas {
+		stats = append(stats, &QuotaStats{
+			Namespace: namespace,
+			Limit:     quota.limit,
+			Rate:      quota.previous,
+			Accepted:  quota.accepted,
+			Exceeded:  quota.exceeded,
+		})
+	}
+	sort.Sort(byNamespace(stats))
+
+	return stats
+}
+
+func namespaceOf(name string) string {
+	if idx := strings.Index(name, "."); idx != -1 {
+		return name[:idx]
+	}
+
+	return name
+}
+
+type byNamespace []*QuotaStats
+
+func (n byNamespace) Len() int           { return len(n) }
+func (n byNamespace) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n byNamespace) Less(i, j int) bool { return n[i].Namespace < n[j].Namespace }
@@ -0,0 +1,88 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseQuotas(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected map[string]int64
+		invalid  bool
+	}{
+		{"", map[string]int64{}, false},
+		{"app1=1000", map[string]int64{"app1": 1000}, false},
+		{"app1=1000,app2=500", map[string]int64{"app1": 1000, "app2": 500}, false},
+		{"app1=0", map[string]int64{"app1": 0}, false},
+		{"app1=1000,app1=10", map[string]int64{"app1": 10}, false},
+		{"app1", nil, true},
+		{"=1000", nil, true},
+		{"app1=", nil, true},
+		{"app1=-1", nil, true},
+		{"app1=1.5", nil, true},
+		{"app1=1000,", nil, true},
+		{"app1=1000;app2=500", nil, true},
+	}
+
+	for _, test := range tests {
+		quotas, err := ParseQuotas(test.value)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", test.value, quotas)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", test.value, err)
+		} else if !reflect.DeepEqual(quotas, test.expected) {
+			t.Errorf("%q: expected %v, got %v", test.value, test.expected, quotas)
+		}
+	}
+}
+
+func TestNamespaceQuotasAllow(t *testing.T) {
+	quotas := NewNamespaceQuotas(map[string]int64{"app1": 2, "app2": 0})
+	// quotas are per second, start early in one so the events are counted together
+	for time.Now().Nanosecond() > 900*int(time.Millisecond) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tests := []struct {
+		name  string
+		allow bool
+	}{
+		{"app1.hits", true},
+		{"app1.latency", true},
+		{"app1.hits", false},
+		{"app2.hits", false},
+		{"app3.hits", true},
+		{"app1", false},
+	}
+	for _, test := range tests {
+		if allow := quotas.Allow(test.name); allow != test.allow {
+			t.Errorf("%s: expected allow %t, got %t", test.name, test.allow, allow)
+		}
+	}
+
+	stats := quotas.Stats()
+	if len(stats) != 2 || stats[0].Namespace != "app1" || stats[0].Accepted != 2 || stats[0].Exceeded != 2 {
+		t.Errorf("unexpected quota stats %+v", stats[0])
+	}
+}
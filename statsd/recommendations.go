@@ -0,0 +1,169 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	occupancyHigh   = 0.8
+	occupancyTarget = 0.5
+	occupancyLow    = 0.1
+	memoryHigh      = 0.8
+)
+
+// HostLoad summarizes stats history reported from a host.
+type HostLoad struct {
+	Host         string
+	Samples      int
+	P99Occupancy float64
+	EventsPerSec float64
+	MemoryMb     float64
+}
+
+type Recommendation struct {
+	Setting   string
+	Current   string
+	Suggested string
+	Reason    string
+}
+
+func (r *Recommendation) String() string {
+	return fmt.Sprintf("%s: %s -> %s (%s)", r.Setting, r.Current, r.Suggested, r.Reason)
+}
+
+func hostLoad(host string, history []*ExecutorStats) *HostLoad {
+	load := &HostLoad{Host: host, Samples: len(history)}
+	occupancies := make([]float64, len(history))
+	for i, stats := range history {
+		occupancies[i] = stats.Occupancy()
+		if memoryMb := float64(stats.Memory) / 1024 / 1024; memoryMb > load.MemoryMb {
+			load.MemoryMb = memoryMb
+		}
+	}
+	load.P99Occupancy = percentile(occupancies, 0.99)
+
+	if len(history) > 1 {
+		first, last := history[0], history[len(history)-1]
+		if seconds := last.Timestamp - first.Timestamp; seconds > 0 && last.Received() >= first.Received() {
+			load.EventsPerSec = float64(last.Received()-first.Received()) / float64(seconds)
+		}
+	}
+
+	return load
+}
+
+// Recommend suggests changes to the sizing in the configuration from the load observed on hosts.
+func Recommend(c *config, loads []*HostLoad) []*Recommendation {
+	recommendations := make([]*Recommendation, 0)
+	if len(loads) == 0 {
+		return recommendations
+	}
+
+	overloaded := 0
+	maxOccupancy := 0.0
+	maxMemory := 0.0
+	for _, load := range loads {
+		if load.P99Occupancy >= occupancyHigh {
+			overloaded++
+		}
+		maxOccupancy = math.Max(maxOccupancy, load.P99Occupancy)
+		maxMemory = math.Max(maxMemory, load.MemoryMb)
+	}
+
+	producers := c.producerCount()
+	occupancyReason := fmt.Sprintf("p99 buffer occupancy %.0f%% on %d of %d hosts", maxOccupancy*100, overloaded, len(loads))
+	if overloaded > 0 {
+		scale := maxOccupancy / occupancyTarget
+		suggested := int(math.Ceil(float64(producers) * scale))
+		recommendations = append(recommendations, &Recommendation{
+			Setting:   "producers",
+			Current:   fmt.Sprint(producers),
+			Suggested: fmt.Sprint(suggested),
+			Reason:    occupancyReason,
+		}, &Recommendation{
+			Setting:   "cpu",
+			Current:   fmt.Sprintf("%.2f", c.Cpus),
+			Suggested: fmt.Sprintf("%.2f", c.Cpus*float64(suggested)/float64(producers)),
+			Reason:    "keep cpus proportional to producers",
+		})
+
+		if overloaded == len(loads) {
+			recommendations = append(recommendations, &Recommendation{
+				Setting:   "instances",
+				Current:   fmt.Sprint(len(loads)),
+				Suggested: fmt.Sprint(int(math.Ceil(float64(len(loads)) * scale))),
+				Reason:    "all hosts are overloaded, spread statsd clients over more hosts",
+			})
+		}
+	} else if maxOccupancy <= occupancyLow && producers > 1 {
+		suggested := int(math.Max(1, math.Ceil(float64(producers)*maxOccupancy/occupancyTarget)))
+		if suggested < producers {
+			recommendations = append(recommendations, &Recommendation{
+				Setting:   "producers",
+				Current:   fmt.Sprint(producers),
+				Suggested: fmt.Sprint(suggested),
+				Reason:    fmt.Sprintf("p99 buffer occupancy is at most %.0f%%", maxOccupancy*100),
+			})
+		}
+	}
+
+	if c.Mem > 0 && maxMemory >= c.Mem*memoryHigh {
+		recommendations = append(recommendations, &Recommendation{
+			Setting:   "mem",
+			Current:   fmt.Sprintf("%.0f", c.Mem),
+			Suggested: fmt.Sprintf("%.0f", math.Ceil(maxMemory*1.5/32)*32),
+			Reason:    fmt.Sprintf("executors use up to %.0f MB", maxMemory),
+		})
+	}
+
+	return recommendations
+}
+
+func (s *Scheduler) hostLoads() []*HostLoad {
+	loads := make([]*HostLoad, 0)
+	for host := range s.cluster.GetTasksByHost() {
+		if history := s.cluster.GetStatsHistory(host); len(history) > 0 {
+			loads = append(loads, hostLoad(host, history))
+		}
+	}
+
+	sort.Sort(byHost(loads))
+	return loads
+}
+
+type byHost []*HostLoad
+
+func (h byHost) Len() int           { return len(h) }
+func (h byHost) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h byHost) Less(i, j int) bool { return h[i].Host < h[j].Host }
+
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
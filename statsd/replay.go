@@ -0,0 +1,306 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kafkaavro "github.com/elodina/go-kafka-avro"
+	"github.com/elodina/siesta"
+	"github.com/elodina/statsd-mesos-kafka/statsd/avro"
+	pb "github.com/elodina/statsd-mesos-kafka/statsd/proto"
+	"github.com/gogo/protobuf/proto"
+)
+
+// Replay consumes metrics produced in a time range and sends them to a statsd server or writer again, e.g. to rebuild a
+// downstream TSDB or load-test consumers with real traffic.
+//
+// Avro and proto records carry the time they were received, which is used to match the range exactly and to keep
+// the original pace. Records without it (transform none) are matched by Kafka offset lookup, which works on log
+// segment boundaries, and are sent as fast as possible.
+type Replay struct {
+	Topic     string
+	Transform string
+	From      time.Time
+	To        time.Time // zero replays up to the latest offset at start
+	Speed     float64   // 1 keeps the original pace, 2 replays twice as fast, 0 as fast as possible
+
+	connector  siesta.Connector
+	decode     func([]byte) (string, time.Time, error)
+	output     io.Writer
+	outputLock sync.Mutex
+	start      time.Time // when the first record was sent
+	first      time.Time // when the first record was received originally
+	paceLock   sync.Mutex
+
+	sent    int64
+	skipped int64
+	failed  int64
+}
+
+func NewReplay(topic string, transform string, from time.Time, to time.Time, speed float64, output io.Writer) (*Replay, error) {
+	if topic == "" {
+		return nil, errors.New("topic is required")
+	}
+	if speed < 0 {
+		return nil, errors.New("speed can't be negative")
+	}
+
+	replay := &Replay{
+		Topic:     topic,
+		Transform: transform,
+		From:      from,
+		To:        to,
+		Speed:     speed,
+		output:    output,
+	}
+
+	switch transform {
+	case TransformNone:
+		replay.decode = decodeNone
+	case TransformAvro:
+		replay.decode = decodeAvro(kafkaavro.NewKafkaAvroDecoder(Config.SchemaRegistryUrl))
+	case TransformProto:
+		replay.decode = decodeProto
+	default:
+		return nil, fmt.Errorf("Invalid transform %s, expected none|avro|proto", transform)
+	}
+
+	brokers, err := bootstrapBrokers()
+	if err != nil {
+		return nil, err
+	}
+	connectorConfig := siesta.NewConnectorConfig()
+	connectorConfig.BrokerList = brokers
+	connectorConfig.ClientID = "statsd-mesos-kafka-replay"
+	if replay.connector, err = siesta.NewDefaultConnector(connectorConfig); err != nil {
+		return nil, err
+	}
+
+	return replay, nil
+}
+
+// NewUdpOutput sends each replayed metric as a statsd packet to the address.
+func NewUdpOutput(address string) (io.Writer, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	return net.DialUDP("udp", nil, addr)
+}
+
+// Run replays all partitions in parallel, each one paced against the same start so the original order is kept.
+func (r *Replay) Run() error {
+	defer func() { <-r.connector.Close() }()
+
+	metadata, err := r.connector.GetTopicMetadata([]string{r.Topic})
+	if err != nil {
+		return err
+	}
+
+	partitions := make([]int32, 0)
+	for _, topicMetadata := range metadata.TopicsMetadata {
+		if topicMetadata.Error != siesta.ErrNoError {
+			return fmt.Errorf("Failed to get metadata of topic %s: %s", r.Topic, topicMetadata.Error)
+		}
+		for _, partitionMetadata := range topicMetadata.PartitionsMetadata {
+			partitions = append(partitions, partitionMetadata.PartitionID)
+		}
+	}
+	if len(partitions) == 0 {
+		return fmt.Errorf("Topic %s has no partitions", r.Topic)
+	}
+
+	errs := make(chan error, len(partitions))
+	for _, partition := range partitions {
+		go func(partition int32) {
+			errs <- r.replayPartition(partition)
+		}(partition)
+	}
+
+	var firstErr error
+	for range partitions {
+		if err := <-errs; err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (r *Replay) replayPartition(partition int32) error {
+	startTime := siesta.EarliestTime
+	if !r.From.IsZero() {
+		startTime = r.From.UnixNano() / int64(time.Millisecond)
+	}
+	offset, err := r.offsetAt(partition, startTime)
+	if err != nil {
+		return fmt.Errorf("Failed to find start offset of partition %d: %s", partition, err)
+	}
+
+	endTime := siesta.LatestTime
+	if !r.To.IsZero() && r.Transform == TransformNone {
+		endTime = r.To.UnixNano() / int64(time.Millisecond)
+	}
+	end, err := r.offsetAt(partition, endTime)
+	if err != nil {
+		return fmt.Errorf("Failed to find end offset of partition %d: %s", partition, err)
+	}
+
+	for offset < end {
+		response, err := r.connector.Fetch(r.Topic, partition, offset)
+		if err != nil {
+			return fmt.Errorf("Failed to fetch partition %d at offset %d: %s", partition, offset, err)
+		}
+		messages, err := response.GetMessages()
+		if err != nil {
+			return fmt.Errorf("Failed to fetch partition %d at offset %d: %s", partition, offset, err)
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		for _, message := range messages {
+			if message.Offset < offset {
+				continue // compressed message sets start at the beginning of the set
+			}
+			if message.Offset >= end {
+				return nil
+			}
+			offset = message.Offset + 1
+
+			line, received, err := r.decode(message.Value)
+			if err != nil {
+				Logger.Debugf("Skipping undecodable record at partition %d offset %d: %s", partition, message.Offset, err)
+				atomic.AddInt64(&r.failed, 1)
+				continue
+			}
+			if !received.IsZero() {
+				if received.Before(r.From) {
+					atomic.AddInt64(&r.skipped, 1)
+					continue
+				}
+				if !r.To.IsZero() && received.After(r.To) {
+					return nil
+				}
+				r.pace(received)
+			}
+
+			r.send(line)
+		}
+	}
+
+	return nil
+}
+
+// offsetAt looks up the first offset of the log segment containing the time. Kafka answers lookups before its oldest
+// segment with no offsets, which the connector doesn't check, so these start at the earliest offset.
+func (r *Replay) offsetAt(partition int32, at int64) (offset int64, err error) {
+	defer func() {
+		if recover() != nil {
+			offset, err = r.connector.GetAvailableOffset(r.Topic, partition, siesta.EarliestTime)
+		}
+	}()
+
+	return r.connector.GetAvailableOffset(r.Topic, partition, at)
+}
+
+// pace waits until the record is due, keeping its original distance to the first replayed record.
+func (r *Replay) pace(received time.Time) {
+	if r.Speed == 0 {
+		return
+	}
+
+	r.paceLock.Lock()
+	if r.start.IsZero() {
+		r.start, r.first = time.Now(), received
+	}
+	due := r.start.Add(time.Duration(float64(received.Sub(r.first)) / r.Speed))
+	r.paceLock.Unlock()
+
+	if wait := due.Sub(time.Now()); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+func (r *Replay) send(line string) {
+	r.outputLock.Lock()
+	defer r.outputLock.Unlock()
+
+	if _, err := io.WriteString(r.output, line+"\n"); err != nil {
+		Logger.Debugf("Failed to send %s: %s", line, err)
+		atomic.AddInt64(&r.failed, 1)
+		return
+	}
+	atomic.AddInt64(&r.sent, 1)
+}
+
+func (r *Replay) String() string {
+	return fmt.Sprintf("sent: %d, skipped: %d, failed: %d", atomic.LoadInt64(&r.sent), atomic.LoadInt64(&r.skipped), atomic.LoadInt64(&r.failed))
+}
+
+func decodeNone(value []byte) (string, time.Time, error) {
+	return string(value), time.Time{}, nil
+}
+
+func decodeAvro(decoder *kafkaavro.KafkaAvroDecoder) func([]byte) (string, time.Time, error) {
+	return func(value []byte) (string, time.Time, error) {
+		logLine := avro.NewLogLine()
+		if err := decoder.DecodeSpecific(value, logLine); err != nil {
+			return "", time.Time{}, err
+		}
+
+		line, ok := logLine.Line.(string)
+		if !ok {
+			return "", time.Time{}, errors.New("record has no line")
+		}
+		for _, timing := range logLine.Timings {
+			if timing.EventName == "received" {
+				return line, time.Unix(0, timing.Value), nil
+			}
+		}
+		return line, time.Time{}, nil
+	}
+}
+
+func decodeProto(value []byte) (string, time.Time, error) {
+	logLine := new(pb.LogLine)
+	if err := proto.Unmarshal(value, logLine); err != nil {
+		return "", time.Time{}, err
+	}
+
+	for _, timing := range logLine.GetTimings() {
+		if timing.GetEventName() == "received" {
+			return logLine.GetLine(), time.Unix(0, timing.GetValue()), nil
+		}
+	}
+	return logLine.GetLine(), time.Time{}, nil
+}
+
+// ParseReplayTime reads RFC3339 time or unix seconds, empty means no limit.
+func ParseReplayTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return parseSince(value)
+}
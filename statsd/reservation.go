@@ -0,0 +1,112 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+)
+
+// bufferPath is where the persistent volume is mounted in the executor sandbox.
+const bufferPath = "buffer"
+
+// reservation tells how a server is launched with resources reserved for the framework role on its agent: the
+// resources the task uses and the operations reserving them and creating the volume if the offer doesn't have them yet.
+type reservation struct {
+	resources  []*mesos.Resource
+	operations []*mesos.Offer_Operation
+}
+
+// persistenceId identifies the server volume on the agent. Ids need to be unique per role on each agent only.
+func (s *Scheduler) persistenceId(hostname string) string {
+	return fmt.Sprintf("%s-%s", s.config.FrameworkName, hostname)
+}
+
+// reserve returns the reservation used to launch a server with the offer. Reserved resources in offers are reused, so
+// a relaunched server gets the same resources and the volume with records its predecessor didn't manage to send.
+func (s *Scheduler) reserve(offer *mesos.Offer, cpus float64, mem float64) *reservation {
+	r := &reservation{
+		resources: []*mesos.Resource{
+			util.NewScalarResourceWithReservation("cpus", cpus, s.config.FrameworkPrincipal, s.config.FrameworkRole),
+			util.NewScalarResourceWithReservation("mem", mem, s.config.FrameworkPrincipal, s.config.FrameworkRole),
+		},
+		operations: make([]*mesos.Offer_Operation, 0),
+	}
+
+	// reserve what's missing only, e.g. after cpu or mem were increased
+	missing := make([]*mesos.Resource, 0)
+	for _, resource := range r.resources {
+		if shortfall := resource.GetScalar().GetValue() - s.reservedScalar(offer, resource.GetName()); shortfall > 0 {
+			missing = append(missing, util.NewScalarResourceWithReservation(resource.GetName(), shortfall, s.config.FrameworkPrincipal, s.config.FrameworkRole))
+		}
+	}
+	if len(missing) > 0 {
+		r.operations = append(r.operations, util.NewReserveOperation(missing))
+	}
+
+	if s.config.VolumeSize > 0 {
+		volume := util.NewVolumeResourceWithReservation(s.config.VolumeSize, bufferPath, s.persistenceId(offer.GetHostname()),
+			mesos.Volume_RW.Enum(), s.config.FrameworkPrincipal, s.config.FrameworkRole)
+		if !offersVolume(offer, s.persistenceId(offer.GetHostname())) {
+			disk := util.NewScalarResourceWithReservation("disk", s.config.VolumeSize, s.config.FrameworkPrincipal, s.config.FrameworkRole)
+			r.operations = append(r.operations, util.NewReserveOperation([]*mesos.Resource{disk}))
+			r.operations = append(r.operations, util.NewCreateOperation([]*mesos.Resource{volume}))
+		}
+		r.resources = append(r.resources, volume)
+	}
+
+	return r
+}
+
+// reservedScalar sums up resources of the offer reserved for the framework role, volumes excluded.
+func (s *Scheduler) reservedScalar(offer *mesos.Offer, name string) float64 {
+	amount := 0.0
+	for _, resource := range offer.GetResources() {
+		if resource.GetName() == name && resource.GetRole() == s.config.FrameworkRole && resource.GetReservation() != nil &&
+			resource.GetDisk().GetPersistence() == nil {
+			amount += resource.GetScalar().GetValue()
+		}
+	}
+	return amount
+}
+
+func offersVolume(offer *mesos.Offer, id string) bool {
+	for _, resource := range offer.GetResources() {
+		if resource.GetDisk().GetPersistence().GetId() == id {
+			return true
+		}
+	}
+	return false
+}
+
+// validateReservation tells why servers can't reserve resources with the configuration, if so.
+func validateReservation(c *config) error {
+	if c.FrameworkRole == "*" || c.FrameworkPrincipal == "" {
+		return errors.New("reserve requires the scheduler to run with framework.principal and framework.role other than *")
+	}
+	return nil
+}
+
+// checkReservation tells why the offer can't be used for a reserved server, if so.
+func (s *Scheduler) checkReservation(offer *mesos.Offer) *Decline {
+	if s.config.VolumeSize > 0 && !offersVolume(offer, s.persistenceId(offer.GetHostname())) && getScalarResources(offer, "disk") < s.config.VolumeSize {
+		return declined(DeclineInsufficientDisk, "no disk for the buffer volume")
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// resourceUsageInterval is how often executor resource usage is pulled from agents.
+var resourceUsageInterval = time.Minute
+
+// executorStatistics is an entry of the agent /monitor/statistics.json endpoint.
+type executorStatistics struct {
+	ExecutorId  string          `json:"executor_id"`
+	FrameworkId string          `json:"framework_id"`
+	Statistics  *resourceSample `json:"statistics"`
+}
+
+type resourceSample struct {
+	Timestamp      float64 `json:"timestamp"`
+	CpusUserTime   float64 `json:"cpus_user_time_secs"`
+	CpusSystemTime float64 `json:"cpus_system_time_secs"`
+	CpusLimit      float64 `json:"cpus_limit"`
+	MemRssBytes    uint64  `json:"mem_rss_bytes"`
+	MemLimitBytes  uint64  `json:"mem_limit_bytes"`
+}
+
+func (s *resourceSample) cpuTime() float64 {
+	return s.CpusUserTime + s.CpusSystemTime
+}
+
+// ResourceUsage is the actual and allocated usage of an executor, including the server it runs.
+type ResourceUsage struct {
+	Host       string
+	CpusUsed   float64 // cpus used on average since the previous sample, 0 for the first one
+	CpusLimit  float64
+	MemUsedMb  float64
+	MemLimitMb float64
+
+	sample *resourceSample
+}
+
+func (u *ResourceUsage) String() string {
+	return fmt.Sprintf("cpus %.2f of %.2f, mem %.1f of %.1f MB", u.CpusUsed, u.CpusLimit, u.MemUsedMb, u.MemLimitMb)
+}
+
+// resourceUsages holds the last usage sampled per host.
+type resourceUsages struct {
+	usages map[string]*ResourceUsage
+	lock   sync.Mutex
+}
+
+func newResourceUsages() *resourceUsages {
+	return &resourceUsages{usages: make(map[string]*ResourceUsage)}
+}
+
+// Observe records a sample, deriving cpu usage from the cpu time spent since the previous sample of the host.
+func (r *resourceUsages) Observe(host string, sample *resourceSample) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	usage := &ResourceUsage{
+		Host:       host,
+		CpusLimit:  sample.CpusLimit,
+		MemUsedMb:  float64(sample.MemRssBytes) / 1024 / 1024,
+		MemLimitMb: float64(sample.MemLimitBytes) / 1024 / 1024,
+		sample:     sample,
+	}
+	if previous, exists := r.usages[host]; exists {
+		elapsed := sample.Timestamp - previous.sample.Timestamp
+		if used := sample.cpuTime() - previous.sample.cpuTime(); elapsed > 0 && used >= 0 {
+			usage.CpusUsed = used / elapsed
+		}
+	}
+	r.usages[host] = usage
+}
+
+// Retain forgets hosts not running a server anymore.
+func (r *resourceUsages) Retain(hosts map[string]bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for host := range r.usages {
+		if !hosts[host] {
+			delete(r.usages, host)
+		}
+	}
+}
+
+func (r *resourceUsages) Get(host string) *ResourceUsage {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.usages[host]
+}
+
+// watchResourceUsage samples the resource usage of executors running servers from the agents they run on.
+func (s *Scheduler) watchResourceUsage() {
+	ticker := time.NewTicker(resourceUsageInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.sampleResourceUsage(); err != nil {
+			s.logger.Debugf("Failed to sample resource usage: %s", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Scheduler) sampleResourceUsage() error {
+	tasks := s.cluster.GetTasksByHost()
+	hosts := make(map[string]bool)
+	slaves := make(map[string]bool)
+	for host, task := range tasks {
+		hosts[host] = true
+		slaves[task.GetSlaveId().GetValue()] = true
+	}
+	s.usages.Retain(hosts)
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	state, err := fetchMasterState(s.currentMasterUrl())
+	if err != nil {
+		return err
+	}
+
+	for _, slave := range state.Slaves {
+		if !slaves[slave.Id] {
+			continue
+		}
+
+		statistics := make([]*executorStatistics, 0)
+		if err := getJson(agentClient, slave.Url()+"/monitor/statistics.json", &statistics); err != nil {
+			s.logger.Debugf("Failed to fetch resource usage from agent %s: %s", slave.Hostname, err)
+			continue
+		}
+
+		for _, executor := range statistics {
+			if executor.FrameworkId != s.frameworkId || executor.Statistics == nil {
+				continue
+			}
+			host := hostnameFromExecutorId(executor.ExecutorId)
+			if task := tasks[host]; task != nil && task.GetExecutor().GetExecutorId().GetValue() == executor.ExecutorId {
+				s.usages.Observe(host, executor.Statistics)
+			}
+		}
+	}
+	return nil
+}
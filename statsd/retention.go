@@ -0,0 +1,57 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import "time"
+
+// historyCompactionInterval is how often history exceeding the retention is dropped.
+var historyCompactionInterval = time.Minute
+
+// compactHistory periodically drops timeline events, stats reports, agents and relaunch failures older than
+// HistoryMaxAge, so long-running schedulers don't grow without bounds.
+func (s *Scheduler) compactHistory() {
+	ticker := time.NewTicker(historyCompactionInterval)
+	defer ticker.Stop()
+
+	for {
+		s.compact(time.Now().Add(-s.config.HistoryMaxAge))
+
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Scheduler) compact(before time.Time) {
+	running := make(map[string]bool)
+	for host := range s.cluster.GetTasksByHost() {
+		running[host] = true
+	}
+	for host := range s.cluster.GetStandbyByHost() {
+		running[host] = true
+	}
+
+	events := s.timeline.Compact(before, s.config.HistoryMaxEvents)
+	stats := s.cluster.CompactStats(before)
+	agents := s.agents.Compact(before, running)
+	failures := s.backoff.Compact(before)
+	if events+stats+agents+failures > 0 {
+		s.logger.Debugf("Compacted history before %s: %d events, %d stats reports, %d agents, %d relaunch failures",
+			before.Format(time.RFC3339), events, stats, agents, failures)
+	}
+}
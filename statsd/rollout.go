@@ -0,0 +1,339 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// rolloutTimeout is how long a restarted server may take to come back and report stats.
+var rolloutTimeout = 5 * time.Minute
+
+const (
+	rolloutPending    = "pending"
+	rolloutRestarting = "restarting"
+	rolloutDone       = "done"
+)
+
+// Rollout tracks servers being restarted one batch at a time to pick up an updated configuration.
+type Rollout struct {
+	Version int
+	Started time.Time
+
+	hosts    map[string]string // host -> pending, restarting, done or the failure reason
+	killed   map[string]string // host -> id of the task killed to restart it
+	finished bool
+	lock     sync.Mutex
+
+	ctx    context.Context // done once finished, wakes up the rollout waiting between batches
+	cancel context.CancelFunc
+}
+
+func newRollout(ctx context.Context, version int, hosts []string) *Rollout {
+	rollout := &Rollout{
+		Version: version,
+		Started: time.Now(),
+		hosts:   make(map[string]string),
+		killed:  make(map[string]string),
+	}
+	rollout.ctx, rollout.cancel = context.WithCancel(ctx)
+	for _, host := range hosts {
+		rollout.hosts[host] = rolloutPending
+	}
+	return rollout
+}
+
+func (r *Rollout) set(host string, state string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.hosts[host] = state
+}
+
+// finish fails hosts not restarted yet with the given reason.
+func (r *Rollout) finish(reason string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.finished = true
+	r.cancel()
+	for host, state := range r.hosts {
+		if state == rolloutPending || state == rolloutRestarting {
+			r.hosts[host] = reason
+		}
+	}
+}
+
+func (r *Rollout) inProgress() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return !r.finished
+}
+
+// progress returns the number of hosts done and the total number of hosts.
+func (r *Rollout) progress() (int, int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	done := 0
+	for _, state := range r.hosts {
+		if state == rolloutDone {
+			done++
+		}
+	}
+	return done, len(r.hosts)
+}
+
+// RolloutStatus is the structured result of /api/rollout/status.
+type RolloutStatus struct {
+	Version  int
+	Started  time.Time
+	Finished bool
+	Done     int
+	Total    int
+	Hosts    map[string]string // host -> pending, restarting, done or the failure reason
+}
+
+func (r *Rollout) Status() *RolloutStatus {
+	done, total := r.progress()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	status := &RolloutStatus{Version: r.Version, Started: r.Started, Finished: r.finished, Done: done, Total: total,
+		Hosts: make(map[string]string, len(r.hosts))}
+	for host, state := range r.hosts {
+		status.Hosts[host] = state
+	}
+	return status
+}
+
+func (r *Rollout) String() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	hosts := make([]string, 0, len(r.hosts))
+	for host := range r.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	state := "in progress"
+	if r.finished {
+		state = "finished"
+	}
+	result := fmt.Sprintf("rollout of config version %d started %s, %s:\n", r.Version, r.Started.Format(time.RFC3339), state)
+	for _, host := range hosts {
+		result += fmt.Sprintf("  %s: %s\n", host, r.hosts[host])
+	}
+	return result
+}
+
+// needsRollout tells whether the update changed anything executors use. Rollout settings, the number of instances
+// and the control topic are used by the scheduler alone.
+func needsRollout(before *config, after *config) bool {
+	compared := *before
+	compared.Instances = after.Instances
+	compared.Priorities = after.Priorities
+	compared.ControlTopic = after.ControlTopic
+	compared.RolloutParallelism = after.RolloutParallelism
+	compared.RolloutPause = after.RolloutPause
+	return compared.String() != after.String()
+}
+
+// RollOut restarts running servers in batches of the configured rollout parallelism so they pick up the current
+// configuration. A rollout already in progress is superseded. Does nothing if rolling restarts are disabled.
+func (s *Scheduler) RollOut() *Rollout {
+	if s.config.RolloutParallelism <= 0 || s.currentDriver() == nil {
+		return nil
+	}
+
+	hosts := make([]string, 0)
+	for host := range s.cluster.GetTasksByHost() {
+		hosts = append(hosts, host)
+	}
+	if len(hosts) == 0 {
+		return nil
+	}
+	sort.Strings(hosts)
+
+	s.activeLock.Lock()
+	version := s.configVersion
+	s.activeLock.Unlock()
+
+	rollout := newRollout(s.ctx, version, hosts)
+	s.rolloutLock.Lock()
+	previous := s.rollout
+	s.rollout = rollout
+	s.rolloutLock.Unlock()
+	if previous != nil && previous.inProgress() {
+		previous.finish(fmt.Sprintf("superseded by config version %d", version))
+	}
+
+	s.timeline.Add(EventRollout, "", "", fmt.Sprintf("restarting %d servers for config version %d, %d at a time", len(hosts), version, s.config.RolloutParallelism))
+	go s.rollOut(rollout, hosts, s.config.RolloutParallelism, s.config.RolloutPause)
+	return rollout
+}
+
+func (s *Scheduler) rollOut(rollout *Rollout, hosts []string, parallelism int, pause time.Duration) {
+	for i := 0; i < len(hosts); i += parallelism {
+		end := i + parallelism
+		if end > len(hosts) {
+			end = len(hosts)
+		}
+		if i > 0 {
+			sleepContext(rollout.ctx, pause)
+		}
+		if !rollout.inProgress() {
+			return
+		}
+		if rollout.ctx.Err() != nil {
+			s.cancelRollout(rollout, "scheduler is shutting down")
+			return
+		}
+
+		batch := hosts[i:end]
+		for _, host := range batch {
+			s.restart(rollout, host)
+		}
+		if err := s.awaitRestart(rollout, batch); err != nil {
+			if !rollout.inProgress() {
+				return
+			}
+			if rollout.ctx.Err() != nil {
+				s.cancelRollout(rollout, "scheduler is shutting down")
+				return
+			}
+			rollout.finish("aborted")
+			s.timeline.Add(EventRollout, "", "", fmt.Sprintf("config version %d aborted: %s", rollout.Version, err))
+			return
+		}
+	}
+
+	if !rollout.inProgress() {
+		return
+	}
+	done, total := rollout.progress()
+	rollout.finish("aborted")
+	s.timeline.Add(EventRollout, "", "", fmt.Sprintf("config version %d finished: %d of %d servers restarted", rollout.Version, done, total))
+}
+
+// restart kills the server and standby task on the host. Killed tasks are relaunched by offers as usual.
+func (s *Scheduler) restart(rollout *Rollout, host string) {
+	task, exists := s.cluster.GetTasksByHost()[host]
+	if !exists {
+		rollout.set(host, "skipped, not running")
+		return
+	}
+	if s.migrating.Contains(host) {
+		rollout.set(host, "skipped, being migrated")
+		return
+	}
+	driver := s.awaitDriver(rollout.ctx, rolloutTimeout)
+	if driver == nil {
+		rollout.set(host, "skipped, disconnected from master")
+		return
+	}
+
+	rollout.lock.Lock()
+	rollout.hosts[host] = rolloutRestarting
+	rollout.killed[host] = task.GetTaskId().GetValue()
+	rollout.lock.Unlock()
+
+	s.logger.Infof("Killing task %s to restart it with config version %d", task.GetTaskId().GetValue(), rollout.Version)
+	s.timeline.Add(EventRollout, host, task.GetTaskId().GetValue(), fmt.Sprintf("restarting for config version %d", rollout.Version))
+	if standby := s.cluster.GetStandby(host); standby != nil {
+		driver.KillTask(standby.GetTaskId())
+	}
+	driver.KillTask(task.GetTaskId())
+}
+
+// awaitRestart waits until every restarting host in the batch runs a new task reporting stats.
+func (s *Scheduler) awaitRestart(rollout *Rollout, batch []string) error {
+	deadline := time.Now().Add(rolloutTimeout)
+	for {
+		if !rollout.inProgress() {
+			return nil
+		}
+
+		waiting := 0
+		for _, host := range batch {
+			rollout.lock.Lock()
+			state, killed := rollout.hosts[host], rollout.killed[host]
+			rollout.lock.Unlock()
+			if state != rolloutRestarting {
+				continue
+			}
+
+			task, exists := s.cluster.GetTasksByHost()[host]
+			if exists && task.GetTaskId().GetValue() != killed && s.cluster.GetStats(host) != nil {
+				rollout.set(host, rolloutDone)
+				s.timeline.Add(EventRollout, host, task.GetTaskId().GetValue(), "restarted")
+				continue
+			}
+			waiting++
+		}
+		if waiting == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			for _, host := range batch {
+				rollout.lock.Lock()
+				if rollout.hosts[host] == rolloutRestarting {
+					rollout.hosts[host] = fmt.Sprintf("not back within %s", rolloutTimeout)
+				}
+				rollout.lock.Unlock()
+			}
+			return fmt.Errorf("%d servers not back within %s", waiting, rolloutTimeout)
+		}
+		if err := sleepContext(rollout.ctx, migrationCheckInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// CancelRollout stops the rollout in progress. Servers already killed come back as usual, the rest aren't restarted.
+func (s *Scheduler) CancelRollout() error {
+	rollout := s.Rollout()
+	if rollout == nil || !rollout.inProgress() {
+		return errors.New("No rollout in progress")
+	}
+
+	s.cancelRollout(rollout, "cancelled")
+	return nil
+}
+
+func (s *Scheduler) cancelRollout(rollout *Rollout, reason string) {
+	done, total := rollout.progress()
+	rollout.finish(reason)
+	s.timeline.Add(EventRollout, "", "", fmt.Sprintf("config version %d %s: %d of %d servers restarted", rollout.Version, reason, done, total))
+}
+
+// Rollout returns the last rolling restart or nil if there was none.
+func (s *Scheduler) Rollout() *Rollout {
+	s.rolloutLock.Lock()
+	defer s.rolloutLock.Unlock()
+
+	return s.rollout
+}
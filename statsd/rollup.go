@@ -0,0 +1,133 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	RollupGroup = "group"
+	RollupZone  = "zone"
+	RollupState = "state"
+)
+
+// zoneAttribute is the agent attribute servers are rolled up by for rollup=zone.
+var zoneAttribute = "zone"
+
+// Rollup sums up servers sharing a zone, attribute value or state.
+type Rollup struct {
+	Key          string
+	Servers      int
+	Standby      int
+	Reporting    int // servers that reported stats
+	Received     int64
+	Produced     int64
+	Failed       int64
+	EventsPerSec float64
+	MaxOccupancy float64
+}
+
+func (r *Rollup) String() string {
+	return fmt.Sprintf("  %s: servers %d (standby %d, reporting %d), received %d, produced %d, failed %d, %.1f events/s, max occupancy %.0f%%\n",
+		r.Key, r.Servers, r.Standby, r.Reporting, r.Received, r.Produced, r.Failed, r.EventsPerSec, r.MaxOccupancy*100)
+}
+
+// rollupKey returns what servers are grouped by: the agent attribute for rollup=group, the zone attribute or the
+// server state.
+func (s *Scheduler) rollupKey(rollup string, attribute string) (func(string) string, error) {
+	switch rollup {
+	case RollupGroup:
+		if attribute == "" {
+			return nil, fmt.Errorf("rollup=%s requires an agent attribute to group by", RollupGroup)
+		}
+		return s.attributeKey(attribute), nil
+	case RollupZone:
+		return s.attributeKey(zoneAttribute), nil
+	case RollupState:
+		return s.serverState, nil
+	}
+
+	return nil, fmt.Errorf("Invalid rollup %s, expected group|zone|state", rollup)
+}
+
+func (s *Scheduler) attributeKey(attribute string) func(string) string {
+	return func(host string) string {
+		if agent := s.agents.Get(host); agent != nil && agent.Attributes[attribute] != "" {
+			return agent.Attributes[attribute]
+		}
+		return "unknown"
+	}
+}
+
+// serverState is migrating for servers being replaced, otherwise reporting once stats arrived or starting before.
+func (s *Scheduler) serverState(host string) string {
+	switch {
+	case s.migrating.Contains(host):
+		return "migrating"
+	case s.cluster.GetStats(host) != nil:
+		return "reporting"
+	default:
+		return "starting"
+	}
+}
+
+// Rollups aggregates running servers by key, sorted by key.
+func (s *Scheduler) Rollups(key func(string) string) []*Rollup {
+	rollups := make(map[string]*Rollup)
+	for host := range s.cluster.GetTasksByHost() {
+		k := key(host)
+		rollup, exists := rollups[k]
+		if !exists {
+			rollup = &Rollup{Key: k}
+			rollups[k] = rollup
+		}
+
+		rollup.Servers++
+		if s.cluster.GetStandby(host) != nil {
+			rollup.Standby++
+		}
+
+		history := s.cluster.GetStatsHistory(host)
+		if len(history) == 0 {
+			continue
+		}
+		rollup.Reporting++
+		last := history[len(history)-1]
+		for _, shard := range last.Shards {
+			rollup.Received += shard.Received
+			rollup.Produced += shard.Produced
+			rollup.Failed += shard.Failed
+		}
+		if occupancy := last.Occupancy(); occupancy > rollup.MaxOccupancy {
+			rollup.MaxOccupancy = occupancy
+		}
+		rollup.EventsPerSec += hostLoad(host, history).EventsPerSec
+	}
+
+	keys := make([]string, 0, len(rollups))
+	for k := range rollups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	sorted := make([]*Rollup, len(keys))
+	for i, k := range keys {
+		sorted[i] = rollups[k]
+	}
+	return sorted
+}
@@ -0,0 +1,236 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var rotationTimeout = 5 * time.Minute
+
+const (
+	rotationPending = "pending"
+	rotationDone    = "done"
+)
+
+// Rotation tracks executors reloading rotated producer properties.
+type Rotation struct {
+	File    string
+	Started time.Time
+
+	hosts    map[string]string // host -> pending, done or the failure reason
+	finished bool
+	lock     sync.Mutex
+}
+
+func newRotation(file string) *Rotation {
+	return &Rotation{
+		File:    file,
+		Started: time.Now(),
+		hosts:   make(map[string]string),
+	}
+}
+
+func (r *Rotation) set(host string, state string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.hosts[host] = state
+}
+
+// complete records the result reported by the host. Returns false if the host wasn't waited for.
+func (r *Rotation) complete(host string, err string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.hosts[host] != rotationPending {
+		return false
+	}
+
+	if err != "" {
+		r.hosts[host] = err
+	} else {
+		r.hosts[host] = rotationDone
+	}
+	return true
+}
+
+// expire fails hosts still pending and returns the number of hosts done and failed.
+func (r *Rotation) expire() (int, int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.finished = true
+	done, failed := 0, 0
+	for host, state := range r.hosts {
+		switch state {
+		case rotationDone:
+			done++
+		case rotationPending:
+			r.hosts[host] = "timed out"
+			failed++
+		default:
+			failed++
+		}
+	}
+	return done, failed
+}
+
+func (r *Rotation) pending() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	pending := 0
+	for _, state := range r.hosts {
+		if state == rotationPending {
+			pending++
+		}
+	}
+	return pending
+}
+
+func (r *Rotation) inProgress() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return !r.finished
+}
+
+func (r *Rotation) String() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	hosts := make([]string, 0, len(r.hosts))
+	for host := range r.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	state := "in progress"
+	if r.finished {
+		state = "finished"
+	}
+	result := fmt.Sprintf("credentials rotation to %s started %s, %s:\n", r.File, r.Started.Format(time.RFC3339), state)
+	for _, host := range hosts {
+		result += fmt.Sprintf("  %s: %s\n", host, r.hosts[host])
+	}
+	return result
+}
+
+// checkRotation tells why producer properties can't be rotated, if so.
+func (s *Scheduler) checkRotation(file string) error {
+	if file == "" {
+		return errors.New("producer.properties is required")
+	}
+	if s.config.ArtifactDir == "" {
+		return errNoArtifactDir
+	}
+	if rotation := s.Rotation(); rotation != nil && rotation.inProgress() {
+		return errors.New("Credentials rotation is already in progress")
+	}
+	if s.currentDriver() == nil && len(s.cluster.GetAllTasks()) > 0 {
+		return newError(ErrNotActive, "Scheduler is disconnected from master")
+	}
+	if _, err := ioutil.ReadFile(file); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Rotate switches producer properties to the given file and makes running executors reload them without a restart.
+// Standby tasks are killed to be relaunched with the new properties. Hosts not reporting back within the timeout are
+// marked failed. Progress is shown in status and recorded in the timeline.
+func (s *Scheduler) Rotate(file string, timeout time.Duration) error {
+	if err := s.checkRotation(file); err != nil {
+		return err
+	}
+	properties, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	rotation := newRotation(file)
+	s.rotationLock.Lock()
+	s.rotation = rotation
+	s.rotationLock.Unlock()
+
+	// launched tasks fetch the new file from now on
+	s.config.ProducerProperties = file
+	s.ConfigUpdated()
+
+	message := NewRotateMessage(filepath.Base(file), string(properties)).String()
+	driver := s.currentDriver()
+	for host, task := range s.cluster.GetTasksByHost() {
+		rotation.set(host, rotationPending)
+		if driver == nil {
+			rotation.complete(host, "scheduler is disconnected from master")
+			continue
+		}
+		if standby := s.cluster.GetStandby(host); standby != nil {
+			s.logger.Infof("Killing standby task %s to relaunch it with rotated credentials", standby.GetTaskId().GetValue())
+			driver.KillTask(standby.GetTaskId())
+		}
+
+		if _, err := driver.SendFrameworkMessage(task.GetExecutor().GetExecutorId(), task.GetSlaveId(), message); err != nil {
+			rotation.complete(host, err.Error())
+		}
+	}
+	s.timeline.Add(EventRotation, "", "", fmt.Sprintf("rotating producer properties to %s", file))
+
+	go s.awaitRotation(rotation, timeout)
+	return nil
+}
+
+func (s *Scheduler) awaitRotation(rotation *Rotation, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for rotation.pending() > 0 && time.Now().Before(deadline) {
+		if err := sleepContext(s.ctx, migrationCheckInterval); err != nil {
+			return
+		}
+	}
+
+	done, failed := rotation.expire()
+	s.timeline.Add(EventRotation, "", "", fmt.Sprintf("rotation to %s finished: %d hosts done, %d failed", rotation.File, done, failed))
+}
+
+// rotated records the result of reloading rotated producer properties reported by an executor.
+func (s *Scheduler) rotated(host string, err string) {
+	rotation := s.Rotation()
+	if rotation == nil || !rotation.complete(host, err) {
+		return
+	}
+
+	if err != "" {
+		s.timeline.Add(EventRotation, host, "", fmt.Sprintf("failed to reload producer properties: %s", err))
+	} else {
+		s.timeline.Add(EventRotation, host, "", "producer properties reloaded")
+	}
+}
+
+// Rotation returns the last credentials rotation or nil if there was none.
+func (s *Scheduler) Rotation() *Rotation {
+	s.rotationLock.Lock()
+	defer s.rotationLock.Unlock()
+
+	return s.rotation
+}
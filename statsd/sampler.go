@@ -0,0 +1,146 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var samplerCheckInterval = time.Second
+
+// AdaptiveSampler samples the highest-volume metric names while executor queues are overloaded.
+// Sampling starts once queue occupancy reaches threshold and stops when it falls below half of it.
+type AdaptiveSampler struct {
+	threshold float64
+	rate      float64
+
+	active  bool
+	forced  bool // sampling regardless of occupancy, e.g. under memory pressure
+	targets map[string]bool
+	lock    sync.RWMutex
+
+	sampled int64
+}
+
+func NewAdaptiveSampler(threshold float64, rate float64) *AdaptiveSampler {
+	return &AdaptiveSampler{
+		threshold: threshold,
+		rate:      rate,
+		targets:   make(map[string]bool),
+	}
+}
+
+func (as *AdaptiveSampler) enabled() bool {
+	return as.threshold > 0 && as.rate > 0 && as.rate < 1
+}
+
+// Update re-evaluates overload state given the current queue occupancy (0..1) and heavy hitters.
+func (as *AdaptiveSampler) Update(occupancy float64, topMetrics []*MetricCount) {
+	as.lock.Lock()
+	defer as.lock.Unlock()
+
+	switch {
+	case as.threshold <= 0:
+	case !as.active && occupancy >= as.threshold:
+		Logger.Warnf("Queue occupancy %.2f reached %.2f, sampling top metrics at rate %.2f", occupancy, as.threshold, as.rate)
+		as.active = true
+	case as.active && occupancy < as.threshold/2:
+		Logger.Infof("Queue occupancy %.2f is back to normal, restoring full fidelity", occupancy)
+		as.active = false
+	}
+
+	as.targets = make(map[string]bool)
+	if as.active || as.forced {
+		for _, metric := range topMetrics {
+			as.targets[metric.Name] = true
+		}
+	}
+}
+
+// Sample returns the line to send, annotated with the effective sample rate if sampled, and false if the line should be skipped.
+// Only counters and timers are sampled, other metric types can't carry a sample rate and are always sent.
+func (as *AdaptiveSampler) Sample(name string, line string) (string, bool) {
+	as.lock.RLock()
+	target := (as.active || as.forced) && as.targets[name]
+	as.lock.RUnlock()
+
+	if !target || !sampleable(line) {
+		return line, true
+	}
+
+	if rand.Float64() >= as.rate {
+		atomic.AddInt64(&as.sampled, 1)
+		return "", false
+	}
+
+	return withSampleRate(line, as.rate), true
+}
+
+// Force makes top metrics sampled regardless of queue occupancy until called with false.
+func (as *AdaptiveSampler) Force(forced bool) {
+	as.lock.Lock()
+	defer as.lock.Unlock()
+
+	as.forced = forced
+}
+
+func (as *AdaptiveSampler) Active() bool {
+	as.lock.RLock()
+	defer as.lock.RUnlock()
+
+	return as.active || as.forced
+}
+
+func (as *AdaptiveSampler) Sampled() int64 {
+	return atomic.LoadInt64(&as.sampled)
+}
+
+// sampleable tells whether the statsd line is a counter or timer, the metric types a sample rate applies to.
+func sampleable(line string) bool {
+	switch metricType(line) {
+	case MetricCounter, MetricTimer:
+		return true
+	}
+	return false
+}
+
+// withSampleRate multiplies the sample rate of a statsd line (name:value|type[|@rate][|#tags]) by rate. Lines of
+// other types than counters and timers are returned unchanged.
+func withSampleRate(line string, rate float64) string {
+	if !sampleable(line) {
+		return line
+	}
+	parts := strings.Split(line, "|")
+
+	for i, part := range parts {
+		if strings.HasPrefix(part, "@") {
+			current, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil {
+				return line
+			}
+			parts[i] = "@" + strconv.FormatFloat(current*rate, 'g', -1, 64)
+			return strings.Join(parts, "|")
+		}
+	}
+
+	annotated := append(parts[:2:2], "@"+strconv.FormatFloat(rate, 'g', -1, 64))
+	return strings.Join(append(annotated, parts[2:]...), "|")
+}
@@ -0,0 +1,114 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"testing"
+
+	log "github.com/cihub/seelog"
+)
+
+func init() {
+	Logger = log.Disabled
+}
+
+func TestWithSampleRate(t *testing.T) {
+	tests := []struct {
+		line     string
+		rate     float64
+		expected string
+	}{
+		{"api.hits:1|c", 0.1, "api.hits:1|c|@0.1"},
+		{"api.hits:1|c|@0.5", 0.1, "api.hits:1|c|@0.05"},
+		{"api.hits:1|c|#env:prod", 0.5, "api.hits:1|c|@0.5|#env:prod"},
+		{"api.hits:1|c|@0.5|#env:prod", 0.5, "api.hits:1|c|@0.25|#env:prod"},
+		{"api.latency:12|ms", 0.25, "api.latency:12|ms|@0.25"},
+		{"api.latency:12|h", 0.25, "api.latency:12|h|@0.25"},
+		{"queue.size:42|g", 0.1, "queue.size:42|g"},
+		{"queue.size:+3|g", 0.1, "queue.size:+3|g"},
+		{"users.unique:alice|s", 0.1, "users.unique:alice|s"},
+		{"api.hits:1|c|@bad", 0.1, "api.hits:1|c|@bad"},
+		{"api.hits", 0.1, "api.hits"},
+	}
+
+	for _, test := range tests {
+		if actual := withSampleRate(test.line, test.rate); actual != test.expected {
+			t.Errorf("withSampleRate(%q, %g) = %q, expected %q", test.line, test.rate, actual, test.expected)
+		}
+	}
+}
+
+func TestAdaptiveSamplerSamplesOnlyCountersAndTimers(t *testing.T) {
+	sampler := NewAdaptiveSampler(0.5, 0.000001)
+	top := []*MetricCount{{Name: "api.hits"}, {Name: "api.latency"}, {Name: "queue.size"}, {Name: "users.unique"}}
+	sampler.Update(0.9, top)
+	if !sampler.Active() {
+		t.Fatal("sampler is not active over the threshold")
+	}
+
+	tests := []struct {
+		name string
+		line string
+		keep bool
+	}{
+		{"api.hits", "api.hits:1|c", false},
+		{"api.latency", "api.latency:12|ms", false},
+		{"queue.size", "queue.size:42|g", true},
+		{"users.unique", "users.unique:alice|s", true},
+		{"other", "other:1|c", true},
+	}
+	for _, test := range tests {
+		line, keep := sampler.Sample(test.name, test.line)
+		if keep != test.keep {
+			t.Errorf("%s: expected keep %t, got %t", test.line, test.keep, keep)
+		}
+		if keep && line != test.line {
+			t.Errorf("%s: expected the line unchanged, got %q", test.line, line)
+		}
+	}
+	if sampler.Sampled() != 2 {
+		t.Errorf("expected 2 sampled out lines, got %d", sampler.Sampled())
+	}
+}
+
+func TestAdaptiveSamplerThresholds(t *testing.T) {
+	tests := []struct {
+		occupancy []float64
+		active    bool
+	}{
+		{[]float64{0.1}, false},
+		{[]float64{0.8}, true},
+		{[]float64{0.8, 0.5}, true},   // stays active until occupancy falls below half of the threshold
+		{[]float64{0.8, 0.39}, false}, // below half of the threshold
+	}
+
+	for _, test := range tests {
+		sampler := NewAdaptiveSampler(0.8, 0.5)
+		for _, occupancy := range test.occupancy {
+			sampler.Update(occupancy, nil)
+		}
+		if sampler.Active() != test.active {
+			t.Errorf("occupancy %v: expected active %t, got %t", test.occupancy, test.active, sampler.Active())
+		}
+	}
+
+	forced := NewAdaptiveSampler(0, 0.5)
+	forced.Force(true)
+	forced.Update(0, []*MetricCount{{Name: "api.hits"}})
+	if _, keep := forced.Sample("api.gauge", "api.gauge:1|g"); !keep {
+		t.Error("forced sampling dropped a gauge not among the top metrics")
+	}
+}
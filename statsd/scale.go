@@ -0,0 +1,83 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// InstancesUnlimited runs a server on every matching host.
+const InstancesUnlimited = 0
+
+// instanceCount counts running servers, servers being migrated away count once.
+func (s *Scheduler) instanceCount() int {
+	return len(s.cluster.GetTasksByHost()) - len(s.migrating.List())
+}
+
+// belowInstances tells whether another server may be launched.
+func (s *Scheduler) belowInstances() bool {
+	return s.config.Instances == InstancesUnlimited || s.instanceCount() < s.config.Instances
+}
+
+// excessHosts returns hosts whose servers should be killed to run the given number of instances.
+func (s *Scheduler) excessHosts(instances int) []string {
+	if instances == InstancesUnlimited {
+		return nil
+	}
+
+	hosts := make([]string, 0)
+	for host := range s.cluster.GetTasksByHost() {
+		if !s.migrating.Contains(host) {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) <= instances {
+		return nil
+	}
+
+	sort.Strings(hosts)
+	return hosts[instances:]
+}
+
+// Scale sets the desired number of servers. Missing servers are launched on next offers, excess ones killed along with
+// their standby tasks.
+func (s *Scheduler) Scale(instances int) ([]string, error) {
+	if instances < 0 {
+		return nil, errors.New("instances can't be negative")
+	}
+
+	s.config.Instances = instances
+	s.ConfigUpdated()
+	s.timeline.Add(EventScaled, "", "", fmt.Sprintf("%d instances", instances))
+	return s.scaleDown(), nil
+}
+
+func (s *Scheduler) scaleDown() []string {
+	hosts := s.excessHosts(s.config.Instances)
+	driver := s.currentDriver()
+	for _, host := range hosts {
+		if task, exists := s.cluster.GetTasksByHost()[host]; exists {
+			s.logger.Infof("Killing task %s to scale down to %d instances", task.GetTaskId().GetValue(), s.config.Instances)
+			driver.KillTask(task.GetTaskId())
+		}
+		if standby := s.cluster.GetStandby(host); standby != nil {
+			driver.KillTask(standby.GetTaskId())
+		}
+	}
+	return hosts
+}
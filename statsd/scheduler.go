@@ -17,80 +17,320 @@ package statsd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
-	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	log "github.com/cihub/seelog"
 	utils "github.com/elodina/go-mesos-utils"
 	"github.com/golang/protobuf/proto"
+	"github.com/mesos/mesos-go/auth"
+	"github.com/mesos/mesos-go/auth/sasl"
+	_ "github.com/mesos/mesos-go/auth/sasl/mech/crammd5"
 	mesos "github.com/mesos/mesos-go/mesosproto"
 	util "github.com/mesos/mesos-go/mesosutil"
 	"github.com/mesos/mesos-go/scheduler"
+	"golang.org/x/net/context"
 )
 
-var sched *Scheduler // This is needed for HTTP server to be able to update this scheduler
+const (
+	standbyLabel          = "standby"
+	standbyExecutorSuffix = "-standby-"
+)
 
 type Scheduler struct {
-	httpServer *HttpServer
-	cluster    *Cluster
-	active     bool
-	activeLock sync.Mutex
-	driver     scheduler.SchedulerDriver
-	labels     string
+	config      *config
+	logger      log.LoggerInterface
+	httpServer  *HttpServer
+	cluster     Cluster
+	agents      *AgentInventory
+	timeline    *Timeline
+	active      bool
+	activeLock  sync.Mutex
+	driver      scheduler.SchedulerDriver // set by driver callbacks, read with currentDriver
+	masterUrl   string                    // set by driver callbacks, read with currentMasterUrl
+	driverLock  sync.RWMutex
+	labels      string
+	frameworkId string
+	gcOnce      sync.Once
+	drainOnce   sync.Once
+	domainsOnce sync.Once
+	usageOnce   sync.Once
+	compactOnce sync.Once
+
+	configVersion int
+	configError   string // reason of the last TASK_ERROR, no tasks are launched until the config gets updated
+	tornDown      bool   // unregistered by teardown, state is not saved anymore
+	halted        bool   // stopped with stop, as opposed to not started yet
+	queuedUpdates []url.Values
+
+	teardown teardownConfirmation
+
+	diagnosing *hostSet // hosts with lost executors whose sandboxes are being captured
+	evacuated  *hostSet // hosts servers were migrated away from
+	migrating  *hostSet
+	targets    *hostSet // hosts servers are being migrated to, free instances are kept for them
+	backoff    *relaunchBackoff
+
+	windows  *maintenanceSchedule
+	domains  *faultDomains
+	draining *hostSet // hosts drained before their maintenance windows
+
+	annotations *maintenanceAnnotations
+	hosts       *hostLists
+	taps        *tapStreams
+	usages      *resourceUsages
+	checksums   *artifactChecksums
+	metrics     *schedulerMetrics
+	preemptions *preemptions
+
+	suppression offerSuppression
+	generations generationCounter
+
+	rotation     *Rotation
+	rotationLock sync.Mutex
+
+	rollout     *Rollout
+	rolloutLock sync.Mutex
+
+	push     *ConfigPush
+	pushLock sync.Mutex
+
+	kafkaDrain     *KafkaDrain
+	kafkaDrainLock sync.Mutex
+
+	storage      utils.Storage
+	stateChanges chan struct{}
+	stateWrites  *stateWrites
+	launches     []*pendingLaunch // launches decided while handling offers, issued once their tasks are saved
+	election     *LeaderElection
+
+	handoff     chan struct{} // set while handing off to a new instance, closed when it tells this one to stop
+	handoffLock sync.Mutex
+
+	ctx    context.Context // done on shutdown, ends operations running in the background
+	cancel context.CancelFunc
+
+	stop     chan struct{} // closed by Stop
+	stopOnce sync.Once
+	stopped  chan struct{} // closed once Start returns
+}
+
+// NewScheduler returns a scheduler using the given configuration, logger and state store instead of the package
+// Config and Logger, so it can be embedded in other programs. Without storage, state is persisted to config.Storage
+// if set. The configuration is updated through the API and restored from the state store.
+func NewScheduler(config *config, logger log.LoggerInterface, storage utils.Storage) *Scheduler {
+	s := &Scheduler{
+		config:  config,
+		logger:  logger,
+		storage: storage,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.cluster = NewCluster()
+	s.agents = NewAgentInventory()
+	s.timeline = NewTimeline(timelineSize)
+	s.diagnosing = newHostSet()
+	s.evacuated = newHostSet()
+	s.migrating = newHostSet()
+	s.targets = newHostSet()
+	s.backoff = newRelaunchBackoff()
+	s.windows = newMaintenanceSchedule()
+	s.domains = newFaultDomains()
+	s.draining = newHostSet()
+	s.annotations = newMaintenanceAnnotations()
+	s.hosts = newHostLists()
+	s.taps = newTapStreams()
+	s.stateWrites = newStateWrites()
+	s.usages = newResourceUsages()
+	s.checksums = newArtifactChecksums()
+	s.metrics = newSchedulerMetrics()
+	s.preemptions = newPreemptions()
+	return s
 }
 
-func (s *Scheduler) Start() error {
-	Logger.Infof("Starting scheduler with configuration: \n%s", Config)
-	sched = s // set this scheduler reachable for http server
+// Start runs the scheduler lifecycle: init, leader election if enabled, state restore and then the Mesos driver.
+// Returns once the driver stops, e.g. after Stop or once the context is done.
+func (s *Scheduler) Start(ctx context.Context) error {
+	defer close(s.stopped)
+	s.logger.Infof("Starting scheduler with configuration: \n%s", s.config)
 
-	ctrlc := make(chan os.Signal, 1)
-	signal.Notify(ctrlc, os.Interrupt)
+	if err := s.init(); err != nil {
+		return err
+	}
+	if err := s.awaitLeadership(); err != nil {
+		return err
+	}
+	if s.config.HandoffFrom != "" {
+		if err := s.prepareHandoff(); err != nil {
+			return err
+		}
+	}
+	if err := s.restoreState(); err != nil {
+		return err
+	}
+	if err := s.checkDuplicateFramework(); err != nil {
+		return err
+	}
+	for _, warning := range Lint(s.config) {
+		s.logger.Warnf("Config warning: %s", warning)
+	}
 
+	return s.run(ctx)
+}
+
+// Stop stops the driver like Shutdown and waits until Start returns or the context is done.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	select {
+	case <-s.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Scheduler) init() error {
 	if err := s.resolveDeps(); err != nil {
 		return err
 	}
 
-	listenAddr := s.listenAddr()
-	s.httpServer = NewHttpServer(listenAddr)
+	if s.storage == nil && s.config.Storage != "" {
+		storage, err := NewStorage(s.config.Storage)
+		if err != nil {
+			return err
+		}
+		s.storage = storage
+	}
+	if s.config.LeaderElection != "" && s.storage == nil {
+		return errors.New("--leader.election requires --storage to share state between schedulers")
+	}
+	if s.config.HandoffFrom != "" && s.storage == nil {
+		return errors.New("--handoff.from requires --storage to take over state")
+	}
+
+	authenticator, err := NewAuthenticator(s.config)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := s.config.apiTls()
+	if err != nil {
+		return err
+	}
+	s.httpServer = NewHttpServer(s.listenAddr(), s)
+	s.httpServer.authenticator = authenticator
+	s.httpServer.server.TLSConfig = tlsConfig
+
+	return nil
+}
+
+// awaitLeadership blocks until this scheduler is elected leader. Returns immediately if leader election is disabled.
+func (s *Scheduler) awaitLeadership() error {
+	if s.config.LeaderElection == "" {
+		return nil
+	}
+
+	election, err := NewLeaderElection(s.config.LeaderElection)
+	if err != nil {
+		return err
+	}
+
+	view := newStoredCluster(s.storage, s.logger)
+	s.logger.Infof("Waiting to become leader at %s, the leader runs %d servers", s.config.LeaderElection, len(view.GetTasksByHost()))
+	if err := election.Await(); err != nil {
+		return fmt.Errorf("Leader election failed: %s", err)
+	}
+	s.logger.Info("Elected as leader")
+	s.election = election
+	return nil
+}
+
+// restoreState loads state saved by the previous scheduler, or the previous leader, and starts saving changes.
+func (s *Scheduler) restoreState() error {
+	if s.storage == nil {
+		return nil
+	}
+
+	if err := s.loadState(); err != nil {
+		return err
+	}
+	s.stateChanges = make(chan struct{}, 1)
+	go s.persistState()
+	return nil
+}
+
+func (s *Scheduler) run(ctx context.Context) error {
 	go s.httpServer.Start()
+	go s.watchEndpoints()
 
-	s.cluster = NewCluster()
 	s.labels = os.Getenv("STACK_LABELS")
 
 	frameworkInfo := &mesos.FrameworkInfo{
-		User:       proto.String(Config.User),
-		Name:       proto.String(Config.FrameworkName),
-		Role:       proto.String(Config.FrameworkRole),
+		User:       proto.String(s.config.User),
+		Name:       proto.String(s.config.FrameworkName),
+		Role:       proto.String(s.config.FrameworkRole),
 		Checkpoint: proto.Bool(true),
 		Labels:     utils.StringToLabels(s.labels),
 	}
-
-	driverConfig := scheduler.DriverConfig{
-		Scheduler: s,
-		Framework: frameworkInfo,
-		Master:    Config.Master,
+	if s.config.FrameworkPrincipal != "" {
+		frameworkInfo.Principal = proto.String(s.config.FrameworkPrincipal)
+	}
+	if s.storage != nil {
+		// keep tasks running while the scheduler restarts so it can pick them up again
+		frameworkInfo.FailoverTimeout = proto.Float64(s.config.FailoverTimeout.Seconds())
+		if s.frameworkId != "" {
+			frameworkInfo.Id = util.NewFrameworkID(s.frameworkId)
+		}
 	}
 
-	driver, err := scheduler.NewMesosSchedulerDriver(driverConfig)
+	driver, err := s.newDriver(frameworkInfo)
+	if err != nil {
+		return fmt.Errorf("Unable to create SchedulerDriver: %s", err)
+	}
 	go func() {
-		<-ctrlc
+		select {
+		case <-ctx.Done():
+		case <-s.stop:
+		case <-s.ctx.Done():
+			return
+		}
 		s.Shutdown(driver)
 	}()
 
-	if err != nil {
-		return fmt.Errorf("Unable to create SchedulerDriver: %s", err)
+	if s.election != nil {
+		go func() {
+			<-s.election.Lost()
+			s.logger.Error("Lost leadership, stopping driver and leaving tasks to the next leader")
+			driver.Stop(true)
+		}()
 	}
-
-	if stat, err := driver.Run(); err != nil {
-		Logger.Infof("Framework stopped with status %s and error: %s\n", stat.String(), err)
-		return err
+	if s.config.HandoffFrom != "" {
+		go s.completeHandoff(func() { driver.Stop(true) })
 	}
 
-	//TODO stop http server
+	stat, err := driver.Run()
+	s.cancel()
+	s.awaitHandoffStop() // failed over by the new instance, keep serving until it is ready
+
+	shutdown, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+	defer cancel()
+	s.httpServer.Stop(shutdown)
 
+	if err != nil {
+		s.logger.Infof("Framework stopped with status %s and error: %s\n", stat.String(), err)
+		return err
+	}
+	if s.election != nil && s.election.IsLost() {
+		return errors.New("Lost leadership")
+	}
 	return nil
 }
 
@@ -99,200 +339,658 @@ func (s *Scheduler) SetActive(active bool) {
 	defer s.activeLock.Unlock()
 
 	s.active = active
-	if !s.active {
+	s.halted = !active
+	if s.active {
+		s.timeline.Add(EventStarted, "", "", "")
+		s.reviveOffers("started")
+	} else {
+		s.timeline.Add(EventStopped, "", "", "")
+		driver := s.currentDriver()
 		for _, task := range s.cluster.GetAllTasks() {
-			Logger.Debugf("Killing task %s", task.GetTaskId().GetValue())
-			s.driver.KillTask(task.GetTaskId())
+			s.logger.Debugf("Killing task %s", task.GetTaskId().GetValue())
+			driver.KillTask(task.GetTaskId())
 		}
 	}
+	s.stateChanged()
 }
 
-func (s *Scheduler) Registered(driver scheduler.SchedulerDriver, id *mesos.FrameworkID, master *mesos.MasterInfo) {
-	Logger.Infof("[Registered] framework: %s master: %s:%d", id.GetValue(), master.GetHostname(), master.GetPort())
+func (s *Scheduler) isActive() bool {
+	s.activeLock.Lock()
+	defer s.activeLock.Unlock()
 
-	s.driver = driver
+	return s.active
+}
+
+// ConfigUpdated records a new version of the configuration in the timeline.
+func (s *Scheduler) ConfigUpdated() {
+	s.activeLock.Lock()
+	s.configVersion++
+	s.configError = ""
+	version := s.configVersion
+	s.activeLock.Unlock()
+
+	s.timeline.Add(EventConfigUpdated, "", "", fmt.Sprintf("config version %d", version))
+	s.stateChanged()
+	s.reviveOffers("config updated")
+}
+
+// newDriver returns the driver for the configured Mesos API, the libprocess driver or the v1 HTTP scheduler API.
+func (s *Scheduler) newDriver(frameworkInfo *mesos.FrameworkInfo) (scheduler.SchedulerDriver, error) {
+	if s.config.MesosApi == MesosApiHttp {
+		driver, err := newHttpDriver(s, s.logger, frameworkInfo, s.config.Master)
+		if err != nil {
+			return nil, err
+		}
+		driver.credential = s.frameworkCredential()
+		return driver, nil
+	}
+
+	driverConfig := scheduler.DriverConfig{
+		Scheduler: s,
+		Framework: frameworkInfo,
+		Master:    s.config.Master,
+	}
+	if credential := s.frameworkCredential(); credential != nil {
+		driverConfig.Credential = credential
+		driverConfig.WithAuthContext = func(ctx context.Context) context.Context {
+			return auth.WithLoginProvider(ctx, sasl.ProviderName)
+		}
+	}
+	return scheduler.NewMesosSchedulerDriver(driverConfig)
+}
+
+// frameworkCredential is what the framework authenticates with to masters requiring authentication, nil without a
+// secret.
+func (s *Scheduler) frameworkCredential() *mesos.Credential {
+	if s.config.FrameworkSecret == "" {
+		return nil
+	}
+
+	return &mesos.Credential{
+		Principal: proto.String(s.config.FrameworkPrincipal),
+		Secret:    proto.String(s.config.FrameworkSecret),
+	}
+}
+
+func (s *Scheduler) Registered(driver scheduler.SchedulerDriver, id *mesos.FrameworkID, master *mesos.MasterInfo) {
+	s.logger.Infof("[Registered] framework: %s master: %s:%d", id.GetValue(), master.GetHostname(), master.GetPort())
+
+	s.setDriver(driver, masterUrl(master))
+	s.frameworkId = id.GetValue()
+	s.timeline.Add(EventRegistered, "", "", fmt.Sprintf("framework: %s master: %s", s.frameworkId, masterUrl(master)))
+	s.gcOnce.Do(func() { go s.collectOrphans() })
+	s.drainOnce.Do(func() { go s.watchMaintenance() })
+	s.domainsOnce.Do(func() { go s.watchFaultDomains() })
+	s.usageOnce.Do(func() { go s.watchResourceUsage() })
+	s.compactOnce.Do(func() { go s.compactHistory() })
+	s.stateChanged()
+	s.reconcileTasks()
 }
 
 func (s *Scheduler) Reregistered(driver scheduler.SchedulerDriver, master *mesos.MasterInfo) {
-	Logger.Infof("[Reregistered] master: %s:%d", master.GetHostname(), master.GetPort())
+	s.logger.Infof("[Reregistered] master: %s:%d", master.GetHostname(), master.GetPort())
 
-	s.driver = driver
+	s.setDriver(driver, masterUrl(master))
+	s.reconcileTasks()
 }
 
 func (s *Scheduler) Disconnected(scheduler.SchedulerDriver) {
-	Logger.Info("[Disconnected]")
+	s.logger.Info("[Disconnected]")
+	s.timeline.Add(EventDisconnected, "", "", "")
 
+	s.driverLock.Lock()
 	s.driver = nil
+	s.driverLock.Unlock()
+}
+
+func (s *Scheduler) setDriver(driver scheduler.SchedulerDriver, masterUrl string) {
+	s.driverLock.Lock()
+	defer s.driverLock.Unlock()
+
+	s.driver = driver
+	s.masterUrl = masterUrl
+}
+
+// currentDriver returns the driver while the scheduler is registered with a master, nil while disconnected.
+func (s *Scheduler) currentDriver() scheduler.SchedulerDriver {
+	s.driverLock.RLock()
+	defer s.driverLock.RUnlock()
+
+	return s.driver
+}
+
+// currentMasterUrl returns the url of the master the scheduler registered with last, empty before registering.
+func (s *Scheduler) currentMasterUrl() string {
+	s.driverLock.RLock()
+	defer s.driverLock.RUnlock()
+
+	return s.masterUrl
+}
+
+// awaitDriver returns the driver once the scheduler is registered with a master. Background work killing tasks waits
+// here during master failovers. Returns nil if the scheduler isn't registered again within the timeout or the context
+// is done.
+func (s *Scheduler) awaitDriver(ctx context.Context, timeout time.Duration) scheduler.SchedulerDriver {
+	deadline := time.Now().Add(timeout)
+	for {
+		if driver := s.currentDriver(); driver != nil {
+			return driver
+		}
+		if time.Now().After(deadline) {
+			return nil
+		}
+		if err := sleepContext(ctx, migrationCheckInterval); err != nil {
+			return nil
+		}
+	}
 }
 
 func (s *Scheduler) ResourceOffers(driver scheduler.SchedulerDriver, offers []*mesos.Offer) {
-	Logger.Debugf("[ResourceOffers] %s", offersString(offers))
+	s.logger.Debugf("[ResourceOffers] %s", offersString(offers))
+	s.metrics.offersReceived(len(offers))
+	chaosDelayOffers(s.logger)
+	s.agents.Observe(offers)
+	s.windows.Observe(offers)
 
 	s.activeLock.Lock()
-	defer s.activeLock.Unlock()
-
 	if !s.active {
-		Logger.Debug("Scheduler is inactive. Declining all offers.")
-		for _, offer := range offers {
-			driver.DeclineOffer(offer.GetId(), &mesos.Filters{RefuseSeconds: proto.Float64(10)})
-		}
+		s.logger.Debug("Scheduler is inactive. Declining all offers.")
+		s.metrics.offersDeclined(DeclineSuspended, len(offers))
+		s.suppressOffers(driver, offers)
+		s.activeLock.Unlock()
+		return
+	}
+	if s.atDesiredSize() {
+		s.logger.Debug("All instances are running. Declining all offers.")
+		s.metrics.offersDeclined(DeclineInstancesRunning, len(offers))
+		s.suppressOffers(driver, offers)
+		s.activeLock.Unlock()
 		return
 	}
 
-	for _, offer := range offers {
-		declineReason := s.acceptOffer(driver, offer)
-		if declineReason != "" {
-			driver.DeclineOffer(offer.GetId(), &mesos.Filters{RefuseSeconds: proto.Float64(10)})
-			Logger.Debugf("Declined offer: %s", declineReason)
+	s.observeMatches(offers)
+	for _, offer := range s.orderOffers(offers, s.config.Placement) {
+		if decline := s.acceptOffer(driver, offer); decline != nil {
+			refuseSeconds := s.refuseSeconds(offer)
+			driver.DeclineOffer(offer.GetId(), &mesos.Filters{RefuseSeconds: proto.Float64(refuseSeconds)})
+			s.logger.Debugf("Declined offer for %.0fs: %s", refuseSeconds, decline)
+			s.metrics.offersDeclined(decline.Reason, 1)
+			s.timeline.PublishDeclined(offer.GetHostname(), decline.Reason, fmt.Sprintf("%s, refused for %.0fs: %s", decline.Reason, refuseSeconds, decline.Message))
 		}
 	}
+	launches := s.launches
+	s.launches = nil
+	s.activeLock.Unlock()
+
+	s.launch(driver, launches)
 }
 
 func (s *Scheduler) OfferRescinded(driver scheduler.SchedulerDriver, id *mesos.OfferID) {
-	Logger.Infof("[OfferRescinded] %s", id.GetValue())
+	s.logger.Infof("[OfferRescinded] %s", id.GetValue())
 }
 
 func (s *Scheduler) StatusUpdate(driver scheduler.SchedulerDriver, status *mesos.TaskStatus) {
-	Logger.Infof("[StatusUpdate] %s", statusString(status))
+	s.logger.Infof("[StatusUpdate] %s", statusString(status))
+	if chaosDropStatusUpdate() {
+		s.logger.Infof("[chaos] dropped status update for task %s", status.GetTaskId().GetValue())
+		return
+	}
+	s.metrics.statusUpdate(status)
 
 	hostname := s.hostnameFromTaskId(status.GetTaskId().GetValue())
+	message := status.GetState().String()
+	if status.GetMessage() != "" {
+		message += ": " + status.GetMessage()
+	}
+	s.timeline.Add(EventTaskStatus, hostname, status.GetTaskId().GetValue(), message)
 
-	if status.GetState() == mesos.TaskState_TASK_FAILED || status.GetState() == mesos.TaskState_TASK_KILLED ||
+	terminal := status.GetState() == mesos.TaskState_TASK_FAILED || status.GetState() == mesos.TaskState_TASK_KILLED ||
 		status.GetState() == mesos.TaskState_TASK_LOST || status.GetState() == mesos.TaskState_TASK_ERROR ||
-		status.GetState() == mesos.TaskState_TASK_FINISHED {
+		status.GetState() == mesos.TaskState_TASK_FINISHED
+	if !terminal {
+		s.checkDuplicate(driver, status)
+		s.checkHealth(driver, status)
+		return
+	}
+	defer s.reviveOffers("task " + status.GetState().String())
+
+	if standby := s.cluster.GetStandby(hostname); standby != nil && standby.GetTaskId().GetValue() == status.GetTaskId().GetValue() {
+		s.cluster.RemoveStandby(hostname)
+		s.stateChanged()
+		s.backOff(hostname, status.GetState())
+		return
+	}
+
+	// ignore updates of tasks already replaced by an activated standby
+	if task, exists := s.cluster.GetTasksByHost()[hostname]; exists && task.GetTaskId().GetValue() != status.GetTaskId().GetValue() {
+		return
+	}
+	s.cluster.Remove(hostname)
+	s.stateChanged()
+	s.backOff(hostname, status.GetState())
+
+	if status.GetState() == mesos.TaskState_TASK_ERROR {
+		s.setConfigError(message)
+	}
+
+	if status.GetState() != mesos.TaskState_TASK_KILLED && status.GetState() != mesos.TaskState_TASK_FINISHED {
+		s.activateStandby(driver, hostname)
+	}
+}
+
+// backOff delays relaunching on the host after the task failed or got lost. Killed and finished tasks are relaunched
+// right away as the scheduler or an operator stopped them.
+func (s *Scheduler) backOff(hostname string, state mesos.TaskState) {
+	if state != mesos.TaskState_TASK_FAILED && state != mesos.TaskState_TASK_LOST {
+		return
+	}
+	if s.inMaintenance(hostname) {
+		s.logger.Infof("Not backing off %s in maintenance", hostname)
+		return
+	}
+
+	delay := s.backoff.Failed(hostname)
+	s.logger.Infof("Delaying relaunch on %s for %s", hostname, delay)
+}
+
+// setConfigError stops launching tasks as they would fail the same way until the configuration is updated.
+func (s *Scheduler) setConfigError(message string) {
+	s.activeLock.Lock()
+	defer s.activeLock.Unlock()
+
+	s.logger.Errorf("Task rejected its configuration, not launching tasks until config is updated: %s", message)
+	s.configError = message
+}
+
+// ConfigError returns the reason tasks are not launched or an empty string if the configuration is fine.
+func (s *Scheduler) ConfigError() string {
+	s.activeLock.Lock()
+	defer s.activeLock.Unlock()
+
+	return s.configError
+}
+
+// activateStandby makes the standby task on the host take over from the failed active task.
+func (s *Scheduler) activateStandby(driver scheduler.SchedulerDriver, hostname string) {
+	task := s.cluster.ActivateStandby(hostname)
+	if task == nil {
+		return
+	}
+	defer s.stateChanged()
+
+	s.logger.Infof("Activating standby task %s on %s", task.GetTaskId().GetValue(), hostname)
+	if _, err := driver.SendFrameworkMessage(task.GetExecutor().GetExecutorId(), task.GetSlaveId(), NewActivateMessage().String()); err != nil {
+		s.logger.Warnf("Failed to activate standby task %s: %s", task.GetTaskId().GetValue(), err)
 		s.cluster.Remove(hostname)
+		driver.KillTask(task.GetTaskId())
+		return
 	}
+	s.timeline.Add(EventStandbyActivated, hostname, task.GetTaskId().GetValue(), "")
 }
 
 func (s *Scheduler) FrameworkMessage(driver scheduler.SchedulerDriver, executor *mesos.ExecutorID, slave *mesos.SlaveID, message string) {
-	Logger.Infof("[FrameworkMessage] executor: %s slave: %s message: %s", executor, slave, message)
+	s.logger.Debugf("[FrameworkMessage] executor: %s slave: %s message: %s", executor, slave, message)
+
+	executorMessage, err := ParseExecutorMessage(message)
+	if err != nil {
+		s.logger.Warnf("Failed to parse framework message: %s", err)
+		return
+	}
+
+	switch executorMessage.Type {
+	case MessageStats:
+		if executorMessage.Stats != nil {
+			s.cluster.SetStats(executorMessage.Stats.Host, executorMessage.Stats)
+			s.backoff.Reset(executorMessage.Stats.Host)
+		}
+	case MessageRotated:
+		s.rotated(executorMessage.Host, executorMessage.Error)
+	case MessageApplied:
+		s.configApplied(executorMessage.Host, executorMessage.Version, executorMessage.Error)
+	case MessageDrained:
+		s.kafkaDrained(executorMessage.Host, executorMessage.Error)
+	case MessageTapped:
+		if executorMessage.Tap != nil {
+			s.taps.deliver(executorMessage.Tap.Id, executorMessage.Lines)
+		}
+	default:
+		s.logger.Warnf("Unknown framework message type: %s", executorMessage.Type)
+	}
 }
 
 func (s *Scheduler) SlaveLost(driver scheduler.SchedulerDriver, slave *mesos.SlaveID) {
-	Logger.Infof("[SlaveLost] %s", slave.GetValue())
+	s.logger.Infof("[SlaveLost] %s", slave.GetValue())
 }
 
 func (s *Scheduler) ExecutorLost(driver scheduler.SchedulerDriver, executor *mesos.ExecutorID, slave *mesos.SlaveID, status int) {
-	Logger.Infof("[ExecutorLost] executor: %s slave: %s status: %d", executor, slave, status)
+	s.logger.Infof("[ExecutorLost] executor: %s slave: %s status: %d", executor, slave, status)
+
+	hostname := hostnameFromExecutorId(executor.GetValue())
+	s.timeline.Add(EventExecutorLost, hostname, "", fmt.Sprintf("executor %s exited with status %d", executor.GetValue(), status))
+	if s.inMaintenance(hostname) { // expected while an operator works on the host, nothing to diagnose
+		return
+	}
+
+	// hold the host until diagnostics are captured so the relaunched executor does not get the sandbox logs mixed up
+	s.diagnosing.Add(hostname)
+	go func() {
+		defer s.diagnosing.Remove(hostname)
+
+		tail, err := s.captureSandbox(executor.GetValue(), slave.GetValue())
+		if err != nil {
+			s.logger.Warnf("Failed to capture sandbox of lost executor %s: %s", executor.GetValue(), err)
+			tail = fmt.Sprintf("capture failed: %s", err)
+		}
+		s.timeline.Add(EventSandboxTail, hostname, "", tail)
+	}()
 }
 
 func (s *Scheduler) Error(driver scheduler.SchedulerDriver, message string) {
-	Logger.Errorf("[Error] %s", message)
+	s.logger.Errorf("[Error] %s", message)
+	if strings.Contains(message, "Framework has been removed") {
+		s.forgetFramework()
+	}
 }
 
-func (s *Scheduler) Shutdown(driver *scheduler.MesosSchedulerDriver) {
-	Logger.Info("Shutdown triggered, stopping driver")
-	driver.Stop(false)
+// Shutdown stops the driver. With storage the framework fails over, so tasks keep running for the failover timeout
+// and a restarted scheduler picks them up, otherwise it is unregistered and Mesos kills its tasks.
+func (s *Scheduler) Shutdown(driver scheduler.SchedulerDriver) {
+	failover := s.storage != nil
+	s.logger.Infof("Shutdown triggered, stopping driver, failover: %t", failover)
+	s.cancel()
+	driver.Stop(failover)
 }
 
-func (s *Scheduler) acceptOffer(driver scheduler.SchedulerDriver, offer *mesos.Offer) string {
+func (s *Scheduler) acceptOffer(driver scheduler.SchedulerDriver, offer *mesos.Offer) *Decline {
+	if s.configError != "" {
+		return declined(DeclineInvalidConfig, "Invalid config: %s", s.configError)
+	}
+	if remaining := s.backoff.Remaining(offer.GetHostname()); remaining > 0 {
+		return declined(DeclineBackoff, "Relaunch on host %s backs off for %s.", offer.GetHostname(), remaining)
+	}
+	if window, draining := s.windows.Draining(offer.GetHostname(), time.Now(), s.config.MaintenanceDrain); draining {
+		return declined(DeclineMaintenance, "Host %s is scheduled for maintenance %s.", offer.GetHostname(), window)
+	}
+	if annotation, annotated := s.annotations.Get(offer.GetHostname(), time.Now()); annotated {
+		return declined(DeclineMaintenance, "Host %s is annotated in maintenance %s.", offer.GetHostname(), annotation)
+	}
+	if decline := s.hosts.Check(offer.GetHostname()); decline != nil {
+		return decline
+	}
+
 	if s.cluster.Exists(offer.GetHostname()) {
-		return fmt.Sprintf("Server on host %s is already running.", offer.GetHostname())
+		if s.needsStandby(offer.GetHostname()) {
+			decline := s.match(offer)
+			if decline == nil {
+				s.launchTask(driver, offer, true)
+			}
+			return decline
+		}
+		return declined(DeclineHostOccupied, "Server on host %s is already running.", offer.GetHostname())
+	} else if s.diagnosing.Contains(offer.GetHostname()) {
+		return declined(DeclineDiagnosing, "Capturing sandbox of lost executor on host %s.", offer.GetHostname())
+	} else if s.evacuated.Contains(offer.GetHostname()) {
+		return declined(DeclineEvacuated, "Host %s is evacuated.", offer.GetHostname())
+	} else if !s.belowInstances() {
+		return s.preempt(driver, offer)
+	} else if decline := s.checkReserved(offer); decline != nil {
+		return decline
+	} else if decline := s.checkMigrationTargets(offer); decline != nil {
+		return decline
+	} else if decline := s.checkSpread(offer); decline != nil {
+		return decline
 	} else {
-		declineReason := s.match(offer)
-		if declineReason == "" {
-			s.launchTask(driver, offer)
+		decline := s.match(offer)
+		if decline == nil {
+			s.launchTask(driver, offer, false)
 		}
-		return declineReason
+		return decline
 	}
 }
 
-func (s *Scheduler) match(offer *mesos.Offer) string {
-	if Config.Cpus > getScalarResources(offer, "cpus") {
-		return "no cpus"
+func (s *Scheduler) match(offer *mesos.Offer) *Decline {
+	cpus, mem := s.taskResources(offer)
+	if cpus > getScalarResources(offer, "cpus") {
+		return declined(DeclineInsufficientCpu, "no cpus")
+	}
+
+	if mem > getScalarResources(offer, "mem") {
+		return declined(DeclineInsufficientMem, "no mem")
+	}
+
+	adminPort, listenPort := s.selectPorts(offer, s.cluster.Exists(offer.GetHostname()))
+	if adminPort == 0 {
+		return declined(DeclineInsufficientPorts, "no port for the executor admin endpoint")
+	}
+	if listenPort == 0 {
+		if s.config.StatsdPort > 0 {
+			return declined(DeclineInsufficientPorts, "no port %d for statsd", s.config.StatsdPort)
+		}
+		return declined(DeclineInsufficientPorts, "no port for statsd")
 	}
 
-	if Config.Mem > getScalarResources(offer, "mem") {
-		return "no mem"
+	if s.config.Reserve && !s.cluster.Exists(offer.GetHostname()) {
+		if decline := s.checkReservation(offer); decline != nil {
+			return decline
+		}
 	}
 
-	return ""
+	return s.checkConstraints(offer)
+}
+
+// needsStandby tells whether a standby task should be launched next to the active task on the host.
+func (s *Scheduler) needsStandby(hostname string) bool {
+	return s.cluster.StandbyCount() < s.config.Standby && s.cluster.GetStandby(hostname) == nil
 }
 
-func (s *Scheduler) launchTask(driver scheduler.SchedulerDriver, offer *mesos.Offer) {
-	taskName := fmt.Sprintf("statsd-kafka-%s", offer.GetHostname())
+func (s *Scheduler) launchTask(driver scheduler.SchedulerDriver, offer *mesos.Offer, standby bool) {
+	taskName := fmt.Sprintf("%s-%s", taskGroup, offer.GetHostname())
+	generation := s.generations.Next(offer.GetHostname())
 	taskId := &mesos.TaskID{
-		Value: proto.String(fmt.Sprintf("%s-%s", taskName, uuid())),
+		Value: proto.String(formatTaskId(offer.GetHostname(), generation)),
 	}
 
-	data, err := json.Marshal(Config)
+	adminPort, listenPort := s.selectPorts(offer, standby)
+	reservedPorts := []uint64{adminPort, listenPort}
+	if standby && s.config.StatsdPort > 0 {
+		reservedPorts = reservedPorts[:1]
+	}
+	cpus, mem := s.taskResources(offer)
+	resources := []*mesos.Resource{
+		util.NewScalarResource("cpus", cpus),
+		util.NewScalarResource("mem", mem),
+		portsResource(reservedPorts...),
+	}
+
+	taskData := NewTaskData(s.config)
+	taskData.StatsdPort = listenPort
+	var operations []*mesos.Offer_Operation
+	if s.config.Reserve && !standby {
+		// standby tasks use unreserved resources, the volume can be used by one task at a time
+		reservation := s.reserve(offer, cpus, mem)
+		resources = append(reservation.resources, portsResource(reservedPorts...))
+		operations = reservation.operations
+		if s.config.VolumeSize > 0 {
+			taskData.BufferPath = bufferPath
+		}
+	}
+
+	data, err := json.Marshal(taskData)
 	if err != nil {
 		panic(err) //shouldn't happen
 	}
-	Logger.Debugf("Task data: %s", string(data))
+	s.logger.Debugf("Task data: %s", string(data))
 
 	task := &mesos.TaskInfo{
-		Name:     proto.String(taskName),
-		TaskId:   taskId,
-		SlaveId:  offer.GetSlaveId(),
-		Executor: s.createExecutor(offer.GetHostname()),
-		Resources: []*mesos.Resource{
-			util.NewScalarResource("cpus", Config.Cpus),
-			util.NewScalarResource("mem", Config.Mem),
-		},
-		Data:   data,
-		Labels: utils.StringToLabels(s.labels),
+		Name:        proto.String(taskName),
+		TaskId:      taskId,
+		SlaveId:     offer.GetSlaveId(),
+		Executor:    s.createExecutor(offer.GetHostname(), standby, reservedPorts...),
+		Resources:   resources,
+		Data:        data,
+		Labels:      s.taskLabels(offer.GetHostname(), generation),
+		Discovery:   s.discoveryInfo(offer.GetHostname(), generation, adminPort, listenPort),
+		HealthCheck: s.healthCheck(adminPort),
 	}
 
-	s.cluster.Add(offer.GetHostname(), task)
+	if standby {
+		task.Labels.Labels = append(task.Labels.Labels, &mesos.Label{Key: proto.String(standbyLabel), Value: proto.String("true")})
+		s.cluster.AddStandby(offer.GetHostname(), task)
+		s.timeline.Add(EventLaunched, offer.GetHostname(), taskId.GetValue(), fmt.Sprintf("standby, config version %d", s.configVersion))
+	} else {
+		s.cluster.Add(offer.GetHostname(), task)
+		s.preemptions.done(offer.GetHostname())
+		s.timeline.Add(EventLaunched, offer.GetHostname(), taskId.GetValue(), fmt.Sprintf("config version %d", s.configVersion))
+	}
 
-	driver.LaunchTasks([]*mesos.OfferID{offer.GetId()}, []*mesos.TaskInfo{task}, &mesos.Filters{RefuseSeconds: proto.Float64(1)})
+	s.launches = append(s.launches, &pendingLaunch{offer: offer, task: task, operations: operations, standby: standby})
+	s.stateChanged()
 }
 
-func (s *Scheduler) createExecutor(hostname string) *mesos.ExecutorInfo {
-	id := fmt.Sprintf("statsd-kafka-%s", hostname)
+// pendingLaunch is a task added to the cluster but not launched yet.
+type pendingLaunch struct {
+	offer      *mesos.Offer
+	task       *mesos.TaskInfo
+	operations []*mesos.Offer_Operation // reservation operations to perform along with the launch
+	standby    bool
+}
 
-	uris := []*mesos.CommandInfo_URI{
-		&mesos.CommandInfo_URI{
-			Value:      proto.String(fmt.Sprintf("%s/resource/%s", Config.Api, Config.Executor)),
-			Executable: proto.Bool(true),
-		},
+// launch launches tasks once the state recording them is saved, so a scheduler restarting after a crash knows every
+// task it launched. If the state can't be saved the tasks are removed again and their offers declined.
+func (s *Scheduler) launch(driver scheduler.SchedulerDriver, launches []*pendingLaunch) {
+	if len(launches) == 0 {
+		return
 	}
 
-	if Config.ProducerProperties != "" {
-		uris = append(uris, &mesos.CommandInfo_URI{
-			Value: proto.String(fmt.Sprintf("%s/resource/%s", Config.Api, Config.ProducerProperties)),
-		})
+	filters := &mesos.Filters{RefuseSeconds: proto.Float64(s.config.RefuseSeconds)}
+	if err := s.flushState(); err != nil {
+		s.logger.Errorf("Not launching %d tasks as the state wasn't saved: %s", len(launches), err)
+		for _, launch := range launches {
+			hostname := launch.offer.GetHostname()
+			if launch.standby {
+				s.cluster.RemoveStandby(hostname)
+			} else {
+				s.cluster.Remove(hostname)
+			}
+			driver.DeclineOffer(launch.offer.GetId(), filters)
+			s.timeline.Add(EventLaunchAborted, hostname, launch.task.GetTaskId().GetValue(), fmt.Sprintf("state not saved: %s", err))
+		}
+		s.stateChanged()
+		return
+	}
+
+	for _, launch := range launches {
+		if launch.operations != nil {
+			operations := append(launch.operations, util.NewLaunchOperation([]*mesos.TaskInfo{launch.task}))
+			driver.AcceptOffers([]*mesos.OfferID{launch.offer.GetId()}, operations, filters)
+		} else {
+			driver.LaunchTasks([]*mesos.OfferID{launch.offer.GetId()}, []*mesos.TaskInfo{launch.task}, filters)
+		}
+	}
+}
+
+func (s *Scheduler) createExecutor(hostname string, standby bool, ports ...uint64) *mesos.ExecutorInfo {
+	id := fmt.Sprintf("statsd-kafka-%s", hostname)
+	if standby {
+		// standby executors run next to the active one and stay around after activation, so they need unique ids
+		id = fmt.Sprintf("%s%s%s", id, standbyExecutorSuffix, uuid()[:8])
+	}
+
+	executor := s.artifactUri(s.config.executorName())
+	executor.Executable = proto.Bool(true)
+	uris := []*mesos.CommandInfo_URI{executor}
+
+	if s.config.ProducerProperties != "" {
+		uris = append(uris, s.artifactUri(filepath.Base(s.config.ProducerProperties)))
 	}
 
 	return &mesos.ExecutorInfo{
 		ExecutorId: util.NewExecutorID(id),
 		Name:       proto.String(id),
-		Command: &mesos.CommandInfo{
-			Value: proto.String(fmt.Sprintf("./%s --log.level %s --host %s", Config.Executor, Config.LogLevel, hostname)),
-			Uris:  uris,
-		},
+		Command:    s.executorCommand(hostname, uris),
+		Container:  s.containerInfo(ports...),
 	}
 }
 
+func hostnameFromExecutorId(executorId string) string {
+	hostname := strings.TrimPrefix(executorId, "statsd-kafka-")
+	if idx := strings.LastIndex(hostname, standbyExecutorSuffix); idx != -1 {
+		hostname = hostname[:idx]
+	}
+	return hostname
+}
+
 func (s *Scheduler) hostnameFromTaskId(taskId string) string {
-	tokens := strings.SplitN(taskId, "-", 3)
-	hostname := tokens[len(tokens)-1]
-	hostname = hostname[:len(hostname)-37] //strip uuid part
-	Logger.Debugf("Hostname extracted from %s is %s", taskId, hostname)
+	hostname, _ := parseTaskId(taskId)
+	s.logger.Debugf("Hostname extracted from %s is %s", taskId, hostname)
 	return hostname
 }
 
 func (s *Scheduler) resolveDeps() error {
-	files, _ := ioutil.ReadDir("./")
-	for _, file := range files {
-		if !file.IsDir() && executorMask.MatchString(file.Name()) {
-			Config.Executor = file.Name()
+	if s.config.ExecutorPath == "" {
+		path, err := s.detectExecutor()
+		if err != nil {
+			return err
 		}
+		s.config.ExecutorPath = path
+	}
+
+	if s.config.ArtifactDir != "" {
+		if dir, err := s.config.artifactDir(); err != nil {
+			return fmt.Errorf("Artifact dir %s is not accessible: %s", s.config.ArtifactDir, err)
+		} else if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("Artifact dir %s is not a directory", s.config.ArtifactDir)
+		}
+	}
+
+	info, err := os.Stat(s.config.ExecutorPath)
+	if err != nil {
+		return fmt.Errorf("Executor %s is not accessible: %s", s.config.ExecutorPath, err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("Executor %s is a directory", s.config.ExecutorPath)
 	}
 
-	if Config.Executor == "" {
-		return fmt.Errorf("%s not found in current dir", executorMask)
+	checksum, err := fileChecksum(s.config.ExecutorPath)
+	if err != nil {
+		return err
 	}
+	if s.config.ExecutorSha256 != "" && !strings.EqualFold(s.config.ExecutorSha256, checksum) {
+		return fmt.Errorf("Executor %s checksum mismatch: expected %s, actual %s", s.config.ExecutorPath, s.config.ExecutorSha256, checksum)
+	}
+	s.config.ExecutorSha256 = checksum
+	s.config.Executor = filepath.Base(s.config.ExecutorPath)
 
+	s.logger.Infof("Using executor %s (sha256 %s)", s.config.ExecutorPath, checksum)
 	return nil
 }
 
-func (s *Scheduler) listenAddr() string {
-	address := Config.Api
-	if strings.HasPrefix(address, "http://") {
-		address = address[len("http://"):]
+// detectExecutor looks for a single executor binary in the current dir, optionally narrowed down by executor version.
+func (s *Scheduler) detectExecutor() (string, error) {
+	candidates := make([]string, 0)
+	files, _ := ioutil.ReadDir("./")
+	for _, file := range files {
+		if !file.IsDir() && executorMask.MatchString(file.Name()) &&
+			(s.config.ExecutorVersion == "" || strings.Contains(file.Name(), s.config.ExecutorVersion)) {
+			candidates = append(candidates, file.Name())
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		if s.config.ExecutorVersion != "" {
+			return "", fmt.Errorf("%s with version %s not found in current dir", executorMask, s.config.ExecutorVersion)
+		}
+		return "", fmt.Errorf("%s not found in current dir", executorMask)
+	case 1:
+		return candidates[0], nil
+	default:
+		return "", fmt.Errorf("Several executors found in current dir: %s. Please set --executor.path or --executor.version", strings.Join(candidates, ", "))
 	}
+}
+
+func (s *Scheduler) listenAddr() string {
+	address := strings.TrimPrefix(strings.TrimPrefix(s.config.Api, "http://"), "https://")
 
 	colonIndex := strings.LastIndex(address, ":")
 	if colonIndex != -1 {
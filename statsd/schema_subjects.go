@@ -0,0 +1,114 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	goavro "github.com/elodina/go-avro"
+	kafkaavro "github.com/elodina/go-kafka-avro"
+)
+
+// schemaSubjects encodes avro records in the Confluent wire format, registering their schema under the subject of the
+// topic they are produced to, <topic>-value, instead of a subject named after the schema. Topics sharing a schema get
+// their own subjects, so compatibility is checked per topic and encodings fanned out to several topics don't collide.
+type schemaSubjects struct {
+	registry kafkaavro.SchemaRegistryClient
+	ids      map[string]int32 // schema id by subject
+	lock     sync.Mutex       // the registry client caches without locking
+}
+
+func newSchemaSubjects(url string) *schemaSubjects {
+	return &schemaSubjects{
+		registry: kafkaavro.NewCachedSchemaRegistryClient(url),
+		ids:      make(map[string]int32),
+	}
+}
+
+func topicSubject(topic string) string {
+	return topic + "-value"
+}
+
+func (s *schemaSubjects) encode(topic string, value interface{}) ([]byte, error) {
+	record, ok := value.(goavro.AvroRecord)
+	if !ok {
+		return nil, fmt.Errorf("Can't encode %T as avro record", value)
+	}
+
+	id, err := s.register(topicSubject(topic), record.Schema())
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := &bytes.Buffer{}
+	buffer.WriteByte(0) // magic byte
+	binary.Write(buffer, binary.BigEndian, id)
+
+	// write errors are not checked, like the kafka-avro encoder did, so records stay byte for byte what consumers
+	// got before subjects were per topic
+	writer := goavro.NewSpecificDatumWriter()
+	writer.SetSchema(record.Schema())
+	writer.Write(record, goavro.NewBinaryEncoder(buffer))
+	return buffer.Bytes(), nil
+}
+
+func (s *schemaSubjects) register(subject string, schema goavro.Schema) (int32, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id, err := s.registry.Register(subject, schema)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to register schema under subject %s: %s", subject, err)
+	}
+	if previous, exists := s.ids[subject]; !exists || previous != id {
+		Logger.Infof("Schema %s registered under subject %s with id %d", schema.GetName(), subject, id)
+	}
+	s.ids[subject] = id
+	return id, nil
+}
+
+// registered returns schema ids by subject for stats.
+func (s *schemaSubjects) registered() map[string]int32 {
+	if s == nil {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.ids) == 0 {
+		return nil
+	}
+	ids := make(map[string]int32, len(s.ids))
+	for subject, id := range s.ids {
+		ids[subject] = id
+	}
+	return ids
+}
+
+func subjectsString(ids map[string]int32) string {
+	subjects := make([]string, 0, len(ids))
+	for subject, id := range ids {
+		subjects = append(subjects, fmt.Sprintf("%s=%d", subject, id))
+	}
+	sort.Strings(subjects)
+	return strings.Join(subjects, ", ")
+}
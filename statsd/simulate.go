@@ -0,0 +1,469 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	util "github.com/mesos/mesos-go/mesosutil"
+)
+
+// simulatedExecutor is the executor launched tasks name, no executor binary is needed to simulate.
+const simulatedExecutor = "statsd-mesos-kafka-executor"
+
+// SimulationFixture is a recorded stream of offers and status updates along with the configuration to schedule with.
+// Config and update steps take the parameters of the update command, e.g. {"constraints": "rack=unique"}.
+type SimulationFixture struct {
+	Config map[string]string `json:"config"`
+	Steps  []*SimulationStep `json:"steps"`
+}
+
+// SimulationStep is one thing happening to the scheduler. Exactly one of its fields is set.
+type SimulationStep struct {
+	Offers []*SimulatedOffer `json:"offers,omitempty"`
+	Status *SimulatedStatus  `json:"status,omitempty"`
+	Update map[string]string `json:"update,omitempty"`
+	Start  bool              `json:"start,omitempty"`
+	Stop   bool              `json:"stop,omitempty"`
+}
+
+type SimulatedOffer struct {
+	Host       string            `json:"host"`
+	Cpus       float64           `json:"cpus"`
+	Mem        float64           `json:"mem"`
+	Ports      string            `json:"ports"` // ranges like 31000-32000,33000-33100
+	Attributes map[string]string `json:"attributes"`
+}
+
+// SimulatedStatus is a status update of the task on the host, the standby task if Standby is set.
+type SimulatedStatus struct {
+	Host    string `json:"host"`
+	State   string `json:"state"`
+	Message string `json:"message"`
+	Healthy *bool  `json:"healthy"`
+	Standby bool   `json:"standby"`
+}
+
+func (step *SimulationStep) String() string {
+	switch {
+	case step.Offers != nil:
+		offers := make([]string, len(step.Offers))
+		for i, offer := range step.Offers {
+			offers[i] = fmt.Sprintf("%s cpus:%.2f mem:%.0f", offer.Host, offer.Cpus, offer.Mem)
+		}
+		return "offers " + strings.Join(offers, ", ")
+	case step.Status != nil:
+		task := "task"
+		if step.Status.Standby {
+			task = "standby task"
+		}
+		return fmt.Sprintf("status %s on %s %s", task, step.Status.Host, step.Status.State)
+	case step.Update != nil:
+		return "update " + updateParams(step.Update).Encode()
+	case step.Start:
+		return "start"
+	case step.Stop:
+		return "stop"
+	}
+	return "nothing"
+}
+
+func LoadSimulationFixture(path string) (*SimulationFixture, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := new(SimulationFixture)
+	if err := json.Unmarshal(data, fixture); err != nil {
+		return nil, fmt.Errorf("Invalid simulation fixture %s: %s", path, err)
+	}
+	return fixture, nil
+}
+
+// Simulation replays a fixture through the scheduling logic of a scheduler without a Mesos master, reporting the
+// launches, declines and kills it decides on. Launched tasks are assumed to run until a status update says otherwise,
+// killed tasks report TASK_KILLED right away. Back-offs and maintenance windows pass in real time, so steps of a
+// fixture happen at once from the scheduler's point of view.
+type Simulation struct {
+	scheduler *Scheduler
+	driver    *simulationDriver
+	events    <-chan *Event
+	output    io.Writer
+}
+
+// NewSimulation creates a started scheduler with the fixture config and overrides applied, validated as by the update
+// command.
+func NewSimulation(fixture *SimulationFixture, overrides url.Values, output io.Writer) (*Simulation, error) {
+	config := NewConfig()
+	config.Executor = simulatedExecutor
+	s := NewScheduler(config, Logger, nil)
+	s.httpServer = NewHttpServer(config.Api, s)
+
+	sim := &Simulation{scheduler: s, driver: newSimulationDriver(), output: output}
+	s.setDriver(sim.driver, "")
+	s.frameworkId = "simulation"
+
+	for _, params := range []url.Values{updateParams(fixture.Config), overrides} {
+		if err := sim.update(params); err != nil {
+			return nil, err
+		}
+	}
+	s.SetActive(true)
+	sim.events, _ = s.timeline.Subscribe(timelineSize)
+	return sim, nil
+}
+
+// Run replays the steps, writing what happens on each of them, and a summary of placements and declines at the end.
+func (sim *Simulation) Run(steps []*SimulationStep) error {
+	for i, step := range steps {
+		fmt.Fprintf(sim.output, "#%d %s\n", i+1, step)
+		if err := sim.step(step); err != nil {
+			return fmt.Errorf("Step %d: %s", i+1, err)
+		}
+		sim.report()
+	}
+
+	sim.summary()
+	return nil
+}
+
+func (sim *Simulation) step(step *SimulationStep) error {
+	s := sim.scheduler
+	switch {
+	case step.Offers != nil:
+		offers := make([]*mesos.Offer, 0, len(step.Offers))
+		for _, simulated := range step.Offers {
+			offer, err := sim.driver.offer(simulated)
+			if err != nil {
+				return err
+			}
+			offers = append(offers, offer)
+		}
+		s.ResourceOffers(sim.driver, offers)
+	case step.Status != nil:
+		status, err := sim.status(step.Status)
+		if err != nil {
+			return err
+		}
+		s.StatusUpdate(sim.driver, status)
+	case step.Update != nil:
+		return sim.update(updateParams(step.Update))
+	case step.Start:
+		s.SetActive(true)
+	case step.Stop:
+		s.SetActive(false)
+	default:
+		return errors.New("Empty step, expected offers, status, update, start or stop")
+	}
+
+	// killed tasks are gone before anything else happens
+	for killed := sim.driver.takeKilled(); len(killed) > 0; killed = sim.driver.takeKilled() {
+		sim.report()
+		for _, taskId := range killed {
+			fmt.Fprintf(sim.output, "   killed %s\n", taskId)
+			s.StatusUpdate(sim.driver, util.NewTaskStatus(util.NewTaskID(taskId), mesos.TaskState_TASK_KILLED))
+		}
+	}
+	return nil
+}
+
+// update validates the parameters like the update API and applies them as the update API does, except
+// that running servers are neither restarted nor sent the new configuration.
+func (sim *Simulation) update(params url.Values) error {
+	if len(params) == 0 {
+		return nil
+	}
+
+	s := sim.scheduler
+	if err := s.httpServer.validateUpdate(params); err != nil {
+		return err
+	}
+
+	applyUpdate(params, s.config)
+	s.ConfigUpdated()
+	if params.Get("instances") != "" {
+		s.scaleDown()
+	}
+	return nil
+}
+
+// status addresses the update to the task currently on the host, as task ids of a recording don't match simulated ones.
+func (sim *Simulation) status(simulated *SimulatedStatus) (*mesos.TaskStatus, error) {
+	state, exists := mesos.TaskState_value[strings.ToUpper(simulated.State)]
+	if !exists {
+		return nil, fmt.Errorf("Invalid task state %s, expected e.g. TASK_RUNNING", simulated.State)
+	}
+
+	task := sim.scheduler.cluster.GetTasksByHost()[simulated.Host]
+	if simulated.Standby {
+		task = sim.scheduler.cluster.GetStandby(simulated.Host)
+	}
+	if task == nil {
+		return nil, fmt.Errorf("No task on %s to update", simulated.Host)
+	}
+
+	status := util.NewTaskStatus(task.GetTaskId(), mesos.TaskState(state))
+	if simulated.Message != "" {
+		status.Message = proto.String(simulated.Message)
+	}
+	status.Healthy = simulated.Healthy
+	return status, nil
+}
+
+// report writes the decisions the scheduler made in the last step.
+func (sim *Simulation) report() {
+	for {
+		select {
+		case event := <-sim.events:
+			line := fmt.Sprintf("   %s", event.Type)
+			if event.Host != "" {
+				line += " " + event.Host
+			}
+			if event.TaskId != "" {
+				line += " " + event.TaskId
+			}
+			if event.Message != "" {
+				line += ": " + event.Message
+			}
+			fmt.Fprintln(sim.output, line)
+		default:
+			for _, host := range sim.driver.takeSuppressed() {
+				fmt.Fprintf(sim.output, "   offer-declined %s: nothing to launch, refused for %.0fs\n", host, suppressRefuseSeconds)
+			}
+			return
+		}
+	}
+}
+
+func (sim *Simulation) summary() {
+	s := sim.scheduler
+	fmt.Fprintln(sim.output, "Placements:")
+	tasks := s.cluster.GetTasksByHost()
+	hosts := make([]string, 0, len(tasks))
+	for host := range tasks {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		line := fmt.Sprintf("  %s %s", host, tasks[host].GetTaskId().GetValue())
+		if standby := s.cluster.GetStandby(host); standby != nil {
+			line += fmt.Sprintf(", standby %s", standby.GetTaskId().GetValue())
+		}
+		fmt.Fprintln(sim.output, line)
+	}
+
+	s.metrics.lock.Lock()
+	defer s.metrics.lock.Unlock()
+	declines := make([]string, 0)
+	for _, reason := range sortedKeys(s.metrics.declines) {
+		declines = append(declines, fmt.Sprintf("%s %d", reason, s.metrics.declines[reason]))
+	}
+	if len(declines) == 0 {
+		declines = append(declines, "none")
+	}
+	fmt.Fprintf(sim.output, "Offers: %d, launched: %d, declined: %s\n", s.metrics.offers, sim.driver.launched(), strings.Join(declines, ", "))
+}
+
+func updateParams(values map[string]string) url.Values {
+	params := url.Values{}
+	for name, value := range values {
+		params.Set(name, value)
+	}
+	return params
+}
+
+// simulationDriver records what the scheduler asks Mesos to do.
+type simulationDriver struct {
+	offerId    int
+	hosts      map[string]string // offer id to host, until launched on or declined
+	launches   int
+	killed     []string
+	suppressed []string // hosts of offers declined without a reason, as nothing is to be launched
+	lock       sync.Mutex
+}
+
+func newSimulationDriver() *simulationDriver {
+	return &simulationDriver{hosts: make(map[string]string)}
+}
+
+func (d *simulationDriver) offer(simulated *SimulatedOffer) (*mesos.Offer, error) {
+	if simulated.Host == "" {
+		return nil, errors.New("Offer without host")
+	}
+	ports := simulated.Ports
+	if ports == "" {
+		ports = "31000-32000"
+	}
+	ranges, err := parsePortRanges(ports)
+	if err != nil {
+		return nil, err
+	}
+
+	d.lock.Lock()
+	d.offerId++
+	id := fmt.Sprintf("simulated-offer-%d", d.offerId)
+	d.hosts[id] = simulated.Host
+	d.lock.Unlock()
+
+	offer := util.NewOffer(util.NewOfferID(id), util.NewFrameworkID("simulation"), util.NewSlaveID("simulated-"+simulated.Host), simulated.Host)
+	offer.Resources = []*mesos.Resource{
+		util.NewScalarResource("cpus", simulated.Cpus),
+		util.NewScalarResource("mem", simulated.Mem),
+		util.NewRangesResource("ports", ranges),
+	}
+	names := make([]string, 0, len(simulated.Attributes))
+	for name := range simulated.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		offer.Attributes = append(offer.Attributes, &mesos.Attribute{
+			Name: proto.String(name),
+			Type: mesos.Value_TEXT.Enum(),
+			Text: &mesos.Value_Text{Value: proto.String(simulated.Attributes[name])},
+		})
+	}
+	return offer, nil
+}
+
+func parsePortRanges(value string) ([]*mesos.Value_Range, error) {
+	ranges := make([]*mesos.Value_Range, 0)
+	for _, part := range strings.Split(value, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+		begin, err := strconv.ParseUint(bounds[0], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid ports %s, expected ranges like 31000-32000", value)
+		}
+		end := begin
+		if len(bounds) == 2 {
+			if end, err = strconv.ParseUint(bounds[1], 10, 16); err != nil || end < begin {
+				return nil, fmt.Errorf("Invalid ports %s, expected ranges like 31000-32000", value)
+			}
+		}
+		ranges = append(ranges, util.NewValueRange(begin, end))
+	}
+	return ranges, nil
+}
+
+func (d *simulationDriver) takeKilled() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	killed := d.killed
+	d.killed = nil
+	return killed
+}
+
+func (d *simulationDriver) takeSuppressed() []string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	suppressed := d.suppressed
+	d.suppressed = nil
+	return suppressed
+}
+
+func (d *simulationDriver) launched() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.launches
+}
+
+func (d *simulationDriver) Start() (mesos.Status, error) { return mesos.Status_DRIVER_RUNNING, nil }
+
+func (d *simulationDriver) Stop(failover bool) (mesos.Status, error) {
+	return mesos.Status_DRIVER_STOPPED, nil
+}
+
+func (d *simulationDriver) Abort() (mesos.Status, error) { return mesos.Status_DRIVER_ABORTED, nil }
+
+func (d *simulationDriver) Join() (mesos.Status, error) { return mesos.Status_DRIVER_STOPPED, nil }
+
+func (d *simulationDriver) Run() (mesos.Status, error) { return mesos.Status_DRIVER_STOPPED, nil }
+
+func (d *simulationDriver) RequestResources(requests []*mesos.Request) (mesos.Status, error) {
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *simulationDriver) AcceptOffers(offerIds []*mesos.OfferID, operations []*mesos.Offer_Operation, filters *mesos.Filters) (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, id := range offerIds {
+		delete(d.hosts, id.GetValue())
+	}
+	for _, operation := range operations {
+		if operation.GetType() == mesos.Offer_Operation_LAUNCH {
+			d.launches += len(operation.GetLaunch().GetTaskInfos())
+		}
+	}
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *simulationDriver) LaunchTasks(offerIds []*mesos.OfferID, tasks []*mesos.TaskInfo, filters *mesos.Filters) (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for _, id := range offerIds {
+		delete(d.hosts, id.GetValue())
+	}
+	d.launches += len(tasks)
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *simulationDriver) KillTask(taskId *mesos.TaskID) (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.killed = append(d.killed, taskId.GetValue())
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *simulationDriver) DeclineOffer(offerId *mesos.OfferID, filters *mesos.Filters) (mesos.Status, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if host, exists := d.hosts[offerId.GetValue()]; exists && filters.GetRefuseSeconds() == suppressRefuseSeconds {
+		d.suppressed = append(d.suppressed, host)
+	}
+	delete(d.hosts, offerId.GetValue())
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *simulationDriver) ReviveOffers() (mesos.Status, error) {
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *simulationDriver) SendFrameworkMessage(executorId *mesos.ExecutorID, slaveId *mesos.SlaveID, data string) (mesos.Status, error) {
+	return mesos.Status_DRIVER_RUNNING, nil
+}
+
+func (d *simulationDriver) ReconcileTasks(statuses []*mesos.TaskStatus) (mesos.Status, error) {
+	return mesos.Status_DRIVER_RUNNING, nil
+}
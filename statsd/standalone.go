@@ -0,0 +1,99 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// ReadConfigFile applies task data, as passed by the scheduler to executors, from a JSON file to Config.
+func ReadConfigFile(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	taskData, err := ParseTaskData(data)
+	if err != nil {
+		return err
+	}
+	taskData.apply(Config)
+	return nil
+}
+
+// RunStandalone runs the server as a plain process without an executor driver, so parsing, transforms and Kafka
+// settings can be tried locally without a Mesos cluster. Stats are logged instead of being reported to the scheduler.
+// Returns once the server is stopped with an interrupt.
+func RunStandalone(host string, adminPort uint64) error {
+	if err := Config.checkStart(); err != nil {
+		return err
+	}
+	transformFunc, exists := transformFunctions[Config.Transform]
+	if !exists {
+		return fmt.Errorf("Invalid transformation mode: %s", Config.Transform)
+	}
+
+	e := &Executor{Host: host}
+	dualWrite, err := NewDualWrite(Config.DualWriteTransform, Config.DualWriteTopic, Config.DualWriteUntil, e.serializer)
+	if err != nil {
+		return err
+	}
+	producers, err := e.newProducers(Config.producerCount())
+	if err != nil {
+		return fmt.Errorf("Failed to create producer: %s", err)
+	}
+
+	e.server = NewStatsDServer(fmt.Sprintf("0.0.0.0:%d", Config.listenPort()), producers, transformFunc, e.serializer(Config.Transform), host)
+	e.server.dualWrite = dualWrite
+	e.server.subjects = e.schemaSubjects()
+	e.shipLogs()
+	if adminPort > 0 {
+		e.startAdminServer(adminPort)
+	}
+
+	ctrlc := make(chan os.Signal, 1)
+	signal.Notify(ctrlc, os.Interrupt)
+	go func() {
+		<-ctrlc
+		e.server.Stop()
+	}()
+
+	go e.logStats()
+	if Config.BrokerDnsTtl > 0 {
+		go e.watchBrokers()
+	}
+	Logger.Infof("Running standalone with configuration:\n%s", Config)
+	e.server.Start()
+	return nil
+}
+
+// logStats logs what a driver-backed executor would report to the scheduler.
+func (e *Executor) logStats() {
+	ticker := time.NewTicker(statsReportInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if e.server.isClosed() {
+			return
+		}
+
+		Logger.Info(e.server.Stats())
+	}
+}
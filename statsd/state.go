@@ -0,0 +1,309 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	utils "github.com/elodina/go-mesos-utils"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// State is what the scheduler persists to pick up running tasks after a restart.
+type State struct {
+	FrameworkId   string
+	Active        bool
+	ConfigVersion int
+	Config        *config
+	Tasks         map[string]*mesos.TaskInfo // hostname -> task
+	Standby       map[string]*mesos.TaskInfo // hostname -> task
+	Generations   map[string]int             // hostname -> generation of the last task launched there
+	Whitelist     []string
+	Blacklist     []string
+	Halted        bool         // stopped with stop, as opposed to not started yet
+	QueuedUpdates []url.Values // updates made while stopped, applied on start
+}
+
+// NewStorage creates a state store for values like file:statsd-mesos-kafka.json or zk:zookeeper:2181/statsd-mesos-kafka.
+func NewStorage(value string) (utils.Storage, error) {
+	kv := strings.SplitN(value, ":", 2)
+	if len(kv) != 2 || kv[1] == "" {
+		return nil, fmt.Errorf("Invalid storage %s, expected file:<path> or zk:<connect>/<path>", value)
+	}
+
+	switch kv[0] {
+	case "file":
+		return utils.NewFileStorage(kv[1]), nil
+	case "zk":
+		return utils.NewZKStorage(kv[1])
+	default:
+		return nil, fmt.Errorf("Unsupported storage type %s, expected file or zk", kv[0])
+	}
+}
+
+// stateFlushTimeout bounds waiting for the state to be saved before launching tasks.
+var stateFlushTimeout = 10 * time.Second
+
+// stateWrites tracks saves of the state. One save is in flight at a time, changes made meanwhile are saved together by
+// the next one, and flushes wait for the save covering the changes made before them, so busy clusters don't pay a
+// write per change.
+type stateWrites struct {
+	changed uint64        // changes made
+	saved   uint64        // changes covered by the last save
+	err     error         // result of the last save
+	saves   chan struct{} // closed after each save
+	lock    sync.Mutex
+}
+
+func newStateWrites() *stateWrites {
+	return &stateWrites{saves: make(chan struct{})}
+}
+
+func (w *stateWrites) change() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.changed++
+}
+
+func (w *stateWrites) pending() uint64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.changed
+}
+
+func (w *stateWrites) done(changes uint64, err error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.saved = changes
+	w.err = err
+	close(w.saves)
+	w.saves = make(chan struct{})
+}
+
+// wait blocks until the changes are saved and returns the error of the save covering them.
+func (w *stateWrites) wait(changes uint64, timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		w.lock.Lock()
+		saved, err, saves := w.saved, w.err, w.saves
+		w.lock.Unlock()
+		if saved >= changes {
+			return err
+		}
+
+		select {
+		case <-saves:
+		case <-timer.C:
+			return newError(ErrStateStoreUnavailable, "State not saved within %s", timeout)
+		}
+	}
+}
+
+// stateChanged schedules saving the state if a storage is configured. Changes in quick succession are saved once.
+func (s *Scheduler) stateChanged() {
+	if s.storage == nil {
+		return
+	}
+
+	s.stateWrites.change()
+	select {
+	case s.stateChanges <- struct{}{}:
+	default:
+	}
+}
+
+// flushState waits until the changes made so far are saved. Returns nil right away without a storage.
+func (s *Scheduler) flushState() error {
+	if s.storage == nil {
+		return nil
+	}
+
+	return s.stateWrites.wait(s.stateWrites.pending(), stateFlushTimeout)
+}
+
+func (s *Scheduler) persistState() {
+	for range s.stateChanges {
+		changes := s.stateWrites.pending()
+		var err error
+		if !s.handingOff() && !s.isTornDown() {
+			err = s.saveState()
+		}
+		s.stateWrites.done(changes, err)
+	}
+}
+
+// saveState persists the framework id, running tasks and configuration.
+func (s *Scheduler) saveState() error {
+	s.activeLock.Lock()
+	state := &State{
+		FrameworkId:   s.frameworkId,
+		Active:        s.active,
+		ConfigVersion: s.configVersion,
+		Config:        s.config,
+		Tasks:         s.cluster.GetTasksByHost(),
+		Standby:       s.cluster.GetStandbyByHost(),
+		Generations:   s.generations.Snapshot(),
+		Whitelist:     s.hosts.Snapshot(HostWhitelist),
+		Blacklist:     s.hosts.Snapshot(HostBlacklist),
+		Halted:        s.halted,
+		QueuedUpdates: s.queuedUpdates,
+	}
+	s.activeLock.Unlock()
+
+	data, err := json.Marshal(state)
+	if err == nil {
+		err = s.storage.Save(data)
+	}
+	if err != nil {
+		s.logger.Errorf("Failed to save state: %s", err)
+	}
+	return err
+}
+
+// loadState restores persisted state. Settings given on the scheduler command line take precedence over saved ones.
+func (s *Scheduler) loadState() error {
+	data, err := s.storage.Load()
+	if err != nil || len(data) == 0 {
+		s.logger.Infof("No saved state found in %s", s.storage)
+		return nil
+	}
+
+	state := &State{Config: new(config)}
+	if err := json.Unmarshal(data, state); err != nil {
+		return fmt.Errorf("Failed to load state from %s: %s", s.storage, err)
+	}
+
+	s.restoreConfig(state.Config)
+	s.frameworkId = state.FrameworkId
+	s.active = state.Active
+	s.halted = state.Halted
+	s.queuedUpdates = state.QueuedUpdates
+	s.configVersion = state.ConfigVersion
+	for hostname, task := range state.Tasks {
+		s.cluster.Add(hostname, task)
+	}
+	for hostname, task := range state.Standby {
+		s.cluster.AddStandby(hostname, task)
+	}
+	s.generations.Restore(state.Generations)
+	s.hosts.Restore(HostWhitelist, state.Whitelist)
+	s.hosts.Restore(HostBlacklist, state.Blacklist)
+
+	s.logger.Infof("Loaded state from %s: framework %s, %d tasks", s.storage, s.frameworkId, len(state.Tasks)+len(state.Standby))
+	return nil
+}
+
+// forgetFramework drops the saved framework id and tasks once the master removed the framework, e.g. because the
+// scheduler was down longer than the failover timeout. The next start registers a new framework.
+func (s *Scheduler) forgetFramework() {
+	if s.storage == nil {
+		return
+	}
+
+	s.logger.Warnf("Framework %s was removed by the master, next start registers a new framework", s.frameworkId)
+	s.frameworkId = ""
+	for hostname := range s.cluster.GetTasksByHost() {
+		s.cluster.Remove(hostname)
+	}
+	for hostname := range s.cluster.GetStandbyByHost() {
+		s.cluster.RemoveStandby(hostname)
+	}
+	s.saveState()
+}
+
+func (s *Scheduler) restoreConfig(saved *config) {
+	startup := *s.config
+	*s.config = *saved
+
+	s.config.Api = startup.Api
+	s.config.Master = startup.Master
+	s.config.MesosApi = startup.MesosApi
+	s.config.FrameworkName = startup.FrameworkName
+	s.config.FrameworkRole = startup.FrameworkRole
+	s.config.FrameworkPrincipal = startup.FrameworkPrincipal
+	s.config.FrameworkSecret = startup.FrameworkSecret
+	s.config.User = startup.User
+	s.config.Namespace = startup.Namespace
+	s.config.Executor = startup.Executor
+	s.config.ExecutorPath = startup.ExecutorPath
+	s.config.ExecutorVersion = startup.ExecutorVersion
+	s.config.ExecutorSha256 = startup.ExecutorSha256
+	s.config.ArtifactDir = startup.ArtifactDir
+	s.config.DiscoveryFile = startup.DiscoveryFile
+	s.config.LogLevel = startup.LogLevel
+	s.config.GcInterval = startup.GcInterval
+	s.config.GcEnforce = startup.GcEnforce
+	s.config.MaintenanceDrain = startup.MaintenanceDrain
+	s.config.RefuseSeconds = startup.RefuseSeconds
+	s.config.MismatchSeconds = startup.MismatchSeconds
+	s.config.HistoryMaxAge = startup.HistoryMaxAge
+	s.config.HistoryMaxEvents = startup.HistoryMaxEvents
+	s.config.InactiveUpdates = startup.InactiveUpdates
+	s.config.ApiAuth = startup.ApiAuth
+	s.config.ApiTokens = startup.ApiTokens
+	s.config.ApiReadOnlyTokens = startup.ApiReadOnlyTokens
+	s.config.ApiUsers = startup.ApiUsers
+	s.config.ApiReadOnlyUsers = startup.ApiReadOnlyUsers
+	s.config.ApiReadOnly = startup.ApiReadOnly
+	s.config.ApiGroups = startup.ApiGroups
+	s.config.OidcIssuer = startup.OidcIssuer
+	s.config.OidcAudience = startup.OidcAudience
+	s.config.OidcJwksUrl = startup.OidcJwksUrl
+	s.config.LdapUrl = startup.LdapUrl
+	s.config.LdapUserDn = startup.LdapUserDn
+	s.config.ApiTlsCert = startup.ApiTlsCert
+	s.config.ApiTlsKey = startup.ApiTlsKey
+	s.config.Storage = startup.Storage
+	s.config.FailoverTimeout = startup.FailoverTimeout
+	s.config.LeaderElection = startup.LeaderElection
+	s.config.HandoffFrom = startup.HandoffFrom
+	s.config.Force = startup.Force
+
+	// the uploaded executor in use may be gone, e.g. with a new artifact dir
+	if s.config.ExecutorUpload != "" {
+		if err := validateExecutorUpload(s.config, s.config.ExecutorUpload); err != nil {
+			s.logger.Warnf("Launching servers with %s again: %s", s.config.Executor, err)
+			s.config.ExecutorUpload = ""
+		}
+	}
+}
+
+// reconcileTasks asks the master for the state of restored tasks. Tasks unknown to the master are reported lost.
+func (s *Scheduler) reconcileTasks() {
+	statuses := make([]*mesos.TaskStatus, 0)
+	for _, task := range s.cluster.GetAllTasks() {
+		statuses = append(statuses, &mesos.TaskStatus{
+			TaskId:  task.GetTaskId(),
+			SlaveId: task.GetSlaveId(),
+			State:   mesos.TaskState_TASK_STAGING.Enum(),
+		})
+	}
+
+	if len(statuses) > 0 {
+		s.logger.Infof("Reconciling %d restored tasks", len(statuses))
+		s.currentDriver().ReconcileTasks(statuses)
+	}
+}
@@ -0,0 +1,265 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	MessageStats    = "stats"
+	MessageActivate = "activate"
+	MessageRotate   = "rotate"
+	MessageRotated  = "rotated"
+	MessageConfig   = "config"
+	MessageApplied  = "applied"
+	MessageDrain    = "drain"
+	MessageDrained  = "drained"
+	MessageTap      = "tap"
+	MessageTapped   = "tapped"
+)
+
+var statsReportInterval = 30 * time.Second
+
+// ExecutorMessage is the envelope for framework messages exchanged between executors and the scheduler.
+type ExecutorMessage struct {
+	Type  string
+	Stats *ExecutorStats `json:",omitempty"`
+
+	Host       string `json:",omitempty"`
+	Error      string `json:",omitempty"`
+	File       string `json:",omitempty"` // producer properties file name in the sandbox
+	Properties string `json:",omitempty"` // producer properties file content
+
+	Config  *ConfigDelta `json:",omitempty"`
+	Version int          `json:",omitempty"` // config version the delta belongs to
+
+	Until int64 `json:",omitempty"` // unix time until which Kafka is drained, 0 resumes
+
+	Tap   *TapRequest `json:",omitempty"`
+	Lines []string    `json:",omitempty"` // tapped lines
+}
+
+// ConfigDelta holds settings executors apply without a restart, empty fields are left unchanged.
+type ConfigDelta struct {
+	Topic      string `json:",omitempty"`
+	BrokerList string `json:",omitempty"`
+	Transform  string `json:",omitempty"`
+}
+
+func NewStatsMessage(stats *ExecutorStats) *ExecutorMessage {
+	return &ExecutorMessage{
+		Type:  MessageStats,
+		Stats: stats,
+	}
+}
+
+func NewActivateMessage() *ExecutorMessage {
+	return &ExecutorMessage{Type: MessageActivate}
+}
+
+func NewRotateMessage(file string, properties string) *ExecutorMessage {
+	return &ExecutorMessage{
+		Type:       MessageRotate,
+		File:       file,
+		Properties: properties,
+	}
+}
+
+func NewRotatedMessage(host string, err error) *ExecutorMessage {
+	message := &ExecutorMessage{
+		Type: MessageRotated,
+		Host: host,
+	}
+	if err != nil {
+		message.Error = err.Error()
+	}
+	return message
+}
+
+func NewConfigMessage(delta *ConfigDelta, version int) *ExecutorMessage {
+	return &ExecutorMessage{
+		Type:    MessageConfig,
+		Config:  delta,
+		Version: version,
+	}
+}
+
+func NewAppliedMessage(host string, version int, err error) *ExecutorMessage {
+	message := &ExecutorMessage{
+		Type:    MessageApplied,
+		Host:    host,
+		Version: version,
+	}
+	if err != nil {
+		message.Error = err.Error()
+	}
+	return message
+}
+
+func NewDrainMessage(until time.Time) *ExecutorMessage {
+	message := &ExecutorMessage{Type: MessageDrain}
+	if !until.IsZero() {
+		message.Until = until.Unix()
+	}
+	return message
+}
+
+func NewDrainedMessage(host string, err error) *ExecutorMessage {
+	message := &ExecutorMessage{
+		Type: MessageDrained,
+		Host: host,
+	}
+	if err != nil {
+		message.Error = err.Error()
+	}
+	return message
+}
+
+func NewTapMessage(tap *TapRequest) *ExecutorMessage {
+	return &ExecutorMessage{
+		Type: MessageTap,
+		Tap:  tap,
+	}
+}
+
+func NewTappedMessage(host string, id string, lines []string) *ExecutorMessage {
+	return &ExecutorMessage{
+		Type:  MessageTapped,
+		Host:  host,
+		Tap:   &TapRequest{Id: id},
+		Lines: lines,
+	}
+}
+
+func ParseExecutorMessage(message string) (*ExecutorMessage, error) {
+	executorMessage := new(ExecutorMessage)
+	err := json.Unmarshal([]byte(message), executorMessage)
+	return executorMessage, err
+}
+
+func (m *ExecutorMessage) String() string {
+	bytes, err := json.Marshal(m)
+	if err != nil {
+		panic(err) //shouldn't happen
+	}
+
+	return string(bytes)
+}
+
+type ExecutorStats struct {
+	Host          string
+	Timestamp     int64
+	Shards        []*ShardStats
+	TopMetrics    []*MetricCount
+	Sampling      bool
+	Sampled       int64
+	Quotas        []*QuotaStats
+	ExpiredGauges int64            // gauges not reporting within the gauge ttl
+	Memory        uint64           // bytes obtained from the OS by the executor
+	MemoryLimit   uint64           // bytes allocated to the task, 0 if unknown
+	Throttled     bool             // resident memory is over the soft limit, so the server throttles itself
+	Draining      bool             // records are buffered on disk instead of produced
+	Buffered      int64            // records buffered on disk
+	BufferDropped int64            // records not buffered over buffer.max.size
+	BufferExpired int64            // buffered records dropped over buffer.max.age
+	BufferCorrupt int64            // lines of buffer files that couldn't be read, moved to corrupt.log
+	LogsShipped   int64            // log lines produced to the log topic
+	LogsDropped   int64            // log lines over the log topic rate
+	Subjects      map[string]int32 `json:",omitempty"` // schema registry ids by subject of avro encoded topics
+}
+
+// Occupancy returns the highest queue occupancy (0..1) among shards.
+func (s *ExecutorStats) Occupancy() float64 {
+	occupancy := 0.0
+	for _, shard := range s.Shards {
+		if shard.Capacity > 0 && float64(shard.Queued)/float64(shard.Capacity) > occupancy {
+			occupancy = float64(shard.Queued) / float64(shard.Capacity)
+		}
+	}
+	return occupancy
+}
+
+func (s *ExecutorStats) Received() int64 {
+	var received int64
+	for _, shard := range s.Shards {
+		received += shard.Received
+	}
+	return received
+}
+
+type ShardStats struct {
+	Shard     int
+	Received  int64
+	Produced  int64
+	Invalid   int64
+	Failed    int64
+	TimedOut  int64 // produce requests not acknowledged within produce timeout
+	Expired   int64 // records dropped for exceeding the latency budget
+	Queued    int
+	Capacity  int
+	Burst     int   // records held in the burst buffer beyond capacity
+	Absorbed  int64 // records ever held in the burst buffer
+	Bursts    int64
+	BurstPeak int // most records held in the burst buffer at once
+}
+
+func (s *ExecutorStats) String() string {
+	var str string
+	for _, shard := range s.Shards {
+		str += fmt.Sprintf("    shard %d: received %d, produced %d, invalid %d, failed %d, timed out %d, expired %d, queued %d\n",
+			shard.Shard, shard.Received, shard.Produced, shard.Invalid, shard.Failed, shard.TimedOut, shard.Expired, shard.Queued)
+		if shard.Bursts > 0 {
+			str += fmt.Sprintf("      burst: %d held beyond capacity %d, absorbed %d in %d bursts, peak %d\n",
+				shard.Burst, shard.Capacity, shard.Absorbed, shard.Bursts, shard.BurstPeak)
+		}
+	}
+	if s.Sampling || s.Sampled > 0 {
+		str += fmt.Sprintf("    sampling: %t, sampled out %d\n", s.Sampling, s.Sampled)
+	}
+	if s.Draining || s.Buffered > 0 {
+		str += fmt.Sprintf("    kafka drain: %t, %d records buffered on disk\n", s.Draining, s.Buffered)
+	}
+	if s.BufferDropped > 0 || s.BufferExpired > 0 || s.BufferCorrupt > 0 {
+		str += fmt.Sprintf("    disk buffer: dropped %d over size limit, %d over age limit, %d corrupt\n",
+			s.BufferDropped, s.BufferExpired, s.BufferCorrupt)
+	}
+	if s.Throttled {
+		str += fmt.Sprintf("    throttled: memory %d MB of %d MB allocated, sampling top metrics\n", s.Memory>>20, s.MemoryLimit>>20)
+	}
+	if s.LogsShipped > 0 || s.LogsDropped > 0 {
+		str += fmt.Sprintf("    log shipping: shipped %d, dropped %d\n", s.LogsShipped, s.LogsDropped)
+	}
+	if len(s.Subjects) > 0 {
+		str += fmt.Sprintf("    schema subjects: %s\n", subjectsString(s.Subjects))
+	}
+	if s.ExpiredGauges > 0 {
+		str += fmt.Sprintf("    expired gauges: %d\n", s.ExpiredGauges)
+	}
+	for _, quota := range s.Quotas {
+		str += fmt.Sprintf("    quota %s: %d/%d per second, accepted %d, exceeded %d\n", quota.Namespace, quota.Rate, quota.Limit, quota.Accepted, quota.Exceeded)
+	}
+	if len(s.TopMetrics) > 0 {
+		str += "    top metrics:\n"
+		for _, metric := range s.TopMetrics {
+			str += fmt.Sprintf("      %s: %d (error %d)\n", metric.Name, metric.Count, metric.Error)
+		}
+	}
+
+	return str
+}
@@ -17,56 +17,189 @@ package statsd
 
 import (
 	"bufio"
+	"math/rand"
 	"net"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/elodina/siesta-producer"
 )
 
 type StatsDServer struct {
-	addr       string
-	connection *net.UDPConn
-	incoming   chan string
-	producer   *producer.KafkaProducer
-	transform  func(string, string) interface{}
-	host       string
+	addr         string
+	connection   *net.UDPConn
+	shards       []*producerShard
+	transform    func(string, string) interface{}
+	serializer   func(string, interface{}) ([]byte, error) // encodes a transformed line for a topic
+	validator    func([]byte) error
+	host         string
+	topMetrics   *TopK
+	sampler      *AdaptiveSampler
+	quotas       *NamespaceQuotas
+	destinations []*Destination
+	typeTopics   map[string]string
+	gauges       *GaugeTracker
+	dualWrite    *DualWrite
+	subjects     *schemaSubjects // schema registry subjects of the avro encoding, nil without a schema registry
+	routingLock  sync.RWMutex    // guards destinations and encoding replaced by pushed config
+	buffer       *diskBuffer
+
+	memoryLimit    uint64 // bytes allocated to the task, 0 if unknown
+	memoryPressure int32
+
+	listener    net.Listener
+	connections map[net.Conn]struct{}
+
+	taps    map[string]*metricTap // tap id -> lines tapped for the scheduler
+	tapping int32                 // number of taps, checked before taking the lock
+	tapLock sync.RWMutex
 
 	closeChan chan struct{}
 	closed    bool
 	closeLock sync.Mutex
+	stopped   chan struct{}  // closed by Stop, wakes up goroutines queueing records on their own
+	senders   sync.WaitGroup // goroutines queueing records, shard queues are closed once they are done
+	done      chan struct{}  // closed once queued records are produced and producers flushed after Stop
 }
 
-func NewStatsDServer(addr string, producer *producer.KafkaProducer, transform func(string, string) interface{}, host string) *StatsDServer {
+func NewStatsDServer(addr string, producers []*producer.KafkaProducer, transform func(string, string) interface{}, serializer func(string, interface{}) ([]byte, error), host string) *StatsDServer {
+	quotas, err := ParseQuotas(Config.Quotas)
+	if err != nil {
+		Logger.Warnf("Ignoring namespace quotas: %s", err)
+	}
+
+	buffer := newDiskBuffer(bufferPath, int64(Config.BufferMaxSize*1024*1024), Config.BufferMaxAge)
+	shards := make([]*producerShard, len(producers))
+	for i, producer := range producers {
+		shards[i] = newProducerShard(i, producer)
+		shards[i].buffer = buffer
+		shards[i].bufferFailed = Config.BufferPath != ""
+	}
+
 	return &StatsDServer{
-		addr:      addr,
-		producer:  producer,
-		transform: transform,
-		host:      host,
-		incoming:  make(chan string, 100), //TODO buffer size should be configurable
-		closeChan: make(chan struct{}, 1),
+		addr:         addr,
+		shards:       shards,
+		transform:    transform,
+		serializer:   serializer,
+		validator:    validateFunctions[Config.Transform],
+		host:         host,
+		topMetrics:   NewTopK(topKCapacity),
+		sampler:      NewAdaptiveSampler(Config.SamplingThreshold, Config.SamplingRate),
+		quotas:       NewNamespaceQuotas(quotas),
+		destinations: destinationsFromConfig(),
+		typeTopics:   typeTopicsFromConfig(),
+		gauges:       NewGaugeTracker(Config.GaugeTtl),
+		buffer:       buffer,
+		connections:  make(map[net.Conn]struct{}),
+		taps:         make(map[string]*metricTap),
+		closeChan:    make(chan struct{}, 1),
+		stopped:      make(chan struct{}),
+		done:         make(chan struct{}),
 	}
 }
 
 func (s *StatsDServer) Start() {
 	s.startUDPServer()
+	if Config.Tcp {
+		s.startTCPServer()
+	}
+	if s.sampler.enabled() {
+		go s.watchOccupancy()
+	}
+	if s.gauges.enabled() {
+		s.senders.Add(1)
+		go s.expireGauges()
+	}
+	go s.resendBuffered()
+	if s.memoryLimit > 0 && Config.MemorySoftLimit > 0 {
+		go s.watchMemory()
+	}
 	s.startProducer()
+	s.buffer.Close()
+	close(s.done)
 }
 
+// defaultKillGracePeriod is how long a stopped server may flush unless configured otherwise.
+const defaultKillGracePeriod = 5 * time.Second
+
+// Stop stops reading metrics, waits until lines being handled are queued and closes the shard queues, so nothing is
+// queued to a closed shard.
 func (s *StatsDServer) Stop() {
 	s.closeLock.Lock()
-	defer s.closeLock.Unlock()
-
 	if s.closed {
+		s.closeLock.Unlock()
 		return
 	}
 
 	Logger.Info("Stopping StatsD server")
+	s.closed = true
+	close(s.stopped)
 	s.closeChan <- struct{}{}
 	s.connection.Close()
-	close(s.incoming)
-	s.producer.Close(5 * time.Second)
-	s.closed = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for connection := range s.connections {
+		connection.Close()
+	}
+	s.closeLock.Unlock()
+
+	deadline := time.Now().Add(Config.killGracePeriod())
+	s.senders.Wait()
+	for _, shard := range s.shards {
+		shard.close(deadline)
+	}
+}
+
+// Wait blocks until the stopped server flushed its producers or the timeout passes.
+func (s *StatsDServer) Wait(timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-s.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (s *StatsDServer) isClosed() bool {
+	s.closeLock.Lock()
+	defer s.closeLock.Unlock()
+
+	return s.closed
+}
+
+func (s *StatsDServer) Stats() *ExecutorStats {
+	stats := &ExecutorStats{
+		Host:          s.host,
+		Timestamp:     time.Now().Unix(),
+		Shards:        make([]*ShardStats, len(s.shards)),
+		TopMetrics:    s.topMetrics.Top(topKReported),
+		Sampling:      s.sampler.Active(),
+		Sampled:       s.sampler.Sampled(),
+		Quotas:        s.quotas.Stats(),
+		ExpiredGauges: s.gauges.Expired(),
+		MemoryLimit:   s.memoryLimit,
+		Throttled:     s.underPressure(),
+		Draining:      s.draining(),
+		Buffered:      s.buffer.Len(),
+		Subjects:      s.subjects.registered(),
+	}
+	stats.LogsShipped, stats.LogsDropped = logShipping.stats()
+	stats.BufferDropped, stats.BufferExpired, stats.BufferCorrupt = s.buffer.stats()
+	for i, shard := range s.shards {
+		stats.Shards[i] = shard.stats()
+	}
+
+	memStats := new(runtime.MemStats)
+	runtime.ReadMemStats(memStats)
+	stats.Memory = memStats.Sys
+
+	return stats
 }
 
 func (s *StatsDServer) startUDPServer() {
@@ -82,7 +215,9 @@ func (s *StatsDServer) startUDPServer() {
 	}
 	s.connection = connection
 
+	s.senders.Add(1)
 	go func() {
+		defer s.senders.Done()
 		for {
 			select {
 			case <-s.closeChan:
@@ -99,18 +234,177 @@ func (s *StatsDServer) startUDPServer() {
 func (s *StatsDServer) scan(connection net.Conn) {
 	scanner := bufio.NewScanner(connection)
 	for scanner.Scan() {
-		s.incoming <- scanner.Text()
+		s.handle(scanner.Text())
 	}
 }
 
-func (s *StatsDServer) startProducer() {
-	go func() {
-		for meta := range s.producer.RecordsMetadata {
-			Logger.Tracef("Received record metadata: topic %s, partition %d, offset %d, error %s", meta.Topic, meta.Partition, meta.Offset, meta.Error)
+// handle applies sampling and quotas to a received line and queues it for every destination it matches.
+func (s *StatsDServer) handle(line string) {
+	name := metricName(line)
+	s.topMetrics.Add(name)
+	s.tap(name, line)
+
+	line, keep := s.sampler.Sample(name, line)
+	if !keep {
+		return
+	}
+
+	if !s.quotas.Allow(name) {
+		switch Config.QuotaAction {
+		case QuotaActionSample:
+			if sampleable(line) && rand.Float64() >= Config.SamplingRate {
+				return
+			}
+			line = withSampleRate(line, Config.SamplingRate)
+		case QuotaActionDivert:
+			if Config.OverflowTopic != "" {
+				s.enqueue(Config.OverflowTopic, line)
+			}
+			return
+		default:
+			return
 		}
-	}()
+	}
+
+	if topic, exists := s.typeTopics[metricType(line)]; exists {
+		s.enqueue(topic, line)
+	} else {
+		s.routingLock.RLock()
+		destinations := s.destinations
+		s.routingLock.RUnlock()
+		for _, destination := range destinations {
+			if destination.Matches(name) {
+				s.enqueue(destination.Topic, line)
+			}
+		}
+	}
+
+	if s.dualWrite.active() {
+		s.shards[shardFor(line, len(s.shards))].enqueue(&metricRecord{topic: s.dualWrite.Topic, line: line, received: time.Now(), dual: true})
+	}
+}
+
+func (s *StatsDServer) enqueue(topic string, line string) {
+	if s.gauges.enabled() && metricType(line) == MetricGauge {
+		s.gauges.Seen(metricName(line), topic)
+	}
+	s.shards[shardFor(line, len(s.shards))].enqueue(&metricRecord{topic: topic, line: line, received: time.Now()})
+}
+
+func (s *StatsDServer) watchOccupancy() {
+	ticker := time.NewTicker(samplerCheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if s.isClosed() {
+			return
+		}
+
+		s.sampler.Update(s.occupancy(), s.topMetrics.Top(topKReported))
+	}
+}
+
+// expireGauges produces an expiry marker to every topic a gauge went to once it stops reporting for the gauge ttl,
+// so consumers can tell a gauge that is gone from one that still reports its last value.
+func (s *StatsDServer) expireGauges() {
+	defer s.senders.Done()
+	ticker := time.NewTicker(gaugeExpiryCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopped:
+			return
+		case <-ticker.C:
+		}
+
+		for name, topics := range s.gauges.Expire() {
+			line := gaugeExpiry(name)
+			for _, topic := range topics {
+				s.shards[shardFor(line, len(s.shards))].enqueue(&metricRecord{topic: topic, line: line, received: time.Now()})
+			}
+		}
+	}
+}
+
+// failing tells whether any shard producer failed at least threshold produce requests in a row.
+func (s *StatsDServer) failing(threshold int64) bool {
+	for _, shard := range s.shards {
+		if atomic.LoadInt64(&shard.consecutiveFailures) >= threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceProducers makes shards use new producers, e.g. to reconnect to Kafka.
+func (s *StatsDServer) replaceProducers(producers []*producer.KafkaProducer) {
+	for i, shard := range s.shards {
+		shard.replaceProducer(producers[i])
+	}
+}
+
+// setDestinations makes the server route metrics to new destinations, e.g. after the topic changed.
+func (s *StatsDServer) setDestinations(destinations []*Destination) {
+	s.routingLock.Lock()
+	defer s.routingLock.Unlock()
+
+	s.destinations = destinations
+}
+
+// setTransform makes the server encode records not produced yet with another transform.
+func (s *StatsDServer) setTransform(transform func(string, string) interface{}, serializer func(string, interface{}) ([]byte, error), validator func([]byte) error) {
+	s.routingLock.Lock()
+	defer s.routingLock.Unlock()
+
+	s.transform = transform
+	s.serializer = serializer
+	s.validator = validator
+}
+
+// occupancy returns the highest queue occupancy (0..1) among shards.
+func (s *StatsDServer) occupancy() float64 {
+	occupancy := 0.0
+	for _, shard := range s.shards {
+		if shardOccupancy := shard.occupancy(); shardOccupancy > occupancy {
+			occupancy = shardOccupancy
+		}
+	}
+	return occupancy
+}
+
+func (s *StatsDServer) encode(record *metricRecord) ([]byte, error) {
+	if record.dual {
+		return s.dualWrite.encode(record.line, s.host)
+	}
+
+	s.routingLock.RLock()
+	transform, serializer, validator := s.transform, s.serializer, s.validator
+	s.routingLock.RUnlock()
+
+	value, err := serializer(record.topic, transform(record.line, s.host))
+	if err != nil {
+		return nil, err
+	}
+
+	if Config.Validate && validator != nil {
+		if err := validator(value); err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
+
+func (s *StatsDServer) startProducer() {
+	var wg sync.WaitGroup
+	for _, shard := range s.shards {
+		wg.Add(1)
+		go func(shard *producerShard) {
+			defer wg.Done()
 
-	for message := range s.incoming {
-		s.producer.Send(&producer.ProducerRecord{Topic: Config.Topic, Value: s.transform(message, s.host)})
+			shard.start(s.encode, s.host)
+		}(shard)
 	}
+	wg.Wait()
 }
@@ -0,0 +1,104 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"sort"
+
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+// ClusterStatus is the structured result of /api/status.
+type ClusterStatus struct {
+	Servers       []*ServerStatus
+	Evacuated     []string `json:",omitempty"`
+	Whitelist     []string `json:",omitempty"`
+	Blacklist     []string `json:",omitempty"`
+	ConfigVersion int
+	ConfigError   string `json:",omitempty"` // no tasks are launched until the config gets updated
+	QueuedUpdates int    `json:",omitempty"` // updates made while stopped, applied on start
+}
+
+// ServerStatus describes a server task and the config it was launched with.
+type ServerStatus struct {
+	Host       string
+	TaskId     string
+	SlaveId    string
+	State      string // starting, reporting or migrating
+	Cpus       float64
+	Mem        float64
+	StatsdPort uint64
+	AdminPort  uint64
+	Standby    string         `json:",omitempty"` // task id of the standby task on the host
+	Config     *TaskData      `json:",omitempty"`
+	Stats      *ExecutorStats `json:",omitempty"`
+	Usage      *ResourceUsage `json:",omitempty"`
+}
+
+func (s *Scheduler) serverStatus(host string, task *mesos.TaskInfo) *ServerStatus {
+	status := &ServerStatus{
+		Host:       host,
+		TaskId:     task.GetTaskId().GetValue(),
+		SlaveId:    task.GetSlaveId().GetValue(),
+		State:      s.serverState(host),
+		StatsdPort: taskStatsdPort(task),
+		AdminPort:  taskPort(task),
+		Stats:      s.cluster.GetStats(host),
+		Usage:      s.usages.Get(host),
+	}
+	for _, resource := range task.GetResources() {
+		switch resource.GetName() {
+		case "cpus":
+			status.Cpus += resource.GetScalar().GetValue()
+		case "mem":
+			status.Mem += resource.GetScalar().GetValue()
+		}
+	}
+	if standby := s.cluster.GetStandby(host); standby != nil {
+		status.Standby = standby.GetTaskId().GetValue()
+	}
+	if taskData, err := ParseTaskData(task.GetData()); err == nil {
+		status.Config = taskData
+	}
+	return status
+}
+
+func (s *Scheduler) clusterStatus() *ClusterStatus {
+	tasks := s.cluster.GetTasksByHost()
+	hosts := make([]string, 0, len(tasks))
+	for host := range tasks {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	s.activeLock.Lock()
+	version := s.configVersion
+	s.activeLock.Unlock()
+
+	status := &ClusterStatus{
+		Servers:       make([]*ServerStatus, 0, len(hosts)),
+		Evacuated:     s.evacuated.List(),
+		Whitelist:     s.hosts.Snapshot(HostWhitelist),
+		Blacklist:     s.hosts.Snapshot(HostBlacklist),
+		ConfigVersion: version,
+		ConfigError:   s.ConfigError(),
+		QueuedUpdates: s.queuedUpdateCount(),
+	}
+	for _, host := range hosts {
+		status.Servers = append(status.Servers, s.serverStatus(host, tasks[host]))
+	}
+	return status
+}
@@ -0,0 +1,99 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+	"github.com/mesos/mesos-go/scheduler"
+)
+
+// suppressRefuseSeconds is how long offers are refused once nothing more needs to be launched. Mesos drops the filters
+// when offers are revived, so launching resumes right away when needed.
+var suppressRefuseSeconds = 3600.0
+
+// offerSuppression tracks whether offers are refused with long filters, as this driver has no SuppressOffers call.
+type offerSuppression struct {
+	suppressed bool
+	mismatched bool // offers of some hosts are refused for the mismatch refuse seconds
+	lock       sync.Mutex
+}
+
+// atDesiredSize tells whether all instances and standby tasks are running, so offers are of no use. Without an
+// instances limit every new agent may get a server, so offers are always needed while active. Offers are needed as
+// well while a higher priority host may preempt a running server.
+func (s *Scheduler) atDesiredSize() bool {
+	if s.config.Instances == InstancesUnlimited || s.belowInstances() || s.mayPreempt() {
+		return false
+	}
+
+	standby := s.config.Standby
+	if running := len(s.cluster.GetTasksByHost()); standby > running {
+		standby = running
+	}
+	return s.cluster.StandbyCount() >= standby
+}
+
+// suppressOffers declines offers for a long time. Called from ResourceOffers with active lock held.
+func (s *Scheduler) suppressOffers(driver scheduler.SchedulerDriver, offers []*mesos.Offer) {
+	s.suppression.lock.Lock()
+	if !s.suppression.suppressed {
+		s.logger.Infof("Nothing to launch, refusing offers for %.0fs until revived", suppressRefuseSeconds)
+		s.suppression.suppressed = true
+	}
+	s.suppression.lock.Unlock()
+
+	for _, offer := range offers {
+		driver.DeclineOffer(offer.GetId(), &mesos.Filters{RefuseSeconds: proto.Float64(suppressRefuseSeconds)})
+	}
+}
+
+// refuseSeconds returns how long to refuse a declined offer. Offers of hosts servers may not run on, as they are
+// blacklisted, evacuated or don't match constraints, are refused longer than offers lacking resources for now.
+// Reviving offers drops the filters, so hosts matching after a config, host list or placement change are offered again.
+func (s *Scheduler) refuseSeconds(offer *mesos.Offer) float64 {
+	host := offer.GetHostname()
+	if s.hosts.Check(host) == nil && !s.evacuated.Contains(host) && s.checkConstraints(offer) == nil {
+		return s.config.RefuseSeconds
+	}
+
+	s.suppression.lock.Lock()
+	s.suppression.mismatched = true
+	s.suppression.lock.Unlock()
+	return s.config.MismatchSeconds
+}
+
+// reviveOffers asks for offers again if they were suppressed or refused as mismatching, e.g. after scaling up, a
+// config change or a failure.
+func (s *Scheduler) reviveOffers(reason string) {
+	s.suppression.lock.Lock()
+	defer s.suppression.lock.Unlock()
+
+	driver := s.currentDriver()
+	if !(s.suppression.suppressed || s.suppression.mismatched) || driver == nil {
+		return
+	}
+
+	s.logger.Infof("Reviving offers: %s", reason)
+	if _, err := driver.ReviveOffers(); err != nil {
+		s.logger.Warnf("Failed to revive offers: %s", err)
+		return
+	}
+	s.suppression.suppressed = false
+	s.suppression.mismatched = false
+}
@@ -0,0 +1,329 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mesos/mesos-go/executor"
+	mesos "github.com/mesos/mesos-go/mesosproto"
+)
+
+const (
+	defaultTapRate = 10
+	maxTapRate     = 1000
+)
+
+var (
+	// tapLease is how long an executor keeps tapping without hearing from the scheduler again, so taps of a
+	// scheduler that went away end on their own.
+	tapLease = 30 * time.Second
+	// tapFlushInterval is how often executors send the lines tapped meanwhile.
+	tapFlushInterval = time.Second
+)
+
+// TapRequest asks an executor to send received lines with names matching Match, at most Rate per second, until the
+// unix time Until. Sent again with a later Until to renew the tap, Until 0 ends it.
+type TapRequest struct {
+	Id    string
+	Match string `json:",omitempty"`
+	Rate  int    `json:",omitempty"`
+	Until int64  `json:",omitempty"`
+}
+
+// metricTap collects lines for a tap on the executor.
+type metricTap struct {
+	match  *regexp.Regexp
+	rate   int
+	until  time.Time
+	second int64 // unix second the lines were counted in
+	count  int   // lines tapped in that second
+	lines  []string
+	lock   sync.Mutex
+}
+
+func (t *metricTap) offer(name string, line string) {
+	if !t.match.MatchString(name) {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := time.Now().Unix()
+	if now != t.second {
+		t.second = now
+		t.count = 0
+	}
+	if t.count >= t.rate {
+		return
+	}
+	t.count++
+	t.lines = append(t.lines, line)
+}
+
+func (t *metricTap) update(match *regexp.Regexp, rate int, until time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.match = match
+	t.rate = rate
+	t.until = until
+}
+
+// take returns the lines tapped since the last call and whether the tap is still leased.
+func (t *metricTap) take() ([]string, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	lines := t.lines
+	t.lines = nil
+	return lines, time.Now().Before(t.until)
+}
+
+// tap offers a received line to the active taps.
+func (s *StatsDServer) tap(name string, line string) {
+	if atomic.LoadInt32(&s.tapping) == 0 {
+		return
+	}
+
+	s.tapLock.RLock()
+	defer s.tapLock.RUnlock()
+	for _, tap := range s.taps {
+		tap.offer(name, line)
+	}
+}
+
+// startTap adds or renews the tap. Returns the tap if it was added.
+func (s *StatsDServer) startTap(request *TapRequest) (*metricTap, error) {
+	match, err := regexp.Compile(request.Match)
+	if err != nil {
+		return nil, err
+	}
+
+	s.tapLock.Lock()
+	defer s.tapLock.Unlock()
+
+	until := time.Unix(request.Until, 0)
+	if tap, exists := s.taps[request.Id]; exists {
+		tap.update(match, request.Rate, until)
+		return nil, nil
+	}
+
+	tap := &metricTap{match: match, rate: request.Rate, until: until}
+	s.taps[request.Id] = tap
+	atomic.StoreInt32(&s.tapping, int32(len(s.taps)))
+	return tap, nil
+}
+
+func (s *StatsDServer) stopTap(id string) {
+	s.tapLock.Lock()
+	defer s.tapLock.Unlock()
+
+	delete(s.taps, id)
+	atomic.StoreInt32(&s.tapping, int32(len(s.taps)))
+}
+
+// tap starts, renews or ends a tap of the running server as requested by the scheduler.
+func (e *Executor) tap(driver executor.ExecutorDriver, request *TapRequest) {
+	server := e.runningServer()
+	if request == nil || server == nil {
+		return
+	}
+
+	if request.Until == 0 {
+		server.stopTap(request.Id)
+		return
+	}
+
+	tap, err := server.startTap(request)
+	if err != nil {
+		Logger.Warnf("Failed to start tap %s: %s", request.Id, err)
+		return
+	}
+	if tap != nil {
+		go e.streamTap(driver, server, request.Id, tap)
+	}
+}
+
+// streamTap sends the tapped lines to the scheduler until the tap ends, its lease expires or the server stops.
+func (e *Executor) streamTap(driver executor.ExecutorDriver, server *StatsDServer, id string, tap *metricTap) {
+	defer server.stopTap(id)
+
+	ticker := time.NewTicker(tapFlushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		lines, leased := tap.take()
+		if len(lines) > 0 {
+			if _, err := driver.SendFrameworkMessage(NewTappedMessage(e.Host, id, lines).String()); err != nil {
+				Logger.Warnf("Failed to send tapped lines: %s", err)
+			}
+		}
+
+		server.tapLock.RLock()
+		_, active := server.taps[id]
+		server.tapLock.RUnlock()
+		if !active || !leased || server.isClosed() {
+			return
+		}
+	}
+}
+
+// tapStreams hands lines tapped by executors to the API requests they were tapped for.
+type tapStreams struct {
+	streams map[string]*TapStream
+	lock    sync.Mutex
+}
+
+func newTapStreams() *tapStreams {
+	return &tapStreams{streams: make(map[string]*TapStream)}
+}
+
+// deliver passes the lines on unless the stream is gone or the reader falls behind, dropping them then.
+func (t *tapStreams) deliver(id string, lines []string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if stream, exists := t.streams[id]; exists {
+		select {
+		case stream.Lines <- lines:
+		default:
+		}
+	}
+}
+
+// TapStream receives the lines tapped on a host until it is closed or the server there stops.
+type TapStream struct {
+	Lines chan []string
+
+	id      string
+	host    string
+	request *TapRequest
+	task    *mesos.TaskInfo
+	sched   *Scheduler
+	err     error
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Tap makes the server on the host send a sample of the lines it receives with names matching the regex, at most
+// rate lines per second, until the returned stream is closed.
+func (s *Scheduler) Tap(host string, match string, rate int) (*TapStream, error) {
+	if _, err := regexp.Compile(match); err != nil {
+		return nil, fmt.Errorf("Invalid match: %s", err)
+	}
+	if rate <= 0 || rate > maxTapRate {
+		return nil, fmt.Errorf("Rate %d must be positive and at most %d", rate, maxTapRate)
+	}
+	if s.currentDriver() == nil {
+		return nil, newError(ErrNotActive, "Scheduler is not registered")
+	}
+	task := s.cluster.GetTasksByHost()[host]
+	if task == nil {
+		return nil, newError(ErrHostNotFound, "No server running on host %s", host)
+	}
+
+	stream := &TapStream{
+		Lines:   make(chan []string, 16),
+		id:      fmt.Sprintf("%s-%d", host, time.Now().UnixNano()),
+		host:    host,
+		request: &TapRequest{Match: match, Rate: rate},
+		task:    task,
+		sched:   s,
+		done:    make(chan struct{}),
+	}
+	stream.request.Id = stream.id
+
+	s.taps.lock.Lock()
+	s.taps.streams[stream.id] = stream
+	s.taps.lock.Unlock()
+
+	if err := stream.send(time.Now().Add(tapLease)); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	go stream.renew()
+	return stream, nil
+}
+
+func (t *TapStream) send(until time.Time) error {
+	request := *t.request
+	if !until.IsZero() {
+		request.Until = until.Unix()
+	}
+
+	message := NewTapMessage(&request).String()
+	driver := t.sched.currentDriver()
+	if driver == nil {
+		return errors.New("scheduler is disconnected from master")
+	}
+	_, err := driver.SendFrameworkMessage(t.task.GetExecutor().GetExecutorId(), t.task.GetSlaveId(), message)
+	return err
+}
+
+// renew extends the lease of the tap while the stream is open and ends the stream once the server stops.
+func (t *TapStream) renew() {
+	ticker := time.NewTicker(tapLease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		}
+
+		task := t.sched.cluster.GetTasksByHost()[t.host]
+		if task == nil || task.GetTaskId().GetValue() != t.task.GetTaskId().GetValue() {
+			t.close(errors.New("server stopped"))
+			return
+		}
+		if err := t.send(time.Now().Add(tapLease)); err != nil {
+			t.sched.logger.Warnf("Failed to renew tap on %s: %s", t.host, err)
+		}
+	}
+}
+
+// Err tells why the stream ended on its own, once Lines is closed.
+func (t *TapStream) Err() error {
+	return t.err
+}
+
+// Close ends the tap on the executor.
+func (t *TapStream) Close() {
+	t.close(nil)
+}
+
+func (t *TapStream) close(err error) {
+	t.once.Do(func() {
+		t.sched.taps.lock.Lock()
+		delete(t.sched.taps.streams, t.id)
+		t.err = err
+		close(t.Lines)
+		t.sched.taps.lock.Unlock()
+
+		close(t.done)
+		if err := t.send(time.Time{}); err != nil {
+			t.sched.logger.Warnf("Failed to end tap on %s: %s", t.host, err)
+		}
+	})
+}
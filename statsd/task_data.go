@@ -0,0 +1,185 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	// taskDataVersion is the task data version written by this scheduler and fully understood by this executor.
+	// Bump it when adding fields. Unknown fields are ignored, so executors can read data of newer versions.
+	taskDataVersion = 13
+	// taskDataMinVersion is the oldest executor version able to run with task data written by this scheduler.
+	// Bump it only for incompatible changes, e.g. when a field changes its meaning.
+	taskDataMinVersion = 1
+)
+
+// TaskData is the configuration passed from the scheduler to executors in TaskInfo data.
+// Task data without Version was written by schedulers passing the whole scheduler configuration and reads as version 0.
+type TaskData struct {
+	Version    int
+	MinVersion int
+
+	ProducerProperties string
+	BrokerList         string
+	BrokerDnsTtl       time.Duration
+	Producers          int
+	SamplingThreshold  float64
+	SamplingRate       float64
+	MemorySoftLimit    float64 // since version 8
+	Quotas             string
+	QuotaAction        string
+	OverflowTopic      string
+	Validate           bool
+	Tcp                bool
+	TcpErrors          bool
+	DeadLetterTopic    string
+	ProduceTimeout     time.Duration // since version 2
+	LatencyBudget      time.Duration // since version 2
+	GaugeTtl           time.Duration // since version 4
+	KillGracePeriod    time.Duration // since version 9
+	QueueSize          int           // since version 11
+	BurstSize          int           // since version 11
+	BurstDuration      time.Duration // since version 11
+	LogTopic           string        // since version 12
+	LogTopicLevel      string        // since version 12
+	LogTopicRate       int           // since version 12
+	Topic              string
+	Destinations       string
+	DestSampling       string // since version 5
+	TypeTopics         string // since version 3
+	Transform          string
+	DualWriteTransform string    // since version 2
+	DualWriteTopic     string    // since version 2
+	DualWriteUntil     time.Time // since version 2
+	SchemaRegistryUrl  string
+	Namespace          string
+	LogLevel           string
+	StatsdPort         uint64        // since version 6, set per task
+	BufferPath         string        // since version 7, set per task
+	BufferMaxSize      float64       // since version 13
+	BufferMaxAge       time.Duration // since version 13
+	DiscoveryFile      string        // since version 10
+}
+
+func NewTaskData(c *config) *TaskData {
+	return &TaskData{
+		Version:            taskDataVersion,
+		MinVersion:         taskDataMinVersion,
+		ProducerProperties: c.ProducerProperties,
+		BrokerList:         c.BrokerList,
+		BrokerDnsTtl:       c.BrokerDnsTtl,
+		Producers:          c.Producers,
+		SamplingThreshold:  c.SamplingThreshold,
+		SamplingRate:       c.SamplingRate,
+		MemorySoftLimit:    c.MemorySoftLimit,
+		Quotas:             c.Quotas,
+		QuotaAction:        c.QuotaAction,
+		OverflowTopic:      c.OverflowTopic,
+		Validate:           c.Validate,
+		Tcp:                c.Tcp,
+		TcpErrors:          c.TcpErrors,
+		DeadLetterTopic:    c.DeadLetterTopic,
+		ProduceTimeout:     c.ProduceTimeout,
+		LatencyBudget:      c.LatencyBudget,
+		GaugeTtl:           c.GaugeTtl,
+		KillGracePeriod:    c.KillGracePeriod,
+		QueueSize:          c.QueueSize,
+		BurstSize:          c.BurstSize,
+		BurstDuration:      c.BurstDuration,
+		LogTopic:           c.LogTopic,
+		LogTopicLevel:      c.LogTopicLevel,
+		LogTopicRate:       c.LogTopicRate,
+		Topic:              c.Topic,
+		Destinations:       c.Destinations,
+		DestSampling:       c.DestSampling,
+		TypeTopics:         c.TypeTopics,
+		Transform:          c.Transform,
+		DualWriteTransform: c.DualWriteTransform,
+		DualWriteTopic:     c.DualWriteTopic,
+		DualWriteUntil:     c.DualWriteUntil,
+		SchemaRegistryUrl:  c.SchemaRegistryUrl,
+		Namespace:          c.Namespace,
+		LogLevel:           c.LogLevel,
+		BufferMaxSize:      c.BufferMaxSize,
+		BufferMaxAge:       c.BufferMaxAge,
+		DiscoveryFile:      c.DiscoveryFile,
+	}
+}
+
+// ParseTaskData reads task data of any version this executor is compatible with.
+func ParseTaskData(data []byte) (*TaskData, error) {
+	taskData := new(TaskData)
+	if err := json.Unmarshal(data, taskData); err != nil {
+		return nil, fmt.Errorf("Invalid task data: %s", err)
+	}
+
+	if taskData.MinVersion > taskDataVersion {
+		return nil, fmt.Errorf("Task data version %d requires executor supporting version %d, this executor supports version %d",
+			taskData.Version, taskData.MinVersion, taskDataVersion)
+	}
+	if taskData.Version > taskDataVersion {
+		Logger.Infof("Task data version %d is newer than supported version %d, ignoring unknown settings", taskData.Version, taskDataVersion)
+	}
+
+	return taskData, nil
+}
+
+func (d *TaskData) apply(c *config) {
+	c.ProducerProperties = d.ProducerProperties
+	c.BrokerList = d.BrokerList
+	c.BrokerDnsTtl = d.BrokerDnsTtl
+	c.Producers = d.Producers
+	c.SamplingThreshold = d.SamplingThreshold
+	c.SamplingRate = d.SamplingRate
+	c.MemorySoftLimit = d.MemorySoftLimit
+	c.Quotas = d.Quotas
+	c.QuotaAction = d.QuotaAction
+	c.OverflowTopic = d.OverflowTopic
+	c.Validate = d.Validate
+	c.Tcp = d.Tcp
+	c.TcpErrors = d.TcpErrors
+	c.DeadLetterTopic = d.DeadLetterTopic
+	c.ProduceTimeout = d.ProduceTimeout
+	c.LatencyBudget = d.LatencyBudget
+	c.GaugeTtl = d.GaugeTtl
+	c.KillGracePeriod = d.KillGracePeriod
+	c.QueueSize = d.QueueSize
+	c.BurstSize = d.BurstSize
+	c.BurstDuration = d.BurstDuration
+	c.LogTopic = d.LogTopic
+	c.LogTopicLevel = d.LogTopicLevel
+	c.LogTopicRate = d.LogTopicRate
+	c.Topic = d.Topic
+	c.Destinations = d.Destinations
+	c.DestSampling = d.DestSampling
+	c.TypeTopics = d.TypeTopics
+	c.Transform = d.Transform
+	c.DualWriteTransform = d.DualWriteTransform
+	c.DualWriteTopic = d.DualWriteTopic
+	c.DualWriteUntil = d.DualWriteUntil
+	c.SchemaRegistryUrl = d.SchemaRegistryUrl
+	c.Namespace = d.Namespace
+	c.LogLevel = d.LogLevel
+	c.StatsdPort = d.StatsdPort
+	c.BufferPath = d.BufferPath
+	c.BufferMaxSize = d.BufferMaxSize
+	c.BufferMaxAge = d.BufferMaxAge
+	c.DiscoveryFile = d.DiscoveryFile
+}
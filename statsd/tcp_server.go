@@ -0,0 +1,112 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"bufio"
+	"net"
+	"time"
+)
+
+const (
+	backpressureHigh = 0.9 // queue occupancy at which TCP clients stop being read
+	backpressureLow  = 0.5 // queue occupancy at which reading resumes
+)
+
+var backpressureCheckInterval = 10 * time.Millisecond
+
+const backpressureError = "ERR buffers full, slow down\n"
+
+func (s *StatsDServer) startTCPServer() {
+	Logger.Debugf("Starting StatsD TCP server at %s", s.addr)
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		panic(err)
+	}
+	s.listener = listener
+
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				if !s.isClosed() {
+					Logger.Warnf("Failed to accept TCP connection: %s", err)
+				}
+				return
+			}
+
+			if !s.trackConnection(connection) {
+				connection.Close()
+				return
+			}
+			go s.serveTCP(connection)
+		}
+	}()
+	Logger.Infof("Listening for messages at TCP %s", s.addr)
+}
+
+// serveTCP reads lines from a client. While queues are saturated the connection is not read, so the client's writes
+// block once socket buffers fill up instead of metrics being dropped.
+func (s *StatsDServer) serveTCP(connection net.Conn) {
+	defer s.untrackConnection(connection)
+	defer connection.Close()
+
+	scanner := bufio.NewScanner(connection)
+	for scanner.Scan() {
+		if s.occupancy() >= backpressureHigh {
+			if Config.TcpErrors {
+				connection.Write([]byte(backpressureError))
+			}
+			if !s.awaitCapacity() {
+				return
+			}
+		}
+
+		s.handle(scanner.Text())
+	}
+}
+
+// awaitCapacity blocks until queue occupancy drops below the low watermark. Returns false if the server was stopped.
+func (s *StatsDServer) awaitCapacity() bool {
+	for s.occupancy() >= backpressureLow {
+		if s.isClosed() {
+			return false
+		}
+		time.Sleep(backpressureCheckInterval)
+	}
+
+	return !s.isClosed()
+}
+
+func (s *StatsDServer) trackConnection(connection net.Conn) bool {
+	s.closeLock.Lock()
+	defer s.closeLock.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.connections[connection] = struct{}{}
+	s.senders.Add(1)
+	return true
+}
+
+func (s *StatsDServer) untrackConnection(connection net.Conn) {
+	s.closeLock.Lock()
+	defer s.closeLock.Unlock()
+
+	delete(s.connections, connection)
+	s.senders.Done()
+}
@@ -0,0 +1,120 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// teardownTokenTtl is how long a confirmation token issued for teardown stays valid.
+var teardownTokenTtl = time.Minute
+
+var teardownTimeout = time.Minute
+
+// unregisterDelay gives the teardown response time to reach the client before the scheduler exits.
+var unregisterDelay = time.Second
+
+// teardownConfirmation is the token a teardown request must repeat, so the framework is never torn down by accident.
+type teardownConfirmation struct {
+	token   string
+	expires time.Time
+	lock    sync.Mutex
+}
+
+// issue returns a new token invalidating the previous one.
+func (c *teardownConfirmation) issue() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.token = uuid()[:8]
+	c.expires = time.Now().Add(teardownTokenTtl)
+	return c.token
+}
+
+// check consumes the token if it matches.
+func (c *teardownConfirmation) check(token string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.token == "" || token != c.token {
+		return errors.New("Invalid confirmation token, request a new one without confirm")
+	}
+	if time.Now().After(c.expires) {
+		return errors.New("Confirmation token expired, request a new one without confirm")
+	}
+
+	c.token = ""
+	return nil
+}
+
+// Teardown kills all tasks and waits until they are terminal. With unregister the framework is removed from Mesos,
+// the persisted state is cleared and the scheduler exits. Otherwise servers stay stopped until started again. Tasks
+// stay killed if the context is done while waiting, but the framework isn't unregistered.
+func (s *Scheduler) Teardown(ctx context.Context, unregister bool) error {
+	driver := s.currentDriver()
+	if driver == nil {
+		return newError(ErrNotActive, "Scheduler is disconnected from master")
+	}
+
+	tasks := len(s.cluster.GetAllTasks())
+	s.timeline.Add(EventTeardown, "", "", fmt.Sprintf("killing %d tasks, unregister: %t", tasks, unregister))
+	s.SetActive(false)
+
+	deadline := time.Now().Add(teardownTimeout)
+	for len(s.cluster.GetAllTasks()) > 0 {
+		if time.Now().After(deadline) {
+			// unregistering makes the master kill remaining tasks anyway
+			s.logger.Warnf("%d tasks not terminal within %s", len(s.cluster.GetAllTasks()), teardownTimeout)
+			if !unregister {
+				return fmt.Errorf("Tasks were killed but %d didn't stop within %s", len(s.cluster.GetAllTasks()), teardownTimeout)
+			}
+			break
+		}
+		if err := sleepContext(ctx, migrationCheckInterval); err != nil {
+			return fmt.Errorf("Tasks were killed, stopped waiting for them to stop: %s", err)
+		}
+	}
+
+	if !unregister {
+		return nil
+	}
+
+	s.activeLock.Lock()
+	s.tornDown = true
+	s.activeLock.Unlock()
+	if s.storage != nil {
+		if err := s.storage.Save(nil); err != nil {
+			return newError(ErrStateStoreUnavailable, "Failed to clear state: %s", err)
+		}
+	}
+
+	s.timeline.Add(EventTeardown, "", "", fmt.Sprintf("unregistering framework %s", s.frameworkId))
+	s.logger.Infof("Unregistering framework %s", s.frameworkId)
+	time.AfterFunc(unregisterDelay, func() { driver.Stop(false) })
+	return nil
+}
+
+func (s *Scheduler) isTornDown() bool {
+	s.activeLock.Lock()
+	defer s.activeLock.Unlock()
+
+	return s.tornDown
+}
@@ -0,0 +1,220 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	EventRegistered       = "registered"
+	EventDisconnected     = "disconnected"
+	EventStarted          = "started"
+	EventStopped          = "stopped"
+	EventConfigUpdated    = "config-updated"
+	EventLaunched         = "launched"
+	EventTaskStatus       = "task-status"
+	EventOrphanKilled     = "orphan-killed"
+	EventExecutorLost     = "executor-lost"
+	EventSandboxTail      = "sandbox-tail"
+	EventMigration        = "migration"
+	EventStandbyActivated = "standby-activated"
+	EventRotation         = "rotation"
+	EventDualWrite        = "dual-write"
+	EventHandoff          = "handoff"
+	EventScaled           = "scaled"
+	EventDecommission     = "decommission"
+	EventRollout          = "rollout"
+	EventConfigPush       = "config-push"
+	EventTeardown         = "teardown"
+	EventMaintenance      = "maintenance"
+	EventKafkaDrain       = "kafka-drain"
+	EventUnhealthy        = "unhealthy"
+	EventHostLists        = "host-lists"
+	EventLaunchAborted    = "launch-aborted"
+	EventPreempted        = "preempted"
+	EventApiAccess        = "api-access"     // requests of principals scoped to a server group
+	EventOfferDeclined    = "offer-declined" // streamed to subscribers only, too frequent to keep in history
+)
+
+var timelineSize = 1000
+
+type Event struct {
+	Time    time.Time
+	Type    string
+	Host    string        `json:",omitempty"`
+	TaskId  string        `json:",omitempty"`
+	Reason  DeclineReason `json:",omitempty"` // of offer-declined events
+	Message string
+}
+
+func (e *Event) String() string {
+	s := fmt.Sprintf("%s %s", e.Time.Format(time.RFC3339), e.Type)
+	if e.Host != "" {
+		s += " host: " + e.Host
+	}
+	if e.TaskId != "" {
+		s += " task: " + e.TaskId
+	}
+	if e.Message != "" {
+		s += " " + e.Message
+	}
+
+	return s
+}
+
+// Timeline keeps a bounded history of cluster events, dropping the oldest events once full, and passes new events on
+// to subscribers.
+type Timeline struct {
+	events      []*Event
+	size        int
+	subscribers map[chan *Event]struct{}
+	lock        sync.Mutex
+}
+
+func NewTimeline(size int) *Timeline {
+	return &Timeline{
+		events:      make([]*Event, 0),
+		size:        size,
+		subscribers: make(map[chan *Event]struct{}),
+	}
+}
+
+func (t *Timeline) Add(eventType string, host string, taskId string, message string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	event := newEvent(eventType, host, taskId, message)
+	t.events = append(t.events, event)
+	if len(t.events) > t.size {
+		t.events = t.events[len(t.events)-t.size:]
+	}
+	t.notify(event)
+}
+
+// Publish passes an event to subscribers without keeping it in history.
+func (t *Timeline) Publish(eventType string, host string, taskId string, message string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if len(t.subscribers) > 0 {
+		t.notify(newEvent(eventType, host, taskId, message))
+	}
+}
+
+// PublishDeclined passes an offer-declined event with the reason the offer was declined for to subscribers.
+func (t *Timeline) PublishDeclined(host string, reason DeclineReason, message string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if len(t.subscribers) > 0 {
+		event := newEvent(EventOfferDeclined, host, "", message)
+		event.Reason = reason
+		t.notify(event)
+	}
+}
+
+func newEvent(eventType string, host string, taskId string, message string) *Event {
+	return &Event{
+		Time:    time.Now(),
+		Type:    eventType,
+		Host:    host,
+		TaskId:  taskId,
+		Message: message,
+	}
+}
+
+// notify passes the event to subscribers, skipping those falling behind.
+func (t *Timeline) notify(event *Event) {
+	for subscriber := range t.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving events from now on, buffering up to size events, and a func to unsubscribe.
+func (t *Timeline) Subscribe(size int) (<-chan *Event, func()) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	subscriber := make(chan *Event, size)
+	t.subscribers[subscriber] = struct{}{}
+	return subscriber, func() {
+		t.lock.Lock()
+		defer t.lock.Unlock()
+
+		delete(t.subscribers, subscriber)
+	}
+}
+
+// Compact drops events that happened before the given time and keeps at most size events from now on. Returns the
+// number of events dropped.
+func (t *Timeline) Compact(before time.Time, size int) int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.size = size
+	kept := make([]*Event, 0, len(t.events))
+	for _, event := range t.events {
+		if !event.Time.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+	if len(kept) > t.size {
+		kept = kept[len(kept)-t.size:]
+	}
+
+	dropped := len(t.events) - len(kept)
+	t.events = kept
+	return dropped
+}
+
+// Since returns events that happened after the given time, oldest first.
+func (t *Timeline) Since(since time.Time) []*Event {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	events := make([]*Event, 0)
+	for _, event := range t.events {
+		if event.Time.After(since) {
+			events = append(events, event)
+		}
+	}
+
+	return events
+}
+
+// parseSince accepts either RFC3339 time or unix seconds. Empty value means the beginning of history.
+func parseSince(value string) (time.Time, error) {
+	if value == "" {
+		return time.Unix(0, 0), nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return since, fmt.Errorf("Invalid time %s, expected RFC3339 time or unix seconds", value)
+	}
+	return since, nil
+}
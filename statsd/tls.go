@@ -0,0 +1,77 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiTls returns the TLS config the API is served with, nil if no certificate is configured.
+func (c *config) apiTls() (*tls.Config, error) {
+	if c.ApiTlsCert == "" && c.ApiTlsKey == "" {
+		return nil, nil
+	}
+	if c.ApiTlsCert == "" || c.ApiTlsKey == "" {
+		return nil, fmt.Errorf("--api.tls.cert and --api.tls.key must be set together")
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.ApiTlsCert, c.ApiTlsKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load API certificate: %s", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{certificate}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// localApiClient returns a client for requests of the scheduler to its own API on the loopback address. With TLS it
+// trusts the configured certificate and verifies it for the advertised API host instead of the loopback address.
+func (c *config) localApiClient() (*http.Client, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	if c.ApiTlsCert == "" {
+		return client, nil
+	}
+
+	pem, err := ioutil.ReadFile(c.ApiTlsCert)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read API certificate: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("No certificates found in %s", c.ApiTlsCert)
+	}
+
+	host := strings.TrimPrefix(strings.TrimPrefix(c.Api, "http://"), "https://")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, ServerName: host}}
+	return client, nil
+}
+
+// apiUrl returns the url the API is advertised at, with https if it is served with TLS.
+func (c *config) apiUrl() string {
+	address := strings.TrimPrefix(strings.TrimPrefix(c.Api, "http://"), "https://")
+	if c.ApiTlsCert != "" {
+		return "https://" + address
+	}
+	return "http://" + address
+}
@@ -0,0 +1,128 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+const (
+	topKReported = 10
+	topKCapacity = 100
+)
+
+type MetricCount struct {
+	Name  string
+	Count int64
+	Error int64 // upper bound of overestimation of Count
+}
+
+// TopK keeps an approximate list of the most frequent metric names using the Space-Saving algorithm.
+// At most capacity names are tracked; a new name evicts the least frequent one and inherits its count.
+// Counters are kept in a min-heap by count, so counting and evicting take O(log capacity).
+type TopK struct {
+	capacity int
+	counters map[string]*topKCounter
+	byCount  topKHeap
+	lock     sync.Mutex
+}
+
+type topKCounter struct {
+	MetricCount
+	index int // position in the heap
+}
+
+func NewTopK(capacity int) *TopK {
+	return &TopK{
+		capacity: capacity,
+		counters: make(map[string]*topKCounter),
+	}
+}
+
+func (t *TopK) Add(name string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if counter, exists := t.counters[name]; exists {
+		counter.Count++
+		heap.Fix(&t.byCount, counter.index)
+		return
+	}
+
+	if len(t.counters) < t.capacity {
+		counter := &topKCounter{MetricCount: MetricCount{Name: name, Count: 1}}
+		t.counters[name] = counter
+		heap.Push(&t.byCount, counter)
+		return
+	}
+
+	min := t.byCount[0]
+	delete(t.counters, min.Name)
+	min.Name, min.Error = name, min.Count
+	min.Count++
+	t.counters[name] = min
+	heap.Fix(&t.byCount, 0)
+}
+
+// Top returns up to k most frequent names ordered by descending count.
+func (t *TopK) Top(k int) []*MetricCount {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	counts := make([]*MetricCount, 0, len(t.counters))
+	for _, counter := range t.counters {
+		metricCount := counter.MetricCount
+		counts = append(counts, &metricCount)
+	}
+	sort.Sort(byCount(counts))
+
+	if len(counts) > k {
+		counts = counts[:k]
+	}
+	return counts
+}
+
+type byCount []*MetricCount
+
+func (c byCount) Len() int           { return len(c) }
+func (c byCount) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byCount) Less(i, j int) bool { return c[i].Count > c[j].Count }
+
+// topKHeap orders counters by ascending count for container/heap, the least frequent first.
+type topKHeap []*topKCounter
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h topKHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *topKHeap) Push(x interface{}) {
+	counter := x.(*topKCounter)
+	counter.index = len(*h)
+	*h = append(*h, counter)
+}
+
+func (h *topKHeap) Pop() interface{} {
+	old := *h
+	counter := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return counter
+}
@@ -0,0 +1,118 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTopKCountsExactlyWithinCapacity(t *testing.T) {
+	topK := NewTopK(3)
+	for name, count := range map[string]int{"a": 5, "b": 3, "c": 1} {
+		for i := 0; i < count; i++ {
+			topK.Add(name)
+		}
+	}
+
+	top := topK.Top(3)
+	expected := []MetricCount{{Name: "a", Count: 5}, {Name: "b", Count: 3}, {Name: "c", Count: 1}}
+	if len(top) != len(expected) {
+		t.Fatalf("expected %d names, got %d", len(expected), len(top))
+	}
+	for i, count := range expected {
+		if *top[i] != count {
+			t.Errorf("expected %+v at %d, got %+v", count, i, *top[i])
+		}
+	}
+}
+
+func TestTopKEvictionErrorBounds(t *testing.T) {
+	tests := []struct {
+		name     string
+		capacity int
+		streams  map[string]int // occurrences per name
+		heavy    []string       // names frequent enough to be guaranteed to be tracked
+	}{
+		{"one heavy hitter", 4, map[string]int{"heavy": 500, "n1": 20, "n2": 20, "n3": 20, "n4": 20, "n5": 20, "n6": 20}, []string{"heavy"}},
+		{"two heavy hitters", 5, map[string]int{"h1": 300, "h2": 200, "n1": 10, "n2": 10, "n3": 10, "n4": 10, "n5": 10, "n6": 10, "n7": 10}, []string{"h1", "h2"}},
+		{"long tail", 10, longTail(200, 3), nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topK := NewTopK(test.capacity)
+			total := 0
+			// interleave names so evictions happen throughout the stream
+			for remaining := true; remaining; {
+				remaining = false
+				for name, count := range test.streams {
+					if count > 0 {
+						topK.Add(name)
+						test.streams[name] = count - 1
+						total++
+						remaining = true
+					}
+				}
+			}
+
+			tracked := make(map[string]*MetricCount)
+			for _, counter := range topK.Top(test.capacity) {
+				tracked[counter.Name] = counter
+			}
+			if len(tracked) > test.capacity {
+				t.Fatalf("tracking %d names over capacity %d", len(tracked), test.capacity)
+			}
+			for _, counter := range tracked {
+				if counter.Error > int64(total/test.capacity) {
+					t.Errorf("%s: error %d over the bound total/capacity %d", counter.Name, counter.Error, total/test.capacity)
+				}
+				if counter.Count-counter.Error < 0 {
+					t.Errorf("%s: count %d with error %d", counter.Name, counter.Count, counter.Error)
+				}
+			}
+			for _, name := range test.heavy {
+				if tracked[name] == nil {
+					t.Errorf("heavy hitter %s is not tracked", name)
+				}
+			}
+		})
+	}
+}
+
+func TestTopKEvictionBoundsTrueCounts(t *testing.T) {
+	topK := NewTopK(2)
+	stream := []string{"a", "a", "b", "c", "c", "c", "d", "a"}
+	counts := make(map[string]int64)
+	for _, name := range stream {
+		topK.Add(name)
+		counts[name]++
+	}
+
+	for _, counter := range topK.Top(2) {
+		if counter.Count < counts[counter.Name] || counter.Count-counter.Error > counts[counter.Name] {
+			t.Errorf("%s: count %d with error %d doesn't bound the true count %d", counter.Name, counter.Count, counter.Error, counts[counter.Name])
+		}
+	}
+}
+
+func longTail(names int, count int) map[string]int {
+	stream := make(map[string]int)
+	for i := 0; i < names; i++ {
+		stream[fmt.Sprintf("tail.%d", i)] = count
+	}
+	return stream
+}
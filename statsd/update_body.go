@@ -0,0 +1,215 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	producer "github.com/elodina/siesta-producer"
+)
+
+// maxUpdateBody limits JSON update documents, which only hold configuration values.
+const maxUpdateBody = 1 << 20
+
+// knownUpdateParams are the parameters /api/update accepts. JSON bodies may only contain these.
+var knownUpdateParams = map[string]bool{
+	"producer.properties": true, "producer.properties.content": true, "broker.list": true, "broker.dns.ttl": true,
+	"produce.timeout": true, "latency.budget": true, "gauge.ttl": true, "kill.grace.period": true, "queue.size": true,
+	"burst.size": true, "burst.duration": true, "topic": true, "destinations": true, "destination.sampling": true,
+	"type.topics": true, "transform": true, "dual.write.transform": true, "dual.write.topic": true,
+	"dual.write.window": true, "schema.registry.url": true, "resource.overrides": true, "priorities": true,
+	"cpu": true, "mem": true, "host": true, "group": true, "executor.upload": true, "executor.image": true,
+	"container.network": true, "reserve": true, "volume.size": true, "buffer.max.size": true, "buffer.max.age": true,
+	"placement": true, "spread": true, "constraints": true, "standby": true, "instances": true,
+	"health.check.interval": true, "health.check.failures": true, "port": true, "rollout.parallelism": true,
+	"rollout.pause": true, "producers": true, "sampling.threshold": true, "sampling.rate": true,
+	"memory.soft.limit": true, "quotas": true, "quota.action": true, "overflow.topic": true, "validate": true,
+	"tcp": true, "tcp.errors": true, "dead.letter.topic": true, "control.topic": true, "log.topic": true,
+	"log.topic.level": true, "log.topic.rate": true,
+}
+
+// typedUpdateParams are the update parameters holding numbers, booleans or durations by the kind of value expected.
+// Applying an update skips values that don't parse, so they are rejected up front instead of being ignored.
+var typedUpdateParams = map[string]string{
+	"queue.size": "int", "burst.size": "int", "standby": "int", "instances": "int", "health.check.failures": "int",
+	"port": "int", "rollout.parallelism": "int", "producers": "int", "log.topic.rate": "int",
+	"cpu": "float", "mem": "float", "volume.size": "float", "buffer.max.size": "float", "sampling.threshold": "float",
+	"sampling.rate": "float", "memory.soft.limit": "float",
+	"reserve": "bool", "validate": "bool", "tcp": "bool", "tcp.errors": "bool",
+	"broker.dns.ttl": "duration", "produce.timeout": "duration", "latency.budget": "duration", "gauge.ttl": "duration",
+	"kill.grace.period": "duration", "burst.duration": "duration", "dual.write.window": "duration",
+	"health.check.interval": "duration", "rollout.pause": "duration", "buffer.max.age": "duration",
+}
+
+// validateUpdateValues rejects values of typed update parameters that don't parse.
+func validateUpdateValues(queryParams url.Values) error {
+	names := make([]string, 0, len(typedUpdateParams))
+	for name := range typedUpdateParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value := queryParams.Get(name)
+		if value == "" {
+			continue
+		}
+
+		var err error
+		expected := ""
+		switch typedUpdateParams[name] {
+		case "int":
+			_, err = strconv.Atoi(value)
+			expected = "a whole number"
+		case "float":
+			_, err = strconv.ParseFloat(value, 64)
+			expected = "a number"
+		case "bool":
+			_, err = strconv.ParseBool(value)
+			expected = "true or false"
+		case "duration":
+			_, err = time.ParseDuration(value)
+			expected = "a duration, e.g. 10s"
+		}
+		if err != nil {
+			return fmt.Errorf("Invalid %s %s, expected %s", name, value, expected)
+		}
+	}
+	return nil
+}
+
+// storePostedProperties stores producer.properties.content in the artifact dir, named by its checksum, and points
+// producer.properties at the stored file. The content is checked to be readable by the producer first.
+// A dry run stores the content in a temporary file instead, which the returned function removes.
+func (c *config) storePostedProperties(queryParams url.Values, dryRun bool) (func(), error) {
+	content := queryParams.Get("producer.properties.content")
+	if content == "" {
+		return func() {}, nil
+	}
+	if queryParams.Get("producer.properties") != "" {
+		return nil, fmt.Errorf("Only one of producer.properties and producer.properties.content may be given")
+	}
+
+	dir, err := c.artifactDir()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(content))
+	name := fmt.Sprintf("producer-%s.properties", hex.EncodeToString(sum[:])[:12])
+
+	path := filepath.Join(dir, name)
+	if dryRun {
+		path, err = writeTempFile(name, []byte(content))
+	} else {
+		err = writeFileAtomically(path, []byte(content))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to store producer.properties: %s", err)
+	}
+	remove := func() {
+		if dryRun {
+			os.Remove(path)
+		}
+	}
+	if _, err := producer.ProducerConfigFromFile(path); err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("Invalid producer.properties.content: %s", err)
+	}
+
+	queryParams.Del("producer.properties.content")
+	queryParams.Set("producer.properties", path)
+	return remove, nil
+}
+
+// writeTempFile writes data to a new file in the temporary directory, named after the given name.
+func writeTempFile(name string, data []byte) (string, error) {
+	tmp, err := ioutil.TempFile("", name+".")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// updateQuery returns the parameters of an update: the query merged with the JSON object posted as body, if any.
+// Values in the body are strings, numbers or booleans and are handled like the same query parameters.
+func updateQuery(r *http.Request) (url.Values, error) {
+	queryParams := r.URL.Query()
+	if r.Method != http.MethodPost {
+		return queryParams, nil
+	}
+	if contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); contentType != "application/json" {
+		return nil, fmt.Errorf("Unsupported update body %s, expected application/json", r.Header.Get("Content-Type"))
+	}
+
+	decoder := json.NewDecoder(io.LimitReader(r.Body, maxUpdateBody))
+	decoder.UseNumber()
+	body := make(map[string]interface{})
+	if err := decoder.Decode(&body); err != nil {
+		return nil, fmt.Errorf("Invalid update body, expected a JSON object: %s", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("Invalid update body, expected a single JSON object")
+	}
+
+	names := make([]string, 0, len(body))
+	for name := range body {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !knownUpdateParams[name] {
+			return nil, fmt.Errorf("Unknown update parameter %s", name)
+		}
+		if _, exists := queryParams[name]; exists {
+			return nil, fmt.Errorf("Update parameter %s is given in both query and body", name)
+		}
+
+		switch value := body[name].(type) {
+		case string:
+			queryParams.Set(name, value)
+		case json.Number:
+			queryParams.Set(name, value.String())
+		case bool:
+			queryParams.Set(name, strconv.FormatBool(value))
+		default:
+			return nil, fmt.Errorf("Invalid value of update parameter %s, expected a string, number or boolean", name)
+		}
+	}
+	return queryParams, nil
+}
@@ -0,0 +1,185 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testProperties = "bootstrap.servers=kafka-1:9092\nacks=1\n"
+
+func TestUpdateQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		query       string
+		contentType string
+		body        string
+		expected    url.Values
+		err         string
+	}{
+		{"query only", "GET", "topic=metrics", "", "", url.Values{"topic": {"metrics"}}, ""},
+		{"body values", "POST", "dryRun=true", "application/json", `{"topic": "metrics", "instances": 3, "cpu": 0.5, "tcp": true}`,
+			url.Values{"dryRun": {"true"}, "topic": {"metrics"}, "instances": {"3"}, "cpu": {"0.5"}, "tcp": {"true"}}, ""},
+		{"content type with charset", "POST", "", "application/json; charset=utf-8", `{"topic": "metrics"}`, url.Values{"topic": {"metrics"}}, ""},
+		{"unknown key", "POST", "", "application/json", `{"topic": "metrics", "topics": "other"}`, nil, "Unknown update parameter topics"},
+		{"key in query and body", "POST", "topic=a", "application/json", `{"topic": "b"}`, nil, "given in both query and body"},
+		{"nested object", "POST", "", "application/json", `{"topic": {"name": "metrics"}}`, nil, "expected a string, number or boolean"},
+		{"array value", "POST", "", "application/json", `{"topic": ["metrics"]}`, nil, "expected a string, number or boolean"},
+		{"null value", "POST", "", "application/json", `{"topic": null}`, nil, "expected a string, number or boolean"},
+		{"not an object", "POST", "", "application/json", `["topic"]`, nil, "expected a JSON object"},
+		{"two objects", "POST", "", "application/json", `{"topic": "a"} {"topic": "b"}`, nil, "expected a single JSON object"},
+		{"form body", "POST", "", "application/x-www-form-urlencoded", "topic=metrics", nil, "Unsupported update body"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(test.method, "/api/update?"+test.query, strings.NewReader(test.body))
+			if test.contentType != "" {
+				request.Header.Set("Content-Type", test.contentType)
+			}
+
+			params, err := updateQuery(request)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+			if params.Encode() != test.expected.Encode() {
+				t.Errorf("expected %s, got %s", test.expected.Encode(), params.Encode())
+			}
+		})
+	}
+}
+
+func TestValidateUpdateValues(t *testing.T) {
+	tests := []struct {
+		params url.Values
+		valid  bool
+	}{
+		{url.Values{}, true},
+		{url.Values{"topic": {"anything goes"}}, true},
+		{url.Values{"producers": {"4"}, "cpu": {"0.5"}, "tcp": {"true"}, "gauge.ttl": {"5m"}}, true},
+		{url.Values{"producers": {"abc"}}, false},
+		{url.Values{"producers": {"1.5"}}, false},
+		{url.Values{"cpu": {"half"}}, false},
+		{url.Values{"tcp": {"yes"}}, false},
+		{url.Values{"gauge.ttl": {"5"}}, false},
+		{url.Values{"buffer.max.age": {"two days"}}, false},
+	}
+
+	for _, test := range tests {
+		if err := validateUpdateValues(test.params); (err == nil) != test.valid {
+			t.Errorf("%s: expected valid %t, got error %v", test.params.Encode(), test.valid, err)
+		}
+	}
+}
+
+func TestStorePostedProperties(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  url.Values
+		dryRun  bool
+		stored  bool
+		invalid bool
+	}{
+		{"no content", url.Values{"topic": {"metrics"}}, false, false, false},
+		{"content", url.Values{"producer.properties.content": {testProperties}}, false, true, false},
+		{"dry run", url.Values{"producer.properties.content": {testProperties}}, true, false, false},
+		{"invalid content", url.Values{"producer.properties.content": {"acks=all\n"}}, false, false, true},
+		{"invalid content in dry run", url.Values{"producer.properties.content": {"acks=all\n"}}, true, false, true},
+		{"content and path", url.Values{"producer.properties.content": {testProperties}, "producer.properties": {"p"}}, false, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "artifacts")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			if dir, err = filepath.EvalSymlinks(dir); err != nil {
+				t.Fatal(err)
+			}
+			c := NewConfig()
+			c.ArtifactDir = dir
+
+			remove, err := c.storePostedProperties(test.params, test.dryRun)
+			if test.invalid {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				assertArtifacts(t, dir, 0)
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error %s", err)
+			}
+
+			path := test.params.Get("producer.properties")
+			if test.params.Get("producer.properties.content") != "" {
+				t.Error("producer.properties.content is left in the update")
+			}
+			if test.stored || test.dryRun {
+				if content, err := ioutil.ReadFile(path); err != nil || string(content) != testProperties {
+					t.Errorf("producer.properties %s doesn't have the posted content: %v", path, err)
+				}
+			}
+			remove()
+
+			if test.stored {
+				assertArtifacts(t, dir, 1)
+				if name := filepath.Base(path); !strings.HasPrefix(name, "producer-") || filepath.Dir(path) != dir {
+					t.Errorf("properties stored as %s", path)
+				}
+			} else {
+				assertArtifacts(t, dir, 0)
+			}
+			if test.dryRun {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("dry run left %s behind", path)
+				}
+			}
+		})
+	}
+}
+
+func TestStorePostedPropertiesRequiresArtifactDir(t *testing.T) {
+	params := url.Values{"producer.properties.content": {testProperties}}
+	if _, err := NewConfig().storePostedProperties(params, true); err == nil {
+		t.Error("expected an error without artifact dir")
+	}
+}
+
+func assertArtifacts(t *testing.T, dir string, expected int) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != expected {
+		t.Errorf("expected %d files in the artifact dir, found %d", expected, len(infos))
+	}
+}
@@ -17,8 +17,15 @@ package statsd
 
 import (
 	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"os"
+	"time"
+
 	mesos "github.com/mesos/mesos-go/mesosproto"
+	"golang.org/x/net/context"
 )
 
 func uuid() string {
@@ -27,6 +34,21 @@ func uuid() string {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
 }
 
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 func suffix(str string, maxLen int) string {
 	if len(str) < maxLen {
 		return str
@@ -106,3 +128,16 @@ func statusString(status *mesos.TaskStatus) string {
 
 	return s
 }
+
+// sleepContext sleeps for the duration unless the context is done first, returning its error then.
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,78 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package statsd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	goavro "github.com/elodina/go-avro"
+	"github.com/elodina/statsd-mesos-kafka/statsd/avro"
+	pb "github.com/elodina/statsd-mesos-kafka/statsd/proto"
+	"github.com/gogo/protobuf/proto"
+)
+
+// validateFunctions check that an encoded record can be read back with the schema of the active transform.
+var validateFunctions map[string]func([]byte) error = map[string]func([]byte) error{
+	TransformNone:  validateNone,
+	TransformAvro:  validateAvro,
+	TransformProto: validateProto,
+}
+
+func validateNone(encoded []byte) error {
+	if !utf8.Valid(encoded) {
+		return errors.New("record is not valid UTF-8")
+	}
+	return nil
+}
+
+func validateAvro(encoded []byte) error {
+	if len(encoded) < 5 || encoded[0] != 0 {
+		return errors.New("record does not start with the avro magic byte and schema id")
+	}
+
+	logLine := avro.NewLogLine()
+	reader := goavro.NewSpecificDatumReader()
+	reader.SetSchema(logLine.Schema())
+	if err := reader.Read(logLine, goavro.NewBinaryDecoder(encoded[5:])); err != nil {
+		return fmt.Errorf("record does not match avro schema: %s", err)
+	}
+	return nil
+}
+
+func validateProto(encoded []byte) error {
+	if err := proto.Unmarshal(encoded, new(pb.LogLine)); err != nil {
+		return fmt.Errorf("record does not match proto schema: %s", err)
+	}
+	return nil
+}
+
+// deadLetter is the JSON document produced to the dead-letter topic for records that failed encoding or validation.
+type deadLetter struct {
+	Host   string
+	Line   string
+	Reason string
+}
+
+func newDeadLetter(host string, line string, reason error) []byte {
+	bytes, err := json.Marshal(&deadLetter{Host: host, Line: line, Reason: reason.Error()})
+	if err != nil {
+		panic(err) //shouldn't happen
+	}
+	return bytes
+}